@@ -0,0 +1,10 @@
+// Package openapiv2 содержит описание HTTP API в формате OpenAPI v2,
+// сгенерированное protoc-gen-openapiv2 из api/event/v1/EventService.proto.
+package openapiv2
+
+import _ "embed"
+
+// Spec - документ OpenAPI, встраиваемый в бинарный файл календаря.
+//
+//go:embed EventService.swagger.json
+var Spec []byte
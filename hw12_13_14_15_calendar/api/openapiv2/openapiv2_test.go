@@ -0,0 +1,75 @@
+package openapiv2_test
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/milov52/hw12_13_14_15_calendar/api/openapiv2"
+	desc "github.com/milov52/hw12_13_14_15_calendar/pkg/api/event/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+)
+
+// pathParam - параметр пути в правиле google.api.http, в OpenAPI он записывается
+// в lowerCamelCase.
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// TestSpecInSync проверяет, что встроенный документ сгенерирован из текущего proto:
+// каждый HTTP-метод сервиса описан в нем с тем же путем.
+func TestSpecInSync(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+			Summary     string `json:"summary"`
+		} `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(openapiv2.Spec, &spec))
+
+	methods := desc.File_EventService_proto.Services().ByName("Calendar").Methods()
+	require.Positive(t, methods.Len())
+
+	for i := 0; i < methods.Len(); i++ {
+		method := methods.Get(i)
+		rule, ok := proto.GetExtension(method.Options(), annotations.E_Http).(*annotations.HttpRule)
+		require.True(t, ok, method.Name())
+
+		verb, path := httpRule(rule)
+		path = pathParam.ReplaceAllStringFunc(path, func(p string) string {
+			return "{" + lowerCamel(strings.Trim(p, "{}")) + "}"
+		})
+
+		op, ok := spec.Paths[path][verb]
+		require.True(t, ok, "%s: %s %s is missing in the spec", method.Name(), verb, path)
+		require.Equal(t, "Calendar_"+string(method.Name()), op.OperationID)
+		require.NotEmpty(t, op.Summary, method.Name())
+	}
+}
+
+func httpRule(rule *annotations.HttpRule) (string, string) {
+	switch {
+	case rule.GetGet() != "":
+		return "get", rule.GetGet()
+	case rule.GetPost() != "":
+		return "post", rule.GetPost()
+	case rule.GetPut() != "":
+		return "put", rule.GetPut()
+	case rule.GetDelete() != "":
+		return "delete", rule.GetDelete()
+	case rule.GetPatch() != "":
+		return "patch", rule.GetPatch()
+	}
+	return "", ""
+}
+
+func lowerCamel(name string) string {
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
@@ -3,6 +3,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"log/slog"
@@ -13,6 +14,8 @@ import (
 	"time"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/milov52/hw12_13_14_15_calendar/api/openapiv2"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/api/apierror"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/api/event"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/config"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/logger"
@@ -21,32 +24,48 @@ import (
 	internalgrpc "github.com/milov52/hw12_13_14_15_calendar/internal/server/grpc"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/server/http"
 	sevent "github.com/milov52/hw12_13_14_15_calendar/internal/service/calendar"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/tlsconfig"
 	desc "github.com/milov52/hw12_13_14_15_calendar/pkg/api/event/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
-const (
-	inMemory = "in-memory"
-	sql      = "sql"
+var (
+	configFile  string
+	printConfig bool
+	helpEnv     bool
 )
 
-var configFile string
-
 func main() {
 	flag.StringVar(&configFile, "config", "configs/calendar_config.yaml", "Path to configuration file")
+	flag.BoolVar(&printConfig, "print-config", false, "Print the effective configuration with secrets redacted and exit")
+	flag.BoolVar(&helpEnv, "help-env", false, "Print environment variables overriding the configuration and exit")
 	flag.Parse()
 
-	cfg := config.MustLoad(configFile)
+	if helpEnv {
+		_ = config.PrintEnv(os.Stdout)
+		return
+	}
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if printConfig {
+		_ = config.Print(os.Stdout, cfg)
+		return
+	}
 	logg := logger.SetupLogger(cfg.Env)
+	_ = logger.SetLevel(cfg.Env, cfg.LogLevel)
 
 	var storage sevent.Storage
 
 	switch cfg.DefaultStorage {
-	case inMemory:
-		storage = memorystorage.New()
-	case sql:
-		sqlStorage := sqlstorage.New(nil)
+	case config.StorageInMemory:
+		storage = memorystorage.New(memorystorage.WithEventQuota(cfg.RateLimit.MaxEventsPerUser))
+	case config.StorageSQL:
+		sqlStorage := sqlstorage.New(nil, sqlstorage.WithEventQuota(cfg.RateLimit.MaxEventsPerUser))
 		// Подключаемся к базе данных
 		ctx := context.Background()
 		if err := sqlStorage.Connect(ctx, *cfg); err != nil {
@@ -57,38 +76,68 @@ func main() {
 		defer sqlStorage.Close(ctx) // Закрываем соединение при завершении программы
 	}
 
-	calendarService := sevent.NewEventService(*logg, storage)
+	calendarService := sevent.NewEventService(*logg, storage,
+		sevent.WithIdempotencyTTL(cfg.Idempotency.TTL),
+		sevent.WithAdmins(cfg.Admin.Users),
+	)
 	controller := event.NewEventController(calendarService)
 
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", cfg.GRPCServer.Port)) // :82
+	grpcTLS, err := tlsconfig.Server(cfg.GRPCServer.TLS)
 	if err != nil {
-		slog.Error("failed to listen: %v", err)
+		logg.Error("failed to configure grpc tls: " + err.Error())
+		os.Exit(1)
 	}
-
-	grpcServer := internalgrpc.NewServer(*logg, *controller)
-	err = grpcServer.Start(lis)
+	gatewayTLS, err := tlsconfig.Client(cfg.GRPCServer.ClientTLS)
 	if err != nil {
-		slog.Error("grpc server error", err)
+		logg.Error("failed to configure gateway tls: " + err.Error())
+		os.Exit(1)
 	}
-
-	conn, err := grpc.NewClient(
-		lis.Addr().String(),
-		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	httpTLS, err := tlsconfig.Server(cfg.HTTPServer.TLS)
 	if err != nil {
-		slog.Error("failed to dial server", err)
+		logg.Error("failed to configure http tls: " + err.Error())
+		os.Exit(1)
 	}
 
-	mux := runtime.NewServeMux()
-	err = desc.RegisterCalendarHandler(context.Background(), mux, conn)
+	warnUnverifiedIdentity(logg, cfg)
+
+	grpcServer := internalgrpc.NewServer(*logg, *controller, cfg.RateLimit, grpcTLS)
+	server := internalhttp.NewServer(*logg, *cfg, httpTLS)
+	mux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(internalhttp.HeaderMatcher),
+		runtime.WithErrorHandler(apierror.NewHTTPErrorHandler(*logg)),
+	)
+
+	switch cfg.HTTPServer.Gateway {
+	case config.GatewaySinglePort:
+		// gRPC обслуживается HTTP-сервером, шифрование задается в http_server.tls
+		server.ServeGRPC(grpcServer)
+		err = desc.RegisterCalendarHandlerServer(context.Background(), mux, controller)
+	case config.GatewayInProcess:
+		startGRPCServer(grpcServer, cfg.GRPCServer.Port)
+		err = desc.RegisterCalendarHandlerServer(context.Background(), mux, controller)
+	default:
+		lis := startGRPCServer(grpcServer, cfg.GRPCServer.Port)
+		err = registerLoopbackGateway(mux, lis.Addr().String(), gatewayTLS, grpcServer.GatewayDialOption())
+	}
 	if err != nil {
-		slog.Error("failed to register calendar handler", err)
+		slog.Error("failed to register calendar handler", "err", err)
+	}
+	if cfg.HTTPServer.Docs {
+		if err := internalhttp.RegisterDocs(mux, openapiv2.Spec); err != nil {
+			slog.Error("failed to register api docs", "err", err)
+		}
 	}
 
-	server := internalhttp.NewServer(*logg, *cfg)
-	ctx, cancel := signal.NotifyContext(context.Background(),
-		syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
+	// SIGHUP перечитывает конфигурацию; на ходу меняется только уровень логирования
+	config.WatchReload(ctx, configFile, *logg, func(newCfg *config.Config) {
+		if err := logger.SetLevel(newCfg.Env, newCfg.LogLevel); err != nil {
+			logg.Error("failed to set log level", "err", err)
+		}
+	})
+
 	go func() {
 		<-ctx.Done()
 
@@ -108,3 +157,46 @@ func main() {
 		os.Exit(1) //nolint:gocritic
 	}
 }
+
+func startGRPCServer(grpcServer *internalgrpc.Server, port string) net.Listener {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port)) // :82
+	if err != nil {
+		slog.Error("failed to listen", "err", err)
+	}
+
+	err = grpcServer.Start(lis)
+	if err != nil {
+		slog.Error("grpc server error", "err", err)
+	}
+	return lis
+}
+
+// registerLoopbackGateway подключает gateway к собственному gRPC-серверу как клиента.
+func registerLoopbackGateway(
+	mux *runtime.ServeMux, addr string, tlsConfig *tls.Config, opts ...grpc.DialOption,
+) error {
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.NewClient(addr, append(opts, grpc.WithTransportCredentials(creds))...)
+	if err != nil {
+		return fmt.Errorf("failed to dial server: %w", err)
+	}
+	return desc.RegisterCalendarHandler(context.Background(), mux, conn)
+}
+
+// warnUnverifiedIdentity предупреждает, что без проверки клиентских сертификатов пользователь
+// и ограничение частоты по нему держатся на X-User-Id: сервис должен стоять за доверенным прокси.
+func warnUnverifiedIdentity(logg *slog.Logger, cfg *config.Config) {
+	servers := map[string]config.TLS{"http_server": cfg.HTTPServer.TLS}
+	if cfg.HTTPServer.Gateway != config.GatewaySinglePort {
+		servers["grpc_server"] = cfg.GRPCServer.TLS
+	}
+	for name, tlsCfg := range servers {
+		if !tlsCfg.VerifiesClients() {
+			logg.Warn("client certificates are not verified, caller is taken from x-user-id;"+
+				" run behind a trusted proxy", "server", name, "per_user_rate_limit", cfg.RateLimit.PerUser.RPS > 0)
+		}
+	}
+}
@@ -1,29 +1,98 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/milov52/hw12_13_14_15_calendar/internal/config"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/logger"
-	"github.com/milov52/hw12_13_14_15_calendar/internal/queue/rabbitmq"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/queue"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/service/sender"
 )
 
-var configFile string
+var (
+	configFile  string
+	printConfig bool
+	helpEnv     bool
+)
 
 func main() {
 	flag.StringVar(&configFile, "config", "configs/calendar_config.yaml", "Path to configuration file")
+	flag.BoolVar(&printConfig, "print-config", false, "Print the effective configuration with secrets redacted and exit")
+	flag.BoolVar(&helpEnv, "help-env", false, "Print environment variables overriding the configuration and exit")
 	flag.Parse()
 
-	cfg := config.MustLoad(configFile)
+	if helpEnv {
+		_ = config.PrintEnv(os.Stdout)
+		return
+	}
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if printConfig {
+		_ = config.Print(os.Stdout, cfg)
+		return
+	}
 	logg := logger.SetupLogger(cfg.Env)
+	_ = logger.SetLevel(cfg.Env, cfg.LogLevel)
+
+	// SIGHUP перечитывает конфигурацию; на ходу меняется только уровень логирования
+	config.WatchReload(context.Background(), configFile, *logg, func(newCfg *config.Config) {
+		if err := logger.SetLevel(newCfg.Env, newCfg.LogLevel); err != nil {
+			logg.Error("failed to set log level", "err", err)
+		}
+	})
+
+	if cfg.Queue.Type == config.QueueMemory {
+		logg.Error("queue type memory runs the sender inside calendar_scheduler, use rabbitmq or nats")
+		os.Exit(1)
+	}
+
+	// Шаблоны проверяются до подключения к очереди, чтобы ошибка в них не теряла сообщения
+	renderer, err := sender.NewRenderer(cfg.Sender.Templates.Dir, cfg.Sender.Templates.DefaultLocale)
+	if err != nil {
+		logg.Error("failed to load templates: " + err.Error())
+		os.Exit(1)
+	}
 
 	eventQueue, err := queue.NewQueue(cfg)
 	if err != nil {
 		logg.Error("failed to create queue: " + err.Error())
 		os.Exit(1)
 	}
-	eventSender := sender.NewSender(*logg, eventQueue)
-	eventSender.ReadMessages()
+	defer eventQueue.Close()
+	statusQueue, err := queue.NewQueue(cfg, queue.WithName(queue.StatusQueue))
+	if err != nil {
+		logg.Error("failed to create status queue: " + err.Error())
+		os.Exit(1)
+	}
+	defer statusQueue.Close()
+
+	if cfg.Sender.HealthPort != "" {
+		healthServer := queue.HealthServer(cfg.Sender.HealthPort, eventQueue, statusQueue)
+		go func() {
+			if err := healthServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logg.Error("health check server stopped: " + err.Error())
+			}
+		}()
+		defer healthServer.Close()
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	eventSender := sender.NewSender(*logg, eventQueue,
+		sender.WithStatusQueue(statusQueue),
+		sender.WithRetry(cfg.Sender.MaxAttempts, cfg.Sender.RetryBackoff),
+		sender.WithRenderer(renderer),
+	)
+	eventSender.ReadMessages(ctx)
 }
@@ -1,27 +1,37 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/milov52/hw12_13_14_15_calendar/internal/config"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/cron"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/logger"
-	"github.com/milov52/hw12_13_14_15_calendar/internal/queue/rabbitmq"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/queue"
 	memorystorage "github.com/milov52/hw12_13_14_15_calendar/internal/repository/event/memory"
 	sqlstorage "github.com/milov52/hw12_13_14_15_calendar/internal/repository/event/sql"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/service/calendar"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/service/scheduler"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/service/sender"
 	"golang.org/x/net/context"
 )
 
-const (
-	inMemory = "in-memory"
-	sql      = "sql"
+var (
+	configFile  string
+	printConfig bool
+	helpEnv     bool
 )
 
-var configFile string
-
 func main() {
 	flag.StringVar(&configFile, "config", "configs/calendar_config.yaml", "Path to configuration file")
+	flag.BoolVar(&printConfig, "print-config", false, "Print the effective configuration with secrets redacted and exit")
+	flag.BoolVar(&helpEnv, "help-env", false, "Print environment variables overriding the configuration and exit")
 	flag.Parse()
 
 	code := run()
@@ -29,15 +39,32 @@ func main() {
 }
 
 func run() int {
-	cfg := config.MustLoad(configFile)
+	if helpEnv {
+		_ = config.PrintEnv(os.Stdout)
+		return 0
+	}
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if printConfig {
+		_ = config.Print(os.Stdout, cfg)
+		return 0
+	}
 	logg := logger.SetupLogger(cfg.Env)
+	_ = logger.SetLevel(cfg.Env, cfg.LogLevel)
 
-	var storage scheduler.Storage
+	// Сводкам нужны события с правами доступа сервиса календаря, поэтому хранилище - общее
+	var storage interface {
+		scheduler.Storage
+		calendar.Storage
+	}
 
 	switch cfg.DefaultStorage {
-	case inMemory:
+	case config.StorageInMemory:
 		storage = memorystorage.New()
-	case sql:
+	case config.StorageSQL:
 		sqlStorage := sqlstorage.New(nil)
 		ctx := context.Background()
 
@@ -55,9 +82,134 @@ func run() int {
 		logg.Error("failed to create queue: " + err.Error())
 		return 1 // Возвращаем код ошибки, чтобы завершить программу
 	}
+	defer eventQueue.Close()
 
-	eventScheduler := scheduler.NewScheduler(*logg, storage, eventQueue)
-	eventScheduler.Start(context.Background(), cfg.Scheduler.LaunchFrequency)
+	statusQueue, err := queue.NewQueue(cfg, queue.WithName(queue.StatusQueue))
+	if err != nil {
+		logg.Error("failed to create status queue: " + err.Error())
+		return 1
+	}
+	defer statusQueue.Close()
+
+	if cfg.Scheduler.HealthPort != "" {
+		healthServer := queue.HealthServer(cfg.Scheduler.HealthPort, eventQueue, statusQueue)
+		go func() {
+			if err := healthServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logg.Error("health check server stopped: " + err.Error())
+			}
+		}()
+		defer healthServer.Close()
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	catchUpPolicy, err := model.ParseCatchUpPolicy(cfg.Scheduler.CatchUp.Policy)
+	if err != nil {
+		logg.Error("failed to configure catch-up: " + err.Error())
+		return 1
+	}
+	retention, err := cfg.Scheduler.Retention.Policy()
+	if err != nil {
+		logg.Error("failed to configure retention: " + err.Error())
+		return 1
+	}
+	eventScheduler := scheduler.NewScheduler(*logg, storage, eventQueue,
+		scheduler.WithCatchUp(model.CatchUp{Policy: catchUpPolicy, Grace: cfg.Scheduler.CatchUp.Grace}),
+		scheduler.WithRetention(retention),
+		scheduler.WithDigestInterval(cfg.Scheduler.DigestInterval),
+		scheduler.WithStatusQueue(statusQueue),
+		scheduler.WithEvents(calendar.NewEventService(*logg, storage)),
+	)
+	if err := registerJobs(eventScheduler, cfg.Scheduler); err != nil {
+		logg.Error("failed to register jobs: " + err.Error())
+		return 1
+	}
+	// SIGHUP перечитывает конфигурацию: уровень логирования, расписания задач и сроки хранения
+	config.WatchReload(ctx, configFile, *logg, func(newCfg *config.Config) {
+		if err := logger.SetLevel(newCfg.Env, newCfg.LogLevel); err != nil {
+			logg.Error("failed to set log level", "err", err)
+		}
+		if err := rescheduleJobs(eventScheduler, newCfg.Scheduler); err != nil {
+			logg.Error("failed to reschedule jobs", "err", err)
+		}
+		retention, err := newCfg.Scheduler.Retention.Policy()
+		if err != nil {
+			logg.Error("failed to reload retention policy", "err", err)
+			return
+		}
+		eventScheduler.SetRetention(retention)
+	})
+	// Очереди в памяти не видны другим процессам, поэтому отправитель работает здесь же
+	if cfg.Queue.Type == config.QueueMemory {
+		renderer, err := sender.NewRenderer(cfg.Sender.Templates.Dir, cfg.Sender.Templates.DefaultLocale)
+		if err != nil {
+			logg.Error("failed to load templates: " + err.Error())
+			return 1
+		}
+		eventSender := sender.NewSender(*logg, eventQueue,
+			sender.WithStatusQueue(statusQueue),
+			sender.WithRetry(cfg.Sender.MaxAttempts, cfg.Sender.RetryBackoff),
+			sender.WithRenderer(renderer),
+		)
+		go eventSender.ReadMessages(ctx)
+	}
+	go eventScheduler.ConsumeStatusReports(ctx)
+	eventScheduler.Start(ctx)
 
 	return 0
 }
+
+// jobSchedules возвращает расписания встроенных задач из конфигурации.
+func jobSchedules(cfg config.Scheduler) map[string]string {
+	return map[string]string{
+		scheduler.JobReminders: cfg.RemindersSchedule(),
+		scheduler.JobCleanup:   cfg.CleanupSchedule(),
+		scheduler.JobAgenda:    cfg.AgendaSchedule(),
+	}
+}
+
+func registerJobs(s *scheduler.Scheduler, cfg config.Scheduler) error {
+	jobs := []struct {
+		name string
+		cfg  config.Job
+		run  func(ctx context.Context) error
+	}{
+		{scheduler.JobReminders, cfg.Reminders, s.ProcessReminders},
+		{scheduler.JobCleanup, cfg.Cleanup, s.PurgeEvents},
+		{scheduler.JobAgenda, cfg.Agenda, s.SendAgendas},
+	}
+
+	schedules := jobSchedules(cfg)
+	for _, job := range jobs {
+		schedule, err := cron.Parse(schedules[job.name])
+		if err != nil {
+			return err
+		}
+		err = s.Register(scheduler.Job{
+			Name:     job.name,
+			Schedule: schedule,
+			Jitter:   job.cfg.Jitter,
+			Timeout:  job.cfg.Timeout,
+			Run:      job.run,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rescheduleJobs применяет новые расписания; jitter и timeout меняются только перезапуском.
+func rescheduleJobs(s *scheduler.Scheduler, cfg config.Scheduler) error {
+	for name, expr := range jobSchedules(cfg) {
+		schedule, err := cron.Parse(expr)
+		if err != nil {
+			return err
+		}
+		if err := s.Reschedule(name, schedule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
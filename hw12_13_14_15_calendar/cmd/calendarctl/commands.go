@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	desc "github.com/milov52/hw12_13_14_15_calendar/pkg/api/event/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const dateLayout = "2006-01-02"
+
+// startLayouts - допустимые форматы времени начала события, без зоны - местное время.
+var startLayouts = []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02T15:04"}
+
+var periods = []string{"day", "week", "month"}
+
+var errUsage = errors.New("invalid arguments")
+
+// runner выполняет команду с уже разобранными флагами.
+type runner func(ctx context.Context, app *app, args []string) error
+
+type command struct {
+	name  string
+	usage string
+	// setup регистрирует флаги команды и возвращает её обработчик
+	setup func(fs *flag.FlagSet) runner
+}
+
+type app struct {
+	client desc.CalendarClient
+	output string
+}
+
+var commands = []command{
+	{
+		name:  "create",
+		usage: "create -title T -start TIME -duration D [-description S] [-calendar ID]",
+		setup: setupCreate,
+	},
+	{
+		name:  "update",
+		usage: "update -title T -start TIME -duration D [-description S] [-calendar ID | -no-calendar] EVENT_ID",
+		setup: setupUpdate,
+	},
+	{name: "delete", usage: "delete EVENT_ID...", setup: setupDelete},
+	{name: "list", usage: "list [-date YYYY-MM-DD] [-calendar ID] day|week|month", setup: setupList},
+	{name: "export", usage: "export [-date YYYY-MM-DD] [-calendar ID] [-file PATH] day|week|month", setup: setupExport},
+	{name: "import", usage: "import [-all-or-nothing] -file PATH", setup: setupImport},
+}
+
+// eventFlags - флаги, описывающие событие в create и update.
+type eventFlags struct {
+	title       string
+	start       string
+	duration    time.Duration
+	description string
+	calendarID  string
+}
+
+func (f *eventFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.title, "title", "", "event title")
+	fs.StringVar(&f.start, "start", "", "start time: RFC3339 or \"YYYY-MM-DD HH:MM\" in local time")
+	fs.DurationVar(&f.duration, "duration", time.Hour, "event duration")
+	fs.StringVar(&f.description, "description", "", "event description")
+	fs.StringVar(&f.calendarID, "calendar", "", "calendar id")
+}
+
+func (f *eventFlags) info() (*desc.EventInfo, error) {
+	start, err := parseStart(f.start)
+	if err != nil {
+		return nil, err
+	}
+	view := eventView{
+		Title:       f.title,
+		Start:       start,
+		Duration:    f.duration.String(),
+		Description: f.description,
+		CalendarID:  f.calendarID,
+	}
+	return view.toInfo()
+}
+
+func parseStart(value string) (time.Time, error) {
+	for _, layout := range startLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid start time %q", value)
+}
+
+func setupCreate(fs *flag.FlagSet) runner {
+	var event eventFlags
+	event.register(fs)
+
+	return func(ctx context.Context, app *app, _ []string) error {
+		info, err := event.info()
+		if err != nil {
+			return err
+		}
+		resp, err := app.client.CreateEvent(ctx, &desc.CreateRequest{Event: info})
+		if err != nil {
+			return err
+		}
+		fmt.Println(resp.GetUUID())
+		return nil
+	}
+}
+
+func setupUpdate(fs *flag.FlagSet) runner {
+	var event eventFlags
+	event.register(fs)
+	noCalendar := fs.Bool("no-calendar", false, "remove the event from its calendar")
+
+	return func(ctx context.Context, app *app, args []string) error {
+		if len(args) != 1 {
+			return errUsage
+		}
+		// Событие заменяется целиком, поэтому флаги указываются все, как при создании
+		info, err := event.info()
+		if err != nil {
+			return err
+		}
+		if *noCalendar && info.GetCalendarId() != "" {
+			return errUsage
+		}
+		_, err = app.client.UpdateEvent(ctx, &desc.UpdateRequest{
+			UUID: args[0], Event: info, ClearCalendar: *noCalendar,
+		})
+		return err
+	}
+}
+
+func setupDelete(_ *flag.FlagSet) runner {
+	return func(ctx context.Context, app *app, args []string) error {
+		if len(args) == 0 {
+			return errUsage
+		}
+		for _, id := range args {
+			if _, err := app.client.DeleteEvent(ctx, &desc.DeleteRequest{UUID: id}); err != nil {
+				st := status.Convert(err)
+				return status.Errorf(st.Code(), "%s: %s", id, st.Message())
+			}
+		}
+		return nil
+	}
+}
+
+// periodFlags - выборка событий за период в list и export.
+type periodFlags struct {
+	date       string
+	calendarID string
+}
+
+func (f *periodFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.date, "date", time.Now().Format(dateLayout), "first day of the period, YYYY-MM-DD")
+	fs.StringVar(&f.calendarID, "calendar", "", "only events of the calendar")
+}
+
+func (f *periodFlags) events(ctx context.Context, client desc.CalendarClient, args []string) ([]eventView, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	date, err := time.ParseInLocation(dateLayout, f.date, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q", f.date)
+	}
+
+	var list func(context.Context, *desc.GetRequest, ...grpc.CallOption) (*desc.GetResponse, error)
+	switch args[0] {
+	case "day":
+		list = client.GetDayEventList
+	case "week":
+		list = client.GetWeekEventList
+	case "month":
+		list = client.GetMonthEventList
+	default:
+		return nil, fmt.Errorf("unknown period %q, expected day, week or month", args[0])
+	}
+
+	resp, err := list(ctx, &desc.GetRequest{Date: timestamppb.New(date), CalendarId: f.calendarID})
+	if err != nil {
+		return nil, err
+	}
+	events := make([]eventView, 0, len(resp.GetEvents()))
+	for _, event := range resp.GetEvents() {
+		events = append(events, viewFromEvent(event))
+	}
+	return events, nil
+}
+
+func setupList(fs *flag.FlagSet) runner {
+	var period periodFlags
+	period.register(fs)
+
+	return func(ctx context.Context, app *app, args []string) error {
+		events, err := period.events(ctx, app.client, args)
+		if err != nil {
+			return err
+		}
+		return writeEvents(os.Stdout, app.output, events)
+	}
+}
+
+func setupExport(fs *flag.FlagSet) runner {
+	var period periodFlags
+	period.register(fs)
+	file := fs.String("file", "", "output file, stdout by default")
+
+	return func(ctx context.Context, app *app, args []string) error {
+		events, err := period.events(ctx, app.client, args)
+		if err != nil {
+			return err
+		}
+		// Экспорт должен читаться import, таблица для этого не подходит
+		format := app.output
+		if format == outputTable {
+			format = outputYAML
+		}
+
+		if *file == "" {
+			return writeEvents(os.Stdout, format, events)
+		}
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		if err := writeEvents(f, format, events); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+}
+
+func setupImport(fs *flag.FlagSet) runner {
+	file := fs.String("file", "", "YAML or JSON file produced by export, - for stdin")
+	allOrNothing := fs.Bool("all-or-nothing", false, "roll back the whole import on the first error")
+
+	return func(ctx context.Context, app *app, _ []string) error {
+		if *file == "" {
+			return errUsage
+		}
+		in := os.Stdin
+		if *file != "-" {
+			f, err := os.Open(*file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+
+		views, err := readEvents(in)
+		if err != nil {
+			return err
+		}
+		req := &desc.BatchCreateRequest{AllOrNothing: *allOrNothing}
+		for _, view := range views {
+			// Идентификаторы выдает сервер, экспортированные не переносятся
+			info, err := view.toInfo()
+			if err != nil {
+				return err
+			}
+			req.Events = append(req.Events, info)
+		}
+
+		resp, err := app.client.BatchCreateEvents(ctx, req)
+		if err != nil {
+			return err
+		}
+		return writeBatchResults(resp.GetResults(), views)
+	}
+}
+
+func writeBatchResults(results []*desc.BatchResult, views []eventView) error {
+	var failed int
+	for _, result := range results {
+		title := ""
+		if i := int(result.GetIndex()); i < len(views) {
+			title = views[i].Title
+		}
+		if result.GetError() != "" {
+			failed++
+			fmt.Fprintf(os.Stderr, "%d %q: %s\n", result.GetIndex(), title, result.GetError())
+			continue
+		}
+		fmt.Printf("%d %q: %s\n", result.GetIndex(), title, result.GetUUID())
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d events were not imported", failed, len(views))
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// bashCompletion - шаблон скрипта дополнения: %[1]s - команды, %[2]s - ветки case
+// с флагами команд, %[3]s - периоды list и export, %[4]s - глобальные флаги.
+const bashCompletion = `# calendarctl completion
+_calendarctl() {
+  local cur=${COMP_WORDS[COMP_CWORD]}
+  local cmd="" i
+  for ((i = 1; i < COMP_CWORD; i++)); do
+    case "${COMP_WORDS[i]}" in
+      -*) ;;
+      *) cmd=${COMP_WORDS[i]}; break ;;
+    esac
+  done
+
+  if [ -z "$cmd" ]; then
+    if [[ "$cur" == -* ]]; then
+      COMPREPLY=($(compgen -W "%[4]s" -- "$cur"))
+    else
+      COMPREPLY=($(compgen -W "%[1]s" -- "$cur"))
+    fi
+    return
+  fi
+
+  if [[ "$cur" == -* ]]; then
+    case "$cmd" in
+%[2]s    esac
+    return
+  fi
+
+  case "$cmd" in
+    list|export) COMPREPLY=($(compgen -W "%[3]s" -- "$cur")) ;;
+    completion) COMPREPLY=($(compgen -W "bash zsh" -- "$cur")) ;;
+    *) COMPREPLY=($(compgen -f -- "$cur")) ;;
+  esac
+}
+complete -F _calendarctl calendarctl
+`
+
+// writeCompletion печатает скрипт дополнения для bash или zsh.
+// Для zsh используется тот же скрипт через bashcompinit.
+func writeCompletion(w io.Writer, shell string, global *flag.FlagSet) error {
+	names := make([]string, 0, len(commands)+1)
+	var cases strings.Builder
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+		fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		cmd.setup(fs)
+		if flags := flagNames(fs); flags != "" {
+			fmt.Fprintf(&cases, "      %s) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", cmd.name, flags)
+		}
+	}
+	names = append(names, "completion")
+
+	script := fmt.Sprintf(bashCompletion,
+		strings.Join(names, " "), cases.String(), strings.Join(periods, " "), flagNames(global))
+
+	switch shell {
+	case "bash":
+		_, err := io.WriteString(w, script)
+		return err
+	case "zsh":
+		_, err := io.WriteString(w, "autoload -U +X bashcompinit && bashcompinit\n"+script)
+		return err
+	}
+	return fmt.Errorf("unsupported shell %q, expected bash or zsh", shell)
+}
+
+func flagNames(fs *flag.FlagSet) string {
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) {
+		names = append(names, "-"+f.Name)
+	})
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/config"
+)
+
+// Config - настройки клиента. Переменные окружения имеют приоритет над файлом,
+// флаги командной строки - над переменными окружения.
+type Config struct {
+	Server  string        `yaml:"server" env:"CALENDARCTL_SERVER" env-default:"localhost:50051"`
+	UserID  string        `yaml:"user_id" env:"CALENDARCTL_USER"`
+	Output  string        `yaml:"output" env:"CALENDARCTL_OUTPUT" env-default:"table"`
+	Timeout time.Duration `yaml:"timeout" env:"CALENDARCTL_TIMEOUT" env-default:"10s"`
+	TLS     config.TLS    `yaml:"tls"`
+}
+
+// defaultConfigPath - ~/.config/calendarctl/config.yaml или значение CALENDARCTL_CONFIG.
+func defaultConfigPath() string {
+	if path := os.Getenv("CALENDARCTL_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "calendarctl", "config.yaml")
+}
+
+// loadConfig читает файл, если он есть, иначе только переменные окружения.
+func loadConfig(path string) (Config, error) {
+	var cfg Config
+	if path != "" {
+		_, err := os.Stat(path)
+		switch {
+		case err == nil:
+			return cfg, cleanenv.ReadConfig(path, &cfg)
+		case !errors.Is(err, os.ErrNotExist):
+			return cfg, err
+		}
+	}
+	return cfg, cleanenv.ReadEnv(&cfg)
+}
@@ -0,0 +1,140 @@
+// Command calendarctl - консольный клиент gRPC API календаря.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/auth"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/tlsconfig"
+	desc "github.com/milov52/hw12_13_14_15_calendar/pkg/api/event/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		if st, ok := status.FromError(err); ok {
+			fmt.Fprintf(os.Stderr, "error: %s: %s\n", st.Code(), st.Message())
+		} else {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	global := flag.NewFlagSet("calendarctl", flag.ContinueOnError)
+	configFile := global.String("config", defaultConfigPath(), "path to configuration file")
+	server := global.String("server", "", "calendar gRPC address, host:port")
+	userID := global.String("user", "", "user id sent in x-user-id")
+	output := global.String("o", "", "output format: table, json or yaml")
+	global.Usage = func() { usage(global) }
+	if err := global.Parse(args); err != nil {
+		return err
+	}
+
+	args = global.Args()
+	if len(args) == 0 {
+		global.Usage()
+		return flag.ErrHelp
+	}
+	if args[0] == "completion" {
+		if len(args) != 2 {
+			return errUsage
+		}
+		return writeCompletion(os.Stdout, args[1], global)
+	}
+
+	cmd, ok := findCommand(args[0])
+	if !ok {
+		global.Usage()
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: calendarctl", cmd.usage)
+		fs.PrintDefaults()
+	}
+	runCommand := cmd.setup(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if *server != "" {
+		cfg.Server = *server
+	}
+	if *userID != "" {
+		cfg.UserID = *userID
+	}
+	if *output != "" {
+		cfg.Output = *output
+	}
+	if err := validOutput(cfg.Output); err != nil {
+		return err
+	}
+
+	conn, err := dial(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+	if cfg.UserID != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, auth.MetadataKey, cfg.UserID)
+	}
+
+	err = runCommand(ctx, &app{client: desc.NewCalendarClient(conn), output: cfg.Output}, fs.Args())
+	if errors.Is(err, errUsage) {
+		fs.Usage()
+	}
+	return err
+}
+
+func dial(cfg Config) (*grpc.ClientConn, error) {
+	tlsConfig, err := tlsconfig.Client(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	return grpc.NewClient(cfg.Server, grpc.WithTransportCredentials(creds))
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func usage(global *flag.FlagSet) {
+	out := global.Output()
+	fmt.Fprintln(out, "usage: calendarctl [flags] COMMAND [command flags] [args]")
+	fmt.Fprintln(out, "\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintln(out, "  "+cmd.usage)
+	}
+	fmt.Fprintln(out, "  completion bash|zsh")
+	fmt.Fprintln(out, "\nflags:")
+	global.PrintDefaults()
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	desc "github.com/milov52/hw12_13_14_15_calendar/pkg/api/event/v1"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+const (
+	reminderChannelPrefix = "REMINDER_CHANNEL_"
+	attendeeStatusPrefix  = "ATTENDEE_STATUS_"
+)
+
+// eventView - представление события для вывода, экспорта и импорта.
+// Длительности хранятся строкой в формате time.ParseDuration, например 1h30m.
+type eventView struct {
+	ID           string         `json:"id,omitempty" yaml:"id,omitempty"`
+	Title        string         `json:"title" yaml:"title"`
+	Start        time.Time      `json:"start" yaml:"start"`
+	Duration     string         `json:"duration" yaml:"duration"`
+	Description  string         `json:"description,omitempty" yaml:"description,omitempty"`
+	UserID       string         `json:"user_id,omitempty" yaml:"user_id,omitempty"`
+	CalendarID   string         `json:"calendar_id,omitempty" yaml:"calendar_id,omitempty"`
+	NotifyBefore string         `json:"notify_before,omitempty" yaml:"notify_before,omitempty"`
+	Reminders    []reminderView `json:"reminders,omitempty" yaml:"reminders,omitempty"`
+	Attendees    []attendeeView `json:"attendees,omitempty" yaml:"attendees,omitempty"`
+}
+
+// reminderView - напоминание; канал - email, sms или push.
+type reminderView struct {
+	Offset  string `json:"offset" yaml:"offset"`
+	Channel string `json:"channel" yaml:"channel"`
+}
+
+// attendeeView - участник. Статус выводится для справки: при импорте участники
+// приглашаются заново и отвечают сами.
+type attendeeView struct {
+	UserID string `json:"user_id" yaml:"user_id"`
+	Status string `json:"status,omitempty" yaml:"status,omitempty"`
+}
+
+func viewFromEvent(event *desc.Event) eventView {
+	info := event.GetEvent()
+	view := eventView{
+		ID:          event.GetId(),
+		Title:       info.GetTitle(),
+		Start:       info.GetStartTime().AsTime(),
+		Duration:    info.GetDuration().AsDuration().String(),
+		Description: info.GetDescription(),
+		UserID:      info.GetUserId(),
+		CalendarID:  info.GetCalendarId(),
+	}
+	if notifyBefore := info.GetNotifyBefore().AsDuration(); notifyBefore > 0 {
+		view.NotifyBefore = notifyBefore.String()
+	}
+	for _, r := range info.GetReminders() {
+		view.Reminders = append(view.Reminders, reminderView{
+			Offset:  r.GetOffset().AsDuration().String(),
+			Channel: enumName(r.GetChannel().String(), reminderChannelPrefix),
+		})
+	}
+	for _, a := range info.GetAttendees() {
+		view.Attendees = append(view.Attendees, attendeeView{
+			UserID: a.GetUserId(),
+			Status: enumName(a.GetStatus().String(), attendeeStatusPrefix),
+		})
+	}
+	return view
+}
+
+func (v eventView) toInfo() (*desc.EventInfo, error) {
+	duration, err := time.ParseDuration(v.Duration)
+	if err != nil {
+		return nil, fmt.Errorf("event %q: invalid duration: %w", v.Title, err)
+	}
+	info := &desc.EventInfo{
+		Title:       v.Title,
+		StartTime:   timestamppb.New(v.Start),
+		Duration:    durationpb.New(duration),
+		Description: v.Description,
+		UserId:      v.UserID,
+		CalendarId:  v.CalendarID,
+	}
+	if v.NotifyBefore != "" {
+		notifyBefore, err := time.ParseDuration(v.NotifyBefore)
+		if err != nil {
+			return nil, fmt.Errorf("event %q: invalid notify_before: %w", v.Title, err)
+		}
+		info.NotifyBefore = durationpb.New(notifyBefore)
+	}
+	for i, r := range v.Reminders {
+		offset, err := time.ParseDuration(r.Offset)
+		if err != nil {
+			return nil, fmt.Errorf("event %q: reminders[%d]: invalid offset: %w", v.Title, i, err)
+		}
+		channel, ok := desc.ReminderChannel_value[enumValue(r.Channel, reminderChannelPrefix)]
+		if !ok || channel == 0 {
+			return nil, fmt.Errorf("event %q: reminders[%d]: unknown channel %q", v.Title, i, r.Channel)
+		}
+		info.Reminders = append(info.Reminders, &desc.Reminder{
+			Offset: durationpb.New(offset), Channel: desc.ReminderChannel(channel),
+		})
+	}
+	for _, a := range v.Attendees {
+		info.Attendees = append(info.Attendees, &desc.Attendee{UserId: a.UserID})
+	}
+	return info, nil
+}
+
+// enumName превращает значение перечисления protobuf в короткое имя: REMINDER_CHANNEL_EMAIL -> email.
+func enumName(value, prefix string) string {
+	return strings.ToLower(strings.TrimPrefix(value, prefix))
+}
+
+// enumValue - обратное к enumName преобразование.
+func enumValue(name, prefix string) string {
+	return prefix + strings.ToUpper(strings.TrimSpace(name))
+}
+
+func validOutput(format string) error {
+	switch format {
+	case outputTable, outputJSON, outputYAML:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, expected table, json or yaml", format)
+}
+
+// writeEvents выводит события в формате format. Таблица - для человека,
+// JSON и YAML можно передать обратно в import.
+func writeEvents(w io.Writer, format string, events []eventView) error {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if events == nil {
+			events = []eventView{}
+		}
+		return enc.Encode(events)
+	case outputYAML:
+		enc := yaml.NewEncoder(w)
+		defer enc.Close()
+		return enc.Encode(events)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTART\tDURATION\tTITLE\tCALENDAR")
+	for _, e := range events {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			e.ID, e.Start.Local().Format("2006-01-02 15:04"), e.Duration, e.Title, e.CalendarID)
+	}
+	return tw.Flush()
+}
+
+// readEvents читает список событий в YAML или JSON (JSON - подмножество YAML).
+func readEvents(r io.Reader) ([]eventView, error) {
+	var events []eventView
+	if err := yaml.NewDecoder(r).Decode(&events); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to parse events: %w", err)
+	}
+	return events, nil
+}
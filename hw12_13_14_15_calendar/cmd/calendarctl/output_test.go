@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	desc "github.com/milov52/hw12_13_14_15_calendar/pkg/api/event/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	events := []eventView{
+		{
+			ID:       "74e1317b-941b-42ea-b6dc-435d46ef396b",
+			Title:    "Планерка",
+			Start:    time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC),
+			Duration: "30m0s",
+			UserID:   "user1",
+			Reminders: []reminderView{
+				{Offset: "15m0s", Channel: "email"},
+				{Offset: "1h0m0s", Channel: "push"},
+			},
+			Attendees: []attendeeView{{UserID: "user2", Status: "accepted"}},
+		},
+		{
+			Title:        "Обед",
+			Start:        time.Date(2026, 10, 20, 13, 0, 0, 0, time.UTC),
+			Duration:     "1h0m0s",
+			Description:  "в столовой",
+			NotifyBefore: "10m0s",
+		},
+	}
+
+	for _, format := range []string{outputJSON, outputYAML} {
+		var buf bytes.Buffer
+		require.NoError(t, writeEvents(&buf, format, events))
+
+		read, err := readEvents(&buf)
+		require.NoError(t, err, format)
+		require.Equal(t, events, read, format)
+
+		info, err := read[0].toInfo()
+		require.NoError(t, err)
+		require.Equal(t, 30*time.Minute, info.GetDuration().AsDuration())
+
+		// Импортированное событие экспортируется так же: напоминания и участники не теряются
+		require.Equal(t, events[0], viewFromEvent(&desc.Event{Id: events[0].ID, Event: withStatus(info)}), format)
+
+		info, err = read[1].toInfo()
+		require.NoError(t, err)
+		require.Equal(t, 10*time.Minute, info.GetNotifyBefore().AsDuration())
+		require.Equal(t, events[1], viewFromEvent(&desc.Event{Event: info}), format)
+	}
+}
+
+// withStatus отмечает, что участники приняли приглашение, как это вернул бы сервер.
+func withStatus(info *desc.EventInfo) *desc.EventInfo {
+	for _, a := range info.Attendees {
+		a.Status = desc.AttendeeStatus_ATTENDEE_STATUS_ACCEPTED
+	}
+	return info
+}
+
+func TestImportRejectsUnknownReminderChannel(t *testing.T) {
+	view := eventView{
+		Title: "Планерка", Duration: "30m", Reminders: []reminderView{{Offset: "15m", Channel: "pigeon"}},
+	}
+	_, err := view.toInfo()
+	require.ErrorContains(t, err, "unknown channel")
+}
+
+func TestReadEventsEmpty(t *testing.T) {
+	events, err := readEvents(bytes.NewReader(nil))
+	require.NoError(t, err)
+	require.Empty(t, events)
+}
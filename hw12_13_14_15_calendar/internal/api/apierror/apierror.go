@@ -0,0 +1,91 @@
+// Package apierror переводит ошибки сервисов в статусы gRPC и ответы HTTP.
+// Контроллеры возвращают доменные ошибки как есть, перевод выполняется
+// в одном месте: в перехватчике gRPC и в обработчике ошибок gateway.
+package apierror
+
+import (
+	"context"
+	"errors"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// internalMessage возвращается клиенту вместо текста непредвиденной ошибки.
+const internalMessage = "internal error"
+
+var domainCodes = []struct {
+	err  error
+	code codes.Code
+}{
+	{model.ErrValidation, codes.InvalidArgument},
+	{model.ErrInvalidTimeRange, codes.InvalidArgument},
+	{model.ErrEmptySearchQuery, codes.InvalidArgument},
+	{model.ErrInvalidAttendeeStatus, codes.InvalidArgument},
+	{model.ErrInvalidPermission, codes.InvalidArgument},
+	{model.ErrEventNotFound, codes.NotFound},
+	{model.ErrCalendarNotFound, codes.NotFound},
+	{model.ErrAttendeeNotFound, codes.NotFound},
+	{model.ErrPreferencesNotFound, codes.NotFound},
+	{model.ErrDateBusy, codes.AlreadyExists},
+	{model.ErrIdempotencyKeyReused, codes.FailedPrecondition},
+	{model.ErrPermissionDenied, codes.PermissionDenied},
+	{model.ErrUnauthenticated, codes.Unauthenticated},
+	{model.ErrBatchAborted, codes.Aborted},
+	{model.ErrQuotaExceeded, codes.ResourceExhausted},
+	{context.Canceled, codes.Canceled},
+	{context.DeadlineExceeded, codes.DeadlineExceeded},
+}
+
+// Code возвращает код gRPC для ошибки.
+func Code(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	if st, ok := status.FromError(err); ok {
+		return st.Code()
+	}
+	for _, d := range domainCodes {
+		if errors.Is(err, d.err) {
+			return d.code
+		}
+	}
+	return codes.Internal
+}
+
+// ToStatus переводит ошибку в статус gRPC. Уже готовый статус возвращается
+// без изменений, ошибки проверки полей дополняются errdetails.BadRequest.
+// Текст непредвиденных ошибок клиенту не раскрывается.
+func ToStatus(err error) *status.Status {
+	if err == nil {
+		return nil
+	}
+	if st, ok := status.FromError(err); ok {
+		return st
+	}
+
+	code := Code(err)
+	if code == codes.Internal {
+		return status.New(code, internalMessage)
+	}
+
+	st := status.New(code, err.Error())
+	var verr *model.ValidationError
+	if !errors.As(err, &verr) {
+		return st
+	}
+
+	badRequest := &errdetails.BadRequest{}
+	for _, v := range verr.Violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       v.Field,
+			Description: v.Description,
+		})
+	}
+	if withDetails, detailsErr := st.WithDetails(badRequest); detailsErr == nil {
+		return withDetails
+	}
+	return st
+}
@@ -0,0 +1,81 @@
+package apierror_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/api/apierror"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestToStatus(t *testing.T) {
+	verr := &model.ValidationError{}
+	verr.Add("title", "must not be empty")
+
+	tests := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{"not found", fmt.Errorf("repository.sql.UpdateEvent: %w", model.ErrEventNotFound), codes.NotFound},
+		{"busy", model.ErrDateBusy, codes.AlreadyExists},
+		{"validation", verr, codes.InvalidArgument},
+		{"time range", model.ErrInvalidTimeRange, codes.InvalidArgument},
+		{"permission", model.ErrPermissionDenied, codes.PermissionDenied},
+		{"canceled", fmt.Errorf("query: %w", context.Canceled), codes.Canceled},
+		{"deadline", context.DeadlineExceeded, codes.DeadlineExceeded},
+		{"status", status.Error(codes.Unavailable, "down"), codes.Unavailable},
+		{"unknown", errors.New("connection refused"), codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.code, apierror.ToStatus(tt.err).Code())
+		})
+	}
+
+	// Текст непредвиденной ошибки не должен уходить клиенту
+	require.NotContains(t, apierror.ToStatus(errors.New("password=secret")).Message(), "secret")
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := apierror.UnaryServerInterceptor(*slogDiscard())
+	_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/event.Calendar/UpdateEvent"},
+		func(context.Context, any) (any, error) {
+			return nil, fmt.Errorf("failed to update event: %w", model.ErrEventNotFound)
+		})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestHTTPErrorHandler(t *testing.T) {
+	verr := &model.ValidationError{}
+	verr.Add("event.duration", "must be positive")
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v1/event", nil)
+	apierror.HTTPErrorHandler(context.Background(), nil, nil, w, r, verr)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var body apierror.ErrorBody
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, "INVALID_ARGUMENT", body.Code)
+	require.Equal(t, []apierror.FieldViolation{
+		{Field: "event.duration", Description: "must be positive"},
+	}, body.Violations)
+}
+
+func slogDiscard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
@@ -0,0 +1,74 @@
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// FieldViolation - ошибка одного поля запроса в теле ответа HTTP.
+type FieldViolation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// ErrorBody - тело ответа HTTP с ошибкой. Формат не зависит от версии gateway:
+// code - имя кода gRPC, например NOT_FOUND. Для OpenAPI описан сообщением ErrorResponse
+// в EventService.proto, при изменении полей нужно менять оба.
+type ErrorBody struct {
+	Code       string           `json:"code"`
+	Message    string           `json:"message"`
+	Violations []FieldViolation `json:"violations,omitempty"`
+}
+
+// CodeName возвращает имя кода gRPC, например NOT_FOUND.
+func CodeName(c codes.Code) string {
+	return code.Code(c).String()
+}
+
+// HTTPErrorHandler - обработчик ошибок grpc-gateway, отдающий ErrorBody.
+func HTTPErrorHandler(
+	_ context.Context, _ *runtime.ServeMux, _ runtime.Marshaler,
+	w http.ResponseWriter, _ *http.Request, err error,
+) {
+	st := ToStatus(err)
+	body := ErrorBody{
+		Code:    CodeName(st.Code()),
+		Message: st.Message(),
+	}
+	for _, detail := range st.Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			for _, v := range badRequest.GetFieldViolations() {
+				body.Violations = append(body.Violations, FieldViolation{
+					Field:       v.GetField(),
+					Description: v.GetDescription(),
+				})
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(runtime.HTTPStatusFromCode(st.Code()))
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// NewHTTPErrorHandler дополняет HTTPErrorHandler записью в лог непредвиденных ошибок.
+// Нужен, когда gateway вызывает контроллер напрямую, минуя UnaryServerInterceptor.
+// Статусы от gRPC-сервера уже записаны интерцептором и повторно не пишутся.
+func NewHTTPErrorHandler(logger slog.Logger) runtime.ErrorHandlerFunc {
+	return func(ctx context.Context, mux *runtime.ServeMux, m runtime.Marshaler,
+		w http.ResponseWriter, r *http.Request, err error,
+	) {
+		if _, ok := status.FromError(err); !ok && Code(err) == codes.Internal {
+			logger.Error("request failed", "path", r.URL.Path, "err", err)
+		}
+		HTTPErrorHandler(ctx, mux, m, w, r, err)
+	}
+}
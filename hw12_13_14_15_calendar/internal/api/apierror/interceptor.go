@@ -0,0 +1,26 @@
+package apierror
+
+import (
+	"context"
+	"log/slog"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// UnaryServerInterceptor переводит ошибки обработчиков в статусы gRPC.
+// Непредвиденные ошибки пишутся в лог целиком, клиент получает только код.
+func UnaryServerInterceptor(logger slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+
+		st := ToStatus(err)
+		if st.Code() == codes.Internal {
+			logger.Error("request failed", "method", info.FullMethod, "err", err)
+		}
+		return resp, st.Err()
+	}
+}
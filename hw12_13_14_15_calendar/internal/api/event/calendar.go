@@ -0,0 +1,180 @@
+package event
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/converter/server"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	servicepb "github.com/milov52/hw12_13_14_15_calendar/pkg/api/event/v1"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func (c *Controller) CreateCalendar(
+	ctx context.Context, req *servicepb.CreateCalendarRequest,
+) (*servicepb.CreateResponse, error) {
+	calendar := server.CalendarFromReq(req.GetCalendar())
+	if calendar.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid req: name is empty")
+	}
+
+	id, err := c.eventService.CreateCalendar(ctx, calendar)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create calendar: %w", err)
+	}
+	return &servicepb.CreateResponse{UUID: id.String()}, nil
+}
+
+func (c *Controller) UpdateCalendar(ctx context.Context, req *servicepb.UpdateCalendarRequest) (*emptypb.Empty, error) {
+	calendarID, err := uuid.Parse(req.GetUUID())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid req: %v", err)
+	}
+	calendar := server.CalendarFromReq(req.GetCalendar())
+	if calendar.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid req: name is empty")
+	}
+
+	if err := c.eventService.UpdateCalendar(ctx, calendarID, calendar); err != nil {
+		return nil, fmt.Errorf("failed to update calendar: %w", err)
+	}
+	return nil, nil
+}
+
+func (c *Controller) DeleteCalendar(ctx context.Context, req *servicepb.DeleteRequest) (*emptypb.Empty, error) {
+	calendarID, err := uuid.Parse(req.GetUUID())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid req: %v", err)
+	}
+
+	if err := c.eventService.DeleteCalendar(ctx, calendarID); err != nil {
+		return nil, fmt.Errorf("failed to delete calendar: %w", err)
+	}
+	return nil, nil
+}
+
+func (c *Controller) GetCalendar(
+	ctx context.Context, req *servicepb.GetCalendarRequest,
+) (*servicepb.UserCalendar, error) {
+	calendarID, err := uuid.Parse(req.GetUUID())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid req: %v", err)
+	}
+
+	calendar, err := c.eventService.GetCalendar(ctx, calendarID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get calendar: %w", err)
+	}
+	return server.CalendarToResp(calendar), nil
+}
+
+func (c *Controller) ListCalendars(
+	ctx context.Context, req *servicepb.ListCalendarsRequest,
+) (*servicepb.ListCalendarsResponse, error) {
+	calendars, err := c.eventService.ListCalendars(ctx, req.GetUserId())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list calendars: %w", err)
+	}
+	return server.CalendarsToResp(calendars), nil
+}
+
+func (c *Controller) ShareCalendar(ctx context.Context, req *servicepb.ShareCalendarRequest) (*emptypb.Empty, error) {
+	calendarID, err := uuid.Parse(req.GetUUID())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid req: %v", err)
+	}
+	permission, err := server.PermissionFromReq(req.GetPermission())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid req: %v", err)
+	}
+
+	share := model.CalendarShare{UserID: req.GetUserId(), Permission: permission}
+	if err := c.eventService.ShareCalendar(ctx, calendarID, share); err != nil {
+		return nil, fmt.Errorf("failed to share calendar: %w", err)
+	}
+	return nil, nil
+}
+
+func (c *Controller) RevokeCalendarShare(
+	ctx context.Context, req *servicepb.RevokeCalendarShareRequest,
+) (*emptypb.Empty, error) {
+	calendarID, err := uuid.Parse(req.GetUUID())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid req: %v", err)
+	}
+
+	if err := c.eventService.RevokeCalendarShare(ctx, calendarID, req.GetUserId()); err != nil {
+		return nil, fmt.Errorf("failed to revoke calendar share: %w", err)
+	}
+	return nil, nil
+}
+
+func (c *Controller) ListJobRuns(
+	ctx context.Context, req *servicepb.ListJobRunsRequest,
+) (*servicepb.ListJobRunsResponse, error) {
+	filter := model.JobRunFilter{Job: req.GetJob(), Limit: int(req.GetLimit())}
+	runs, err := c.eventService.ListJobRuns(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list job runs: %w", err)
+	}
+	return server.JobRunsToResp(runs), nil
+}
+
+func (c *Controller) ListNotifications(
+	ctx context.Context, req *servicepb.ListNotificationsRequest,
+) (*servicepb.ListNotificationsResponse, error) {
+	filter := model.NotificationFilter{OwnerID: req.GetUserId(), Limit: int(req.GetLimit())}
+	if req.GetEventId() != "" {
+		eventID, err := uuid.Parse(req.GetEventId())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid req: %v", err)
+		}
+		filter.EventID = eventID
+	}
+
+	records, err := c.eventService.ListNotifications(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notifications: %w", err)
+	}
+	return server.NotificationsToResp(records), nil
+}
+
+func (c *Controller) GetNotificationPreferences(
+	ctx context.Context, req *servicepb.NotificationPreferencesRequest,
+) (*servicepb.NotificationPreferences, error) {
+	prefs, err := c.eventService.GetNotificationPreferences(ctx, req.GetUserId())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification preferences: %w", err)
+	}
+	return server.PreferencesToResp(prefs), nil
+}
+
+func (c *Controller) UpdateNotificationPreferences(
+	ctx context.Context, req *servicepb.UpdateNotificationPreferencesRequest,
+) (*servicepb.NotificationPreferences, error) {
+	prefs, err := server.PreferencesFromReq(req.GetPreferences())
+	if err != nil {
+		return nil, invalidField("preferences", err)
+	}
+	if req.GetUserId() != "" {
+		prefs.UserID = req.GetUserId()
+	}
+
+	prefs, err = c.eventService.UpdateNotificationPreferences(ctx, prefs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update notification preferences: %w", err)
+	}
+	return server.PreferencesToResp(prefs), nil
+}
+
+func (c *Controller) DeleteNotificationPreferences(
+	ctx context.Context, req *servicepb.NotificationPreferencesRequest,
+) (*emptypb.Empty, error) {
+	if err := c.eventService.DeleteNotificationPreferences(ctx, req.GetUserId()); err != nil {
+		return nil, fmt.Errorf("failed to delete notification preferences: %w", err)
+	}
+	return nil, nil
+}
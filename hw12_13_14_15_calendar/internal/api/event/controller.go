@@ -1,6 +1,8 @@
 package event
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,19 +11,49 @@ import (
 	servicepb "github.com/milov52/hw12_13_14_15_calendar/pkg/api/event/v1"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 var _ servicepb.CalendarServer = (*Controller)(nil)
 
+// IdempotencyKeyMetadata - ключ метаданных gRPC (и HTTP-заголовок Idempotency-Key)
+// с ключом идемпотентности CreateEvent.
+const IdempotencyKeyMetadata = "idempotency-key"
+
+const maxIdempotencyKeyLength = 255
+
 type EventService interface {
 	CreateEvent(ctx context.Context, event model.Event) (uuid.UUID, error)
-	UpdateEvent(ctx context.Context, id uuid.UUID, event model.Event) error
+	CreateEventIdempotent(ctx context.Context, key string, event model.Event) (uuid.UUID, error)
+	UpdateEvent(ctx context.Context, update model.EventUpdate) error
 	DeleteEvent(ctx context.Context, id uuid.UUID) error
-	DayEventList(ctx context.Context, date time.Time) ([]model.Event, error)
-	WeekEventList(ctx context.Context, date time.Time) ([]model.Event, error)
-	MonthEventList(ctx context.Context, date time.Time) ([]model.Event, error)
+	DayEventList(ctx context.Context, date time.Time, filter model.EventFilter) ([]model.Event, error)
+	WeekEventList(ctx context.Context, date time.Time, filter model.EventFilter) ([]model.Event, error)
+	MonthEventList(ctx context.Context, date time.Time, filter model.EventFilter) ([]model.Event, error)
+	GetFreeBusy(ctx context.Context, userIDs []string, from, to time.Time) (map[string][]model.Interval, error)
+	FindFreeSlots(ctx context.Context, query model.SlotQuery) ([]model.Interval, error)
+	SearchEvents(ctx context.Context, query model.SearchQuery) (model.SearchPage, error)
+	InviteAttendees(ctx context.Context, eventID uuid.UUID, userIDs []string) error
+	RespondToInvitation(ctx context.Context, eventID uuid.UUID, userID string, status model.AttendeeStatus) error
+	BatchCreateEvents(ctx context.Context, events []model.Event, allOrNothing bool) ([]model.BatchResult, error)
+	BatchUpdateEvents(ctx context.Context, updates []model.EventUpdate, allOrNothing bool) ([]model.BatchResult, error)
+	BatchDeleteEvents(ctx context.Context, ids []uuid.UUID, allOrNothing bool) ([]model.BatchResult, error)
+	CreateCalendar(ctx context.Context, calendar model.Calendar) (uuid.UUID, error)
+	UpdateCalendar(ctx context.Context, id uuid.UUID, calendar model.Calendar) error
+	DeleteCalendar(ctx context.Context, id uuid.UUID) error
+	GetCalendar(ctx context.Context, id uuid.UUID) (model.Calendar, error)
+	ListCalendars(ctx context.Context, userID string) ([]model.Calendar, error)
+	ShareCalendar(ctx context.Context, id uuid.UUID, share model.CalendarShare) error
+	RevokeCalendarShare(ctx context.Context, id uuid.UUID, userID string) error
+	ListJobRuns(ctx context.Context, filter model.JobRunFilter) ([]model.JobRun, error)
+	ListNotifications(ctx context.Context, filter model.NotificationFilter) ([]model.NotificationRecord, error)
+	GetNotificationPreferences(ctx context.Context, userID string) (model.NotificationPreferences, error)
+	UpdateNotificationPreferences(
+		ctx context.Context, prefs model.NotificationPreferences,
+	) (model.NotificationPreferences, error)
+	DeleteNotificationPreferences(ctx context.Context, userID string) error
 }
 
 type Controller struct {
@@ -37,30 +69,37 @@ func (c *Controller) CreateEvent(ctx context.Context, req *servicepb.CreateReque
 	r := req.GetEvent()
 	eventDTO, err := server.EventFromReq(r)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, "invalid req: %v", err)
+		return nil, invalidField("event", err)
+	}
+	key := idempotencyKey(ctx)
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, invalidField(IdempotencyKeyMetadata,
+			fmt.Errorf("must be at most %d characters", maxIdempotencyKeyLength))
 	}
 
-	id, err := c.eventService.CreateEvent(ctx, *eventDTO)
+	id, err := c.eventService.CreateEventIdempotent(ctx, key, *eventDTO)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to create event: %v", err)
+		return nil, fmt.Errorf("failed to create event: %w", err)
 	}
 
 	return &servicepb.CreateResponse{UUID: id.String()}, nil
 }
 
 func (c *Controller) UpdateEvent(ctx context.Context, req *servicepb.UpdateRequest) (*emptypb.Empty, error) {
+	verr := &model.ValidationError{}
 	eventDTO, err := server.EventFromReq(req.GetEvent())
-	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, "invalid req: %v", err)
-	}
+	verr.Merge("event", err)
 	eventID, err := uuid.Parse(req.UUID)
-	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, "invalid req: %v", err)
+	verr.Merge("UUID", err)
+	if err := verr.Err(); err != nil {
+		return nil, err
 	}
 
-	err = c.eventService.UpdateEvent(ctx, eventID, *eventDTO)
+	err = c.eventService.UpdateEvent(ctx, model.EventUpdate{
+		ID: eventID, Event: *eventDTO, ClearCalendar: req.GetClearCalendar(),
+	})
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to create event: %v", err)
+		return nil, fmt.Errorf("failed to update event: %w", err)
 	}
 
 	return nil, nil
@@ -74,16 +113,21 @@ func (c *Controller) DeleteEvent(ctx context.Context, req *servicepb.DeleteReque
 
 	err = c.eventService.DeleteEvent(ctx, eventID)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to delete event: %v", err)
+		return nil, fmt.Errorf("failed to delete event: %w", err)
 	}
 	return nil, nil
 }
 
 func (c *Controller) GetDayEventList(ctx context.Context, req *servicepb.GetRequest) (*servicepb.GetResponse, error) {
 	day := req.GetDate().AsTime()
-	events, err := c.eventService.DayEventList(ctx, day)
+	filter, err := server.FilterFromReq(req)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid req: %v", err)
+	}
+
+	events, err := c.eventService.DayEventList(ctx, day, filter)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to get events: %v", err)
+		return nil, fmt.Errorf("failed to get events: %w", err)
 	}
 
 	return server.EventsToResp(events), nil
@@ -91,9 +135,14 @@ func (c *Controller) GetDayEventList(ctx context.Context, req *servicepb.GetRequ
 
 func (c *Controller) GetWeekEventList(ctx context.Context, req *servicepb.GetRequest) (*servicepb.GetResponse, error) {
 	day := req.GetDate().AsTime()
-	events, err := c.eventService.WeekEventList(ctx, day)
+	filter, err := server.FilterFromReq(req)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid req: %v", err)
+	}
+
+	events, err := c.eventService.WeekEventList(ctx, day, filter)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to get events: %v", err)
+		return nil, fmt.Errorf("failed to get events: %w", err)
 	}
 
 	return server.EventsToResp(events), nil
@@ -101,10 +150,201 @@ func (c *Controller) GetWeekEventList(ctx context.Context, req *servicepb.GetReq
 
 func (c *Controller) GetMonthEventList(ctx context.Context, req *servicepb.GetRequest) (*servicepb.GetResponse, error) {
 	day := req.GetDate().AsTime()
-	events, err := c.eventService.MonthEventList(ctx, day)
+	filter, err := server.FilterFromReq(req)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid req: %v", err)
+	}
+
+	events, err := c.eventService.MonthEventList(ctx, day, filter)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to get events: %v", err)
+		return nil, fmt.Errorf("failed to get events: %w", err)
 	}
 
 	return server.EventsToResp(events), nil
 }
+
+func (c *Controller) SearchEvents(
+	ctx context.Context, req *servicepb.SearchRequest,
+) (*servicepb.SearchResponse, error) {
+	page, err := c.eventService.SearchEvents(ctx, server.SearchQueryFromReq(req))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search events: %w", err)
+	}
+
+	return server.SearchToResp(page), nil
+}
+
+func (c *Controller) InviteAttendees(ctx context.Context, req *servicepb.InviteRequest) (*emptypb.Empty, error) {
+	eventID, err := uuid.Parse(req.GetUUID())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid req: %v", err)
+	}
+	if len(req.GetUserIds()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid req: user_ids is empty")
+	}
+	verr := &model.ValidationError{}
+	for i, userID := range req.GetUserIds() {
+		if !model.ValidUserID(userID) {
+			verr.Add(fmt.Sprintf("user_ids[%d]", i), "has invalid format")
+		}
+	}
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+
+	err = c.eventService.InviteAttendees(ctx, eventID, req.GetUserIds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to invite attendees: %w", err)
+	}
+	return nil, nil
+}
+
+func (c *Controller) RespondToInvitation(ctx context.Context, req *servicepb.RespondRequest) (*emptypb.Empty, error) {
+	eventID, err := uuid.Parse(req.GetUUID())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid req: %v", err)
+	}
+	attendeeStatus, err := server.AttendeeStatusFromReq(req.GetStatus())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid req: %v", err)
+	}
+
+	err = c.eventService.RespondToInvitation(ctx, eventID, req.GetUserId(), attendeeStatus)
+	if err != nil {
+		return nil, fmt.Errorf("failed to respond to invitation: %w", err)
+	}
+	return nil, nil
+}
+
+func (c *Controller) GetFreeBusy(
+	ctx context.Context, req *servicepb.FreeBusyRequest,
+) (*servicepb.FreeBusyResponse, error) {
+	if len(req.GetUserIds()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid req: user_ids is empty")
+	}
+
+	busy, err := c.eventService.GetFreeBusy(ctx, req.GetUserIds(), req.GetFrom().AsTime(), req.GetTo().AsTime())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get free/busy: %w", err)
+	}
+
+	return server.FreeBusyToResp(req.GetUserIds(), busy), nil
+}
+
+func (c *Controller) FindFreeSlots(
+	ctx context.Context, req *servicepb.FindFreeSlotsRequest,
+) (*servicepb.FindFreeSlotsResponse, error) {
+	if len(req.GetUserIds()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid req: user_ids is empty")
+	}
+	query, err := server.SlotQueryFromReq(req)
+	if err != nil {
+		return nil, err
+	}
+
+	slots, err := c.eventService.FindFreeSlots(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find free slots: %w", err)
+	}
+
+	return &servicepb.FindFreeSlotsResponse{Slots: server.IntervalsToResp(slots)}, nil
+}
+
+func (c *Controller) BatchCreateEvents(
+	ctx context.Context, req *servicepb.BatchCreateRequest,
+) (*servicepb.BatchResponse, error) {
+	verr := &model.ValidationError{}
+	events := make([]model.Event, 0, len(req.GetEvents()))
+	for i, r := range req.GetEvents() {
+		eventDTO, err := server.EventFromReq(r)
+		if err != nil {
+			verr.Merge(fmt.Sprintf("events[%d]", i), err)
+			continue
+		}
+		events = append(events, *eventDTO)
+	}
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+
+	results, err := c.eventService.BatchCreateEvents(ctx, events, req.GetAllOrNothing())
+	if err != nil {
+		return nil, fmt.Errorf("failed to batch create events: %w", err)
+	}
+
+	return server.BatchToResp(results), nil
+}
+
+func (c *Controller) BatchUpdateEvents(
+	ctx context.Context, req *servicepb.BatchUpdateRequest,
+) (*servicepb.BatchResponse, error) {
+	verr := &model.ValidationError{}
+	updates := make([]model.EventUpdate, 0, len(req.GetEvents()))
+	for i, r := range req.GetEvents() {
+		eventDTO, eventErr := server.EventFromReq(r.GetEvent())
+		verr.Merge(fmt.Sprintf("events[%d].event", i), eventErr)
+		eventID, idErr := uuid.Parse(r.GetUUID())
+		verr.Merge(fmt.Sprintf("events[%d].UUID", i), idErr)
+		if eventErr == nil && idErr == nil {
+			updates = append(updates, model.EventUpdate{
+				ID: eventID, Event: *eventDTO, ClearCalendar: r.GetClearCalendar(),
+			})
+		}
+	}
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+
+	results, err := c.eventService.BatchUpdateEvents(ctx, updates, req.GetAllOrNothing())
+	if err != nil {
+		return nil, fmt.Errorf("failed to batch update events: %w", err)
+	}
+
+	return server.BatchToResp(results), nil
+}
+
+func (c *Controller) BatchDeleteEvents(
+	ctx context.Context, req *servicepb.BatchDeleteRequest,
+) (*servicepb.BatchResponse, error) {
+	verr := &model.ValidationError{}
+	ids := make([]uuid.UUID, 0, len(req.GetUUIDs()))
+	for i, raw := range req.GetUUIDs() {
+		eventID, err := uuid.Parse(raw)
+		if err != nil {
+			verr.Merge(fmt.Sprintf("UUIDs[%d]", i), err)
+			continue
+		}
+		ids = append(ids, eventID)
+	}
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+
+	results, err := c.eventService.BatchDeleteEvents(ctx, ids, req.GetAllOrNothing())
+	if err != nil {
+		return nil, fmt.Errorf("failed to batch delete events: %w", err)
+	}
+
+	return server.BatchToResp(results), nil
+}
+
+// idempotencyKey возвращает ключ идемпотентности из метаданных запроса.
+func idempotencyKey(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	for _, v := range md.Get(IdempotencyKeyMetadata) {
+		if key := strings.TrimSpace(v); key != "" {
+			return key
+		}
+	}
+	return ""
+}
+
+// invalidField возвращает ошибку проверки поля field запроса.
+func invalidField(field string, err error) error {
+	verr := &model.ValidationError{}
+	verr.Merge(field, err)
+	return verr
+}
@@ -2,18 +2,24 @@ package event_test
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/api/apierror"
 	event2 "github.com/milov52/hw12_13_14_15_calendar/internal/api/event"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/auth"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/service/calendar"
 	servicepb "github.com/milov52/hw12_13_14_15_calendar/pkg/api/event/v1"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
@@ -42,6 +48,148 @@ func (m *MockStorage) GetEvents(ctx context.Context, date time.Time, offset int)
 	return args.Get(0).([]model.Event), args.Error(1)
 }
 
+func (m *MockStorage) GetUserEvents(
+	ctx context.Context, userID string, date time.Time, offset int,
+) ([]model.Event, error) {
+	args := m.Called(ctx, userID, date, offset)
+	return args.Get(0).([]model.Event), args.Error(1)
+}
+
+func (m *MockStorage) GetBusyIntervals(
+	ctx context.Context, userIDs []string, from, to time.Time,
+) (map[string][]model.Interval, error) {
+	args := m.Called(ctx, userIDs, from, to)
+	return args.Get(0).(map[string][]model.Interval), args.Error(1)
+}
+
+func (m *MockStorage) GetCalendarBusyIntervals(
+	ctx context.Context, calendarIDs []uuid.UUID, from, to time.Time,
+) ([]model.Interval, error) {
+	args := m.Called(ctx, calendarIDs, from, to)
+	return args.Get(0).([]model.Interval), args.Error(1)
+}
+
+func (m *MockStorage) InviteAttendees(ctx context.Context, eventID uuid.UUID, userIDs []string) error {
+	args := m.Called(ctx, eventID, userIDs)
+	return args.Error(0)
+}
+
+func (m *MockStorage) RespondToInvitation(
+	ctx context.Context, eventID uuid.UUID, userID string, status model.AttendeeStatus,
+) error {
+	args := m.Called(ctx, eventID, userID, status)
+	return args.Error(0)
+}
+
+func (m *MockStorage) BatchCreateEvents(
+	ctx context.Context, events []model.Event, allOrNothing bool,
+) ([]model.BatchResult, error) {
+	args := m.Called(ctx, events, allOrNothing)
+	return args.Get(0).([]model.BatchResult), args.Error(1)
+}
+
+func (m *MockStorage) BatchUpdateEvents(
+	ctx context.Context, updates []model.EventUpdate, allOrNothing bool,
+) ([]model.BatchResult, error) {
+	args := m.Called(ctx, updates, allOrNothing)
+	return args.Get(0).([]model.BatchResult), args.Error(1)
+}
+
+func (m *MockStorage) BatchDeleteEvents(
+	ctx context.Context, ids []uuid.UUID, allOrNothing bool,
+) ([]model.BatchResult, error) {
+	args := m.Called(ctx, ids, allOrNothing)
+	return args.Get(0).([]model.BatchResult), args.Error(1)
+}
+
+func (m *MockStorage) GetEvent(ctx context.Context, id uuid.UUID) (model.Event, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(model.Event), args.Error(1)
+}
+
+func (m *MockStorage) GetCalendarEvents(
+	ctx context.Context, calendarID uuid.UUID, date time.Time, offset int,
+) ([]model.Event, error) {
+	args := m.Called(ctx, calendarID, date, offset)
+	return args.Get(0).([]model.Event), args.Error(1)
+}
+
+func (m *MockStorage) CreateCalendar(ctx context.Context, c model.Calendar) (uuid.UUID, error) {
+	args := m.Called(ctx, c)
+	return args.Get(0).(uuid.UUID), args.Error(1)
+}
+
+func (m *MockStorage) UpdateCalendar(ctx context.Context, id uuid.UUID, c model.Calendar) error {
+	args := m.Called(ctx, id, c)
+	return args.Error(0)
+}
+
+func (m *MockStorage) DeleteCalendar(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockStorage) GetCalendar(ctx context.Context, id uuid.UUID) (model.Calendar, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(model.Calendar), args.Error(1)
+}
+
+func (m *MockStorage) ListCalendars(ctx context.Context, userID string) ([]model.Calendar, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]model.Calendar), args.Error(1)
+}
+
+func (m *MockStorage) ShareCalendar(ctx context.Context, calendarID uuid.UUID, share model.CalendarShare) error {
+	args := m.Called(ctx, calendarID, share)
+	return args.Error(0)
+}
+
+func (m *MockStorage) RevokeCalendarShare(ctx context.Context, calendarID uuid.UUID, userID string) error {
+	args := m.Called(ctx, calendarID, userID)
+	return args.Error(0)
+}
+
+func (m *MockStorage) SearchEvents(ctx context.Context, query model.SearchQuery) (model.SearchPage, error) {
+	args := m.Called(ctx, query)
+	return args.Get(0).(model.SearchPage), args.Error(1)
+}
+
+func (m *MockStorage) CreateEventIdempotent(
+	ctx context.Context, key model.IdempotencyKey, evt model.Event,
+) (uuid.UUID, bool, error) {
+	args := m.Called(ctx, key, evt)
+	return args.Get(0).(uuid.UUID), args.Bool(1), args.Error(2)
+}
+
+func (m *MockStorage) ListJobRuns(ctx context.Context, filter model.JobRunFilter) ([]model.JobRun, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).([]model.JobRun), args.Error(1)
+}
+
+func (m *MockStorage) ListNotifications(
+	ctx context.Context, filter model.NotificationFilter,
+) ([]model.NotificationRecord, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).([]model.NotificationRecord), args.Error(1)
+}
+
+func (m *MockStorage) GetNotificationPreferences(
+	ctx context.Context, userID string,
+) (model.NotificationPreferences, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(model.NotificationPreferences), args.Error(1)
+}
+
+func (m *MockStorage) SaveNotificationPreferences(ctx context.Context, prefs model.NotificationPreferences) error {
+	args := m.Called(ctx, prefs)
+	return args.Error(0)
+}
+
+func (m *MockStorage) DeleteNotificationPreferences(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
 func TestCreateEventGRPC(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
@@ -60,7 +208,7 @@ func TestCreateEventGRPC(t *testing.T) {
 			UserId:    "user1",
 		},
 	}
-	resp, err := controller.CreateEvent(context.Background(), req)
+	resp, err := controller.CreateEvent(auth.WithUserID(context.Background(), "user1"), req)
 
 	require.NoError(t, err)
 	require.NotNil(t, resp)
@@ -69,6 +217,36 @@ func TestCreateEventGRPC(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
+func TestCreateEventIgnoresAttendeeStatus(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo)
+	controller := event2.NewEventController(mockService)
+
+	// Организатор не может ответить за приглашённых
+	mockRepo.On("CreateEvent", mock.Anything, mock.MatchedBy(func(e model.Event) bool {
+		return len(e.Attendees) == 2 &&
+			e.Attendees[0].Status == model.AttendeeNeedsAction && e.Attendees[1].Status == model.AttendeeNeedsAction
+	})).Return(uuid.New(), nil).Once()
+
+	req := &servicepb.CreateRequest{
+		Event: &servicepb.EventInfo{
+			Title:     "Test Event",
+			StartTime: timestamppb.New(time.Now()),
+			Duration:  durationpb.New(time.Hour),
+			Attendees: []*servicepb.Attendee{
+				{UserId: "user2", Status: servicepb.AttendeeStatus_ATTENDEE_STATUS_ACCEPTED},
+				{UserId: "user3", Status: servicepb.AttendeeStatus_ATTENDEE_STATUS_TENTATIVE},
+			},
+		},
+	}
+	_, err := controller.CreateEvent(auth.WithUserID(context.Background(), "user1"), req)
+	require.NoError(t, err)
+
+	mockRepo.AssertExpectations(t)
+}
+
 func TestUpdateEventGRPC(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
@@ -76,24 +254,58 @@ func TestUpdateEventGRPC(t *testing.T) {
 	mockService := calendar.NewEventService(*logger, mockRepo)
 	controller := event2.NewEventController(mockService)
 
+	mockRepo.On("GetEvent", mock.Anything, mock.AnythingOfType("uuid.UUID")).
+		Return(model.Event{UserID: "user1"}, nil)
 	mockRepo.On("UpdateEvent", mock.Anything, mock.AnythingOfType("uuid.UUID"),
 		mock.AnythingOfType("model.Event")).Return(nil)
 
 	req := &servicepb.UpdateRequest{
 		UUID: uuid.New().String(),
 		Event: &servicepb.EventInfo{
-			Title:    "Test Event2",
-			Duration: durationpb.New(time.Hour * 2),
-			UserId:   "user1",
+			Title:     "Test Event2",
+			StartTime: timestamppb.New(time.Now()),
+			Duration:  durationpb.New(time.Hour * 2),
+			UserId:    "user1",
 		},
 	}
 
-	_, err := controller.UpdateEvent(context.Background(), req)
+	_, err := controller.UpdateEvent(auth.WithUserID(context.Background(), "user1"), req)
 	require.NoError(t, err)
 
 	mockRepo.AssertExpectations(t)
 }
 
+func TestUpdateEventKeepsOwner(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo)
+	controller := event2.NewEventController(mockService)
+
+	mockRepo.On("GetEvent", mock.Anything, mock.AnythingOfType("uuid.UUID")).
+		Return(model.Event{UserID: "user1"}, nil)
+	mockRepo.On("UpdateEvent", mock.Anything, mock.AnythingOfType("uuid.UUID"), mock.MatchedBy(func(e model.Event) bool {
+		return e.UserID == "user1"
+	})).Return(nil).Twice()
+
+	// Без владельца и с чужим владельцем событие остаётся за прежним владельцем
+	for _, userID := range []string{"", "user2"} {
+		req := &servicepb.UpdateRequest{
+			UUID: uuid.New().String(),
+			Event: &servicepb.EventInfo{
+				Title:     "Test Event2",
+				StartTime: timestamppb.New(time.Now()),
+				Duration:  durationpb.New(time.Hour),
+				UserId:    userID,
+			},
+		}
+		_, err := controller.UpdateEvent(auth.WithUserID(context.Background(), "user1"), req)
+		require.NoError(t, err)
+	}
+
+	mockRepo.AssertExpectations(t)
+}
+
 func TestDeleteEventGRPC(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
@@ -101,6 +313,8 @@ func TestDeleteEventGRPC(t *testing.T) {
 	mockService := calendar.NewEventService(*logger, mockRepo)
 	controller := event2.NewEventController(mockService)
 
+	mockRepo.On("GetEvent", mock.Anything, mock.AnythingOfType("uuid.UUID")).
+		Return(model.Event{UserID: "user1"}, nil)
 	mockRepo.On("DeleteEvent", mock.Anything,
 		mock.AnythingOfType("uuid.UUID")).Return(nil)
 
@@ -108,7 +322,7 @@ func TestDeleteEventGRPC(t *testing.T) {
 		UUID: uuid.New().String(),
 	}
 
-	_, err := controller.DeleteEvent(context.Background(), req)
+	_, err := controller.DeleteEvent(auth.WithUserID(context.Background(), "user1"), req)
 	require.NoError(t, err)
 
 	mockRepo.AssertExpectations(t)
@@ -121,16 +335,710 @@ func TestDayEventList(t *testing.T) {
 	mockService := calendar.NewEventService(*logger, mockRepo)
 	controller := event2.NewEventController(mockService)
 
-	mockRepo.On("GetEvents", mock.Anything,
+	mockRepo.On("GetUserEvents", mock.Anything, "user1",
 		mock.AnythingOfType("time.Time"), mock.AnythingOfType("int")).Return([]model.Event{}, nil)
+	mockRepo.On("ListCalendars", mock.Anything, "user1").Return([]model.Calendar{}, nil)
 
 	req := &servicepb.GetRequest{
 		Date: timestamppb.New(time.Now()),
 	}
-	resp, err := controller.GetDayEventList(context.Background(), req)
+	resp, err := controller.GetDayEventList(auth.WithUserID(context.Background(), "user1"), req)
 
 	require.NoError(t, err)
 	require.NotNil(t, resp)
 
 	mockRepo.AssertExpectations(t)
 }
+
+func TestDayEventListForUser(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo)
+	controller := event2.NewEventController(mockService)
+
+	mockRepo.On("GetUserEvents", mock.Anything, "user2",
+		mock.AnythingOfType("time.Time"), mock.AnythingOfType("int")).Return([]model.Event{{
+		ID:        uuid.New(),
+		Title:     "Team meeting",
+		UserID:    "user1",
+		Attendees: []model.Attendee{{UserID: "user2", Status: model.AttendeeAccepted}},
+	}}, nil)
+	mockRepo.On("ListCalendars", mock.Anything, "user2").Return([]model.Calendar{}, nil)
+
+	req := &servicepb.GetRequest{
+		Date:   timestamppb.New(time.Now()),
+		UserId: "user2",
+	}
+	resp, err := controller.GetDayEventList(auth.WithUserID(context.Background(), "user2"), req)
+
+	require.NoError(t, err)
+	require.Len(t, resp.Events, 1)
+	require.Equal(t, "user2", resp.Events[0].Event.Attendees[0].UserId)
+	require.Equal(t, servicepb.AttendeeStatus_ATTENDEE_STATUS_ACCEPTED, resp.Events[0].Event.Attendees[0].Status)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRespondToInvitationGRPC(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo)
+	controller := event2.NewEventController(mockService)
+
+	eventID := uuid.New()
+	mockRepo.On("RespondToInvitation", mock.Anything, eventID, "user2", model.AttendeeDeclined).Return(nil)
+
+	ctx := auth.WithUserID(context.Background(), "user2")
+	req := &servicepb.RespondRequest{
+		UUID:   eventID.String(),
+		UserId: "user2",
+		Status: servicepb.AttendeeStatus_ATTENDEE_STATUS_DECLINED,
+	}
+	_, err := controller.RespondToInvitation(ctx, req)
+	require.NoError(t, err)
+
+	_, err = controller.RespondToInvitation(ctx, &servicepb.RespondRequest{
+		UUID:   eventID.String(),
+		UserId: "user2",
+	})
+	require.Error(t, err)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRespondToInvitationAsCaller(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo)
+	controller := event2.NewEventController(mockService)
+
+	// Без user_id отвечает вызывающий
+	eventID := uuid.New()
+	mockRepo.On("RespondToInvitation", mock.Anything, eventID, "user2", model.AttendeeAccepted).Return(nil)
+
+	_, err := controller.RespondToInvitation(auth.WithUserID(context.Background(), "user2"), &servicepb.RespondRequest{
+		UUID:   eventID.String(),
+		Status: servicepb.AttendeeStatus_ATTENDEE_STATUS_ACCEPTED,
+	})
+	require.NoError(t, err)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestAnonymousRequestsRejected(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	// Хранилище без ожиданий: любой вызов репозитория провалит тест
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo)
+	controller := event2.NewEventController(mockService)
+
+	ctx := context.Background()
+	info := &servicepb.EventInfo{
+		Title: "Test Event", StartTime: timestamppb.New(time.Now()), Duration: durationpb.New(time.Hour),
+	}
+	calls := map[string]func() error{
+		"CreateEvent": func() error {
+			_, err := controller.CreateEvent(ctx, &servicepb.CreateRequest{Event: info})
+			return err
+		},
+		"UpdateEvent": func() error {
+			_, err := controller.UpdateEvent(ctx, &servicepb.UpdateRequest{UUID: uuid.New().String(), Event: info})
+			return err
+		},
+		"DeleteEvent": func() error {
+			_, err := controller.DeleteEvent(ctx, &servicepb.DeleteRequest{UUID: uuid.New().String()})
+			return err
+		},
+		"GetDayEventList": func() error {
+			_, err := controller.GetDayEventList(ctx, &servicepb.GetRequest{Date: timestamppb.Now(), UserId: "user1"})
+			return err
+		},
+		"SearchEvents": func() error {
+			_, err := controller.SearchEvents(ctx, &servicepb.SearchRequest{Query: "budget"})
+			return err
+		},
+		"RespondToInvitation": func() error {
+			_, err := controller.RespondToInvitation(ctx, &servicepb.RespondRequest{
+				UUID: uuid.New().String(), UserId: "user1", Status: servicepb.AttendeeStatus_ATTENDEE_STATUS_ACCEPTED,
+			})
+			return err
+		},
+		"ListCalendars": func() error {
+			_, err := controller.ListCalendars(ctx, &servicepb.ListCalendarsRequest{UserId: "user1"})
+			return err
+		},
+		"ListNotifications": func() error {
+			_, err := controller.ListNotifications(ctx, &servicepb.ListNotificationsRequest{EventId: uuid.New().String()})
+			return err
+		},
+		"GetNotificationPreferences": func() error {
+			_, err := controller.GetNotificationPreferences(ctx, &servicepb.NotificationPreferencesRequest{})
+			return err
+		},
+		"UpdateNotificationPreferences": func() error {
+			_, err := controller.UpdateNotificationPreferences(ctx, &servicepb.UpdateNotificationPreferencesRequest{
+				Preferences: &servicepb.NotificationPreferences{},
+			})
+			return err
+		},
+		"DeleteNotificationPreferences": func() error {
+			_, err := controller.DeleteNotificationPreferences(ctx, &servicepb.NotificationPreferencesRequest{})
+			return err
+		},
+		"GetFreeBusy": func() error {
+			_, err := controller.GetFreeBusy(ctx, &servicepb.FreeBusyRequest{
+				UserIds: []string{"user1"}, From: timestamppb.Now(), To: timestamppb.New(time.Now().Add(time.Hour)),
+			})
+			return err
+		},
+	}
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, codes.Unauthenticated, apierror.Code(call()))
+		})
+	}
+}
+
+func TestUpdateEventClearCalendar(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo)
+	controller := event2.NewEventController(mockService)
+
+	calendarID := uuid.New()
+	mockRepo.On("GetEvent", mock.Anything, mock.AnythingOfType("uuid.UUID")).
+		Return(model.Event{UserID: "user1", CalendarID: calendarID}, nil)
+	mockRepo.On("GetCalendar", mock.Anything, calendarID).
+		Return(model.Calendar{ID: calendarID, OwnerID: "user1"}, nil)
+	mockRepo.On("UpdateEvent", mock.Anything, mock.AnythingOfType("uuid.UUID"), mock.MatchedBy(func(e model.Event) bool {
+		return e.CalendarID == uuid.Nil
+	})).Return(nil).Once()
+
+	ctx := auth.WithUserID(context.Background(), "user1")
+	info := &servicepb.EventInfo{
+		Title: "Test Event", StartTime: timestamppb.New(time.Now()), Duration: durationpb.New(time.Hour),
+	}
+	_, err := controller.UpdateEvent(ctx, &servicepb.UpdateRequest{
+		UUID: uuid.New().String(), Event: info, ClearCalendar: true,
+	})
+	require.NoError(t, err)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestBatchCreateEventsGRPC(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo)
+	controller := event2.NewEventController(mockService)
+
+	createdID := uuid.New()
+	mockRepo.On("BatchCreateEvents", mock.Anything,
+		mock.AnythingOfType("[]model.Event"), true).Return([]model.BatchResult{
+		{Index: 0, ID: createdID},
+		{Index: 1, Err: model.ErrDateBusy},
+		{Index: 2, Err: errors.New("repository.sql.CreateEvent: ERROR: relation \"event\" does not exist")},
+	}, nil)
+
+	req := &servicepb.BatchCreateRequest{
+		Events: []*servicepb.EventInfo{
+			{Title: "Event 1", StartTime: timestamppb.New(time.Now()), Duration: durationpb.New(time.Hour), UserId: "user1"},
+			{Title: "Event 2", StartTime: timestamppb.New(time.Now()), Duration: durationpb.New(time.Hour), UserId: "user1"},
+			{Title: "Event 3", StartTime: timestamppb.New(time.Now()), Duration: durationpb.New(time.Hour), UserId: "user1"},
+		},
+		AllOrNothing: true,
+	}
+	resp, err := controller.BatchCreateEvents(auth.WithUserID(context.Background(), "user1"), req)
+
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 3)
+	require.Equal(t, createdID.String(), resp.Results[0].UUID)
+	require.Empty(t, resp.Results[0].Error)
+	require.Empty(t, resp.Results[0].Code)
+	require.Equal(t, model.ErrDateBusy.Error(), resp.Results[1].Error)
+	require.Equal(t, "ALREADY_EXISTS", resp.Results[1].Code)
+	// Текст непредвиденной ошибки клиенту не раскрывается
+	require.Equal(t, "internal error", resp.Results[2].Error)
+	require.Equal(t, "INTERNAL", resp.Results[2].Code)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestBatchUpdateEventsAuthorizesEachItem(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo)
+	controller := event2.NewEventController(mockService)
+
+	ownID, foreignCalendar := uuid.New(), uuid.New()
+	mockRepo.On("GetEvent", mock.Anything, ownID).Return(model.Event{ID: ownID, UserID: "user1"}, nil)
+	mockRepo.On("GetCalendar", mock.Anything, foreignCalendar).
+		Return(model.Calendar{ID: foreignCalendar, OwnerID: "user2"}, nil)
+	mockRepo.On("BatchUpdateEvents", mock.Anything, mock.MatchedBy(func(updates []model.EventUpdate) bool {
+		return len(updates) == 1 && updates[0].Event.UserID == "user1"
+	}), false).Return([]model.BatchResult{{Index: 0, ID: ownID}}, nil).Once()
+
+	ctx := auth.WithUserID(context.Background(), "user1")
+	info := func(userID, calendarID string) *servicepb.EventInfo {
+		return &servicepb.EventInfo{
+			Title: "Test Event", StartTime: timestamppb.New(time.Now()), Duration: durationpb.New(time.Hour),
+			UserId: userID, CalendarId: calendarID,
+		}
+	}
+
+	// Владелец не указан и указан чужой: в хранилище уходит прежний владелец
+	_, err := controller.BatchUpdateEvents(ctx, &servicepb.BatchUpdateRequest{
+		Events: []*servicepb.UpdateRequest{{UUID: ownID.String(), Event: info("user2", "")}},
+	})
+	require.NoError(t, err)
+
+	// Перенос в календарь, куда вызывающий не может писать, отклоняет пакет
+	_, err = controller.BatchUpdateEvents(ctx, &servicepb.BatchUpdateRequest{
+		Events: []*servicepb.UpdateRequest{{UUID: ownID.String(), Event: info("", foreignCalendar.String())}},
+	})
+	require.Equal(t, codes.PermissionDenied, apierror.Code(err))
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestBatchDeleteEventsInvalidUUID(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo)
+	controller := event2.NewEventController(mockService)
+
+	req := &servicepb.BatchDeleteRequest{UUIDs: []string{uuid.New().String(), "not-a-uuid"}}
+	_, err := controller.BatchDeleteEvents(context.Background(), req)
+
+	require.Error(t, err)
+	mockRepo.AssertNotCalled(t, "BatchDeleteEvents", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestShareCalendarNotOwner(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo)
+	controller := event2.NewEventController(mockService)
+
+	calendarID := uuid.New()
+	mockRepo.On("GetCalendar", mock.Anything, calendarID).
+		Return(model.Calendar{ID: calendarID, OwnerID: "user1", Name: "work"}, nil)
+
+	ctx := auth.WithUserID(context.Background(), "user2")
+	_, err := controller.ShareCalendar(ctx, &servicepb.ShareCalendarRequest{
+		UUID:       calendarID.String(),
+		UserId:     "user3",
+		Permission: servicepb.SharePermission_SHARE_PERMISSION_READ,
+	})
+	require.Equal(t, codes.PermissionDenied, apierror.Code(err))
+
+	mockRepo.AssertNotCalled(t, "ShareCalendar", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCalendarEventListFreeBusy(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo)
+	controller := event2.NewEventController(mockService)
+
+	calendarID := uuid.New()
+	mockRepo.On("GetCalendar", mock.Anything, calendarID).Return(model.Calendar{
+		ID:      calendarID,
+		OwnerID: "user1",
+		Shares:  []model.CalendarShare{{UserID: "user2", Permission: model.PermissionFreeBusy}},
+	}, nil)
+	mockRepo.On("GetCalendarEvents", mock.Anything, calendarID,
+		mock.AnythingOfType("time.Time"), mock.AnythingOfType("int")).Return([]model.Event{{
+		ID:          uuid.New(),
+		Title:       "Salary review",
+		Description: "confidential",
+		UserID:      "user1",
+		CalendarID:  calendarID,
+	}}, nil)
+
+	req := &servicepb.GetRequest{
+		Date:       timestamppb.New(time.Now()),
+		CalendarId: calendarID.String(),
+	}
+
+	resp, err := controller.GetDayEventList(auth.WithUserID(context.Background(), "user2"), req)
+	require.NoError(t, err)
+	require.Len(t, resp.Events, 1)
+	require.Equal(t, "busy", resp.Events[0].Event.Title)
+	require.Empty(t, resp.Events[0].Event.Description)
+
+	_, err = controller.GetDayEventList(auth.WithUserID(context.Background(), "user3"), req)
+	require.Equal(t, codes.PermissionDenied, apierror.Code(err))
+}
+
+func TestGetFreeBusyRequiresSharedCalendar(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo)
+	controller := event2.NewEventController(mockService)
+
+	from := time.Date(2024, time.January, 15, 9, 0, 0, 0, time.UTC)
+	to := from.Add(8 * time.Hour)
+	shared, readOnly := uuid.New(), uuid.New()
+	mockRepo.On("ListCalendars", mock.Anything, "user2").Return([]model.Calendar{
+		{ID: shared, OwnerID: "user1", Shares: []model.CalendarShare{
+			{UserID: "user2", Permission: model.PermissionFreeBusy},
+		}},
+		{ID: readOnly, OwnerID: "user3", Shares: []model.CalendarShare{
+			{UserID: "user4", Permission: model.PermissionRead},
+		}},
+		{ID: uuid.New(), OwnerID: "user2"},
+	}, nil)
+	mockRepo.On("GetCalendarBusyIntervals", mock.Anything, []uuid.UUID{shared}, from, to).
+		Return([]model.Interval{{Start: from, End: from.Add(time.Hour)}}, nil)
+	mockRepo.On("GetBusyIntervals", mock.Anything, []string{"user2"}, from, to).
+		Return(map[string][]model.Interval{"user2": {{Start: from.Add(2 * time.Hour), End: from.Add(3 * time.Hour)}}}, nil)
+
+	ctx := auth.WithUserID(context.Background(), "user2")
+	req := &servicepb.FreeBusyRequest{
+		UserIds: []string{"user1", "user2"}, From: timestamppb.New(from), To: timestamppb.New(to),
+	}
+	resp, err := controller.GetFreeBusy(ctx, req)
+	require.NoError(t, err)
+	require.Len(t, resp.Users, 2)
+	for _, user := range resp.Users {
+		require.Len(t, user.Busy, 1, user.UserId)
+	}
+
+	// Календарь user3 не открыт вызывающему
+	req.UserIds = []string{"user3"}
+	_, err = controller.GetFreeBusy(ctx, req)
+	require.Equal(t, codes.PermissionDenied, apierror.Code(err))
+
+	req.UserIds = make([]string, model.MaxFreeBusyUsers+1)
+	_, err = controller.GetFreeBusy(ctx, req)
+	require.Equal(t, codes.InvalidArgument, apierror.Code(err))
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestSearchEventsGRPC(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo)
+	controller := event2.NewEventController(mockService)
+
+	mockRepo.On("SearchEvents", mock.Anything, model.SearchQuery{
+		Text:   "budget",
+		UserID: "user1",
+		Limit:  model.DefaultSearchLimit,
+	}).Return(model.SearchPage{
+		Results: []model.SearchResult{{Event: model.Event{ID: uuid.New(), Title: "Budget review"}, Rank: 0.6}},
+		Total:   1,
+	}, nil)
+
+	ctx := auth.WithUserID(context.Background(), "user1")
+	resp, err := controller.SearchEvents(ctx, &servicepb.SearchRequest{Query: "budget", UserId: "user1"})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, resp.Total)
+	require.Equal(t, "Budget review", resp.Results[0].Event.Event.Title)
+
+	_, err = controller.SearchEvents(ctx, &servicepb.SearchRequest{Query: "  "})
+	require.Equal(t, codes.InvalidArgument, apierror.Code(err))
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreateEventValidation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo)
+	controller := event2.NewEventController(mockService)
+
+	req := &servicepb.CreateRequest{
+		Event: &servicepb.EventInfo{
+			Title:        " ",
+			Duration:     durationpb.New(-time.Hour),
+			NotifyBefore: durationpb.New(400 * 24 * time.Hour),
+			UserId:       "user 1",
+			// Канал напоминания обязателен, неизвестный канал не заменяется каналом по умолчанию
+			Reminders: []*servicepb.Reminder{
+				{Offset: durationpb.New(time.Hour)},
+				{Offset: durationpb.New(time.Hour), Channel: servicepb.ReminderChannel(42)},
+			},
+		},
+	}
+	_, err := controller.CreateEvent(context.Background(), req)
+
+	st := apierror.ToStatus(err)
+	require.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 1)
+	badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+	require.True(t, ok)
+
+	var fields []string
+	for _, v := range badRequest.GetFieldViolations() {
+		fields = append(fields, v.GetField())
+	}
+	require.ElementsMatch(t, []string{
+		"event.title", "event.start_time", "event.duration", "event.user_id", "event.notify_before",
+		"event.reminders[0].channel", "event.reminders[1].channel",
+	}, fields)
+
+	mockRepo.AssertNotCalled(t, "CreateEvent", mock.Anything, mock.Anything)
+}
+
+func TestFindFreeSlotsValidation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo)
+	controller := event2.NewEventController(mockService)
+
+	from := time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC)
+	req := &servicepb.FindFreeSlotsRequest{
+		UserIds:      make([]string, model.MaxFreeBusyUsers+1),
+		From:         timestamppb.New(from),
+		To:           timestamppb.New(from.AddDate(0, 0, 1)),
+		Duration:     durationpb.New(time.Second),
+		WorkDayStart: durationpb.New(18 * time.Hour),
+		WorkDayEnd:   durationpb.New(9 * time.Hour),
+		TimeZone:     "Mars/Olympus",
+		Limit:        -1,
+	}
+	_, err := controller.FindFreeSlots(context.Background(), req)
+
+	st := apierror.ToStatus(err)
+	require.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 1)
+	badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+	require.True(t, ok)
+
+	var fields []string
+	for _, v := range badRequest.GetFieldViolations() {
+		fields = append(fields, v.GetField())
+	}
+	require.ElementsMatch(t, []string{"time_zone", "duration", "work_day_end", "limit", "user_ids"}, fields)
+
+	mockRepo.AssertNotCalled(t, "GetBusyIntervals", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDeleteEventNotFound(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo)
+	controller := event2.NewEventController(mockService)
+
+	mockRepo.On("GetEvent", mock.Anything, mock.AnythingOfType("uuid.UUID")).
+		Return(model.Event{}, model.ErrEventNotFound)
+
+	ctx := auth.WithUserID(context.Background(), "user1")
+	_, err := controller.DeleteEvent(ctx, &servicepb.DeleteRequest{UUID: uuid.New().String()})
+	require.Equal(t, codes.NotFound, apierror.Code(err))
+
+	mockRepo.AssertNotCalled(t, "DeleteEvent", mock.Anything, mock.Anything)
+}
+
+func TestCreateEventQuotaExceeded(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo)
+	controller := event2.NewEventController(mockService)
+
+	// Квоту проверяет хранилище в той же транзакции, что и вставку
+	mockRepo.On("CreateEvent", mock.Anything, mock.AnythingOfType("model.Event")).
+		Return(uuid.Nil, model.ErrQuotaExceeded)
+
+	req := &servicepb.CreateRequest{
+		Event: &servicepb.EventInfo{
+			Title:     "Test Event",
+			StartTime: timestamppb.New(time.Now()),
+			Duration:  durationpb.New(time.Hour),
+			UserId:    "user1",
+		},
+	}
+	_, err := controller.CreateEvent(auth.WithUserID(context.Background(), "user1"), req)
+	require.Equal(t, codes.ResourceExhausted, apierror.Code(err))
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreateEventIdempotencyKey(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo)
+	controller := event2.NewEventController(mockService)
+
+	createdID := uuid.New()
+	mockRepo.On("CreateEventIdempotent", mock.Anything, mock.MatchedBy(func(key model.IdempotencyKey) bool {
+		return key.Key == "retry-1" && key.UserID == "user1" && key.RequestHash != ""
+	}), mock.AnythingOfType("model.Event")).Return(createdID, true, nil)
+
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs(event2.IdempotencyKeyMetadata, "retry-1", auth.MetadataKey, "user1"))
+	resp, err := controller.CreateEvent(ctx, &servicepb.CreateRequest{
+		Event: &servicepb.EventInfo{
+			Title:     "Test Event",
+			StartTime: timestamppb.New(time.Now()),
+			Duration:  durationpb.New(time.Hour),
+			UserId:    "user1",
+		},
+	})
+
+	require.NoError(t, err)
+	require.Equal(t, createdID.String(), resp.UUID)
+	mockRepo.AssertNotCalled(t, "CreateEvent", mock.Anything, mock.Anything)
+}
+
+func TestListJobRunsAdminOnly(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo, calendar.WithAdmins([]string{"admin"}))
+	controller := event2.NewEventController(mockService)
+
+	startedAt := time.Date(2024, time.September, 2, 3, 0, 0, 0, time.UTC)
+	mockRepo.On("ListJobRuns", mock.Anything, model.JobRunFilter{Job: "cleanup", Limit: model.DefaultJobRunLimit}).
+		Return([]model.JobRun{{
+			Job:       "cleanup",
+			StartedAt: startedAt,
+			Duration:  2 * time.Second,
+			Status:    model.JobRunFailed,
+			Error:     "timeout",
+		}}, nil)
+
+	req := &servicepb.ListJobRunsRequest{Job: "cleanup"}
+	_, err := controller.ListJobRuns(auth.WithUserID(context.Background(), "user1"), req)
+	require.Equal(t, codes.PermissionDenied, apierror.Code(err))
+
+	resp, err := controller.ListJobRuns(auth.WithUserID(context.Background(), "admin"), req)
+	require.NoError(t, err)
+	require.Len(t, resp.GetRuns(), 1)
+	run := resp.GetRuns()[0]
+	require.Equal(t, servicepb.JobRunStatus_JOB_RUN_STATUS_FAILED, run.GetStatus())
+	require.Equal(t, startedAt, run.GetStartedAt().AsTime())
+	require.Equal(t, 2*time.Second, run.GetDuration().AsDuration())
+	require.Equal(t, "timeout", run.GetError())
+}
+
+func TestListNotifications(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo)
+	controller := event2.NewEventController(mockService)
+
+	eventID := uuid.New()
+	queuedAt := time.Date(2024, time.September, 2, 9, 45, 0, 0, time.UTC)
+	mockRepo.On("GetEvent", mock.Anything, eventID).Return(model.Event{ID: eventID, UserID: "user1"}, nil)
+	// Уведомления о событии всегда ограничены его владельцем
+	mockRepo.On("ListNotifications", mock.Anything, model.NotificationFilter{
+		OwnerID: "user1", EventID: eventID, Limit: model.DefaultNotificationLimit,
+	}).Return([]model.NotificationRecord{{
+		ID:          uuid.New(),
+		EventID:     eventID,
+		OwnerID:     "user1",
+		RecipientID: "user2",
+		Channel:     model.ChannelEmail,
+		Delivery:    model.DeliveryOnTime,
+		Status:      model.NotificationFailed,
+		Attempts:    3,
+		LastError:   "smtp timeout",
+		QueuedAt:    queuedAt,
+		UpdatedAt:   queuedAt.Add(time.Minute),
+	}}, nil)
+
+	// Чужую историю смотреть нельзя
+	_, err := controller.ListNotifications(auth.WithUserID(context.Background(), "user2"),
+		&servicepb.ListNotificationsRequest{UserId: "user1"})
+	require.Equal(t, codes.PermissionDenied, apierror.Code(err))
+	_, err = controller.ListNotifications(auth.WithUserID(context.Background(), "user2"),
+		&servicepb.ListNotificationsRequest{EventId: eventID.String()})
+	require.Equal(t, codes.PermissionDenied, apierror.Code(err))
+
+	resp, err := controller.ListNotifications(auth.WithUserID(context.Background(), "user1"),
+		&servicepb.ListNotificationsRequest{EventId: eventID.String()})
+	require.NoError(t, err)
+	require.Len(t, resp.GetNotifications(), 1)
+	n := resp.GetNotifications()[0]
+	require.Equal(t, servicepb.NotificationStatus_NOTIFICATION_STATUS_FAILED, n.GetStatus())
+	require.Equal(t, servicepb.ReminderChannel_REMINDER_CHANNEL_EMAIL, n.GetChannel())
+	require.Equal(t, "user2", n.GetRecipientId())
+	require.Equal(t, int32(3), n.GetAttempts())
+	require.Equal(t, "smtp timeout", n.GetLastError())
+	require.Equal(t, queuedAt, n.GetQueuedAt().AsTime())
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	mockRepo := new(MockStorage)
+	mockService := calendar.NewEventService(*logger, mockRepo)
+	controller := event2.NewEventController(mockService)
+	ctx := auth.WithUserID(context.Background(), "user1")
+
+	// Настроек нет - возвращаются настройки по умолчанию
+	mockRepo.On("GetNotificationPreferences", mock.Anything, "user1").
+		Return(model.NotificationPreferences{}, model.ErrPreferencesNotFound)
+	resp, err := controller.GetNotificationPreferences(ctx, &servicepb.NotificationPreferencesRequest{})
+	require.NoError(t, err)
+	require.Equal(t, "user1", resp.GetUserId())
+	require.Equal(t, servicepb.NotificationMode_NOTIFICATION_MODE_INDIVIDUAL, resp.GetMode())
+
+	_, err = controller.GetNotificationPreferences(ctx, &servicepb.NotificationPreferencesRequest{UserId: "user2"})
+	require.Equal(t, codes.PermissionDenied, apierror.Code(err))
+
+	_, err = controller.UpdateNotificationPreferences(ctx, &servicepb.UpdateNotificationPreferencesRequest{
+		Preferences: &servicepb.NotificationPreferences{
+			TimeZone:   "Mars/Olympus",
+			QuietHours: &servicepb.QuietHours{Start: "25:00"},
+		},
+	})
+	require.Equal(t, codes.InvalidArgument, apierror.Code(err))
+	require.ErrorContains(t, err, "preferences.time_zone")
+	require.ErrorContains(t, err, "preferences.quiet_hours.start")
+
+	prefs := model.NotificationPreferences{
+		UserID:     "user1",
+		Channels:   []model.ReminderChannel{model.ChannelPush},
+		TimeZone:   "Europe/Moscow",
+		Locale:     "ru",
+		QuietHours: model.QuietHours{Start: 22 * time.Hour, End: 7*time.Hour + 30*time.Minute},
+		Mode:       model.ModeDigest,
+		Agenda:     model.DailyAgenda{Enabled: true, At: 8 * time.Hour},
+	}
+	mockRepo.On("SaveNotificationPreferences", mock.Anything, prefs).Return(nil)
+	resp, err = controller.UpdateNotificationPreferences(ctx, &servicepb.UpdateNotificationPreferencesRequest{
+		Preferences: &servicepb.NotificationPreferences{
+			Channels:   []servicepb.ReminderChannel{servicepb.ReminderChannel_REMINDER_CHANNEL_PUSH},
+			TimeZone:   "Europe/Moscow",
+			QuietHours: &servicepb.QuietHours{Start: "22:00", End: "07:30"},
+			Mode:       servicepb.NotificationMode_NOTIFICATION_MODE_DIGEST,
+			AgendaTime: "08:00",
+			Locale:     "ru",
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "user1", resp.GetUserId())
+	require.Equal(t, "22:00", resp.GetQuietHours().GetStart())
+	require.Equal(t, "07:30", resp.GetQuietHours().GetEnd())
+	require.Equal(t, "08:00", resp.GetAgendaTime())
+	require.Equal(t, "ru", resp.GetLocale())
+	mockRepo.AssertCalled(t, "SaveNotificationPreferences", mock.Anything, prefs)
+
+	// Сброс несуществующих настроек не ошибка
+	mockRepo.On("DeleteNotificationPreferences", mock.Anything, "user1").Return(model.ErrPreferencesNotFound)
+	_, err = controller.DeleteNotificationPreferences(ctx, &servicepb.NotificationPreferencesRequest{})
+	require.NoError(t, err)
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// MetadataKey - ключ метаданных gRPC (и HTTP-заголовок X-User-Id),
+// через который клиент передаёт идентификатор пользователя.
+//
+// Заголовок задаёт сам клиент, поэтому без клиентских сертификатов ему можно доверять,
+// только если сервис стоит за доверенным прокси, который аутентифицирует пользователя
+// и перезаписывает X-User-Id. При проверенном клиентском сертификате пользователем
+// считается его CN, см. ResolveIdentity.
+const MetadataKey = "x-user-id"
+
+// ErrIdentityMismatch - X-User-Id не совпадает с именем из клиентского сертификата.
+var ErrIdentityMismatch = errors.New("x-user-id does not match client certificate")
+
+type userIDKey struct{}
+
+// WithUserID возвращает контекст, в котором вызывающим считается userID.
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+// UserIDFromContext возвращает идентификатор вызывающего пользователя: сначала
+// из значения, положенного WithUserID, затем из входящих метаданных запроса.
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	if userID, ok := ctx.Value(userIDKey{}).(string); ok && userID != "" {
+		return userID, true
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	for _, v := range md.Get(MetadataKey) {
+		if userID := strings.TrimSpace(v); userID != "" {
+			return userID, true
+		}
+	}
+	return "", false
+}
+
+// CertificateIdentity возвращает имя клиента (CN) из проверенного клиентского сертификата.
+// В отличие от X-User-Id его нельзя подменить.
+func CertificateIdentity(state *tls.ConnectionState) (string, bool) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	name := state.VerifiedChains[0][0].Subject.CommonName
+	return name, name != ""
+}
+
+// ResolveIdentity определяет вызывающего пользователя. С проверенным клиентским сертификатом
+// это его CN, а переданный клиентом X-User-Id (claimed) должен быть пустым или совпадать с ним.
+// Без сертификата возвращается первый непустой claimed - см. оговорку у MetadataKey.
+func ResolveIdentity(state *tls.ConnectionState, claimed []string) (string, error) {
+	identity, verified := CertificateIdentity(state)
+	for _, v := range claimed {
+		userID := strings.TrimSpace(v)
+		switch {
+		case userID == "":
+			continue
+		case !verified:
+			return userID, nil
+		case userID != identity:
+			return "", ErrIdentityMismatch
+		}
+	}
+	return identity, nil
+}
@@ -0,0 +1,107 @@
+// Package clock абстрагирует текущее время и таймеры, чтобы логику, зависящую
+// от времени, можно было тестировать детерминированно с Fake.
+package clock
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Clock - источник текущего времени и таймеров.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer - аналог time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker - аналог time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+	Reset(d time.Duration)
+}
+
+// Real - системные часы.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// Since возвращает время, прошедшее с t по часам c.
+func Since(c Clock, t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// WithTimeout - context.WithTimeout, отсчитывающий время по часам c.
+func WithTimeout(parent context.Context, c Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := c.(realClock); ok {
+		return context.WithTimeout(parent, d)
+	}
+
+	inner, cancel := context.WithCancel(parent)
+	ctx := &timeoutCtx{Context: inner, deadline: c.Now().Add(d)}
+	timer := c.NewTimer(d)
+	go func() {
+		select {
+		case <-timer.C():
+			ctx.expired.Store(true)
+			cancel()
+		case <-inner.Done():
+			timer.Stop()
+		}
+	}()
+	return ctx, cancel
+}
+
+// timeoutCtx - контекст, истекающий по таймеру Clock.
+type timeoutCtx struct {
+	context.Context
+	deadline time.Time
+	expired  atomic.Bool
+}
+
+func (c *timeoutCtx) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+func (c *timeoutCtx) Err() error {
+	if c.expired.Load() {
+		return context.DeadlineExceeded
+	}
+	return c.Context.Err()
+}
@@ -0,0 +1,151 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake - управляемые вручную часы для тестов. Время стоит на месте, пока его
+// не сдвинут Advance или Set; таймеры и тикеры срабатывают при сдвиге.
+type Fake struct {
+	mu      sync.Mutex
+	changed *sync.Cond
+	now     time.Time
+	waiters map[*fakeTimer]struct{}
+}
+
+var _ Clock = (*Fake)(nil)
+
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now, waiters: make(map[*fakeTimer]struct{})}
+	f.changed = sync.NewCond(&f.mu)
+	return f
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{clock: f, ch: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	t := &fakeTimer{clock: f, ch: make(chan time.Time, 1), period: d}
+	t.Reset(d)
+	return fakeTicker{t}
+}
+
+// Advance сдвигает время на d, по порядку срабатывая все таймеры и тикеры,
+// время которых наступило.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.advanceTo(f.now.Add(d))
+}
+
+// Set переводит часы на t. Перевод назад таймеры не срабатывает.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if t.Before(f.now) {
+		f.now = t
+		return
+	}
+	f.advanceTo(t)
+}
+
+// BlockUntil ждет, пока не будет взведено не меньше n таймеров и тикеров.
+// Позволяет дождаться, что проверяемый код дошел до ожидания, без sleep.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.changed.Wait()
+	}
+}
+
+func (f *Fake) advanceTo(end time.Time) {
+	for {
+		var next *fakeTimer
+		for t := range f.waiters {
+			if !t.when.After(end) && (next == nil || t.when.Before(next.when)) {
+				next = t
+			}
+		}
+		if next == nil {
+			break
+		}
+
+		f.now = next.when
+		// Как и у time.Ticker, непрочитанное срабатывание не копится
+		select {
+		case next.ch <- f.now:
+		default:
+		}
+		if next.period > 0 {
+			next.when = next.when.Add(next.period)
+		} else {
+			delete(f.waiters, next)
+		}
+	}
+	f.now = end
+	f.changed.Broadcast()
+}
+
+type fakeTimer struct {
+	clock  *Fake
+	ch     chan time.Time
+	when   time.Time
+	period time.Duration
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	_, active := t.clock.waiters[t]
+	delete(t.clock.waiters, t)
+	t.clock.changed.Broadcast()
+	return active
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	f := t.clock
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, active := f.waiters[t]
+	if t.period > 0 {
+		t.period = d
+	}
+	t.when = f.now.Add(d)
+	f.waiters[t] = struct{}{}
+	// Таймер с неположительной длительностью срабатывает сразу
+	if d <= 0 {
+		f.advanceTo(f.now)
+	}
+	f.changed.Broadcast()
+	return active
+}
+
+type fakeTicker struct {
+	*fakeTimer
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
+
+func (t fakeTicker) Reset(d time.Duration) {
+	t.fakeTimer.Reset(d)
+}
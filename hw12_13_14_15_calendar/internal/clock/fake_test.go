@@ -0,0 +1,97 @@
+package clock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2024, time.September, 2, 12, 0, 0, 0, time.UTC)
+
+func fired(ch <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-ch:
+		return t, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestFakeTimer(t *testing.T) {
+	c := NewFake(start)
+	timer := c.NewTimer(time.Minute)
+
+	c.Advance(59 * time.Second)
+	_, ok := fired(timer.C())
+	require.False(t, ok)
+
+	c.Advance(time.Second)
+	at, ok := fired(timer.C())
+	require.True(t, ok)
+	require.Equal(t, start.Add(time.Minute), at)
+	require.False(t, timer.Stop())
+
+	require.False(t, timer.Reset(time.Second))
+	require.True(t, timer.Stop())
+	c.Advance(time.Hour)
+	_, ok = fired(timer.C())
+	require.False(t, ok)
+}
+
+func TestFakeTicker(t *testing.T) {
+	c := NewFake(start)
+	ticker := c.NewTicker(10 * time.Second)
+
+	c.Advance(10 * time.Second)
+	at, ok := fired(ticker.C())
+	require.True(t, ok)
+	require.Equal(t, start.Add(10*time.Second), at)
+
+	// Непрочитанные срабатывания не копятся
+	c.Advance(time.Minute)
+	_, ok = fired(ticker.C())
+	require.True(t, ok)
+	_, ok = fired(ticker.C())
+	require.False(t, ok)
+	require.Equal(t, start.Add(70*time.Second), c.Now())
+
+	ticker.Reset(time.Hour)
+	c.Advance(time.Minute)
+	_, ok = fired(ticker.C())
+	require.False(t, ok)
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	c := NewFake(start)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-c.NewTimer(time.Minute).C()
+	}()
+
+	c.BlockUntil(1)
+	c.Advance(time.Minute)
+	<-done
+}
+
+func TestWithTimeout(t *testing.T) {
+	c := NewFake(start)
+	ctx, cancel := WithTimeout(context.Background(), c, time.Minute)
+	defer cancel()
+
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok)
+	require.Equal(t, start.Add(time.Minute), deadline)
+
+	c.BlockUntil(1)
+	c.Advance(time.Minute)
+	<-ctx.Done()
+	require.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+
+	ctx, cancel = WithTimeout(context.Background(), c, time.Minute)
+	cancel()
+	<-ctx.Done()
+	require.ErrorIs(t, ctx.Err(), context.Canceled)
+}
@@ -2,69 +2,293 @@ package config
 
 import (
 	"fmt"
-	"log"
-	"os"
 	"time"
 
-	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
 )
 
+// Config - настройки сервисов календаря. Любое поле можно переопределить
+// переменной окружения CALENDAR_<СЕКЦИЯ>_<ПОЛЕ>, например CALENDAR_DATABASE_HOST,
+// кроме правил scheduler.retention.calendars и users; полный список выводит флаг -help-env.
 type Config struct {
-	Env            string     `yaml:"env" env-default:"local" env-required:"true"`
-	DefaultStorage string     `yaml:"default_storage" env-default:"in-memory" env-required:"true"`
-	HTTPServer     HTTPServer `yaml:"http_server"`
-	GRPCServer     GRPCServer `yaml:"grpc_server"`
-	Database       Database   `yaml:"database"`
-	RabbitMQ       RabbitMQ   `yaml:"rabbitmq"`
-	Scheduler      Scheduler  `yaml:"scheduler"`
+	// Env - local, dev или prod.
+	Env            string `yaml:"env" env:"CALENDAR_ENV" env-default:"local"`
+	DefaultStorage string `yaml:"default_storage" env:"CALENDAR_DEFAULT_STORAGE" env-default:"in-memory"`
+	// LogLevel - debug, info, warn, error; пусто - по умолчанию для env. Перечитывается по SIGHUP.
+	LogLevel    string      `yaml:"log_level" env:"CALENDAR_LOG_LEVEL"`
+	HTTPServer  HTTPServer  `yaml:"http_server" env-prefix:"CALENDAR_HTTP_SERVER_"`
+	GRPCServer  GRPCServer  `yaml:"grpc_server" env-prefix:"CALENDAR_GRPC_SERVER_"`
+	Database    Database    `yaml:"database" env-prefix:"CALENDAR_DATABASE_"`
+	Queue       Queue       `yaml:"queue" env-prefix:"CALENDAR_QUEUE_"`
+	RabbitMQ    RabbitMQ    `yaml:"rabbitmq" env-prefix:"CALENDAR_RABBITMQ_"`
+	Scheduler   Scheduler   `yaml:"scheduler" env-prefix:"CALENDAR_SCHEDULER_"`
+	Sender      Sender      `yaml:"sender" env-prefix:"CALENDAR_SENDER_"`
+	RateLimit   RateLimit   `yaml:"rate_limit" env-prefix:"CALENDAR_RATE_LIMIT_"`
+	Idempotency Idempotency `yaml:"idempotency" env-prefix:"CALENDAR_IDEMPOTENCY_"`
+	Admin       Admin       `yaml:"admin" env-prefix:"CALENDAR_ADMIN_"`
 }
 
+const (
+	StorageInMemory = "in-memory"
+	StorageSQL      = "sql"
+)
+
 type Database struct {
-	Host     string `yaml:"host" env-required:"true"`
-	Port     string `yaml:"port" env-required:"true"`
-	Username string `yaml:"username" env-required:"true"`
-	Password string `yaml:"password" env-required:"true"`
-	DBName   string `yaml:"dbname" env-required:"true"`
+	Host     string `yaml:"host" env:"HOST"`
+	Port     string `yaml:"port" env:"PORT"`
+	Username string `yaml:"username" env:"USERNAME"`
+	Password string `yaml:"password" env:"PASSWORD"`
+	DBName   string `yaml:"dbname" env:"DBNAME"`
+	// SSLMode - режим sslmode libpq: disable, allow, prefer, require, verify-ca, verify-full.
+	// Сертификаты берутся из секции tls (ca_file, cert_file, key_file), enabled не учитывается.
+	SSLMode string `yaml:"sslmode" env:"SSLMODE" env-default:"disable"`
+	TLS     TLS    `yaml:"tls" env-prefix:"TLS_"`
 }
 
 type HTTPServer struct {
-	Host        string        `yaml:"host" env-default:"localhost"`
-	Port        string        `yaml:"port" env-default:"8081"`
-	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
-	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	Host        string        `yaml:"host" env:"HOST" env-default:"localhost"`
+	Port        string        `yaml:"port" env:"PORT" env-default:"8081"`
+	Timeout     time.Duration `yaml:"timeout" env:"TIMEOUT" env-default:"4s"`
+	IdleTimeout time.Duration `yaml:"idle_timeout" env:"IDLE_TIMEOUT" env-default:"60s"`
+	TLS         TLS           `yaml:"tls" env-prefix:"TLS_"`
+	// Gateway - как HTTP gateway обращается к API: loopback, in-process, single-port.
+	Gateway string `yaml:"gateway" env:"GATEWAY" env-default:"loopback"`
+	// Docs - отдавать описание API /openapi.json и Swagger UI /docs.
+	Docs bool `yaml:"docs" env:"DOCS" env-default:"true"`
 }
 
+const (
+	// GatewayLoopback - gateway подключается к собственному gRPC-серверу как клиент.
+	GatewayLoopback = "loopback"
+	// GatewayInProcess - gateway вызывает контроллер напрямую, gRPC-сервер
+	// по-прежнему слушает свой порт для внешних клиентов.
+	GatewayInProcess = "in-process"
+	// GatewaySinglePort - gRPC и HTTP обслуживаются на порту HTTP-сервера,
+	// отдельный порт gRPC не открывается.
+	GatewaySinglePort = "single-port"
+)
+
 type GRPCServer struct {
-	Host string `yaml:"host" env-default:"localhost"`
-	Port string `yaml:"port" env-default:"50051"`
+	Host string `yaml:"host" env:"HOST" env-default:"localhost"`
+	Port string `yaml:"port" env:"PORT" env-default:"50051"`
+	TLS  TLS    `yaml:"tls" env-prefix:"TLS_"`
+	// ClientTLS - настройки подключения HTTP gateway к gRPC-серверу.
+	ClientTLS TLS `yaml:"client_tls" env-prefix:"CLIENT_TLS_"`
+}
+
+// Брокеры сообщений между планировщиком и отправителем.
+const (
+	QueueRabbitMQ = "rabbitmq"
+	QueueNATS     = "nats"
+	// QueueMemory - очереди в памяти процесса, для разработки и тестов: планировщик
+	// сам запускает отправителя, отдельный calendar_sender не нужен.
+	QueueMemory = "memory"
+)
+
+// Queue - брокер сообщений; настройки RabbitMQ - в секции rabbitmq.
+type Queue struct {
+	Type string `yaml:"type" env:"TYPE" env-default:"rabbitmq"`
+	NATS NATS   `yaml:"nats" env-prefix:"NATS_"`
+}
+
+// NATS - подключение к NATS с включённым JetStream (nats-server -js): очереди хранятся
+// в потоках на сервере. Логин и пароль, если нужны, указываются в URL.
+type NATS struct {
+	URL string `yaml:"url" env:"URL" env-default:"nats://localhost:4222"`
+	TLS TLS    `yaml:"tls" env-prefix:"TLS_"`
 }
 
 type RabbitMQ struct {
-	Host     string `yaml:"host" env-default:"localhost"`
-	Port     string `yaml:"port" env-default:"5672"`
-	Username string `yaml:"username" env-required:"true"`
-	Password string `yaml:"password" env-required:"true"`
+	Host     string `yaml:"host" env:"HOST" env-default:"localhost"`
+	Port     string `yaml:"port" env:"PORT" env-default:"5672"`
+	Username string `yaml:"username" env:"USERNAME"`
+	Password string `yaml:"password" env:"PASSWORD"`
+	// При включенном TLS подключение идет по amqps://
+	TLS TLS `yaml:"tls" env-prefix:"TLS_"`
+	// ReconnectBackoff - задержка перед первой попыткой переподключения, дальше вдвое больше,
+	// но не больше MaxReconnectBackoff.
+	ReconnectBackoff    time.Duration `yaml:"reconnect_backoff" env:"RECONNECT_BACKOFF" env-default:"500ms"`
+	MaxReconnectBackoff time.Duration `yaml:"max_reconnect_backoff" env:"MAX_RECONNECT_BACKOFF" env-default:"30s"`
+	// PublishBuffer - сколько сообщений хранить, пока нет связи с брокером.
+	PublishBuffer int `yaml:"publish_buffer" env:"PUBLISH_BUFFER" env-default:"1000"`
+}
+
+// TLS - настройки TLS для сервера или клиента. Файлы сертификата, ключа и CA
+// перечитываются при изменении, перезапуск сервиса не нужен.
+type TLS struct {
+	Enabled  bool   `yaml:"enabled" env:"ENABLED"`
+	CertFile string `yaml:"cert_file" env:"CERT_FILE"`
+	KeyFile  string `yaml:"key_file" env:"KEY_FILE"`
+	// CAFile - для сервера CA клиентских сертификатов, для клиента CA сервера.
+	CAFile string `yaml:"ca_file" env:"CA_FILE"`
+	// ClientAuth - только для сервера: none, request, require, verify_if_given, require_and_verify.
+	// CN проверенного клиентского сертификата становится идентификатором пользователя.
+	ClientAuth string `yaml:"client_auth" env:"CLIENT_AUTH" env-default:"none"`
+	// ServerName и InsecureSkipVerify - только для клиента.
+	ServerName         string `yaml:"server_name" env:"SERVER_NAME"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" env:"INSECURE_SKIP_VERIFY"`
+}
+
+// VerifiesClients сообщает, что сервер проверяет клиентские сертификаты и знает пользователя
+// по CN. Иначе пользователь берётся из X-User-Id, который задаёт клиент или прокси.
+func (t TLS) VerifiesClients() bool {
+	return t.Enabled && t.verifiesClients()
+}
+
+func (t TLS) verifiesClients() bool {
+	return t.ClientAuth == "verify_if_given" || t.ClientAuth == "require_and_verify"
+}
+
+// RateLimit - ограничения частоты запросов к API. Нулевой rps отключает
+// соответствующее ограничение, нулевой max_events_per_user - квоту на события.
+type RateLimit struct {
+	// PerUser - по вызывающему пользователю: CN проверенного клиентского сертификата, без mTLS -
+	// X-User-Id, которому можно доверять только за доверенным прокси.
+	PerUser          Limit `yaml:"per_user" env-prefix:"PER_USER_"`
+	PerIP            Limit `yaml:"per_ip" env-prefix:"PER_IP_"`
+	MaxEventsPerUser int   `yaml:"max_events_per_user" env:"MAX_EVENTS_PER_USER" env-default:"0"`
+}
+
+type Idempotency struct {
+	// TTL - сколько хранится результат запроса с ключом идемпотентности.
+	TTL time.Duration `yaml:"ttl" env:"TTL" env-default:"24h"`
+}
+
+type Limit struct {
+	RPS   float64 `yaml:"rps" env:"RPS"`
+	Burst int     `yaml:"burst" env:"BURST"`
 }
 
+// Scheduler - расписания задач планировщика, перечитываются по SIGHUP.
 type Scheduler struct {
-	LaunchFrequency time.Duration `yaml:"launch_frequency" env-default:"1m"`
+	// LaunchFrequency - период отправки напоминаний, если не задан reminders.schedule.
+	LaunchFrequency time.Duration `yaml:"launch_frequency" env:"LAUNCH_FREQUENCY" env-default:"1m"`
+	Reminders       Job           `yaml:"reminders" env-prefix:"REMINDERS_"`
+	Cleanup         Job           `yaml:"cleanup" env-prefix:"CLEANUP_"`
+	Agenda          Job           `yaml:"agenda" env-prefix:"AGENDA_"`
+	CatchUp         CatchUp       `yaml:"catch_up" env-prefix:"CATCH_UP_"`
+	Retention       Retention     `yaml:"retention" env-prefix:"RETENTION_"`
+	// DigestInterval - как часто уходят дайджесты напоминаний пользователям в режиме digest.
+	DigestInterval time.Duration `yaml:"digest_interval" env:"DIGEST_INTERVAL" env-default:"1h"`
+	// HealthPort - порт HTTP-проверки /healthz подключения к брокеру; пусто - проверка выключена.
+	HealthPort string `yaml:"health_port" env:"HEALTH_PORT"`
 }
 
-func MustLoad(configPath string) *Config {
-	if configPath == "" {
-		log.Fatal("CONFIG_PATH environment variable not set")
+// CatchUp - обработка напоминаний о событиях, начавшихся, пока планировщик не работал.
+type CatchUp struct {
+	// Policy - send_late (отправить), send_missed (отправить с пометкой о пропуске)
+	// или skip (не отправлять); применяется к событиям, начавшимся не раньше grace назад.
+	Policy string `yaml:"policy" env:"POLICY" env-default:"send_late"`
+	// Grace - сколько после начала события напоминание ещё обрабатывается по policy,
+	// более старые пропускаются.
+	Grace time.Duration `yaml:"grace" env:"GRACE" env-default:"1h"`
+}
+
+// Retention - сроки хранения событий, которые удаляет задача cleanup.
+type Retention struct {
+	// MaxAge - событие удаляется, когда с его начала прошло больше max_age.
+	// 0 заменяется значением по умолчанию, бессрочное хранение задается только в calendars и users.
+	MaxAge time.Duration `yaml:"max_age" env:"MAX_AGE" env-default:"8760h"`
+	// KeepWithAttendees - не удалять события с приглашёнными участниками.
+	KeepWithAttendees bool `yaml:"keep_with_attendees" env:"KEEP_WITH_ATTENDEES"`
+	// DryRun - ничего не удалять, только записать в лог и историю задачи, что было бы удалено.
+	DryRun bool `yaml:"dry_run" env:"DRY_RUN"`
+	// Calendars и Users - правила для календарей (по id) и владельцев событий, задаются только в файле.
+	// Правило заменяет общее целиком, правило календаря важнее правила владельца.
+	Calendars map[string]RetentionRule `yaml:"calendars"`
+	Users     map[string]RetentionRule `yaml:"users"`
+}
+
+// RetentionRule - правило хранения для календаря или пользователя; max_age 0 - хранить бессрочно.
+type RetentionRule struct {
+	MaxAge            time.Duration `yaml:"max_age"`
+	KeepWithAttendees bool          `yaml:"keep_with_attendees"`
+}
+
+// Policy преобразует настройки в model.RetentionPolicy.
+func (r Retention) Policy() (model.RetentionPolicy, error) {
+	policy := model.RetentionPolicy{
+		Default:   model.RetentionRule{MaxAge: r.MaxAge, KeepWithAttendees: r.KeepWithAttendees},
+		Calendars: make(map[uuid.UUID]model.RetentionRule, len(r.Calendars)),
+		Users:     make(map[string]model.RetentionRule, len(r.Users)),
+		DryRun:    r.DryRun,
+	}
+	for id, rule := range r.Calendars {
+		calendarID, err := uuid.Parse(id)
+		if err != nil {
+			return model.RetentionPolicy{}, fmt.Errorf("calendar %q: %w", id, err)
+		}
+		policy.Calendars[calendarID] = model.RetentionRule(rule)
+	}
+	for userID, rule := range r.Users {
+		policy.Users[userID] = model.RetentionRule(rule)
+	}
+	return policy, nil
+}
+
+const (
+	// DefaultCleanupSchedule - расписание удаления старых событий по умолчанию.
+	DefaultCleanupSchedule = "@daily"
+	// DefaultAgendaSchedule - как часто проверяется, кому пора отправить сводку.
+	DefaultAgendaSchedule = "*/5 * * * *"
+)
+
+// Job - настройки задачи планировщика.
+type Job struct {
+	// Schedule - выражение cron ("*/5 * * * *", "@daily", "@every 30s").
+	Schedule string `yaml:"schedule" env:"SCHEDULE"`
+	// Jitter - случайная задержка запуска до указанной величины.
+	Jitter time.Duration `yaml:"jitter" env:"JITTER"`
+	// Timeout ограничивает один запуск; 0 - без ограничения.
+	Timeout time.Duration `yaml:"timeout" env:"TIMEOUT"`
+}
+
+// RemindersSchedule возвращает расписание напоминаний с учетом launch_frequency.
+func (s Scheduler) RemindersSchedule() string {
+	if s.Reminders.Schedule != "" {
+		return s.Reminders.Schedule
 	}
-	dir, _ := os.Getwd()
-	fmt.Println(dir)
+	return "@every " + s.LaunchFrequency.String()
+}
 
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		log.Fatal("config file does not exist")
+// CleanupSchedule возвращает расписание удаления старых событий.
+func (s Scheduler) CleanupSchedule() string {
+	if s.Cleanup.Schedule != "" {
+		return s.Cleanup.Schedule
 	}
+	return DefaultCleanupSchedule
+}
 
-	var cfg Config
-	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
-		log.Fatal("cannot read config file: ", err)
+// AgendaSchedule возвращает расписание отправки ежедневных сводок.
+func (s Scheduler) AgendaSchedule() string {
+	if s.Agenda.Schedule != "" {
+		return s.Agenda.Schedule
 	}
+	return DefaultAgendaSchedule
+}
+
+// Sender - доставка уведомлений отправителем.
+type Sender struct {
+	// MaxAttempts - сколько раз пытаться доставить уведомление, прежде чем отметить его failed.
+	MaxAttempts int `yaml:"max_attempts" env:"MAX_ATTEMPTS" env-default:"3"`
+	// RetryBackoff - задержка перед первым повтором, каждая следующая вдвое больше.
+	RetryBackoff time.Duration `yaml:"retry_backoff" env:"RETRY_BACKOFF" env-default:"1s"`
+	Templates    Templates     `yaml:"templates" env-prefix:"TEMPLATES_"`
+	// HealthPort - порт HTTP-проверки /healthz подключения к брокеру; пусто - проверка выключена.
+	HealthPort string `yaml:"health_port" env:"HEALTH_PORT"`
+}
+
+// Templates - шаблоны текста уведомлений.
+type Templates struct {
+	// Dir - каталог с шаблонами <язык>/<вид>[.<канал>].<txt|html>.tmpl, которые заменяют
+	// и дополняют встроенные; пусто - только встроенные.
+	Dir string `yaml:"dir" env:"DIR"`
+	// DefaultLocale - язык, если у получателя он не задан или для него нет шаблонов.
+	DefaultLocale string `yaml:"default_locale" env:"DEFAULT_LOCALE" env-default:"en"`
+}
 
-	return &cfg
+// Admin - пользователи с доступом к служебным методам API, например истории задач планировщика.
+type Admin struct {
+	Users []string `yaml:"users" env:"USERS"`
 }
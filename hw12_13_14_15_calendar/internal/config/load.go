@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+	"gopkg.in/yaml.v3"
+)
+
+// redacted заменяет секреты при выводе конфигурации.
+const redacted = "******"
+
+// Load читает файл конфигурации, применяет переменные окружения и проверяет результат.
+// Ошибки проверки возвращаются все сразу.
+func Load(configPath string) (*Config, error) {
+	if configPath == "" {
+		return nil, fmt.Errorf("config path is not set")
+	}
+
+	var cfg Config
+	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
+		return nil, fmt.Errorf("cannot read config file: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s:\n%w", configPath, err)
+	}
+	return &cfg, nil
+}
+
+// MustLoad - Load, завершающий программу при ошибке.
+func MustLoad(configPath string) *Config {
+	cfg, err := Load(configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return cfg
+}
+
+// Redacted возвращает копию конфигурации без паролей.
+func (c Config) Redacted() Config {
+	if c.Database.Password != "" {
+		c.Database.Password = redacted
+	}
+	if c.RabbitMQ.Password != "" {
+		c.RabbitMQ.Password = redacted
+	}
+	c.Queue.NATS.URL = stripUserinfo(c.Queue.NATS.URL)
+	return c
+}
+
+// stripUserinfo убирает логин, пароль и токен из списка адресов через запятую.
+func stripUserinfo(urls string) string {
+	servers := strings.Split(urls, ",")
+	for i, server := range servers {
+		u, err := url.Parse(strings.TrimSpace(server))
+		if err != nil {
+			// Адрес не разобрать - выводить его целиком небезопасно
+			servers[i] = redacted
+			continue
+		}
+		if u.User != nil {
+			u.User = nil
+			servers[i] = u.String()
+		}
+	}
+	return strings.Join(servers, ",")
+}
+
+// Print выводит итоговую конфигурацию в YAML без паролей.
+func Print(w io.Writer, cfg *Config) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// EnvVar - переменная окружения, переопределяющая поле конфигурации.
+type EnvVar struct {
+	Name    string
+	Field   string
+	Type    string
+	Default string
+}
+
+// EnvVars перечисляет переменные окружения для всех полей Config.
+func EnvVars() []EnvVar {
+	var vars []EnvVar
+	collectEnvVars(reflect.TypeOf(Config{}), "", "", &vars)
+	return vars
+}
+
+func collectEnvVars(t reflect.Type, envPrefix, fieldPrefix string, vars *[]EnvVar) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		field := fieldPrefix + f.Tag.Get("yaml")
+		if f.Type.Kind() == reflect.Struct && f.Type != reflect.TypeOf(time.Time{}) {
+			collectEnvVars(f.Type, envPrefix+f.Tag.Get("env-prefix"), field+".", vars)
+			continue
+		}
+		// Поля без тега env задаются только в файле
+		if f.Tag.Get("env") == "" {
+			continue
+		}
+		*vars = append(*vars, EnvVar{
+			Name:    envPrefix + f.Tag.Get("env"),
+			Field:   field,
+			Type:    f.Type.String(),
+			Default: f.Tag.Get("env-default"),
+		})
+	}
+}
+
+// PrintEnv выводит таблицу переменных окружения, переопределяющих настройки.
+func PrintEnv(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VARIABLE\tFIELD\tTYPE\tDEFAULT")
+	for _, v := range EnvVars() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", v.Name, v.Field, v.Type, v.Default)
+	}
+	return tw.Flush()
+}
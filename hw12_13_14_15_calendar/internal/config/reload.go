@@ -0,0 +1,35 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// WatchReload перечитывает конфигурацию по SIGHUP, пока не отменен ctx, и передает
+// ее в apply. Конфигурация с ошибками не применяется. apply должен менять только
+// настройки, безопасные для изменения на ходу: уровень логирования, частоту планировщика.
+func WatchReload(ctx context.Context, configPath string, logger slog.Logger, apply func(*Config)) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(sighup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sighup:
+				cfg, err := Load(configPath)
+				if err != nil {
+					logger.Error("failed to reload config", "err", err)
+					continue
+				}
+				apply(cfg)
+				logger.Info("config reloaded", "path", configPath)
+			}
+		}
+	}()
+}
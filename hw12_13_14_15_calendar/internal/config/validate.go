@@ -0,0 +1,216 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/cron"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+)
+
+var (
+	envs            = []string{"local", "dev", "prod"}
+	storages        = []string{StorageInMemory, StorageSQL}
+	logLevels       = []string{"", "debug", "info", "warn", "error"}
+	gateways        = []string{GatewayLoopback, GatewayInProcess, GatewaySinglePort}
+	queueTypes      = []string{"", QueueRabbitMQ, QueueNATS, QueueMemory}
+	sslModes        = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+	clientAuthModes = []string{"", "none", "request", "require", "verify_if_given", "require_and_verify"}
+	catchUpPolicies = []string{
+		"", string(model.CatchUpSendLate), string(model.CatchUpSendMissed), string(model.CatchUpSkip),
+	}
+)
+
+// FieldError - ошибка одного поля конфигурации; Field - путь в YAML, например database.host.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// validator собирает ошибки всех полей, чтобы вернуть их одним списком.
+type validator struct {
+	errs []error
+}
+
+func (v *validator) add(field, format string, args ...any) {
+	v.errs = append(v.errs, &FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) oneOf(field, value string, allowed []string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.add(field, "unknown value %q, expected one of %q", value, allowed)
+}
+
+func (v *validator) required(field, value string) {
+	if value == "" {
+		v.add(field, "is required")
+	}
+}
+
+func (v *validator) port(field, value string) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		v.add(field, "must be a port number, got %q", value)
+	}
+}
+
+func (v *validator) positive(field string, value time.Duration) {
+	if value <= 0 {
+		v.add(field, "must be positive, got %s", value)
+	}
+}
+
+// Validate проверяет конфигурацию целиком и возвращает все найденные ошибки
+// через errors.Join; каждая ошибка - *FieldError.
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.oneOf("env", c.Env, envs)
+	v.oneOf("default_storage", c.DefaultStorage, storages)
+	v.oneOf("log_level", c.LogLevel, logLevels)
+
+	v.port("http_server.port", c.HTTPServer.Port)
+	v.positive("http_server.timeout", c.HTTPServer.Timeout)
+	v.positive("http_server.idle_timeout", c.HTTPServer.IdleTimeout)
+	v.oneOf("http_server.gateway", c.HTTPServer.Gateway, gateways)
+	v.serverTLS("http_server.tls", c.HTTPServer.TLS)
+
+	v.port("grpc_server.port", c.GRPCServer.Port)
+	v.serverTLS("grpc_server.tls", c.GRPCServer.TLS)
+	v.clientTLS("grpc_server.client_tls", c.GRPCServer.ClientTLS)
+
+	// База нужна только для sql-хранилища
+	if c.DefaultStorage == StorageSQL {
+		v.required("database.host", c.Database.Host)
+		v.port("database.port", c.Database.Port)
+		v.required("database.username", c.Database.Username)
+		v.required("database.dbname", c.Database.DBName)
+		v.oneOf("database.sslmode", c.Database.SSLMode, sslModes)
+		if (c.Database.TLS.CertFile == "") != (c.Database.TLS.KeyFile == "") {
+			v.add("database.tls", "cert_file and key_file must be set together")
+		}
+	}
+
+	// Проверяются настройки только выбранного брокера
+	v.oneOf("queue.type", c.Queue.Type, queueTypes)
+	switch c.Queue.Type {
+	case "", QueueRabbitMQ:
+		v.required("rabbitmq.host", c.RabbitMQ.Host)
+		v.port("rabbitmq.port", c.RabbitMQ.Port)
+		v.required("rabbitmq.username", c.RabbitMQ.Username)
+		v.required("rabbitmq.password", c.RabbitMQ.Password)
+		v.clientTLS("rabbitmq.tls", c.RabbitMQ.TLS)
+		v.positive("rabbitmq.reconnect_backoff", c.RabbitMQ.ReconnectBackoff)
+		if c.RabbitMQ.MaxReconnectBackoff < c.RabbitMQ.ReconnectBackoff {
+			v.add("rabbitmq.max_reconnect_backoff", "must not be less than reconnect_backoff")
+		}
+		if c.RabbitMQ.PublishBuffer < 1 {
+			v.add("rabbitmq.publish_buffer", "must be at least 1, got %d", c.RabbitMQ.PublishBuffer)
+		}
+	case QueueNATS:
+		v.required("queue.nats.url", c.Queue.NATS.URL)
+		v.clientTLS("queue.nats.tls", c.Queue.NATS.TLS)
+	}
+
+	if c.Scheduler.Reminders.Schedule == "" {
+		v.positive("scheduler.launch_frequency", c.Scheduler.LaunchFrequency)
+	}
+	v.job("scheduler.reminders", c.Scheduler.Reminders)
+	v.job("scheduler.cleanup", c.Scheduler.Cleanup)
+	v.job("scheduler.agenda", c.Scheduler.Agenda)
+	v.oneOf("scheduler.catch_up.policy", c.Scheduler.CatchUp.Policy, catchUpPolicies)
+	if c.Scheduler.CatchUp.Grace < 0 {
+		v.add("scheduler.catch_up.grace", "must not be negative")
+	}
+	v.retention("scheduler.retention", c.Scheduler.Retention)
+	v.positive("scheduler.digest_interval", c.Scheduler.DigestInterval)
+	if c.Scheduler.HealthPort != "" {
+		v.port("scheduler.health_port", c.Scheduler.HealthPort)
+	}
+	if c.Sender.MaxAttempts < 1 {
+		v.add("sender.max_attempts", "must be at least 1, got %d", c.Sender.MaxAttempts)
+	}
+	v.positive("sender.retry_backoff", c.Sender.RetryBackoff)
+	if c.Sender.HealthPort != "" {
+		v.port("sender.health_port", c.Sender.HealthPort)
+	}
+	v.limit("rate_limit.per_user", c.RateLimit.PerUser)
+	v.limit("rate_limit.per_ip", c.RateLimit.PerIP)
+	if c.RateLimit.MaxEventsPerUser < 0 {
+		v.add("rate_limit.max_events_per_user", "must not be negative")
+	}
+	v.positive("idempotency.ttl", c.Idempotency.TTL)
+
+	return errors.Join(v.errs...)
+}
+
+func (v *validator) serverTLS(field string, tls TLS) {
+	v.oneOf(field+".client_auth", tls.ClientAuth, clientAuthModes)
+	if !tls.Enabled {
+		return
+	}
+	v.required(field+".cert_file", tls.CertFile)
+	v.required(field+".key_file", tls.KeyFile)
+	if tls.verifiesClients() {
+		v.required(field+".ca_file", tls.CAFile)
+	}
+}
+
+func (v *validator) clientTLS(field string, tls TLS) {
+	if tls.Enabled && (tls.CertFile == "") != (tls.KeyFile == "") {
+		v.add(field, "cert_file and key_file must be set together")
+	}
+}
+
+func (v *validator) job(field string, job Job) {
+	if job.Schedule != "" {
+		if _, err := cron.Parse(job.Schedule); err != nil {
+			v.add(field+".schedule", "%s", err)
+		}
+	}
+	if job.Jitter < 0 {
+		v.add(field+".jitter", "must not be negative")
+	}
+	if job.Timeout < 0 {
+		v.add(field+".timeout", "must not be negative")
+	}
+}
+
+func (v *validator) retention(field string, r Retention) {
+	if r.MaxAge < 0 {
+		v.add(field+".max_age", "must not be negative")
+	}
+	for id, rule := range r.Calendars {
+		if _, err := uuid.Parse(id); err != nil {
+			v.add(field+".calendars", "invalid calendar id %q", id)
+		}
+		if rule.MaxAge < 0 {
+			v.add(field+".calendars."+id+".max_age", "must not be negative")
+		}
+	}
+	for userID, rule := range r.Users {
+		if rule.MaxAge < 0 {
+			v.add(field+".users."+userID+".max_age", "must not be negative")
+		}
+	}
+}
+
+func (v *validator) limit(field string, limit Limit) {
+	if limit.RPS < 0 {
+		v.add(field+".rps", "must not be negative")
+	}
+	if limit.Burst < 0 {
+		v.add(field+".burst", "must not be negative")
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	desc "github.com/milov52/hw12_13_14_15_calendar/pkg/api/event/v1"
+)
+
+var sharePermissions = map[desc.SharePermission]model.Permission{
+	desc.SharePermission_SHARE_PERMISSION_FREE_BUSY: model.PermissionFreeBusy,
+	desc.SharePermission_SHARE_PERMISSION_READ:      model.PermissionRead,
+	desc.SharePermission_SHARE_PERMISSION_WRITE:     model.PermissionWrite,
+}
+
+func PermissionFromReq(permission desc.SharePermission) (model.Permission, error) {
+	p, ok := sharePermissions[permission]
+	if !ok {
+		return model.PermissionNone, model.ErrInvalidPermission
+	}
+	return p, nil
+}
+
+func PermissionToResp(permission model.Permission) desc.SharePermission {
+	for k, v := range sharePermissions {
+		if v == permission {
+			return k
+		}
+	}
+	return desc.SharePermission_SHARE_PERMISSION_UNSPECIFIED
+}
+
+func CalendarFromReq(calendar *desc.CalendarInfo) model.Calendar {
+	return model.Calendar{
+		OwnerID:     calendar.GetOwnerId(),
+		Name:        calendar.GetName(),
+		Description: calendar.GetDescription(),
+	}
+}
+
+func CalendarToResp(c model.Calendar) *desc.UserCalendar {
+	info := &desc.CalendarInfo{
+		Name:        c.Name,
+		Description: c.Description,
+		OwnerId:     c.OwnerID,
+	}
+	for _, share := range c.Shares {
+		info.Shares = append(info.Shares, &desc.CalendarShare{
+			UserId:     share.UserID,
+			Permission: PermissionToResp(share.Permission),
+		})
+	}
+	return &desc.UserCalendar{Id: c.ID.String(), Calendar: info}
+}
+
+func CalendarsToResp(cs []model.Calendar) *desc.ListCalendarsResponse {
+	resp := &desc.ListCalendarsResponse{}
+	for _, c := range cs {
+		resp.Calendars = append(resp.Calendars, CalendarToResp(c))
+	}
+	return resp
+}
@@ -1,22 +1,155 @@
 package server
 
 import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/api/apierror"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
 	desc "github.com/milov52/hw12_13_14_15_calendar/pkg/api/event/v1"
 	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// EventFromReq преобразует запрос в событие и проверяет его.
+// Ошибка проверки имеет тип *model.ValidationError.
 func EventFromReq(event *desc.EventInfo) (*model.Event, error) {
-	return &model.Event{
+	verr := &model.ValidationError{}
+	calendarID, err := optionalID(event.GetCalendarId())
+	if err != nil {
+		verr.Add("calendar_id", "must be a valid UUID")
+	}
+
+	e := &model.Event{
 		Title:        event.GetTitle(),
-		StartTime:    event.GetStartTime().AsTime(),
 		Duration:     event.GetDuration().AsDuration(),
 		Description:  event.GetDescription(),
 		UserID:       event.GetUserId(),
 		NotifyBefore: event.GetNotifyBefore().AsDuration(),
 		Sent:         event.GetSent(),
-	}, nil
+		Attendees:    AttendeesFromReq(event.GetAttendees()),
+		CalendarID:   calendarID,
+	}
+	e.Reminders, err = RemindersFromReq(event.GetReminders())
+	verr.Merge("", err)
+	// AsTime для пустого значения вернул бы 1970-01-01, а не нулевое время
+	if event.GetStartTime() != nil {
+		e.StartTime = event.GetStartTime().AsTime()
+	}
+
+	verr.Merge("", e.Validate())
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func FilterFromReq(req *desc.GetRequest) (model.EventFilter, error) {
+	calendarID, err := optionalID(req.GetCalendarId())
+	if err != nil {
+		return model.EventFilter{}, err
+	}
+	return model.EventFilter{UserID: req.GetUserId(), CalendarID: calendarID}, nil
+}
+
+// optionalID разбирает необязательный идентификатор: пустая строка - uuid.Nil.
+func optionalID(id string) (uuid.UUID, error) {
+	if id == "" {
+		return uuid.Nil, nil
+	}
+	return uuid.Parse(id)
+}
+
+var attendeeStatuses = map[desc.AttendeeStatus]model.AttendeeStatus{
+	desc.AttendeeStatus_ATTENDEE_STATUS_NEEDS_ACTION: model.AttendeeNeedsAction,
+	desc.AttendeeStatus_ATTENDEE_STATUS_ACCEPTED:     model.AttendeeAccepted,
+	desc.AttendeeStatus_ATTENDEE_STATUS_DECLINED:     model.AttendeeDeclined,
+	desc.AttendeeStatus_ATTENDEE_STATUS_TENTATIVE:    model.AttendeeTentative,
+}
+
+func AttendeeStatusFromReq(status desc.AttendeeStatus) (model.AttendeeStatus, error) {
+	s, ok := attendeeStatuses[status]
+	if !ok {
+		return "", model.ErrInvalidAttendeeStatus
+	}
+	return s, nil
+}
+
+func AttendeeStatusToResp(status model.AttendeeStatus) desc.AttendeeStatus {
+	for k, v := range attendeeStatuses {
+		if v == status {
+			return k
+		}
+	}
+	return desc.AttendeeStatus_ATTENDEE_STATUS_UNSPECIFIED
+}
+
+func AttendeesFromReq(attendees []*desc.Attendee) []model.Attendee {
+	var res []model.Attendee
+	for _, a := range attendees {
+		// Статус из запроса не используется: приглашённый отвечает сам
+		res = append(res, model.Attendee{UserID: a.GetUserId(), Status: model.AttendeeNeedsAction})
+	}
+	return res
+}
+
+func AttendeesToResp(attendees []model.Attendee) []*desc.Attendee {
+	var res []*desc.Attendee
+	for _, a := range attendees {
+		res = append(res, &desc.Attendee{UserId: a.UserID, Status: AttendeeStatusToResp(a.Status)})
+	}
+	return res
+}
+
+var reminderChannels = map[desc.ReminderChannel]model.ReminderChannel{
+	desc.ReminderChannel_REMINDER_CHANNEL_EMAIL: model.ChannelEmail,
+	desc.ReminderChannel_REMINDER_CHANNEL_SMS:   model.ChannelSMS,
+	desc.ReminderChannel_REMINDER_CHANNEL_PUSH:  model.ChannelPush,
+}
+
+func ReminderChannelToResp(channel model.ReminderChannel) desc.ReminderChannel {
+	for k, v := range reminderChannels {
+		if v == channel {
+			return k
+		}
+	}
+	return desc.ReminderChannel_REMINDER_CHANNEL_UNSPECIFIED
+}
+
+// RemindersFromReq преобразует напоминания запроса; канал обязателен и должен быть известен.
+// Ошибка имеет тип *model.ValidationError.
+func RemindersFromReq(reminders []*desc.Reminder) ([]model.Reminder, error) {
+	verr := &model.ValidationError{}
+	var res []model.Reminder
+	for i, r := range reminders {
+		channel, ok := reminderChannels[r.GetChannel()]
+		switch {
+		case r.GetChannel() == desc.ReminderChannel_REMINDER_CHANNEL_UNSPECIFIED:
+			verr.Add(fmt.Sprintf("reminders[%d].channel", i), "is required")
+		case !ok:
+			verr.Add(fmt.Sprintf("reminders[%d].channel", i), "is unknown")
+		}
+		res = append(res, model.Reminder{Offset: r.GetOffset().AsDuration(), Channel: channel})
+	}
+	return res, verr.Err()
+}
+
+func RemindersToResp(reminders []model.Reminder) []*desc.Reminder {
+	var res []*desc.Reminder
+	for _, r := range reminders {
+		reminder := &desc.Reminder{
+			Id:      r.ID.String(),
+			Offset:  durationpb.New(r.Offset),
+			Channel: ReminderChannelToResp(r.Channel),
+			Sent:    r.Sent,
+		}
+		if r.Sent {
+			reminder.SentAt = timestamppb.New(r.SentAt)
+		}
+		res = append(res, reminder)
+	}
+	return res
 }
 
 func EventToResp(e model.Event) *desc.Event {
@@ -30,10 +163,20 @@ func EventToResp(e model.Event) *desc.Event {
 			UserId:       e.UserID,
 			NotifyBefore: durationpb.New(e.NotifyBefore),
 			Sent:         e.Sent,
+			Attendees:    AttendeesToResp(e.Attendees),
+			Reminders:    RemindersToResp(e.Reminders),
+			CalendarId:   calendarIDToResp(e.CalendarID),
 		},
 	}
 }
 
+func calendarIDToResp(id uuid.UUID) string {
+	if id == uuid.Nil {
+		return ""
+	}
+	return id.String()
+}
+
 func EventsToResp(es []model.Event) *desc.GetResponse {
 	resp := &desc.GetResponse{}
 	for _, e := range es {
@@ -41,3 +184,91 @@ func EventsToResp(es []model.Event) *desc.GetResponse {
 	}
 	return resp
 }
+
+func BatchToResp(results []model.BatchResult) *desc.BatchResponse {
+	resp := &desc.BatchResponse{}
+	for _, r := range results {
+		item := &desc.BatchResult{Index: int32(r.Index)} //nolint:gosec
+		if r.ID != uuid.Nil {
+			item.UUID = r.ID.String()
+		}
+		if r.Err != nil {
+			// Ошибки элементов переводятся так же, как ошибки запросов: текст
+			// непредвиденных ошибок остаётся в логе сервиса
+			st := apierror.ToStatus(r.Err)
+			item.Code, item.Error = apierror.CodeName(st.Code()), st.Message()
+		}
+		resp.Results = append(resp.Results, item)
+	}
+	return resp
+}
+
+func IntervalsToResp(intervals []model.Interval) []*desc.TimeInterval {
+	res := make([]*desc.TimeInterval, 0, len(intervals))
+	for _, i := range intervals {
+		res = append(res, &desc.TimeInterval{Start: timestamppb.New(i.Start), End: timestamppb.New(i.End)})
+	}
+	return res
+}
+
+func FreeBusyToResp(userIDs []string, busy map[string][]model.Interval) *desc.FreeBusyResponse {
+	resp := &desc.FreeBusyResponse{}
+	for _, userID := range userIDs {
+		resp.Users = append(resp.Users, &desc.UserBusy{UserId: userID, Busy: IntervalsToResp(busy[userID])})
+	}
+	return resp
+}
+
+func SlotQueryFromReq(req *desc.FindFreeSlotsRequest) (model.SlotQuery, error) {
+	verr := &model.ValidationError{}
+	loc := time.UTC
+	if req.GetTimeZone() != "" {
+		var err error
+		if loc, err = time.LoadLocation(req.GetTimeZone()); err != nil {
+			verr.Add("time_zone", "is unknown")
+		}
+	}
+
+	query := model.SlotQuery{
+		UserIDs:  req.GetUserIds(),
+		From:     req.GetFrom().AsTime(),
+		To:       req.GetTo().AsTime(),
+		Duration: req.GetDuration().AsDuration(),
+		WorkingHours: model.WorkingHours{
+			Start:    req.GetWorkDayStart().AsDuration(),
+			End:      req.GetWorkDayEnd().AsDuration(),
+			Location: loc,
+		},
+		Limit: int(req.GetLimit()),
+	}
+	verr.Merge("", query.Validate())
+	return query, verr.Err()
+}
+
+func SearchQueryFromReq(req *desc.SearchRequest) model.SearchQuery {
+	query := model.SearchQuery{
+		Text:   req.GetQuery(),
+		UserID: req.GetUserId(),
+		Limit:  int(req.GetLimit()),
+		Offset: int(req.GetOffset()),
+	}
+	// Не заданные границы означают поиск без ограничения по времени
+	if req.GetFrom() != nil {
+		query.From = req.GetFrom().AsTime()
+	}
+	if req.GetTo() != nil {
+		query.To = req.GetTo().AsTime()
+	}
+	return query
+}
+
+func SearchToResp(page model.SearchPage) *desc.SearchResponse {
+	resp := &desc.SearchResponse{Total: int32(page.Total)}
+	for _, r := range page.Results {
+		resp.Results = append(resp.Results, &desc.SearchResult{
+			Event: EventToResp(r.Event),
+			Rank:  float32(r.Rank),
+		})
+	}
+	return resp
+}
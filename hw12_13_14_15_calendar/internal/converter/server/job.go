@@ -0,0 +1,29 @@
+package server
+
+import (
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	desc "github.com/milov52/hw12_13_14_15_calendar/pkg/api/event/v1"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var jobRunStatuses = map[model.JobRunStatus]desc.JobRunStatus{
+	model.JobRunSucceeded: desc.JobRunStatus_JOB_RUN_STATUS_SUCCEEDED,
+	model.JobRunFailed:    desc.JobRunStatus_JOB_RUN_STATUS_FAILED,
+	model.JobRunSkipped:   desc.JobRunStatus_JOB_RUN_STATUS_SKIPPED,
+}
+
+func JobRunsToResp(runs []model.JobRun) *desc.ListJobRunsResponse {
+	resp := &desc.ListJobRunsResponse{}
+	for _, run := range runs {
+		resp.Runs = append(resp.Runs, &desc.JobRun{
+			Job:       run.Job,
+			StartedAt: timestamppb.New(run.StartedAt),
+			Duration:  durationpb.New(run.Duration),
+			Status:    jobRunStatuses[run.Status],
+			Error:     run.Error,
+			Details:   run.Details,
+		})
+	}
+	return resp
+}
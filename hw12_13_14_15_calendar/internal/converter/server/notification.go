@@ -0,0 +1,39 @@
+package server
+
+import (
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	desc "github.com/milov52/hw12_13_14_15_calendar/pkg/api/event/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var notificationStatuses = map[model.NotificationStatus]desc.NotificationStatus{
+	model.NotificationQueued:    desc.NotificationStatus_NOTIFICATION_STATUS_QUEUED,
+	model.NotificationDelivered: desc.NotificationStatus_NOTIFICATION_STATUS_DELIVERED,
+	model.NotificationFailed:    desc.NotificationStatus_NOTIFICATION_STATUS_FAILED,
+	model.NotificationDeferred:  desc.NotificationStatus_NOTIFICATION_STATUS_DEFERRED,
+}
+
+func NotificationsToResp(records []model.NotificationRecord) *desc.ListNotificationsResponse {
+	resp := &desc.ListNotificationsResponse{}
+	for _, r := range records {
+		n := &desc.Notification{
+			Id:          r.ID.String(),
+			Kind:        string(r.Kind),
+			EventId:     r.EventID.String(),
+			ReminderId:  r.ReminderID.String(),
+			RecipientId: r.RecipientID,
+			Channel:     ReminderChannelToResp(r.Channel),
+			Delivery:    string(r.Delivery),
+			Status:      notificationStatuses[r.Status],
+			Attempts:    int32(r.Attempts),
+			LastError:   r.LastError,
+			QueuedAt:    timestamppb.New(r.QueuedAt),
+			UpdatedAt:   timestamppb.New(r.UpdatedAt),
+		}
+		if !r.SendAfter.IsZero() {
+			n.SendAfter = timestamppb.New(r.SendAfter)
+		}
+		resp.Notifications = append(resp.Notifications, n)
+	}
+	return resp
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	desc "github.com/milov52/hw12_13_14_15_calendar/pkg/api/event/v1"
+)
+
+const clockLayout = "15:04"
+
+var notificationModes = map[desc.NotificationMode]model.NotificationMode{
+	desc.NotificationMode_NOTIFICATION_MODE_INDIVIDUAL: model.ModeIndividual,
+	desc.NotificationMode_NOTIFICATION_MODE_DIGEST:     model.ModeDigest,
+}
+
+// PreferencesFromReq преобразует запрос в настройки уведомлений и проверяет их.
+// Ошибка проверки имеет тип *model.ValidationError.
+func PreferencesFromReq(prefs *desc.NotificationPreferences) (model.NotificationPreferences, error) {
+	verr := &model.ValidationError{}
+	p := model.NotificationPreferences{
+		UserID:   prefs.GetUserId(),
+		TimeZone: prefs.GetTimeZone(),
+		Locale:   prefs.GetLocale(),
+		Mode:     model.ModeIndividual,
+	}
+	for _, c := range prefs.GetChannels() {
+		// Неизвестный канал останется пустым и не пройдёт проверку
+		p.Channels = append(p.Channels, reminderChannels[c])
+	}
+	if mode := prefs.GetMode(); mode != desc.NotificationMode_NOTIFICATION_MODE_UNSPECIFIED {
+		p.Mode = notificationModes[mode]
+	}
+
+	var err error
+	if p.QuietHours.Start, err = clockFromReq(prefs.GetQuietHours().GetStart()); err != nil {
+		verr.Add("quiet_hours.start", err.Error())
+	}
+	if p.QuietHours.End, err = clockFromReq(prefs.GetQuietHours().GetEnd()); err != nil {
+		verr.Add("quiet_hours.end", err.Error())
+	}
+	if agenda := prefs.GetAgendaTime(); agenda != "" {
+		p.Agenda.Enabled = true
+		if p.Agenda.At, err = clockFromReq(agenda); err != nil {
+			verr.Add("agenda_time", err.Error())
+		}
+	}
+
+	verr.Merge("", p.Validate())
+	if err := verr.Err(); err != nil {
+		return model.NotificationPreferences{}, err
+	}
+	return p, nil
+}
+
+func PreferencesToResp(p model.NotificationPreferences) *desc.NotificationPreferences {
+	resp := &desc.NotificationPreferences{
+		UserId:   p.UserID,
+		TimeZone: p.TimeZone,
+		Locale:   p.Locale,
+		QuietHours: &desc.QuietHours{
+			Start: clockToResp(p.QuietHours.Start),
+			End:   clockToResp(p.QuietHours.End),
+		},
+	}
+	if p.Agenda.Enabled {
+		resp.AgendaTime = clockToResp(p.Agenda.At)
+	}
+	for _, c := range p.Channels {
+		resp.Channels = append(resp.Channels, ReminderChannelToResp(c))
+	}
+	for k, v := range notificationModes {
+		if v == p.Mode {
+			resp.Mode = k
+		}
+	}
+	return resp
+}
+
+// clockFromReq разбирает время HH:MM в смещение от полуночи; пусто - полночь.
+func clockFromReq(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	t, err := time.Parse(clockLayout, s)
+	if err != nil {
+		return 0, fmt.Errorf("must be in HH:MM format")
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func clockToResp(d time.Duration) string {
+	return time.Time{}.Add(d).Format(clockLayout)
+}
@@ -0,0 +1,192 @@
+// Package cron разбирает расписания в формате cron.
+//
+// Поддерживаются пять полей (минута, час, день месяца, месяц, день недели) со
+// списками, диапазонами и шагом: "*/15 * * * *", "0 9-18 * * 1-5", а также
+// сокращения @yearly, @monthly, @weekly, @daily, @hourly и @every <duration>.
+// Время вычисляется в зоне переданного в Next значения.
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSchedule = errors.New("invalid cron schedule")
+
+// Schedule вычисляет моменты запуска.
+type Schedule interface {
+	// Next возвращает первый момент запуска строго после t.
+	Next(t time.Time) time.Time
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// field - допустимые значения одного поля.
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = [5]field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	// 7 - тоже воскресенье
+	{"day of week", 0, 7},
+}
+
+// Parse разбирает выражение расписания.
+func Parse(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if rest, ok := strings.CutPrefix(expr, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%w %q: @every needs a positive duration", ErrInvalidSchedule, expr)
+		}
+		return Every(d), nil
+	}
+	if spec, ok := descriptors[expr]; ok {
+		expr = spec
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("%w %q: expected %d fields, got %d", ErrInvalidSchedule, expr, len(fields), len(parts))
+	}
+
+	var s specSchedule
+	sets := [5]*uint64{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+	for i, part := range parts {
+		bits, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %s: %w", ErrInvalidSchedule, expr, fields[i].name, err)
+		}
+		*sets[i] = bits
+	}
+	// Воскресенье хранится как 0
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = parts[2] == "*"
+	s.dowAny = parts[4] == "*"
+	return &s, nil
+}
+
+// parseField разбирает список элементов вида *, N, A-B с необязательным шагом /S.
+func parseField(value string, f field) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(value, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			from, to, _ := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = parseValue(from, f); err != nil {
+				return 0, err
+			}
+			if hi, err = parseValue(to, f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			v, err := parseValue(rangePart, f)
+			if err != nil {
+				return 0, err
+			}
+			// N/S означает от N до конца диапазона
+			lo, hi = v, v
+			if hasStep {
+				hi = f.max
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(value string, f field) (int, error) {
+	v, err := strconv.Atoi(value)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %q out of range %d-%d", value, f.min, f.max)
+	}
+	return v, nil
+}
+
+// specSchedule - расписание из пяти полей, значения хранятся битовыми масками.
+type specSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// Если заданы и день месяца, и день недели, достаточно совпадения любого из них
+	domAny, dowAny bool
+}
+
+// maxSearch ограничивает поиск для расписаний, которые никогда не срабатывают, например 30 февраля.
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+func (s *specSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *specSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Every - расписание с постоянным интервалом, отсчитываемым от предыдущего момента.
+type Every time.Duration
+
+func (e Every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
@@ -0,0 +1,68 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// 2 сентября 2024 - понедельник.
+func date(day, hour, minute int) time.Time {
+	return time.Date(2024, time.September, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", date(2, 10, 0), date(2, 10, 1)},
+		{"*/15 * * * *", date(2, 10, 7), date(2, 10, 15)},
+		{"5/20 * * * *", date(2, 10, 30), date(2, 10, 45)},
+		{"0 9-18/3 * * *", date(2, 13, 30), date(2, 15, 0)},
+		{"30 2 * * *", date(2, 10, 0), date(3, 2, 30)},
+		{"0 0 * * 6,7", date(2, 10, 0), date(7, 0, 0)},
+		{"0 0 * * 0", date(2, 10, 0), date(8, 0, 0)},
+		{"0 12 1 * *", date(2, 10, 0), time.Date(2024, time.October, 1, 12, 0, 0, 0, time.UTC)},
+		// День месяца или день недели
+		{"0 0 15 * 3", date(2, 10, 0), date(4, 0, 0)},
+		{"@daily", date(2, 10, 0), date(3, 0, 0)},
+		{"@hourly", date(2, 10, 59), date(2, 11, 0)},
+		{"@every 90s", date(2, 10, 0), date(2, 10, 0).Add(90 * time.Second)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := Parse(tt.expr)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, schedule.Next(tt.from))
+		})
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	schedule, err := Parse("0 0 30 2 *")
+	require.NoError(t, err)
+	require.True(t, schedule.Next(date(2, 0, 0)).IsZero())
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"a * * * *",
+		"@every",
+		"@every -1m",
+		"@sometimes",
+	} {
+		_, err := Parse(expr)
+		require.ErrorIs(t, err, ErrInvalidSchedule, expr)
+	}
+}
@@ -1,8 +1,10 @@
 package logger
 
 import (
+	"fmt"
 	"log/slog"
 	"os"
+	"strings"
 )
 
 const (
@@ -11,21 +13,43 @@ const (
 	envProd  = "prod"
 )
 
+// level - уровень логирования, общий для логгеров процесса. Меняется SetLevel
+// без пересоздания логгеров, например при перечитывании конфигурации.
+var level = new(slog.LevelVar)
+
 func SetupLogger(env string) *slog.Logger {
 	var log *slog.Logger
 	switch env {
-	case envLocal:
-		log = slog.New(
-			slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
-		)
-	case envDev:
+	case envLocal, envDev:
+		level.Set(slog.LevelDebug)
 		log = slog.New(
-			slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level}),
 		)
 	case envProd:
+		level.Set(slog.LevelInfo)
 		log = slog.New(
-			slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}),
+			slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level}),
 		)
 	}
 	return log
 }
+
+// SetLevel задает уровень логирования по имени: debug, info, warn, error.
+// Пустое имя возвращает уровень по умолчанию для env.
+func SetLevel(env, name string) error {
+	if name == "" {
+		if env == envProd {
+			level.Set(slog.LevelInfo)
+		} else {
+			level.Set(slog.LevelDebug)
+		}
+		return nil
+	}
+
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.ToUpper(name))); err != nil {
+		return fmt.Errorf("unknown log level %q", name)
+	}
+	level.Set(l)
+	return nil
+}
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// ErrBatchAborted возвращается для элементов пакета, которые не были применены,
+// потому что в режиме "всё или ничего" упал другой элемент.
+var ErrBatchAborted = errors.New("batch aborted")
+
+type EventUpdate struct {
+	ID    uuid.UUID
+	Event Event
+	// ClearCalendar убирает событие из календаря: пустой Event.CalendarID оставляет прежний календарь.
+	ClearCalendar bool
+}
+
+type BatchResult struct {
+	Index int
+	ID    uuid.UUID
+	Err   error
+}
+
+// AbortBatch проставляет ErrBatchAborted всем успешным элементам пакета.
+func AbortBatch(results []BatchResult) {
+	for i := range results {
+		if results[i].Err == nil {
+			results[i].Err = ErrBatchAborted
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrCalendarNotFound = errors.New("calendar not found")
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrUnauthenticated - запрос без идентификатора вызывающего пользователя.
+	ErrUnauthenticated   = errors.New("unauthenticated")
+	ErrInvalidPermission = errors.New("invalid share permission")
+)
+
+// Permission - уровень доступа к чужому календарю. Каждый следующий уровень
+// включает предыдущие: free-busy < read < write.
+type Permission string
+
+const (
+	PermissionNone     Permission = ""
+	PermissionFreeBusy Permission = "free-busy"
+	PermissionRead     Permission = "read"
+	PermissionWrite    Permission = "write"
+)
+
+var permissionLevels = map[Permission]int{
+	PermissionNone:     0,
+	PermissionFreeBusy: 1,
+	PermissionRead:     2,
+	PermissionWrite:    3,
+}
+
+func (p Permission) Valid() bool {
+	return p != PermissionNone && permissionLevels[p] > 0
+}
+
+// Allows сообщает, достаточно ли уровня p для действия, требующего required.
+func (p Permission) Allows(required Permission) bool {
+	return permissionLevels[p] >= permissionLevels[required]
+}
+
+type CalendarShare struct {
+	UserID     string
+	Permission Permission
+}
+
+type Calendar struct {
+	ID          uuid.UUID
+	OwnerID     string
+	Name        string
+	Description string
+	Shares      []CalendarShare
+}
+
+// PermissionFor возвращает уровень доступа пользователя к календарю.
+func (c Calendar) PermissionFor(userID string) Permission {
+	if c.OwnerID == userID {
+		return PermissionWrite
+	}
+	for _, share := range c.Shares {
+		if share.UserID == userID {
+			return share.Permission
+		}
+	}
+	return PermissionNone
+}
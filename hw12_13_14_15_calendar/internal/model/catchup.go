@@ -0,0 +1,76 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrInvalidCatchUpPolicy = errors.New("invalid catch-up policy")
+
+// CatchUpPolicy - что делать с напоминанием о событии, которое уже началось,
+// например потому что планировщик в это время не работал.
+type CatchUpPolicy string
+
+const (
+	// CatchUpSendLate - отправить как обычное напоминание.
+	CatchUpSendLate CatchUpPolicy = "send_late"
+	// CatchUpSendMissed - отправить с пометкой, что напоминание пропущено.
+	CatchUpSendMissed CatchUpPolicy = "send_missed"
+	// CatchUpSkip - не отправлять, отметить пропущенным.
+	CatchUpSkip CatchUpPolicy = "skip"
+
+	DefaultCatchUpPolicy = CatchUpSendLate
+	DefaultCatchUpGrace  = time.Hour
+)
+
+func ParseCatchUpPolicy(s string) (CatchUpPolicy, error) {
+	switch p := CatchUpPolicy(s); p {
+	case "":
+		return DefaultCatchUpPolicy, nil
+	case CatchUpSendLate, CatchUpSendMissed, CatchUpSkip:
+		return p, nil
+	}
+	return "", ErrInvalidCatchUpPolicy
+}
+
+// Delivery - как обработано напоминание.
+type Delivery string
+
+const (
+	DeliveryOnTime Delivery = "on_time"
+	DeliveryLate   Delivery = "late"
+	DeliveryMissed Delivery = "missed"
+	// DeliverySkipped - напоминание не отправлено и больше не будет.
+	DeliverySkipped Delivery = "skipped"
+)
+
+// Sent сообщает, уходит ли напоминание получателям.
+func (d Delivery) Sent() bool {
+	return d != DeliverySkipped
+}
+
+// CatchUp - правила обработки опоздавших напоминаний. Напоминание о событии,
+// которое ещё не началось, отправляется как обычно, сколько бы ни опоздало.
+// О начавшемся событии - по Policy, если оно началось не раньше чем Grace назад,
+// иначе пропускается.
+type CatchUp struct {
+	Policy CatchUpPolicy
+	Grace  time.Duration
+}
+
+// Delivery определяет, как обработать напоминание в момент now.
+func (c CatchUp) Delivery(n Notification, now time.Time) Delivery {
+	if n.Date.After(now) {
+		return DeliveryOnTime
+	}
+	if now.Sub(n.Date) > c.Grace {
+		return DeliverySkipped
+	}
+	switch c.Policy {
+	case CatchUpSendMissed:
+		return DeliveryMissed
+	case CatchUpSkip:
+		return DeliverySkipped
+	}
+	return DeliveryLate
+}
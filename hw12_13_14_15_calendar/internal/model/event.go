@@ -10,8 +10,34 @@ import (
 var (
 	ErrDateBusy      = errors.New("date is busy for this event")
 	ErrEventNotFound = errors.New("event not found")
+	ErrQuotaExceeded = errors.New("event quota exceeded")
+
+	ErrAttendeeNotFound      = errors.New("attendee not found")
+	ErrInvalidAttendeeStatus = errors.New("invalid attendee status")
+)
+
+type AttendeeStatus string
+
+const (
+	AttendeeNeedsAction AttendeeStatus = "needs-action"
+	AttendeeAccepted    AttendeeStatus = "accepted"
+	AttendeeDeclined    AttendeeStatus = "declined"
+	AttendeeTentative   AttendeeStatus = "tentative"
 )
 
+func (s AttendeeStatus) Valid() bool {
+	switch s {
+	case AttendeeNeedsAction, AttendeeAccepted, AttendeeDeclined, AttendeeTentative:
+		return true
+	}
+	return false
+}
+
+type Attendee struct {
+	UserID string
+	Status AttendeeStatus
+}
+
 type Event struct {
 	ID           uuid.UUID
 	Title        string
@@ -21,11 +47,70 @@ type Event struct {
 	UserID       string
 	NotifyBefore time.Duration
 	Sent         bool
+	Attendees    []Attendee
+	Reminders    []Reminder
+	CalendarID   uuid.UUID
+}
+
+// HasParticipant сообщает, является ли пользователь владельцем или приглашённым участником события.
+func (e Event) HasParticipant(userID string) bool {
+	if e.UserID == userID {
+		return true
+	}
+	for _, a := range e.Attendees {
+		if a.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptedAttendees возвращает идентификаторы участников, принявших приглашение.
+func (e Event) AcceptedAttendees() []string {
+	var ids []string
+	for _, a := range e.Attendees {
+		if a.Status == AttendeeAccepted {
+			ids = append(ids, a.UserID)
+		}
+	}
+	return ids
+}
+
+type EventFilter struct {
+	// UserID - если задан, выбираются события пользователя, события, куда он приглашён,
+	// и события календарей, к которым ему открыт доступ.
+	UserID string
+	// CalendarID - если задан, выбираются только события этого календаря.
+	CalendarID uuid.UUID
+}
+
+// Redacted возвращает событие, из которого оставлено только занятое время:
+// так его видит пользователь с доступом free-busy.
+func (e Event) Redacted() Event {
+	return Event{
+		ID:         e.ID,
+		Title:      "busy",
+		StartTime:  e.StartTime,
+		Duration:   e.Duration,
+		UserID:     e.UserID,
+		CalendarID: e.CalendarID,
+	}
 }
 
 type Notification struct {
-	EventID uuid.UUID
-	Title   string
-	Date    time.Time
-	UserID  string
+	EventID    uuid.UUID
+	ReminderID uuid.UUID
+	Channel    ReminderChannel
+	Title      string
+	Date       time.Time
+	// Duration и Description - для текста напоминания.
+	Duration    time.Duration
+	Description string
+	UserID      string
+	// Attendees - участники, принявшие приглашение; напоминание уходит и им.
+	Attendees []string
+	// NotifyAt - когда напоминание должно было уйти: начало события минус смещение.
+	NotifyAt time.Time
+	// Delivery - как обработано напоминание, заполняется планировщиком.
+	Delivery Delivery
 }
@@ -0,0 +1,77 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidTimeRange = errors.New("invalid time range")
+
+const (
+	// MinSlotDuration - самый короткий слот, который имеет смысл искать.
+	MinSlotDuration = 5 * time.Minute
+	MaxSlotsLimit   = 100
+	// MaxFreeBusyUsers ограничивает число пользователей в одном запросе занятости.
+	MaxFreeBusyUsers = 50
+)
+
+// Interval - полуоткрытый промежуток времени [Start, End).
+type Interval struct {
+	Start time.Time
+	End   time.Time
+}
+
+func (i Interval) Duration() time.Duration {
+	return i.End.Sub(i.Start)
+}
+
+// WorkingHours - рабочее время в течение дня: смещения от полуночи в часовом поясе Location.
+type WorkingHours struct {
+	Start    time.Duration
+	End      time.Duration
+	Location *time.Location
+}
+
+type SlotQuery struct {
+	UserIDs      []string
+	From         time.Time
+	To           time.Time
+	Duration     time.Duration
+	WorkingHours WorkingHours
+	Limit        int
+}
+
+// Validate проверяет параметры поиска слотов; нулевое рабочее время означает время по умолчанию,
+// лимит больше MaxSlotsLimit сервис урезает.
+func (q SlotQuery) Validate() error {
+	verr := &ValidationError{}
+	ValidateFreeBusyUsers(verr, q.UserIDs)
+	if q.Duration < MinSlotDuration {
+		verr.Add("duration", fmt.Sprintf("must be at least %s", MinSlotDuration))
+	}
+	hours := q.WorkingHours
+	if hours.Start != 0 || hours.End != 0 {
+		switch {
+		case hours.Start < 0 || hours.Start >= 24*time.Hour:
+			verr.Add("work_day_start", "must be within a day")
+		case hours.End <= 0 || hours.End > 24*time.Hour:
+			verr.Add("work_day_end", "must be within a day")
+		case hours.Start >= hours.End:
+			verr.Add("work_day_end", "must be after work_day_start")
+		case hours.End-hours.Start < q.Duration:
+			verr.Add("duration", "must fit into working hours")
+		}
+	}
+	if q.Limit < 0 {
+		verr.Add("limit", "must not be negative")
+	}
+	return verr.Err()
+}
+
+// ValidateFreeBusyUsers проверяет список пользователей запроса занятости.
+func ValidateFreeBusyUsers(verr *ValidationError, userIDs []string) {
+	if len(userIDs) > MaxFreeBusyUsers {
+		verr.Add("user_ids", fmt.Sprintf("must contain at most %d users", MaxFreeBusyUsers))
+	}
+}
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrIdempotencyKeyReused = errors.New("idempotency key reused with a different request")
+
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// IdempotencyKey - ключ идемпотентности запроса на создание события.
+// Ключ действует в пределах пользователя и хранится TTL.
+type IdempotencyKey struct {
+	Key    string
+	UserID string
+	// RequestHash - отпечаток запроса: повтор с тем же ключом и другим телом отклоняется.
+	RequestHash string
+	ExpiresAt   time.Time
+}
+
+// Scoped возвращает ключ хранения, уникальный для пары пользователь-ключ.
+func (k IdempotencyKey) Scoped() string {
+	return k.UserID + "/" + k.Key
+}
+
+// RequestHash возвращает отпечаток события для сравнения повторных запросов.
+func RequestHash(event Event) string {
+	// Ошибка невозможна: Event состоит только из сериализуемых полей
+	data, _ := json.Marshal(event)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// JobRunStatus - результат запуска задачи планировщика.
+type JobRunStatus string
+
+const (
+	JobRunSucceeded JobRunStatus = "succeeded"
+	JobRunFailed    JobRunStatus = "failed"
+	// JobRunSkipped - запуск пропущен, потому что предыдущий ещё не завершился.
+	JobRunSkipped JobRunStatus = "skipped"
+)
+
+// JobRun - запись истории запусков задачи планировщика.
+type JobRun struct {
+	Job       string
+	StartedAt time.Time
+	Duration  time.Duration
+	Status    JobRunStatus
+	Error     string
+	// Details - сводка результата, которую задача сообщила через scheduler.ReportDetails.
+	Details string
+}
+
+// JobRunFilter - выборка истории запусков: Job пустой - все задачи, последние Limit запусков.
+type JobRunFilter struct {
+	Job   string
+	Limit int
+}
+
+const (
+	DefaultJobRunLimit = 50
+	MaxJobRunLimit     = 1000
+)
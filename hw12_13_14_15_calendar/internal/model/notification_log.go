@@ -0,0 +1,137 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrNotificationNotFound = errors.New("notification not found")
+
+// NotificationStatus - состояние доставки одного сообщения получателю.
+type NotificationStatus string
+
+const (
+	// NotificationQueued - сообщение отправлено в очередь, отчёта отправителя ещё нет.
+	NotificationQueued    NotificationStatus = "queued"
+	NotificationDelivered NotificationStatus = "delivered"
+	NotificationFailed    NotificationStatus = "failed"
+	// NotificationDeferred - отправка отложена до SendAfter из-за тихих часов или режима дайджеста.
+	NotificationDeferred NotificationStatus = "deferred"
+)
+
+func (s NotificationStatus) Valid() bool {
+	switch s {
+	case NotificationQueued, NotificationDelivered, NotificationFailed, NotificationDeferred:
+		return true
+	}
+	return false
+}
+
+// NotificationKind - вид уведомления.
+type NotificationKind string
+
+const (
+	KindReminder NotificationKind = "reminder"
+	// KindAgenda - ежедневная сводка событий, см. DailyAgenda.
+	KindAgenda NotificationKind = "agenda"
+)
+
+// NotificationRecord - запись журнала уведомлений: одно сообщение о напоминании
+// одному получателю - владельцу события или участнику, или сводка событий дня.
+type NotificationRecord struct {
+	ID   uuid.UUID
+	Kind NotificationKind
+	// EventID и ReminderID пусты у сводки.
+	EventID    uuid.UUID
+	ReminderID uuid.UUID
+	// OwnerID - владелец события, которому доступна история его уведомлений.
+	OwnerID     string
+	RecipientID string
+	Channel     ReminderChannel
+	Delivery    Delivery
+	// Title, EventStart, EventDuration и Description нужны, чтобы отправить отложенное сообщение.
+	Title         string
+	EventStart    time.Time
+	EventDuration time.Duration
+	Description   string
+	Status        NotificationStatus
+	// SendAfter - когда отправить отложенное сообщение.
+	SendAfter time.Time
+	// Attempts - сколько раз отправитель пытался доставить сообщение.
+	Attempts  int
+	LastError string
+	QueuedAt  time.Time
+	UpdatedAt time.Time
+}
+
+// NotificationMessage - сообщение о напоминании или сводка дня в очереди уведомлений. Отложенные
+// напоминания одного получателя уходят одним сообщением, их список - в Items.
+type NotificationMessage struct {
+	ID          uuid.UUID        `json:"id"`
+	Kind        NotificationKind `json:"kind,omitempty"`
+	EventID     uuid.UUID        `json:"event_id"`
+	RecipientID string           `json:"recipient_id"`
+	Title       string           `json:"title"`
+	Date        time.Time        `json:"date"`
+	Channel     ReminderChannel  `json:"channel"`
+	Delivery    Delivery         `json:"delivery"`
+	Duration    time.Duration    `json:"duration,omitempty"`
+	Description string           `json:"description,omitempty"`
+	// Items - напоминания, собранные в одно сообщение; отчёт о доставке отправляется по каждому.
+	Items []NotificationMessage `json:"items,omitempty"`
+	// TimeZone и Locale - часовой пояс и язык получателя для текста сообщения.
+	TimeZone string `json:"time_zone,omitempty"`
+	Locale   string `json:"locale,omitempty"`
+	// Agenda - события дня Date в сводке.
+	Agenda []AgendaItem `json:"agenda,omitempty"`
+}
+
+// AgendaItem - событие в ежедневной сводке.
+type AgendaItem struct {
+	EventID     uuid.UUID     `json:"event_id"`
+	Title       string        `json:"title"`
+	Start       time.Time     `json:"start"`
+	Duration    time.Duration `json:"duration"`
+	Description string        `json:"description,omitempty"`
+}
+
+// Message возвращает сообщение в очередь для записи журнала.
+func (r NotificationRecord) Message() NotificationMessage {
+	return NotificationMessage{
+		ID:          r.ID,
+		Kind:        r.Kind,
+		EventID:     r.EventID,
+		RecipientID: r.RecipientID,
+		Title:       r.Title,
+		Date:        r.EventStart,
+		Channel:     r.Channel,
+		Delivery:    r.Delivery,
+		Duration:    r.EventDuration,
+		Description: r.Description,
+	}
+}
+
+// NotificationStatusReport - отчёт отправителя о доставке сообщения, приходит
+// в очередь статусов и обновляет запись журнала с тем же ID.
+type NotificationStatusReport struct {
+	ID       uuid.UUID          `json:"id"`
+	Status   NotificationStatus `json:"status"`
+	Attempts int                `json:"attempts"`
+	Error    string             `json:"error,omitempty"`
+	At       time.Time          `json:"at"`
+}
+
+// NotificationFilter - выборка журнала: уведомления о событиях владельца OwnerID
+// или об одном событии EventID, последние Limit записей.
+type NotificationFilter struct {
+	OwnerID string
+	EventID uuid.UUID
+	Limit   int
+}
+
+const (
+	DefaultNotificationLimit = 50
+	MaxNotificationLimit     = 1000
+)
@@ -0,0 +1,181 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+)
+
+var ErrPreferencesNotFound = errors.New("notification preferences not found")
+
+// localePattern - тег языка: язык и необязательные подтеги, например ru, en-US, pt_BR.
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}([-_][A-Za-z0-9]{2,8})*$`)
+
+// NotificationMode - как пользователь получает напоминания.
+type NotificationMode string
+
+const (
+	// ModeIndividual - каждое напоминание отдельным сообщением в своё время.
+	ModeIndividual NotificationMode = "individual"
+	// ModeDigest - напоминания копятся и уходят одним сообщением раз в интервал дайджеста.
+	ModeDigest NotificationMode = "digest"
+)
+
+func (m NotificationMode) Valid() bool {
+	return m == ModeIndividual || m == ModeDigest
+}
+
+// QuietHours - ежедневный интервал местного времени, когда уведомления откладываются.
+// Start и End - смещения от полуночи; Start > End - интервал через полночь, Start == End - выключено.
+type QuietHours struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+func (q QuietHours) Enabled() bool {
+	return q.Start != q.End
+}
+
+// NotificationPreferences - настройки уведомлений пользователя.
+type NotificationPreferences struct {
+	UserID string
+	// Channels - предпочитаемые каналы; напоминание по другому каналу уходит по первому из них.
+	Channels []ReminderChannel
+	// TimeZone - часовой пояс IANA, в котором заданы тихие часы; пусто - UTC.
+	TimeZone string
+	// Locale - язык уведомлений; пусто - язык по умолчанию отправителя.
+	Locale     string
+	QuietHours QuietHours
+	Mode       NotificationMode
+	Agenda     DailyAgenda
+}
+
+// AgendaWindow - сколько после времени сводки её ещё можно отправить, например
+// после простоя планировщика; позже сводка о прошедшей части дня бесполезна.
+const AgendaWindow = 2 * time.Hour
+
+// DailyAgenda - ежедневная сводка событий дня, которая уходит в местное время At.
+type DailyAgenda struct {
+	Enabled bool
+	// At - смещение от местной полуночи.
+	At time.Duration
+}
+
+// DefaultPreferences - настройки пользователя, который их не задавал.
+func DefaultPreferences(userID string) NotificationPreferences {
+	return NotificationPreferences{UserID: userID, Mode: ModeIndividual}
+}
+
+// Validate проверяет настройки перед сохранением.
+func (p NotificationPreferences) Validate() error {
+	verr := &ValidationError{}
+	for i, c := range p.Channels {
+		if !c.Valid() {
+			verr.Add(fmt.Sprintf("channels[%d]", i), "is unknown")
+		}
+	}
+	if _, err := time.LoadLocation(p.TimeZone); err != nil {
+		verr.Add("time_zone", "is unknown")
+	}
+	if p.Locale != "" && !localePattern.MatchString(p.Locale) {
+		verr.Add("locale", "must be a language tag like en or pt-BR")
+	}
+	if p.QuietHours.Start < 0 || p.QuietHours.Start >= 24*time.Hour {
+		verr.Add("quiet_hours.start", "must be within a day")
+	}
+	if p.QuietHours.End < 0 || p.QuietHours.End >= 24*time.Hour {
+		verr.Add("quiet_hours.end", "must be within a day")
+	}
+	if !p.Mode.Valid() {
+		verr.Add("mode", "is unknown")
+	}
+	if p.Agenda.At < 0 || p.Agenda.At >= 24*time.Hour {
+		verr.Add("agenda.at", "must be within a day")
+	}
+	return verr.Err()
+}
+
+// Channel возвращает канал, по которому нужно отправить напоминание с каналом c.
+func (p NotificationPreferences) Channel(c ReminderChannel) ReminderChannel {
+	if len(p.Channels) == 0 || slices.Contains(p.Channels, c) {
+		return c
+	}
+	return p.Channels[0]
+}
+
+// DeferUntil возвращает, до какого момента отложить уведомление, которое должно уйти в now:
+// до следующей отправки дайджеста и за пределы тихих часов, но не позже deadline - начала
+// события, иначе напоминание придёт после него. Нулевое время - отправить сразу.
+func (p NotificationPreferences) DeferUntil(now time.Time, digestInterval time.Duration, deadline time.Time) time.Time {
+	at := now
+	if p.Mode == ModeDigest && digestInterval > 0 {
+		at = now.Truncate(digestInterval).Add(digestInterval)
+	}
+	if end, ok := p.quietEnd(at); ok {
+		at = end
+	}
+	if at.After(deadline) {
+		at = deadline
+	}
+	if !at.After(now) {
+		return time.Time{}
+	}
+	return at
+}
+
+// Location возвращает часовой пояс пользователя; неизвестный пояс считается UTC.
+func (p NotificationPreferences) Location() *time.Location {
+	loc, err := time.LoadLocation(p.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// AgendaDue сообщает, пора ли к моменту now отправить сводку, и возвращает местную полночь её дня.
+// Сводка, не отправленная в течение AgendaWindow после своего времени, за этот день уже не уходит.
+func (p NotificationPreferences) AgendaDue(now time.Time) (time.Time, bool) {
+	if !p.Agenda.Enabled {
+		return time.Time{}, false
+	}
+	local := now.In(p.Location())
+	y, m, d := local.Date()
+	offset := clockOffset(local)
+	return time.Date(y, m, d, 0, 0, 0, 0, local.Location()),
+		offset >= p.Agenda.At && offset < p.Agenda.At+AgendaWindow
+}
+
+// clockOffset возвращает время по местным часам как смещение от полуночи. Считается
+// по часам, а не от полуночи, чтобы переход на летнее время не сдвигал интервалы.
+func clockOffset(local time.Time) time.Duration {
+	return time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute +
+		time.Duration(local.Second())*time.Second + time.Duration(local.Nanosecond())
+}
+
+// quietEnd сообщает, попадает ли t в тихие часы, и когда они заканчиваются.
+func (p NotificationPreferences) quietEnd(t time.Time) (time.Time, bool) {
+	if !p.QuietHours.Enabled() {
+		return time.Time{}, false
+	}
+	loc := p.Location()
+	local := t.In(loc)
+	y, m, d := local.Date()
+	offset := clockOffset(local)
+	at := func(day int, offset time.Duration) time.Time {
+		return time.Date(y, m, day, 0, 0, 0, int(offset), loc).In(t.Location())
+	}
+
+	start, end := p.QuietHours.Start, p.QuietHours.End
+	switch {
+	case start < end && offset >= start && offset < end:
+		return at(d, end), true
+	case start > end && offset >= start:
+		// Тихие часы продолжаются после полуночи
+		return at(d+1, end), true
+	case start > end && offset < end:
+		return at(d, end), true
+	}
+	return time.Time{}, false
+}
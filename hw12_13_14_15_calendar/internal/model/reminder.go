@@ -0,0 +1,88 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ReminderChannel string
+
+const (
+	ChannelEmail ReminderChannel = "email"
+	ChannelSMS   ReminderChannel = "sms"
+	ChannelPush  ReminderChannel = "push"
+
+	DefaultReminderChannel = ChannelEmail
+)
+
+func (c ReminderChannel) Valid() bool {
+	switch c {
+	case ChannelEmail, ChannelSMS, ChannelPush:
+		return true
+	}
+	return false
+}
+
+// Reminder - одно напоминание о событии: за Offset до начала по каналу Channel.
+// Состояние доставки хранится для каждого напоминания отдельно.
+type Reminder struct {
+	ID      uuid.UUID
+	Offset  time.Duration
+	Channel ReminderChannel
+	Sent    bool
+	SentAt  time.Time
+	// Delivery - как обработано напоминание; пусто, пока оно не отправлено.
+	Delivery Delivery
+}
+
+// NormalizeReminders возвращает список напоминаний события. Если список пуст,
+// но задано устаревшее поле NotifyBefore, оно превращается в одно напоминание
+// по каналу по умолчанию.
+func NormalizeReminders(e Event) []Reminder {
+	reminders := e.Reminders
+	if len(reminders) == 0 && e.NotifyBefore > 0 {
+		reminders = []Reminder{{Offset: e.NotifyBefore}}
+	}
+
+	normalized := make([]Reminder, 0, len(reminders))
+	for _, r := range reminders {
+		if r.Channel == "" {
+			r.Channel = DefaultReminderChannel
+		}
+		normalized = append(normalized, r)
+	}
+	return normalized
+}
+
+// MergeReminders строит список напоминаний обновлённого события. Напоминания
+// с тем же смещением и каналом сохраняют идентификатор и, если время начала
+// события не изменилось, состояние доставки.
+func MergeReminders(oldEvent, newEvent Event) []Reminder {
+	merged := NormalizeReminders(newEvent)
+	for i := range merged {
+		for _, old := range oldEvent.Reminders {
+			if old.Offset != merged[i].Offset || old.Channel != merged[i].Channel {
+				continue
+			}
+			merged[i].ID = old.ID
+			if oldEvent.StartTime.Equal(newEvent.StartTime) {
+				merged[i].Sent = old.Sent
+				merged[i].SentAt = old.SentAt
+				merged[i].Delivery = old.Delivery
+			}
+			break
+		}
+	}
+	return merged
+}
+
+// AllRemindersSent сообщает, доставлены ли все напоминания события.
+func AllRemindersSent(reminders []Reminder) bool {
+	for _, r := range reminders {
+		if !r.Sent {
+			return false
+		}
+	}
+	return len(reminders) > 0
+}
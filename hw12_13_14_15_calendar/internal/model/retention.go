@@ -0,0 +1,65 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultRetention - сколько хранятся события, если правило не задано в конфигурации.
+const DefaultRetention = 365 * 24 * time.Hour
+
+// MaxDryRunEventIDs ограничивает список событий в отчете пробного запуска.
+const MaxDryRunEventIDs = 100
+
+// RetentionRule - правило хранения событий.
+type RetentionRule struct {
+	// MaxAge - событие удаляется, когда с его начала прошло больше MaxAge; 0 - хранить бессрочно.
+	MaxAge time.Duration
+	// KeepWithAttendees - не удалять события с приглашёнными участниками.
+	KeepWithAttendees bool
+}
+
+// Expired сообщает, истёк ли срок хранения события к моменту now.
+func (r RetentionRule) Expired(e Event, now time.Time) bool {
+	return r.MaxAge > 0 && e.StartTime.Before(now.Add(-r.MaxAge))
+}
+
+// RetentionPolicy - правило хранения для всей инсталляции и переопределения для
+// отдельных календарей и владельцев событий. Переопределение заменяет правило
+// целиком; правило календаря важнее правила владельца.
+type RetentionPolicy struct {
+	Default   RetentionRule
+	Calendars map[uuid.UUID]RetentionRule
+	Users     map[string]RetentionRule
+	// DryRun - ничего не удалять, только посчитать, что было бы удалено.
+	DryRun bool
+}
+
+// Rule возвращает правило, действующее для события.
+func (p RetentionPolicy) Rule(e Event) RetentionRule {
+	if rule, ok := p.Calendars[e.CalendarID]; ok && e.CalendarID != uuid.Nil {
+		return rule
+	}
+	if rule, ok := p.Users[e.UserID]; ok {
+		return rule
+	}
+	return p.Default
+}
+
+// PurgeStats - результат удаления устаревших событий.
+type PurgeStats struct {
+	DryRun bool
+	// Deleted - сколько событий удалено, в режиме DryRun - сколько было бы удалено.
+	Deleted int
+	// KeptWithAttendees - устаревшие события, оставленные из-за участников.
+	KeptWithAttendees int
+	// EventIDs - события, которые были бы удалены, не больше MaxDryRunEventIDs;
+	// заполняется только в режиме DryRun.
+	EventIDs []uuid.UUID
+}
+
+func (s PurgeStats) String() string {
+	return fmt.Sprintf("deleted=%d kept_with_attendees=%d dry_run=%t", s.Deleted, s.KeptWithAttendees, s.DryRun)
+}
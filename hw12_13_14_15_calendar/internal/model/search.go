@@ -0,0 +1,38 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrEmptySearchQuery = errors.New("empty search query")
+
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// SearchQuery - параметры полнотекстового поиска по названию и описанию событий.
+type SearchQuery struct {
+	Text string
+	// From и To ограничивают время начала события; нулевое значение - без ограничения.
+	From time.Time
+	To   time.Time
+	// UserID - если задан, ищутся только события, которые пользователь может читать:
+	// календари с доступом free-busy в поиск не попадают, чтобы не раскрывать их содержимое.
+	UserID string
+	Limit  int
+	Offset int
+}
+
+type SearchResult struct {
+	Event Event
+	Rank  float64
+}
+
+// SearchPage - страница результатов поиска, отсортированных по убыванию релевантности.
+type SearchPage struct {
+	Results []SearchResult
+	// Total - общее число найденных событий без учёта пагинации.
+	Total int
+}
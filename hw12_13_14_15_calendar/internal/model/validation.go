@@ -0,0 +1,135 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var ErrValidation = errors.New("validation failed")
+
+const (
+	MaxTitleLength       = 200
+	MaxDescriptionLength = 4000
+	// MaxReminderOffset - напоминание нельзя поставить раньше, чем за год до события.
+	MaxReminderOffset = 365 * 24 * time.Hour
+)
+
+var userIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@+-]{0,63}$`)
+
+// ValidUserID проверяет формат идентификатора пользователя.
+func ValidUserID(userID string) bool {
+	return userIDPattern.MatchString(userID)
+}
+
+// FieldViolation описывает ошибку в одном поле запроса. Field - путь к полю
+// в терминах API, например "reminders[1].offset".
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// ValidationError содержит все найденные ошибки, а не только первую,
+// чтобы клиент мог исправить запрос за один раз.
+type ValidationError struct {
+	Violations []FieldViolation
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		parts = append(parts, v.Field+": "+v.Description)
+	}
+	return fmt.Sprintf("%s: %s", ErrValidation, strings.Join(parts, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
+
+// Add добавляет ошибку поля.
+func (e *ValidationError) Add(field, description string) {
+	e.Violations = append(e.Violations, FieldViolation{Field: field, Description: description})
+}
+
+// Merge добавляет ошибки err, дописывая prefix к путям полей. Ошибка другого
+// типа считается ошибкой самого поля prefix.
+func (e *ValidationError) Merge(prefix string, err error) {
+	if err == nil {
+		return
+	}
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		e.Add(prefix, err.Error())
+		return
+	}
+	for _, v := range verr.Violations {
+		if prefix != "" {
+			v.Field = prefix + "." + v.Field
+		}
+		e.Violations = append(e.Violations, v)
+	}
+}
+
+// Err возвращает nil, если ошибок не найдено.
+func (e *ValidationError) Err() error {
+	if len(e.Violations) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Validate проверяет событие перед сохранением.
+func (e Event) Validate() error {
+	verr := &ValidationError{}
+
+	title := strings.TrimSpace(e.Title)
+	switch {
+	case title == "":
+		verr.Add("title", "must not be empty")
+	case utf8.RuneCountInString(title) > MaxTitleLength:
+		verr.Add("title", fmt.Sprintf("must be at most %d characters", MaxTitleLength))
+	}
+	if utf8.RuneCountInString(e.Description) > MaxDescriptionLength {
+		verr.Add("description", fmt.Sprintf("must be at most %d characters", MaxDescriptionLength))
+	}
+	if e.StartTime.IsZero() {
+		verr.Add("start_time", "is required")
+	}
+	if e.Duration <= 0 {
+		verr.Add("duration", "must be positive")
+	}
+	if e.UserID != "" && !ValidUserID(e.UserID) {
+		verr.Add("user_id", "has invalid format")
+	}
+	if msg := validateOffset(e.NotifyBefore); msg != "" {
+		verr.Add("notify_before", msg)
+	}
+	for i, r := range e.Reminders {
+		if msg := validateOffset(r.Offset); msg != "" {
+			verr.Add(fmt.Sprintf("reminders[%d].offset", i), msg)
+		}
+		if r.Channel != "" && !r.Channel.Valid() {
+			verr.Add(fmt.Sprintf("reminders[%d].channel", i), "is unknown")
+		}
+	}
+	for i, a := range e.Attendees {
+		if !ValidUserID(a.UserID) {
+			verr.Add(fmt.Sprintf("attendees[%d].user_id", i), "has invalid format")
+		}
+	}
+	return verr.Err()
+}
+
+func validateOffset(offset time.Duration) string {
+	switch {
+	case offset < 0:
+		return "must not be negative"
+	case offset > MaxReminderOffset:
+		return "must not exceed one year"
+	}
+	return ""
+}
@@ -0,0 +1,102 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DefaultCapacity - сколько сообщений очередь хранит, пока их не прочитают.
+const DefaultCapacity = 1024
+
+var (
+	ErrClosed = errors.New("queue is closed")
+	ErrFull   = errors.New("queue is full")
+)
+
+// Broker - именованные очереди в памяти процесса. Как и в RabbitMQ, сообщение получает
+// один из читателей очереди, а отправленное без читателей ждёт в буфере.
+type Broker struct {
+	mu       sync.Mutex
+	capacity int
+	queues   map[string]chan string
+}
+
+func NewBroker(capacity int) *Broker {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &Broker{capacity: capacity, queues: make(map[string]chan string)}
+}
+
+// Queue возвращает подключение к очереди name; очереди с одним именем общие.
+func (b *Broker) Queue(name string) *Queue {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	messages, ok := b.queues[name]
+	if !ok {
+		messages = make(chan string, b.capacity)
+		b.queues[name] = messages
+	}
+	return &Queue{name: name, messages: messages, done: make(chan struct{})}
+}
+
+// Queue - подключение к очереди брокера в памяти.
+type Queue struct {
+	name      string
+	messages  chan string
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Send кладёт сообщение в очередь, не дожидаясь читателя; переполненная очередь - ошибка ErrFull.
+func (q *Queue) Send(msg string) error {
+	select {
+	case <-q.done:
+		return ErrClosed
+	default:
+	}
+	select {
+	case q.messages <- msg:
+		return nil
+	default:
+		return fmt.Errorf("%s: %w: %d messages", q.name, ErrFull, cap(q.messages))
+	}
+}
+
+// Receive возвращает сообщения очереди; канал закрывается после Close.
+func (q *Queue) Receive() (<-chan string, error) {
+	select {
+	case <-q.done:
+		return nil, ErrClosed
+	default:
+	}
+	out := make(chan string)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-q.done:
+				return
+			case msg := <-q.messages:
+				select {
+				case out <- msg:
+				case <-q.done:
+					// Непрочитанное сообщение достанется другим читателям очереди
+					select {
+					case q.messages <- msg:
+					default:
+					}
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Close отключается от очереди; сообщения в ней остаются другим подключениям.
+func (q *Queue) Close() error {
+	q.closeOnce.Do(func() { close(q.done) })
+	return nil
+}
@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func receive(t *testing.T, messages <-chan string) string {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+	}
+	return ""
+}
+
+func TestBroker(t *testing.T) {
+	broker := NewBroker(2)
+	producer, consumer := broker.Queue("notifications"), broker.Queue("notifications")
+
+	// Сообщения без читателя ждут в буфере
+	require.NoError(t, producer.Send("first"))
+	require.NoError(t, producer.Send("second"))
+	require.ErrorIs(t, producer.Send("third"), ErrFull)
+	// Другие очереди не связаны с этой
+	require.NoError(t, broker.Queue("notification_status").Send("report"))
+
+	messages, err := consumer.Receive()
+	require.NoError(t, err)
+	require.Equal(t, "first", receive(t, messages))
+	require.Equal(t, "second", receive(t, messages))
+
+	require.NoError(t, consumer.Close())
+	_, ok := <-messages
+	require.False(t, ok)
+	require.ErrorIs(t, consumer.Send("late"), ErrClosed)
+
+	// Закрытие одного подключения не мешает остальным
+	require.NoError(t, producer.Send("third"))
+	messages, err = broker.Queue("notifications").Receive()
+	require.NoError(t, err)
+	require.Equal(t, "third", receive(t, messages))
+}
+
+func TestBrokerCompetingConsumers(t *testing.T) {
+	broker := NewBroker(DefaultCapacity)
+	first, err := broker.Queue("q").Receive()
+	require.NoError(t, err)
+	second, err := broker.Queue("q").Receive()
+	require.NoError(t, err)
+
+	producer := broker.Queue("q")
+	for i := 0; i < 10; i++ {
+		require.NoError(t, producer.Send("msg"))
+	}
+	// Каждое сообщение получает ровно один читатель
+	got := 0
+	timeout := time.After(time.Second)
+	for got < 10 {
+		select {
+		case <-first:
+		case <-second:
+		case <-timeout:
+			t.Fatalf("received %d of 10 messages", got)
+		}
+		got++
+	}
+	select {
+	case msg := <-first:
+		t.Fatalf("unexpected message %q", msg)
+	case msg := <-second:
+		t.Fatalf("unexpected message %q", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
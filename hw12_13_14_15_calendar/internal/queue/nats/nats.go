@@ -0,0 +1,252 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/config"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/tlsconfig"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	// subjectPrefix - очередь name публикуется в тему calendar.<name>.
+	subjectPrefix = "calendar."
+	// streamPrefix - сообщения очереди name хранятся в потоке JetStream calendar_<name>.
+	streamPrefix = "calendar_"
+	// requestTimeout ограничивает ожидание ответа JetStream: подтверждения публикации
+	// и создания потока или читателя.
+	requestTimeout = 5 * time.Second
+	// pullBatch - сколько сообщений читатель запрашивает у сервера за раз.
+	pullBatch = 16
+	// minRetryBackoff и maxRetryBackoff ограничивают паузу между попытками чтения после ошибки.
+	minRetryBackoff = 100 * time.Millisecond
+	maxRetryBackoff = 5 * time.Second
+)
+
+// Queue - очередь поверх NATS JetStream. Сообщения хранятся в потоке на сервере, пока их
+// не подтвердит читатель, поэтому переживают перезапуск читателей и отправленные без читателей
+// не теряются. Читатели одной очереди делят постоянного (durable) читателя с её именем,
+// поэтому сообщение получает один из них, как в RabbitMQ.
+type Queue struct {
+	conn      *natsgo.Conn
+	js        jetstream.JetStream
+	name      string
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewQueue(cfg config.NATS, name string) (*Queue, error) {
+	tlsConfig, err := tlsconfig.Client(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	// Переподключение без ограничения числа попыток: очередь должна пережить перезапуск NATS
+	opts := []natsgo.Option{natsgo.Name("calendar " + name), natsgo.MaxReconnects(-1)}
+	if tlsConfig != nil {
+		opts = append(opts, natsgo.Secure(tlsConfig))
+	}
+	conn, err := natsgo.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	q := &Queue{conn: conn, js: js, name: name, done: make(chan struct{})}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	if err := q.createStream(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *Queue) createStream(ctx context.Context) error {
+	// Очередь работ: сообщение удаляется из потока, как только его подтвердил читатель
+	_, err := q.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:      streamPrefix + q.name,
+		Subjects:  []string{subjectPrefix + q.name},
+		Retention: jetstream.WorkQueuePolicy,
+		Storage:   jetstream.FileStorage,
+	})
+	if err != nil {
+		return fmt.Errorf("create stream %s: %w", streamPrefix+q.name, err)
+	}
+	return nil
+}
+
+// Send публикует сообщение и ждёт, пока сервер сохранит его в потоке.
+func (q *Queue) Send(msg string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	_, err := q.js.Publish(ctx, subjectPrefix+q.name, []byte(msg))
+	return err
+}
+
+// Receive подключается к постоянному читателю очереди; канал закрывается после Close.
+// Сообщение подтверждается, когда его забрали из канала; не забранные до Close
+// сообщения возвращаются в поток и уходят другому читателю. После ошибок чтение
+// повторяется с паузой, удалённые поток и читатель создаются заново. При отказе
+// в доступе и закрытом подключении канал закрывается.
+func (q *Queue) Receive() (<-chan string, error) {
+	iter, err := q.messages()
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan string)
+	go q.receive(iter, out)
+	return out, nil
+}
+
+// messages подписывается на сообщения постоянного читателя очереди, создавая
+// при необходимости читателя и поток.
+func (q *Queue) messages() (jetstream.MessagesContext, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	consumerConfig := jetstream.ConsumerConfig{
+		Durable:   q.name,
+		AckPolicy: jetstream.AckExplicitPolicy,
+	}
+	consumer, err := q.js.CreateOrUpdateConsumer(ctx, streamPrefix+q.name, consumerConfig)
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		if err = q.createStream(ctx); err == nil {
+			consumer, err = q.js.CreateOrUpdateConsumer(ctx, streamPrefix+q.name, consumerConfig)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create consumer %s: %w", q.name, err)
+	}
+	return consumer.Messages(jetstream.PullMaxMessages(pullBatch))
+}
+
+func (q *Queue) receive(iter jetstream.MessagesContext, out chan<- string) {
+	defer close(out)
+	stopWatch := q.stopOnClose(iter)
+	defer func() {
+		stopWatch()
+		iter.Stop()
+	}()
+
+	backoff := minRetryBackoff
+	for {
+		msg, err := iter.Next()
+		if err != nil {
+			switch {
+			case q.closed():
+				return
+			case permanentError(err):
+				log.Printf("Stop reading nats queue %s: %v", q.name, err)
+				return
+			}
+			if !q.sleep(backoff) {
+				return
+			}
+			backoff = min(backoff*2, maxRetryBackoff)
+			if !consumerLost(err) {
+				// Пропущенный heartbeat и другие временные ошибки: клиент продолжает чтение сам
+				continue
+			}
+			log.Printf("Resubscribe to nats queue %s: %v", q.name, err)
+			next, err := q.messages()
+			if err != nil {
+				log.Printf("Failed to resubscribe to nats queue %s, retry in %s: %v", q.name, backoff, err)
+				continue
+			}
+			stopWatch()
+			iter.Stop()
+			iter, stopWatch = next, q.stopOnClose(next)
+			continue
+		}
+		backoff = minRetryBackoff
+
+		select {
+		case out <- string(msg.Data()):
+			_ = msg.Ack()
+		case <-q.done:
+			_ = msg.Nak()
+			return
+		}
+	}
+}
+
+// stopOnClose останавливает iter при закрытии очереди; возвращённая функция отменяет это.
+func (q *Queue) stopOnClose(iter jetstream.MessagesContext) func() {
+	cancel := make(chan struct{})
+	go func() {
+		select {
+		case <-q.done:
+			iter.Stop()
+		case <-cancel:
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(cancel) }) }
+}
+
+func (q *Queue) closed() bool {
+	select {
+	case <-q.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep ждёт d и возвращает false, если очередь закрыли раньше.
+func (q *Queue) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-q.done:
+		return false
+	}
+}
+
+// consumerLost сообщает, что подписка больше не получит сообщений и её нужно создать заново:
+// читателя или поток удалили, либо итератор остановлен.
+func consumerLost(err error) bool {
+	return errors.Is(err, jetstream.ErrConsumerDeleted) ||
+		errors.Is(err, jetstream.ErrConsumerNotFound) ||
+		errors.Is(err, jetstream.ErrStreamNotFound) ||
+		errors.Is(err, jetstream.ErrMsgIteratorClosed)
+}
+
+// permanentError сообщает об ошибке, которую повторные попытки не исправят.
+func permanentError(err error) bool {
+	return errors.Is(err, natsgo.ErrAuthorization) ||
+		errors.Is(err, natsgo.ErrAuthRevoked) ||
+		errors.Is(err, natsgo.ErrConnectionClosed)
+}
+
+// Healthy возвращает ошибку, если связи с NATS нет; переподключается клиент NATS сам.
+func (q *Queue) Healthy() error {
+	if q.conn.IsConnected() {
+		return nil
+	}
+	if err := q.conn.LastError(); err != nil {
+		return fmt.Errorf("nats queue %s is %s: %w", q.name, q.conn.Status(), err)
+	}
+	return fmt.Errorf("nats queue %s is %s", q.name, q.conn.Status())
+}
+
+// Close закрывает подключение, отправленные сообщения перед этим дописываются на сервер.
+func (q *Queue) Close() error {
+	q.closeOnce.Do(func() {
+		close(q.done)
+		_ = q.conn.Flush()
+		q.conn.Close()
+	})
+	return nil
+}
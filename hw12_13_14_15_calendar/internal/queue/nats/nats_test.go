@@ -0,0 +1,46 @@
+package nats
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceiveErrorClassification(t *testing.T) {
+	// Удалённые читатель и поток создаются заново
+	for _, err := range []error{
+		jetstream.ErrConsumerDeleted,
+		jetstream.ErrConsumerNotFound,
+		fmt.Errorf("pull: %w", jetstream.ErrStreamNotFound),
+		jetstream.ErrMsgIteratorClosed,
+	} {
+		require.True(t, consumerLost(err), err)
+		require.False(t, permanentError(err), err)
+	}
+
+	// Повторные попытки не помогут: чтение прекращается
+	for _, err := range []error{natsgo.ErrAuthorization, natsgo.ErrAuthRevoked, natsgo.ErrConnectionClosed} {
+		require.True(t, permanentError(err), err)
+		require.False(t, consumerLost(err), err)
+	}
+
+	// Временные ошибки повторяются с паузой на прежней подписке
+	for _, err := range []error{jetstream.ErrNoHeartbeat, errors.New("timeout")} {
+		require.False(t, permanentError(err), err)
+		require.False(t, consumerLost(err), err)
+	}
+}
+
+func TestSleepStopsOnClose(t *testing.T) {
+	q := &Queue{done: make(chan struct{})}
+	require.True(t, q.sleep(time.Millisecond))
+
+	close(q.done)
+	require.False(t, q.sleep(time.Hour))
+	require.True(t, q.closed())
+}
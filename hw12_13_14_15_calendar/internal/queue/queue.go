@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/config"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/queue/memory"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/queue/nats"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/queue/rabbitmq"
+)
+
+// Очереди сервисов календаря.
+const (
+	// NotificationsQueue - сообщения о напоминаниях от планировщика отправителю.
+	NotificationsQueue = "notifications"
+	// StatusQueue - отчёты отправителя о доставке сообщений планировщику.
+	StatusQueue = "notification_status"
+)
+
+// Queue - очередь брокера сообщений, брокер выбирается параметром queue.type.
+type Queue interface {
+	Send(msg string) error
+	// Receive возвращает сообщения очереди; каждое получает один из читателей.
+	Receive() (<-chan string, error)
+	Close() error
+}
+
+// memoryBroker - очереди в памяти, общие для всех подключений процесса.
+var memoryBroker = memory.NewBroker(memory.DefaultCapacity)
+
+type Option func(*options)
+
+type options struct {
+	name string
+}
+
+// WithName задаёт имя очереди, по умолчанию NotificationsQueue.
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// NewQueue подключается к очереди брокера из конфигурации.
+func NewQueue(cfg *config.Config, opts ...Option) (Queue, error) {
+	o := options{name: NotificationsQueue}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	switch cfg.Queue.Type {
+	case "", config.QueueRabbitMQ:
+		q, err := rabbitmq.NewQueue(cfg.RabbitMQ, o.name,
+			rabbitmq.WithBackoff(cfg.RabbitMQ.ReconnectBackoff, cfg.RabbitMQ.MaxReconnectBackoff),
+			rabbitmq.WithBufferSize(cfg.RabbitMQ.PublishBuffer),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return q, nil
+	case config.QueueNATS:
+		q, err := nats.NewQueue(cfg.Queue.NATS, o.name)
+		if err != nil {
+			return nil, err
+		}
+		return q, nil
+	case config.QueueMemory:
+		return memoryBroker.Queue(o.name), nil
+	}
+	return nil, fmt.Errorf("unknown queue type %q", cfg.Queue.Type)
+}
+
+// Checker - очередь, которая сообщает о потере связи с брокером; очереди в памяти её не теряют.
+type Checker interface {
+	Healthy() error
+}
+
+// Healthy проверяет связь очередей с брокером.
+func Healthy(queues ...Queue) error {
+	var errs []error
+	for _, q := range queues {
+		if c, ok := q.(Checker); ok {
+			if err := c.Healthy(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// HealthServer - HTTP-сервер с проверкой GET /healthz: 200, пока очереди связаны с брокером,
+// и 503 с причиной, пока они переподключаются.
+func HealthServer(port string, queues ...Queue) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		if err := Healthy(queues...); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, "ok\n")
+	})
+	return &http.Server{Addr: ":" + port, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+}
@@ -0,0 +1,38 @@
+package queue
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+// brokerQueue - очередь в памяти с состоянием связи, как у сетевого брокера.
+type brokerQueue struct {
+	Queue
+	err error
+}
+
+func (q brokerQueue) Healthy() error {
+	return q.err
+}
+
+func TestHealthServer(t *testing.T) {
+	memoryQueue, err := NewQueue(&config.Config{Queue: config.Queue{Type: config.QueueMemory}})
+	require.NoError(t, err)
+	status := &brokerQueue{Queue: memoryQueue}
+	handler := HealthServer("8081", memoryQueue, status).Handler
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	status.err = errors.New("rabbitmq queue notification_status is reconnecting")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Contains(t, rec.Body.String(), "notification_status is reconnecting")
+}
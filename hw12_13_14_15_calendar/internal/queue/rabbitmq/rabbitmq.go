@@ -1,94 +1,632 @@
-package queue
+package rabbitmq
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/milov52/hw12_13_14_15_calendar/internal/config"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/tlsconfig"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+const (
+	DefaultMinBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff = 30 * time.Second
+	DefaultBufferSize = 1000
+
+	// confirmTimeout ограничивает ожидание подтверждения публикации брокером.
+	confirmTimeout = 5 * time.Second
+	// prefetch - сколько неподтверждённых сообщений брокер отдаёт одному читателю.
+	prefetch = 16
+)
+
+var (
+	ErrClosed       = errors.New("rabbitmq: queue is closed")
+	ErrBufferFull   = errors.New("rabbitmq: publish buffer is full")
+	ErrNotConfirmed = errors.New("rabbitmq: message was not confirmed by the broker")
+)
+
+// State - состояние подключения к RabbitMQ.
+type State string
+
+const (
+	StateConnected State = "connected"
+	// StateReconnecting - связь потеряна, отправленные сообщения копятся в буфере до переподключения.
+	StateReconnecting State = "reconnecting"
+	StateClosed       State = "closed"
+)
+
+// Queue - очередь RabbitMQ, которая переживает перезапуск брокера: при разрыве соединения
+// переподключается с экспоненциальной задержкой, заново объявляет очередь и подписки читателей,
+// а отправленные за это время сообщения держит в буфере. Очередь и сообщения хранятся на диске
+// брокера, сообщение считается отправленным после подтверждения брокером, а неподтверждённые
+// остаются в буфере до следующей попытки.
 type Queue struct {
-	Connection *amqp.Connection
-	Channel    *amqp.Channel
-	Queue      *amqp.Queue
+	url        string
+	tlsConfig  *tls.Config
+	name       string
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	bufferSize int
+	// dialer открывает подключение, в тестах - фальшивое.
+	dialer func() (conn, error)
+
+	mu    sync.Mutex
+	state State
+	// sess - текущее подключение, nil во время переподключения.
+	sess *session
+	// ready закрывается, когда подключение восстановлено.
+	ready   chan struct{}
+	lastErr error
+	pending []string
+	// flushing - буфер отправляется; пока это так, Send кладёт сообщения в конец буфера,
+	// чтобы они не обогнали накопленные.
+	flushing bool
+
+	done      chan struct{}
+	closeOnce sync.Once
+	// consumers - работающие читатели; Close ждёт, пока они подтвердят сообщения.
+	consumers sync.WaitGroup
+}
+
+// conn - подключение к брокеру с объявленной очередью.
+type conn interface {
+	// Publish отправляет сообщение и ждёт подтверждения брокера.
+	Publish(msg string) error
+	// Consume подписывается на очередь; сообщения нужно подтверждать.
+	Consume() (<-chan amqp.Delivery, error)
+	// Closed получает причину разрыва подключения или канала, nil - закрыто клиентом.
+	Closed() <-chan *amqp.Error
+	Close() error
+}
+
+// session - одно подключение к RabbitMQ; lost закрывается при его разрыве.
+type session struct {
+	conn conn
+	lost chan struct{}
+}
+
+type Option func(*Queue)
+
+// WithBackoff задаёт задержку перед первой попыткой переподключения и её предел,
+// каждая следующая попытка ждёт вдвое дольше.
+func WithBackoff(minBackoff, maxBackoff time.Duration) Option {
+	return func(q *Queue) {
+		if minBackoff > 0 {
+			q.minBackoff = minBackoff
+		}
+		if maxBackoff > 0 {
+			q.maxBackoff = maxBackoff
+		}
+	}
 }
 
-func NewQueue(cfg *config.Config) (*Queue, error) {
-	amqpConnectionString := fmt.Sprintf("amqp://%s:%s@%s:%s/",
-		cfg.RabbitMQ.Username, cfg.RabbitMQ.Password, cfg.RabbitMQ.Host, cfg.RabbitMQ.Port)
-	conn, err := amqp.Dial(amqpConnectionString)
+// WithBufferSize задаёт, сколько сообщений хранить, пока нет связи с брокером.
+func WithBufferSize(size int) Option {
+	return func(q *Queue) {
+		if size > 0 {
+			q.bufferSize = size
+		}
+	}
+}
+
+// NewQueue подключается к RabbitMQ и объявляет очередь name. Первое подключение должно
+// пройти успешно, дальнейшие разрывы связи очередь восстанавливает сама.
+func NewQueue(cfg config.RabbitMQ, name string, opts ...Option) (*Queue, error) {
+	tlsConfig, err := tlsconfig.Client(cfg.TLS)
 	if err != nil {
 		return nil, err
 	}
 
-	ch, err := conn.Channel()
+	scheme := "amqp"
+	if tlsConfig != nil {
+		scheme = "amqps"
+	}
+	amqpConnectionString := fmt.Sprintf("%s://%s:%s@%s:%s/", scheme,
+		cfg.Username, cfg.Password, cfg.Host, cfg.Port)
+
+	q := newQueue(amqpConnectionString, tlsConfig, name, opts...)
+	sess, err := q.dial()
 	if err != nil {
 		return nil, err
 	}
+	q.connected(sess)
+	go q.supervise()
+	return q, nil
+}
 
-	q, err := ch.QueueDeclare(
-		"notifications", // name
-		false,           // durable
-		false,           // delete when unused
-		false,           // exclusive
-		false,           // no-wait
-		nil,             // arguments
-	)
+// newQueue создаёт очередь без подключения, в состоянии StateReconnecting.
+func newQueue(url string, tlsConfig *tls.Config, name string, opts ...Option) *Queue {
+	q := &Queue{
+		url:        url,
+		tlsConfig:  tlsConfig,
+		name:       name,
+		minBackoff: DefaultMinBackoff,
+		maxBackoff: DefaultMaxBackoff,
+		bufferSize: DefaultBufferSize,
+		state:      StateReconnecting,
+		ready:      make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	q.dialer = q.dialAMQP
+	return q
+}
+
+// dial открывает новое подключение.
+func (q *Queue) dial() (*session, error) {
+	c, err := q.dialer()
 	if err != nil {
 		return nil, err
 	}
+	return &session{conn: c, lost: make(chan struct{})}, nil
+}
 
-	return &Queue{
-		Connection: conn,
-		Channel:    ch,
-		Queue:      &q,
-	}, nil
+// connected делает подключение текущим и запускает отправку сообщений, накопленных без связи.
+func (q *Queue) connected(sess *session) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.state == StateClosed {
+		_ = sess.conn.Close()
+		return
+	}
+	q.sess, q.state, q.lastErr = sess, StateConnected, nil
+	close(q.ready)
+	q.startFlushLocked()
 }
 
+// startFlushLocked запускает flush, если в буфере есть сообщения и он ещё не запущен.
+// Вызывается под q.mu.
+func (q *Queue) startFlushLocked() {
+	if q.flushing || len(q.pending) == 0 {
+		return
+	}
+	q.flushing = true
+	go q.flush()
+}
+
+// flush отправляет буфер по одному сообщению с его начала, пока он не опустеет; сообщение
+// убирается из буфера после подтверждения брокером. Публикация ждёт подтверждений, поэтому
+// идёт без q.mu. Одновременно работает только один flush.
+func (q *Queue) flush() {
+	flushed := 0
+	backoff := q.minBackoff
+	defer func() {
+		if flushed > 0 {
+			log.Printf("Flushed %d buffered messages to queue %s", flushed, q.name)
+		}
+	}()
+
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 || q.state == StateClosed {
+			q.flushing = false
+			q.mu.Unlock()
+			return
+		}
+		sess, ready, msg := q.sess, q.ready, q.pending[0]
+		q.mu.Unlock()
+
+		if sess == nil {
+			// Связь потеряна: продолжим после переподключения
+			select {
+			case <-q.done:
+				return
+			case <-ready:
+				continue
+			}
+		}
+
+		if err := sess.conn.Publish(msg); err != nil {
+			log.Printf("Failed to flush buffered messages to queue %s, retry in %s: %v", q.name, backoff, err)
+			timer := time.NewTimer(backoff)
+			select {
+			case <-q.done:
+				timer.Stop()
+				return
+			case <-sess.lost:
+				timer.Stop()
+				backoff = q.minBackoff
+			case <-timer.C:
+				backoff = nextBackoff(backoff, q.maxBackoff)
+			}
+			continue
+		}
+		backoff = q.minBackoff
+		flushed++
+
+		q.mu.Lock()
+		// Буфер мог очистить Close, иначе в его начале - отправленное сообщение
+		if len(q.pending) > 0 {
+			q.pending = q.pending[1:]
+		}
+		q.mu.Unlock()
+	}
+}
+
+// supervise следит за подключением и восстанавливает его после разрыва, пока очередь не закрыта.
+func (q *Queue) supervise() {
+	for {
+		q.mu.Lock()
+		sess := q.sess
+		q.mu.Unlock()
+		if sess == nil {
+			return
+		}
+
+		var reason *amqp.Error
+		select {
+		case <-q.done:
+			return
+		case reason = <-sess.conn.Closed():
+		}
+		err := amqp.ErrClosed
+		if reason != nil {
+			err = reason
+		}
+		log.Printf("Lost connection to queue %s: %v", q.name, err)
+		q.disconnected(sess, err)
+
+		sess, ok := q.reconnect()
+		if !ok {
+			return
+		}
+		q.connected(sess)
+		log.Printf("Reconnected to queue %s", q.name)
+	}
+}
+
+// disconnected переводит очередь в StateReconnecting; канал без соединения закрывается вместе с ним.
+func (q *Queue) disconnected(sess *session, err error) {
+	q.mu.Lock()
+	if q.state == StateConnected {
+		q.state, q.sess, q.lastErr = StateReconnecting, nil, err
+		q.ready = make(chan struct{})
+	}
+	q.mu.Unlock()
+	close(sess.lost)
+	_ = sess.conn.Close()
+}
+
+// reconnect подключается заново с экспоненциальной задержкой; false - очередь закрыта.
+func (q *Queue) reconnect() (*session, bool) {
+	backoff := q.minBackoff
+	for {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-q.done:
+			timer.Stop()
+			return nil, false
+		case <-timer.C:
+		}
+
+		sess, err := q.dial()
+		if err == nil {
+			return sess, true
+		}
+		log.Printf("Failed to reconnect to queue %s, retry in %s: %v", q.name, backoff, err)
+		q.mu.Lock()
+		q.lastErr = err
+		q.mu.Unlock()
+		backoff = nextBackoff(backoff, q.maxBackoff)
+	}
+}
+
+func nextBackoff(backoff, maxBackoff time.Duration) time.Duration {
+	return min(backoff*2, maxBackoff)
+}
+
+// Send публикует сообщение и ждёт подтверждения брокера. Без связи с брокером, без
+// подтверждения или пока отправляется буфер сообщение встаёт в конец буфера.
 func (q *Queue) Send(msg string) error {
-	err := q.Channel.Publish(
-		"",           // Exchange
-		q.Queue.Name, // Routing key
-		false,        // Mandatory
-		false,        // Immediate
-		amqp.Publishing{
-			ContentType: "text/plain",
-			Body:        []byte(msg),
-		})
-	if err != nil {
-		log.Printf("Failed to publish a message: %v", err)
+	q.mu.Lock()
+	if q.state == StateClosed {
+		q.mu.Unlock()
+		return ErrClosed
+	}
+	sess := q.sess
+	if sess == nil || q.flushing {
+		defer q.mu.Unlock()
+		return q.bufferLocked(msg)
+	}
+	q.mu.Unlock()
+
+	err := sess.conn.Publish(msg)
+	if err == nil {
+		return nil
+	}
+	log.Printf("Failed to publish a message to queue %s: %v", q.name, err)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.state == StateClosed {
+		return ErrClosed
+	}
+	if err := q.bufferLocked(msg); err != nil {
 		return err
 	}
+	// Подключение может быть живым, например брокер отказался подтвердить сообщение
+	q.startFlushLocked()
+	return nil
+}
 
-	log.Printf("Event sent to queue: %s", msg)
+// bufferLocked добавляет сообщение в конец буфера. Вызывается под q.mu.
+func (q *Queue) bufferLocked(msg string) error {
+	if len(q.pending) >= q.bufferSize {
+		return fmt.Errorf("%w: %d messages for %s", ErrBufferFull, len(q.pending), q.name)
+	}
+	q.pending = append(q.pending, msg)
 	return nil
 }
 
+// Receive возвращает сообщения очереди. После переподключения подписка восстанавливается,
+// канал закрывается только после Close.
+//
+// Сообщение подтверждается брокеру, когда читатель забирает следующее или очередь закрывается,
+// поэтому закрывать очередь нужно после того, как читатель обработал последнее сообщение.
+// Если читатель упал, не закончив обработку, брокер отдаст сообщение снова. Сообщение,
+// полученное по оборвавшемуся подключению, тоже придёт повторно: доставка "хотя бы один раз".
 func (q *Queue) Receive() (<-chan string, error) {
-	msgs, err := q.Channel.Consume(
-		q.Queue.Name, // Queue name
-		"",           // Consumer
-		true,         // Auto-Ack
-		false,        // Exclusive
-		false,        // No-local
-		false,        // No-wait
-		nil,          // Args
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.state == StateClosed {
+		return nil, ErrClosed
+	}
+
+	strChan := make(chan string)
+	q.consumers.Add(1)
+	go q.consume(strChan)
+	return strChan, nil
+}
+
+// closedDeliveries заменяет поток сообщений, если подписаться не удалось.
+var closedDeliveries = func() <-chan amqp.Delivery {
+	ch := make(chan amqp.Delivery)
+	close(ch)
+	return ch
+}()
+
+func (q *Queue) consume(out chan<- string) {
+	defer q.consumers.Done()
+	defer close(out)
+	for {
+		q.mu.Lock()
+		sess, ready := q.sess, q.ready
+		q.mu.Unlock()
+		if sess == nil {
+			select {
+			case <-q.done:
+				return
+			case <-ready:
+				continue
+			}
+		}
+
+		msgs, err := sess.conn.Consume()
+		if err != nil {
+			// Ошибка закрывает канал, и supervise переподключится
+			log.Printf("Failed to register a consumer: %v", err)
+			msgs = closedDeliveries
+		}
+		if !q.deliver(msgs, out) {
+			return
+		}
+		// Поток сообщений прервался вместе с подключением - ждём, пока supervise его заменит
+		select {
+		case <-q.done:
+			return
+		case <-sess.lost:
+		}
+	}
+}
+
+// deliver передаёт читателю сообщения одной подписки, пока она не прервётся; false - очередь закрыта.
+// Переданное сообщение подтверждается, когда читатель забрал следующее, то есть обработал это.
+// Подтвердить сообщение прервавшейся подписки нельзя, его доставят снова.
+func (q *Queue) deliver(msgs <-chan amqp.Delivery, out chan<- string) bool {
+	var handed *amqp.Delivery
+	for {
+		select {
+		case <-q.done:
+			// Читатель перестал забирать сообщения и обработал последнее переданное
+			ack(handed)
+			return false
+		case msg, ok := <-msgs:
+			if !ok {
+				return true
+			}
+			select {
+			case out <- string(msg.Body):
+				ack(handed)
+				handed = &msg
+			case <-q.done:
+				ack(handed)
+				_ = msg.Nack(false, true)
+				return false
+			}
+		}
+	}
+}
+
+func ack(msg *amqp.Delivery) {
+	if msg == nil {
+		return
+	}
+	if err := msg.Ack(false); err != nil {
+		log.Printf("Failed to ack a message: %v", err)
+	}
+}
+
+// State возвращает состояние подключения.
+func (q *Queue) State() State {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.state
+}
+
+// Healthy возвращает ошибку, если связи с брокером нет.
+func (q *Queue) Healthy() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.state == StateConnected {
+		return nil
+	}
+	if q.lastErr != nil {
+		return fmt.Errorf("rabbitmq queue %s is %s: %w", q.name, q.state, q.lastErr)
+	}
+	return fmt.Errorf("rabbitmq queue %s is %s", q.name, q.state)
+}
+
+// Close закрывает соединение и останавливает переподключение; неотправленные сообщения из буфера теряются.
+func (q *Queue) Close() error {
+	var err error
+	q.closeOnce.Do(func() {
+		q.mu.Lock()
+		sess := q.sess
+		if len(q.pending) > 0 {
+			log.Printf("Dropped %d buffered messages for queue %s", len(q.pending), q.name)
+		}
+		q.state, q.sess, q.pending = StateClosed, nil, nil
+		q.mu.Unlock()
+
+		close(q.done)
+		// Соединение закрывается после того, как читатели подтвердили обработанные сообщения
+		q.consumers.Wait()
+		if sess != nil {
+			err = sess.conn.Close()
+		}
+	})
+	return err
+}
+
+// amqpConn - подключение к RabbitMQ через amqp091.
+type amqpConn struct {
+	conn    *amqp.Connection
+	channel *amqp.Channel
+	name    string
+	closed  chan *amqp.Error
+}
+
+// dialAMQP открывает соединение и канал в режиме подтверждений и объявляет
+// устойчивую очередь.
+//
+// Очередь, объявленная прежними версиями неустойчивой, переобъявить нельзя: брокер отвечает
+// PRECONDITION_FAILED. Тогда очередь используется как есть, с предупреждением в журнале,
+// чтобы обновление не останавливало доставку. Чтобы перейти на устойчивую очередь,
+// дождитесь, пока она опустеет, и удалите её (rabbitmqctl delete_queue <name>):
+// при следующем подключении она будет объявлена устойчивой.
+func (q *Queue) dialAMQP() (conn, error) {
+	var (
+		connection *amqp.Connection
+		err        error
 	)
+	if q.tlsConfig != nil {
+		connection, err = amqp.DialTLS(q.url, q.tlsConfig)
+	} else {
+		connection, err = amqp.Dial(q.url)
+	}
 	if err != nil {
-		log.Printf("Failed to register a consumer: %v", err)
+		return nil, err
 	}
 
-	// Создаем новый канал для строк
-	strChan := make(chan string)
+	ch, err := connection.Channel()
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
 
-	go func() {
-		defer close(strChan)
+	_, err = ch.QueueDeclare(
+		q.name, // name
+		true,   // durable
+		false,  // delete when unused
+		false,  // exclusive
+		false,  // no-wait
+		nil,    // arguments
+	)
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.PreconditionFailed {
+		log.Printf("Queue %s was declared non-durable and loses messages on broker restart;"+
+			" delete it once drained to redeclare it durable", q.name)
+		// Ошибка объявления закрыла канал
+		ch, err = connection.Channel()
+		if err == nil {
+			_, err = ch.QueueDeclarePassive(q.name, false, false, false, false, nil)
+		}
+	}
+	if err == nil {
+		err = ch.Confirm(false)
+	}
+	if err == nil {
+		err = ch.Qos(prefetch, 0, false)
+	}
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
 
-		for msg := range msgs {
-			strChan <- string(msg.Body)
+	c := &amqpConn{conn: connection, channel: ch, name: q.name, closed: make(chan *amqp.Error, 1)}
+	connClosed := connection.NotifyClose(make(chan *amqp.Error, 1))
+	chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		var reason *amqp.Error
+		select {
+		case reason = <-connClosed:
+		case reason = <-chClosed:
 		}
+		c.closed <- reason
 	}()
+	return c, nil
+}
 
-	return strChan, nil
+func (c *amqpConn) Publish(msg string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), confirmTimeout)
+	defer cancel()
+	confirm, err := c.channel.PublishWithDeferredConfirmWithContext(ctx,
+		"",     // Exchange
+		c.name, // Routing key
+		false,  // Mandatory
+		false,  // Immediate
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Body:         []byte(msg),
+		})
+	if err != nil {
+		return err
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return ErrNotConfirmed
+	}
+	return nil
+}
+
+func (c *amqpConn) Consume() (<-chan amqp.Delivery, error) {
+	return c.channel.Consume(
+		c.name, // Queue name
+		"",     // Consumer
+		false,  // Auto-Ack
+		false,  // Exclusive
+		false,  // No-local
+		false,  // No-wait
+		nil,    // Args
+	)
+}
+
+func (c *amqpConn) Closed() <-chan *amqp.Error {
+	return c.closed
+}
+
+func (c *amqpConn) Close() error {
+	return c.conn.Close()
 }
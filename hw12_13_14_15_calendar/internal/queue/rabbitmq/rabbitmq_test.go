@@ -0,0 +1,301 @@
+package rabbitmq
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextBackoff(t *testing.T) {
+	backoff := DefaultMinBackoff
+	var got []time.Duration
+	for i := 0; i < 8; i++ {
+		backoff = nextBackoff(backoff, DefaultMaxBackoff)
+		got = append(got, backoff)
+	}
+	require.Equal(t, []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second,
+		DefaultMaxBackoff, DefaultMaxBackoff, DefaultMaxBackoff,
+	}, got)
+}
+
+func TestSendWhileReconnecting(t *testing.T) {
+	q := newQueue("amqp://localhost", nil, "notifications", WithBufferSize(2))
+	q.lastErr = errors.New("connection refused")
+	require.Equal(t, StateReconnecting, q.State())
+	require.ErrorContains(t, q.Healthy(), "rabbitmq queue notifications is reconnecting: connection refused")
+
+	// Без связи сообщения ждут в буфере, пока он не заполнится
+	require.NoError(t, q.Send("first"))
+	require.NoError(t, q.Send("second"))
+	require.ErrorIs(t, q.Send("third"), ErrBufferFull)
+	require.Equal(t, []string{"first", "second"}, q.pending)
+
+	// Читатель ждёт подключения, а после Close его канал закрывается
+	messages, err := q.Receive()
+	require.NoError(t, err)
+	require.NoError(t, q.Close())
+	select {
+	case _, ok := <-messages:
+		require.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("receive channel was not closed")
+	}
+
+	require.Equal(t, StateClosed, q.State())
+	require.ErrorIs(t, q.Send("late"), ErrClosed)
+	_, err = q.Receive()
+	require.ErrorIs(t, err, ErrClosed)
+}
+
+// fakeConn - подключение к брокеру в памяти.
+type fakeConn struct {
+	mu        sync.Mutex
+	published []string
+	acked     []uint64
+	nacked    []uint64
+	// publishErr - ошибка публикации, например отказ брокера подтвердить сообщение.
+	publishErr error
+	// gate, если задан, задерживает каждую публикацию до получения из него.
+	gate       chan struct{}
+	deliveries chan amqp.Delivery
+	closed     chan *amqp.Error
+	closeOnce  sync.Once
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{deliveries: make(chan amqp.Delivery), closed: make(chan *amqp.Error, 1)}
+}
+
+func (c *fakeConn) Publish(msg string) error {
+	if c.gate != nil {
+		<-c.gate
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.publishErr != nil {
+		return c.publishErr
+	}
+	c.published = append(c.published, msg)
+	return nil
+}
+
+func (c *fakeConn) Consume() (<-chan amqp.Delivery, error) {
+	return c.deliveries, nil
+}
+
+func (c *fakeConn) Closed() <-chan *amqp.Error {
+	return c.closed
+}
+
+// Close прекращает поставку сообщений, как закрытое соединение amqp.
+func (c *fakeConn) Close() error {
+	c.closeOnce.Do(func() { close(c.deliveries) })
+	return nil
+}
+
+func (c *fakeConn) Ack(tag uint64, _ bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.acked = append(c.acked, tag)
+	return nil
+}
+
+func (c *fakeConn) Nack(tag uint64, _, _ bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nacked = append(c.nacked, tag)
+	return nil
+}
+
+func (c *fakeConn) Reject(uint64, bool) error { return nil }
+
+// deliver отдаёт сообщение читателю, как брокер.
+func (c *fakeConn) deliver(t *testing.T, tag uint64, body string) {
+	t.Helper()
+	select {
+	case c.deliveries <- amqp.Delivery{Acknowledger: c, DeliveryTag: tag, Body: []byte(body)}:
+	case <-time.After(time.Second):
+		t.Fatal("consumer did not take the delivery")
+	}
+}
+
+// lose обрывает подключение, как перезапуск брокера.
+func (c *fakeConn) lose() {
+	_ = c.Close()
+	c.closed <- amqp.ErrClosed
+}
+
+func (c *fakeConn) messages() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.published...)
+}
+
+func (c *fakeConn) ackedTags() []uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]uint64(nil), c.acked...)
+}
+
+// fakeDialer выдаёт подключения из conns по одному; пока их нет, подключиться нельзя.
+type fakeDialer struct {
+	mu    sync.Mutex
+	conns []*fakeConn
+}
+
+func (d *fakeDialer) add(c *fakeConn) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.conns = append(d.conns, c)
+}
+
+func (d *fakeDialer) dial() (conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.conns) == 0 {
+		return nil, errors.New("connection refused")
+	}
+	c := d.conns[0]
+	d.conns = d.conns[1:]
+	return c, nil
+}
+
+// newFakeQueue подключает очередь к первому подключению, как NewQueue.
+func newFakeQueue(t *testing.T, first *fakeConn) (*Queue, *fakeDialer) {
+	t.Helper()
+	dialer := &fakeDialer{}
+	q := newQueue("amqp://localhost", nil, "notifications", WithBackoff(time.Millisecond, 5*time.Millisecond))
+	q.dialer = dialer.dial
+	dialer.add(first)
+	sess, err := q.dial()
+	require.NoError(t, err)
+	q.connected(sess)
+	go q.supervise()
+	t.Cleanup(func() { _ = q.Close() })
+	return q, dialer
+}
+
+func TestReconnectFlushesBuffer(t *testing.T) {
+	first := newFakeConn()
+	q, dialer := newFakeQueue(t, first)
+
+	require.NoError(t, q.Send("first"))
+	require.Equal(t, []string{"first"}, first.messages())
+
+	// Брокер перезапускается: сообщения копятся в буфере, пока подключиться нельзя
+	first.lose()
+	require.Eventually(t, func() bool { return q.State() == StateReconnecting }, time.Second, time.Millisecond)
+	require.ErrorContains(t, q.Healthy(), "rabbitmq queue notifications is reconnecting")
+	require.NoError(t, q.Send("second"))
+	require.NoError(t, q.Send("third"))
+
+	second := newFakeConn()
+	dialer.add(second)
+	require.Eventually(t, func() bool { return len(second.messages()) == 2 }, time.Second, time.Millisecond)
+	require.Equal(t, []string{"second", "third"}, second.messages())
+	require.Equal(t, StateConnected, q.State())
+	require.NoError(t, q.Healthy())
+}
+
+func TestUnconfirmedMessageStaysBuffered(t *testing.T) {
+	first := newFakeConn()
+	first.publishErr = ErrNotConfirmed
+	q, dialer := newFakeQueue(t, first)
+
+	// Брокер не подтвердил сообщение: оно остаётся в буфере до следующего подключения
+	require.NoError(t, q.Send("unconfirmed"))
+	q.mu.Lock()
+	require.Equal(t, []string{"unconfirmed"}, q.pending)
+	q.mu.Unlock()
+
+	second := newFakeConn()
+	dialer.add(second)
+	first.lose()
+	require.Eventually(t, func() bool { return len(second.messages()) == 1 }, time.Second, time.Millisecond)
+	require.Equal(t, []string{"unconfirmed"}, second.messages())
+}
+
+func TestConsumeResubscribesAfterReconnect(t *testing.T) {
+	first := newFakeConn()
+	q, dialer := newFakeQueue(t, first)
+
+	messages, err := q.Receive()
+	require.NoError(t, err)
+	receive := func() string {
+		t.Helper()
+		select {
+		case msg := <-messages:
+			return msg
+		case <-time.After(time.Second):
+			t.Fatal("no message received")
+			return ""
+		}
+	}
+
+	first.deliver(t, 1, "before")
+	require.Equal(t, "before", receive())
+	// Пока читатель не забрал следующее сообщение, предыдущее не подтверждено
+	require.Empty(t, first.ackedTags())
+	first.deliver(t, 2, "unprocessed")
+	require.Equal(t, "unprocessed", receive())
+	require.Eventually(t, func() bool {
+		return len(first.ackedTags()) == 1
+	}, time.Second, time.Millisecond)
+	require.Equal(t, []uint64{1}, first.ackedTags())
+
+	// Подключение оборвалось: сообщение 2 брокер отдаст снова
+	second := newFakeConn()
+	dialer.add(second)
+	first.lose()
+	second.deliver(t, 1, "unprocessed")
+	require.Equal(t, "unprocessed", receive())
+	require.Equal(t, []uint64{1}, first.ackedTags())
+
+	// Close подтверждает последнее обработанное сообщение до закрытия соединения
+	require.NoError(t, q.Close())
+	_, ok := <-messages
+	require.False(t, ok)
+	require.Equal(t, []uint64{1}, second.ackedTags())
+}
+
+func TestCloseReturnsUnreadMessage(t *testing.T) {
+	first := newFakeConn()
+	q, _ := newFakeQueue(t, first)
+
+	_, err := q.Receive()
+	require.NoError(t, err)
+
+	// Читатель не забрал сообщение: после Close оно возвращается в очередь
+	first.deliver(t, 1, "unread")
+	require.NoError(t, q.Close())
+	first.mu.Lock()
+	defer first.mu.Unlock()
+	require.Empty(t, first.acked)
+	require.Equal(t, []uint64{1}, first.nacked)
+}
+
+func TestSendDuringFlushKeepsOrder(t *testing.T) {
+	first := newFakeConn()
+	q, dialer := newFakeQueue(t, first)
+
+	first.lose()
+	require.Eventually(t, func() bool { return q.State() == StateReconnecting }, time.Second, time.Millisecond)
+	require.NoError(t, q.Send("first"))
+	require.NoError(t, q.Send("second"))
+
+	// Брокер подтверждает медленно: новое сообщение ждёт в буфере, пока не уйдут накопленные
+	second := newFakeConn()
+	second.gate = make(chan struct{})
+	dialer.add(second)
+	require.Eventually(t, func() bool { return q.State() == StateConnected }, time.Second, time.Millisecond)
+	require.NoError(t, q.Send("third"))
+	close(second.gate)
+
+	require.Eventually(t, func() bool { return len(second.messages()) == 3 }, time.Second, time.Millisecond)
+	require.Equal(t, []string{"first", "second", "third"}, second.messages())
+}
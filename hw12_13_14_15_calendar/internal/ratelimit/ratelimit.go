@@ -0,0 +1,104 @@
+// Package ratelimit реализует ограничение частоты запросов алгоритмом token bucket
+// с отдельным ведром на каждый ключ (пользователя, IP-адрес).
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/config"
+)
+
+// sweepInterval - как часто удаляются вёдра, которые давно не использовались.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter ограничивает частоту событий по ключу: в среднем rate событий в секунду
+// с допустимым всплеском до burst. Безопасен для конкурентного использования.
+type Limiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow расходует один токен ключа. Если токенов нет, возвращает false
+// и время, через которое появится следующий токен.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if l.rate <= 0 {
+		return false, sweepInterval
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep удаляет вёдра, успевшие наполниться: их состояние совпадает с новым ведром.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RetryAfterSeconds округляет время ожидания вверх до целых секунд
+// для заголовка Retry-After.
+func RetryAfterSeconds(wait time.Duration) int {
+	return int(math.Max(1, math.Ceil(wait.Seconds())))
+}
+
+// New создаёт ограничитель по настройкам; при нулевом rps ограничение
+// отключено и возвращается nil, для которого Allow всегда разрешает запрос.
+func New(cfg config.Limit) *Limiter {
+	if cfg.RPS <= 0 {
+		return nil
+	}
+	burst := cfg.Burst
+	if burst < 1 {
+		burst = int(math.Ceil(cfg.RPS))
+	}
+	return NewLimiter(cfg.RPS, burst)
+}
@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2024, time.September, 2, 10, 0, 0, 0, time.UTC)
+	l := NewLimiter(1, 2)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("user1"); !ok {
+			t.Fatalf("expected request %d within burst to be allowed", i)
+		}
+	}
+	ok, wait := l.Allow("user1")
+	if ok || wait != time.Second {
+		t.Fatalf("expected request over burst to wait 1s, got %v, %v", ok, wait)
+	}
+	if ok, _ := l.Allow("user2"); !ok {
+		t.Fatal("expected other key to have its own bucket")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if _, wait := l.Allow("user1"); wait != 500*time.Millisecond {
+		t.Fatalf("expected half a token refilled, got wait %v", wait)
+	}
+	now = now.Add(time.Second)
+	if ok, _ := l.Allow("user1"); !ok {
+		t.Fatal("expected token to be refilled")
+	}
+
+	now = now.Add(time.Hour)
+	l.Allow("user3")
+	if _, ok := l.buckets["user2"]; ok {
+		t.Fatal("expected idle bucket to be swept")
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	if got := RetryAfterSeconds(100 * time.Millisecond); got != 1 {
+		t.Fatalf("expected 1, got %d", got)
+	}
+	if got := RetryAfterSeconds(2100 * time.Millisecond); got != 3 {
+		t.Fatalf("expected 3, got %d", got)
+	}
+}
@@ -0,0 +1,119 @@
+package memorystorage
+
+import (
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"golang.org/x/net/context"
+)
+
+func (s *Storage) CreateCalendar(ctx context.Context, calendar model.Calendar) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	calendar.ID = s.generateID()
+	calendar.Shares = nil
+	s.calendars[calendar.ID] = calendar
+	return calendar.ID, nil
+}
+
+func (s *Storage) UpdateCalendar(ctx context.Context, id uuid.UUID, calendar model.Calendar) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.calendars[id]
+	if !ok {
+		return model.ErrCalendarNotFound
+	}
+
+	// Владелец и список доступов меняются только через отдельные методы
+	old.Name = calendar.Name
+	old.Description = calendar.Description
+	s.calendars[id] = old
+	return nil
+}
+
+func (s *Storage) DeleteCalendar(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.calendars[id]; !ok {
+		return model.ErrCalendarNotFound
+	}
+
+	for eventID, event := range s.events {
+		if event.CalendarID == id {
+			_, _ = s.deleteEvent(eventID)
+		}
+	}
+	delete(s.calendars, id)
+	return nil
+}
+
+func (s *Storage) GetCalendar(ctx context.Context, id uuid.UUID) (model.Calendar, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	calendar, ok := s.calendars[id]
+	if !ok {
+		return model.Calendar{}, model.ErrCalendarNotFound
+	}
+	return calendar, nil
+}
+
+func (s *Storage) ListCalendars(ctx context.Context, userID string) ([]model.Calendar, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var calendars []model.Calendar
+	for _, calendar := range s.calendars {
+		if calendar.PermissionFor(userID) != model.PermissionNone {
+			calendars = append(calendars, calendar)
+		}
+	}
+	sort.Slice(calendars, func(i, j int) bool {
+		return calendars[i].Name < calendars[j].Name
+	})
+	return calendars, nil
+}
+
+func (s *Storage) ShareCalendar(ctx context.Context, calendarID uuid.UUID, share model.CalendarShare) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	calendar, ok := s.calendars[calendarID]
+	if !ok {
+		return model.ErrCalendarNotFound
+	}
+
+	shares := make([]model.CalendarShare, 0, len(calendar.Shares)+1)
+	for _, existing := range calendar.Shares {
+		if existing.UserID != share.UserID {
+			shares = append(shares, existing)
+		}
+	}
+	calendar.Shares = append(shares, share)
+	s.calendars[calendarID] = calendar
+	return nil
+}
+
+func (s *Storage) RevokeCalendarShare(ctx context.Context, calendarID uuid.UUID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	calendar, ok := s.calendars[calendarID]
+	if !ok {
+		return model.ErrCalendarNotFound
+	}
+
+	shares := make([]model.CalendarShare, 0, len(calendar.Shares))
+	for _, existing := range calendar.Shares {
+		if existing.UserID != userID {
+			shares = append(shares, existing)
+		}
+	}
+	calendar.Shares = shares
+	s.calendars[calendarID] = calendar
+	return nil
+}
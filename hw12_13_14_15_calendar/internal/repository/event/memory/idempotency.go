@@ -0,0 +1,58 @@
+package memorystorage
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"golang.org/x/net/context"
+)
+
+type idempotencyRecord struct {
+	requestHash string
+	eventID     uuid.UUID
+	expiresAt   time.Time
+}
+
+// CreateEventIdempotent создаёт событие, запоминая результат под ключом. Повтор с тем же
+// ключом и тем же запросом возвращает исходный ID и replayed = true.
+func (s *Storage) CreateEventIdempotent(
+	ctx context.Context, key model.IdempotencyKey, event model.Event,
+) (id uuid.UUID, replayed bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	s.sweepIdempotencyKeys(now)
+
+	if record, ok := s.idempotency[key.Scoped()]; ok && now.Before(record.expiresAt) {
+		if record.requestHash != key.RequestHash {
+			return uuid.Nil, false, model.ErrIdempotencyKeyReused
+		}
+		return record.eventID, true, nil
+	}
+
+	id, err = s.createEvent(event)
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+	s.idempotency[key.Scoped()] = idempotencyRecord{
+		requestHash: key.RequestHash,
+		eventID:     id,
+		expiresAt:   key.ExpiresAt,
+	}
+	return id, false, nil
+}
+
+// sweepIdempotencyKeys раз в минуту удаляет истёкшие ключи.
+func (s *Storage) sweepIdempotencyKeys(now time.Time) {
+	if now.Sub(s.lastIdempotencySweep) < time.Minute {
+		return
+	}
+	s.lastIdempotencySweep = now
+	for key, record := range s.idempotency {
+		if !now.Before(record.expiresAt) {
+			delete(s.idempotency, key)
+		}
+	}
+}
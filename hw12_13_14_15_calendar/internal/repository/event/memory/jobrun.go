@@ -0,0 +1,35 @@
+package memorystorage
+
+import (
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"golang.org/x/net/context"
+)
+
+// maxJobRuns - сколько последних запусков задач хранится в памяти.
+const maxJobRuns = model.MaxJobRunLimit
+
+// SaveJobRun добавляет запись в историю запусков задач планировщика.
+func (s *Storage) SaveJobRun(_ context.Context, run model.JobRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobRuns = append(s.jobRuns, run)
+	if len(s.jobRuns) > maxJobRuns {
+		s.jobRuns = append(s.jobRuns[:0], s.jobRuns[len(s.jobRuns)-maxJobRuns:]...)
+	}
+	return nil
+}
+
+// ListJobRuns возвращает последние запуски задач, начиная с самого нового.
+func (s *Storage) ListJobRuns(_ context.Context, filter model.JobRunFilter) ([]model.JobRun, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var runs []model.JobRun
+	for i := len(s.jobRuns) - 1; i >= 0 && len(runs) < filter.Limit; i-- {
+		if filter.Job == "" || s.jobRuns[i].Job == filter.Job {
+			runs = append(runs, s.jobRuns[i])
+		}
+	}
+	return runs, nil
+}
@@ -0,0 +1,103 @@
+package memorystorage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"golang.org/x/net/context"
+)
+
+// notificationRetention - сколько хранится журнал уведомлений.
+const notificationRetention = 30 * 24 * time.Hour
+
+// SaveNotifications добавляет записи в журнал уведомлений и удаляет записи старше notificationRetention.
+func (s *Storage) SaveNotifications(_ context.Context, records []model.NotificationRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.saveNotifications(records)
+	return nil
+}
+
+// saveNotifications добавляет записи в журнал и удаляет устаревшие; вызывается под s.mu.
+func (s *Storage) saveNotifications(records []model.NotificationRecord) {
+	cutoff := s.clock.Now().Add(-notificationRetention)
+	for id, record := range s.notifications {
+		if record.QueuedAt.Before(cutoff) {
+			delete(s.notifications, id)
+		}
+	}
+	for _, record := range records {
+		s.notifications[record.ID] = record
+	}
+}
+
+// UpdateNotificationStatus применяет отчёт отправителя к записи журнала.
+func (s *Storage) UpdateNotificationStatus(_ context.Context, report model.NotificationStatusReport) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.notifications[report.ID]
+	if !ok {
+		return model.ErrNotificationNotFound
+	}
+	record.Status = report.Status
+	record.Attempts = report.Attempts
+	record.LastError = report.Error
+	record.UpdatedAt = report.At
+	s.notifications[report.ID] = record
+	return nil
+}
+
+// ListNotifications возвращает записи журнала, начиная с самой новой.
+func (s *Storage) ListNotifications(
+	_ context.Context, filter model.NotificationFilter,
+) ([]model.NotificationRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var records []model.NotificationRecord
+	for _, record := range s.notifications {
+		if filter.OwnerID != "" && record.OwnerID != filter.OwnerID {
+			continue
+		}
+		if filter.EventID != uuid.Nil && record.EventID != filter.EventID {
+			continue
+		}
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].QueuedAt.Equal(records[j].QueuedAt) {
+			return records[i].QueuedAt.After(records[j].QueuedAt)
+		}
+		return records[i].ID.String() < records[j].ID.String()
+	})
+	if len(records) > filter.Limit {
+		records = records[:filter.Limit]
+	}
+	return records, nil
+}
+
+// ListDeferredNotifications возвращает отложенные записи журнала, время отправки которых наступило к until.
+func (s *Storage) ListDeferredNotifications(
+	_ context.Context, until time.Time,
+) ([]model.NotificationRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var records []model.NotificationRecord
+	for _, record := range s.notifications {
+		if record.Status == model.NotificationDeferred && !record.SendAfter.After(until) {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].SendAfter.Equal(records[j].SendAfter) {
+			return records[i].SendAfter.Before(records[j].SendAfter)
+		}
+		return records[i].QueuedAt.Before(records[j].QueuedAt)
+	})
+	return records, nil
+}
@@ -0,0 +1,106 @@
+package memorystorage
+
+import (
+	"slices"
+	"time"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"golang.org/x/net/context"
+)
+
+func (s *Storage) GetNotificationPreferences(
+	_ context.Context, userID string,
+) (model.NotificationPreferences, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	prefs, ok := s.preferences[userID]
+	if !ok {
+		return model.NotificationPreferences{}, model.ErrPreferencesNotFound
+	}
+	prefs.Channels = slices.Clone(prefs.Channels)
+	return prefs, nil
+}
+
+// SaveNotificationPreferences создаёт или заменяет настройки пользователя.
+func (s *Storage) SaveNotificationPreferences(_ context.Context, prefs model.NotificationPreferences) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefs.Channels = slices.Clone(prefs.Channels)
+	s.preferences[prefs.UserID] = prefs
+	return nil
+}
+
+func (s *Storage) DeleteNotificationPreferences(_ context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.preferences[userID]; !ok {
+		return model.ErrPreferencesNotFound
+	}
+	delete(s.preferences, userID)
+	return nil
+}
+
+// ListNotificationPreferences возвращает настройки пользователей, которые их задали.
+func (s *Storage) ListNotificationPreferences(
+	_ context.Context, userIDs []string,
+) (map[string]model.NotificationPreferences, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string]model.NotificationPreferences, len(userIDs))
+	for _, userID := range userIDs {
+		if prefs, ok := s.preferences[userID]; ok {
+			prefs.Channels = slices.Clone(prefs.Channels)
+			result[userID] = prefs
+		}
+	}
+	return result, nil
+}
+
+// ListAgendaPreferences возвращает настройки пользователей, включивших ежедневную сводку.
+func (s *Storage) ListAgendaPreferences(_ context.Context) ([]model.NotificationPreferences, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []model.NotificationPreferences
+	for _, prefs := range s.preferences {
+		if prefs.Agenda.Enabled {
+			prefs.Channels = slices.Clone(prefs.Channels)
+			result = append(result, prefs)
+		}
+	}
+	return result, nil
+}
+
+// ClaimAgenda отмечает сводку пользователя за день day отправленной и записывает
+// records в журнал уведомлений; false - сводка за этот день уже отправлялась.
+func (s *Storage) ClaimAgenda(
+	_ context.Context, userID string, day time.Time, records []model.NotificationRecord,
+) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	date := day.Format(time.DateOnly)
+	if s.agendaSent[userID] >= date {
+		return false, nil
+	}
+	s.agendaSent[userID] = date
+	if len(records) > 0 {
+		s.saveNotifications(records)
+	}
+	return true, nil
+}
+
+// ReleaseAgenda снимает отметку ClaimAgenda, если сводку за день day не удалось отправить.
+func (s *Storage) ReleaseAgenda(_ context.Context, userID string, day time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.agendaSent[userID] == day.Format(time.DateOnly) {
+		delete(s.agendaSent, userID)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package memorystorage
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"golang.org/x/net/context"
+)
+
+// Веса совпадений, как у ts_rank в PostgreSQL: название важнее описания.
+const (
+	titleWeight       = 1.0
+	descriptionWeight = 0.4
+)
+
+// tokenize разбивает текст на слова в нижнем регистре.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// eventTerms возвращает вес каждого слова события.
+func eventTerms(event model.Event) map[string]float64 {
+	terms := make(map[string]float64)
+	for _, term := range tokenize(event.Title) {
+		terms[term] += titleWeight
+	}
+	for _, term := range tokenize(event.Description) {
+		terms[term] += descriptionWeight
+	}
+	return terms
+}
+
+func (s *Storage) addToSearchIndex(event model.Event) {
+	for term, weight := range eventTerms(event) {
+		postings, ok := s.terms[term]
+		if !ok {
+			postings = make(map[uuid.UUID]float64)
+			s.terms[term] = postings
+		}
+		postings[event.ID] = weight
+	}
+}
+
+func (s *Storage) removeFromSearchIndex(event model.Event) {
+	for term := range eventTerms(event) {
+		delete(s.terms[term], event.ID)
+		if len(s.terms[term]) == 0 {
+			delete(s.terms, term)
+		}
+	}
+}
+
+// SearchEvents ищет события, содержащие все слова запроса.
+func (s *Storage) SearchEvents(ctx context.Context, query model.SearchQuery) (model.SearchPage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	terms := tokenize(query.Text)
+	if len(terms) == 0 {
+		return model.SearchPage{}, model.ErrEmptySearchQuery
+	}
+
+	ranks := make(map[uuid.UUID]float64)
+	for id, weight := range s.terms[terms[0]] {
+		ranks[id] = weight
+	}
+	for _, term := range terms[1:] {
+		postings := s.terms[term]
+		for id := range ranks {
+			weight, ok := postings[id]
+			if !ok {
+				delete(ranks, id)
+				continue
+			}
+			ranks[id] += weight
+		}
+	}
+
+	var results []model.SearchResult
+	for id, rank := range ranks {
+		event := s.events[id]
+		if !query.From.IsZero() && event.StartTime.Before(query.From) {
+			continue
+		}
+		if !query.To.IsZero() && !event.StartTime.Before(query.To) {
+			continue
+		}
+		if query.UserID != "" && !s.readableBy(event, query.UserID) {
+			continue
+		}
+		results = append(results, model.SearchResult{Event: event, Rank: rank})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].Event.StartTime.Before(results[j].Event.StartTime)
+	})
+
+	page := model.SearchPage{Total: len(results)}
+	if query.Offset >= len(results) {
+		return page, nil
+	}
+	results = results[query.Offset:]
+	if query.Limit > 0 && query.Limit < len(results) {
+		results = results[:query.Limit]
+	}
+	page.Results = results
+	return page, nil
+}
+
+// readableBy сообщает, может ли пользователь видеть содержимое события.
+func (s *Storage) readableBy(event model.Event, userID string) bool {
+	if event.HasParticipant(userID) {
+		return true
+	}
+	calendar, ok := s.calendars[event.CalendarID]
+	return ok && calendar.PermissionFor(userID).Allows(model.PermissionRead)
+}
@@ -1,25 +1,71 @@
 package memorystorage
 
 import (
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/clock"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
 	"golang.org/x/net/context"
 )
 
 type Storage struct {
-	byDay  map[string][]model.Event
-	events map[uuid.UUID]model.Event
-	mu     sync.RWMutex
+	byDay     map[string][]model.Event
+	events    map[uuid.UUID]model.Event
+	calendars map[uuid.UUID]model.Calendar
+	// terms - обратный индекс для полнотекстового поиска: слово -> событие -> вес.
+	terms map[string]map[uuid.UUID]float64
+	// idempotency - результаты запросов с ключом идемпотентности.
+	idempotency          map[string]idempotencyRecord
+	lastIdempotencySweep time.Time
+	// jobRuns - история запусков задач планировщика, от старых к новым.
+	jobRuns []model.JobRun
+	// notifications - журнал уведомлений; записи переживают удаление события.
+	notifications map[uuid.UUID]model.NotificationRecord
+	// preferences - настройки уведомлений пользователей.
+	preferences map[string]model.NotificationPreferences
+	// agendaSent - местная дата последней отправленной сводки пользователя.
+	agendaSent map[string]string
+	// maxEventsPerUser - сколько событий может хранить один пользователь; 0 - без ограничений.
+	maxEventsPerUser int
+	clock            clock.Clock
+	mu               sync.RWMutex
 }
 
-func New() *Storage {
-	return &Storage{
-		byDay:  make(map[string][]model.Event),
-		events: make(map[uuid.UUID]model.Event),
+type Option func(*Storage)
+
+// WithClock задаёт источник времени, в тестах - clock.Fake.
+func WithClock(c clock.Clock) Option {
+	return func(s *Storage) {
+		s.clock = c
+	}
+}
+
+// WithEventQuota ограничивает число событий, которыми владеет один пользователь.
+func WithEventQuota(maxEventsPerUser int) Option {
+	return func(s *Storage) {
+		s.maxEventsPerUser = maxEventsPerUser
+	}
+}
+
+func New(opts ...Option) *Storage {
+	s := &Storage{
+		byDay:         make(map[string][]model.Event),
+		events:        make(map[uuid.UUID]model.Event),
+		calendars:     make(map[uuid.UUID]model.Calendar),
+		terms:         make(map[string]map[uuid.UUID]float64),
+		idempotency:   make(map[string]idempotencyRecord),
+		notifications: make(map[uuid.UUID]model.NotificationRecord),
+		preferences:   make(map[string]model.NotificationPreferences),
+		agendaSent:    make(map[string]string),
+		clock:         clock.Real,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 func (s *Storage) generateID() uuid.UUID {
@@ -29,11 +75,13 @@ func (s *Storage) generateID() uuid.UUID {
 func (s *Storage) addToIndex(event model.Event) {
 	dayKey := event.StartTime.Format(time.DateOnly)
 	s.byDay[dayKey] = append(s.byDay[dayKey], event)
+	s.addToSearchIndex(event)
 }
 
 func (s *Storage) removeFromIndex(event model.Event) {
 	dayKey := event.StartTime.Format(time.DateOnly)
 	s.byDay[dayKey] = removeEventFromSlice(s.byDay[dayKey], event.ID)
+	s.removeFromSearchIndex(event)
 }
 
 func (s *Storage) isExistEvent(event model.Event) bool {
@@ -58,132 +106,461 @@ func removeEventFromSlice(events []model.Event, eventID uuid.UUID) []model.Event
 	return events
 }
 
-func (s *Storage) CreateEvent(ctx context.Context, event model.Event) (uuid.UUID, error) {
+func (s *Storage) insertEvent(event model.Event) {
+	s.events[event.ID] = event
+	s.addToIndex(event)
+}
+
+func normalizeAttendees(attendees []model.Attendee) []model.Attendee {
+	if len(attendees) == 0 {
+		return nil
+	}
+	normalized := make([]model.Attendee, 0, len(attendees))
+	for _, a := range attendees {
+		if a.Status == "" {
+			a.Status = model.AttendeeNeedsAction
+		}
+		normalized = append(normalized, a)
+	}
+	return normalized
+}
+
+func (s *Storage) createEvent(event model.Event) (uuid.UUID, error) {
 	if s.isExistEvent(event) {
 		return uuid.Nil, model.ErrDateBusy
 	}
-
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	if s.maxEventsPerUser > 0 && s.countUserEvents(event.UserID) >= s.maxEventsPerUser {
+		return uuid.Nil, model.ErrQuotaExceeded
+	}
 
 	event.ID = s.generateID()
-	s.events[event.ID] = event
-	s.addToIndex(event)
+	event.Attendees = normalizeAttendees(event.Attendees)
+	event.Reminders = s.assignReminderIDs(model.NormalizeReminders(event))
+	event.Sent = model.AllRemindersSent(event.Reminders)
+	s.insertEvent(event)
 	return event.ID, nil
 }
 
-func (s *Storage) UpdateEvent(ctx context.Context, id uuid.UUID, event model.Event) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// updateEvent обновляет событие, сохраняя список участников:
+// им управляют InviteAttendees и RespondToInvitation.
+func (s *Storage) updateEvent(id uuid.UUID, event model.Event) (model.Event, error) {
+	if oldEvent, ok := s.events[id]; ok {
+		// Владелец события не меняется: иначе обновление обходило бы квоту событий
+		event.UserID = oldEvent.UserID
+		event.Attendees = oldEvent.Attendees
+		event.Reminders = s.assignReminderIDs(model.MergeReminders(oldEvent, event))
+		event.Sent = model.AllRemindersSent(event.Reminders)
+	}
+	return s.replaceEvent(id, event)
+}
+
+func (s *Storage) assignReminderIDs(reminders []model.Reminder) []model.Reminder {
+	for i := range reminders {
+		if reminders[i].ID == uuid.Nil {
+			reminders[i].ID = s.generateID()
+		}
+	}
+	return reminders
+}
 
+func (s *Storage) replaceEvent(id uuid.UUID, event model.Event) (model.Event, error) {
 	oldEvent, ok := s.events[id]
 	if !ok {
-		return model.ErrEventNotFound
+		return model.Event{}, model.ErrEventNotFound
 	}
 
 	// Удаляем старую версию события из индексов
 	s.removeFromIndex(oldEvent)
 
-	s.events[id] = event
-	s.addToIndex(event)
-	return nil
+	event.ID = id
+	s.insertEvent(event)
+	return oldEvent, nil
 }
 
-func (s *Storage) DeleteEvent(ctx context.Context, id uuid.UUID) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
+func (s *Storage) deleteEvent(id uuid.UUID) (model.Event, error) {
 	event, ok := s.events[id]
 	if !ok {
-		return model.ErrEventNotFound
+		return model.Event{}, model.ErrEventNotFound
 	}
 
 	s.removeFromIndex(event)
 	delete(s.events, id)
-	return nil
+	return event, nil
 }
 
-func (s *Storage) GetEvents(ctx context.Context, startDate time.Time, offset int) ([]model.Event, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+func (s *Storage) CreateEvent(ctx context.Context, event model.Event) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createEvent(event)
+}
+
+func (s *Storage) UpdateEvent(ctx context.Context, id uuid.UUID, event model.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.updateEvent(id, event)
+	return err
+}
+
+func (s *Storage) DeleteEvent(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.deleteEvent(id)
+	return err
+}
+
+// runBatch выполняет apply для каждого элемента пакета под уже взятой блокировкой.
+// apply возвращает функцию отката, которая вызывается для применённых элементов,
+// если в режиме allOrNothing один из элементов завершился ошибкой.
+func runBatch(n int, allOrNothing bool, apply func(i int) (uuid.UUID, func(), error)) []model.BatchResult {
+	results := make([]model.BatchResult, n)
+	undo := make([]func(), 0, n)
+
+	for i := 0; i < n; i++ {
+		id, rollback, err := apply(i)
+		results[i] = model.BatchResult{Index: i, ID: id, Err: err}
+		if err == nil {
+			undo = append(undo, rollback)
+			continue
+		}
+		if allOrNothing {
+			for j := len(undo) - 1; j >= 0; j-- {
+				undo[j]()
+			}
+			for j := i + 1; j < n; j++ {
+				results[j] = model.BatchResult{Index: j}
+			}
+			model.AbortBatch(results)
+			return results
+		}
+	}
+	return results
+}
 
+func (s *Storage) BatchCreateEvents(
+	ctx context.Context, events []model.Event, allOrNothing bool,
+) ([]model.BatchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return runBatch(len(events), allOrNothing, func(i int) (uuid.UUID, func(), error) {
+		id, err := s.createEvent(events[i])
+		return id, func() { _, _ = s.deleteEvent(id) }, err
+	}), nil
+}
+
+func (s *Storage) BatchUpdateEvents(
+	ctx context.Context, updates []model.EventUpdate, allOrNothing bool,
+) ([]model.BatchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return runBatch(len(updates), allOrNothing, func(i int) (uuid.UUID, func(), error) {
+		id := updates[i].ID
+		oldEvent, err := s.updateEvent(id, updates[i].Event)
+		return id, func() { _, _ = s.replaceEvent(id, oldEvent) }, err
+	}), nil
+}
+
+func (s *Storage) BatchDeleteEvents(
+	ctx context.Context, ids []uuid.UUID, allOrNothing bool,
+) ([]model.BatchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return runBatch(len(ids), allOrNothing, func(i int) (uuid.UUID, func(), error) {
+		oldEvent, err := s.deleteEvent(ids[i])
+		return ids[i], func() { s.insertEvent(oldEvent) }, err
+	}), nil
+}
+
+// collectEvents собирает события за offset дней начиная со startDate, для которых keep вернула true.
+func (s *Storage) collectEvents(startDate time.Time, offset int, keep func(model.Event) bool) []model.Event {
 	var events []model.Event
 	for i := 0; i < offset; i++ {
 		day := startDate.AddDate(0, 0, i)
 		dayKey := day.Format(time.DateOnly)
-		if dayEvents, ok := s.byDay[dayKey]; ok {
-			events = append(events, dayEvents...)
+		for _, event := range s.byDay[dayKey] {
+			if keep(event) {
+				events = append(events, event)
+			}
 		}
 	}
-	if len(events) == 0 {
-		return events, model.ErrEventNotFound
+	return events
+}
+
+func (s *Storage) GetEvents(ctx context.Context, startDate time.Time, offset int) ([]model.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := s.collectEvents(startDate, offset, func(model.Event) bool { return true })
+	return events, nil
+}
+
+func (s *Storage) GetEvent(ctx context.Context, id uuid.UUID) (model.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	event, ok := s.events[id]
+	if !ok {
+		return model.Event{}, model.ErrEventNotFound
 	}
+	return event, nil
+}
+
+func (s *Storage) GetUserEvents(
+	ctx context.Context, userID string, startDate time.Time, offset int,
+) ([]model.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := s.collectEvents(startDate, offset, func(event model.Event) bool {
+		return s.visibleTo(event, userID)
+	})
+	return events, nil
+}
+
+// countUserEvents возвращает число событий, которыми владеет пользователь.
+func (s *Storage) countUserEvents(userID string) int {
+	count := 0
+	for _, event := range s.events {
+		if event.UserID == userID {
+			count++
+		}
+	}
+	return count
+}
+
+// visibleTo сообщает, видно ли событие пользователю: как участнику
+// или через доступ к календарю события.
+func (s *Storage) visibleTo(event model.Event, userID string) bool {
+	if event.HasParticipant(userID) {
+		return true
+	}
+	calendar, ok := s.calendars[event.CalendarID]
+	return ok && calendar.PermissionFor(userID) != model.PermissionNone
+}
+
+func (s *Storage) GetCalendarEvents(
+	ctx context.Context, calendarID uuid.UUID, startDate time.Time, offset int,
+) ([]model.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := s.collectEvents(startDate, offset, func(event model.Event) bool {
+		return event.CalendarID == calendarID
+	})
 	return events, nil
 }
 
+func (s *Storage) GetBusyIntervals(
+	ctx context.Context, userIDs []string, from, to time.Time,
+) (map[string][]model.Interval, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	busy := make(map[string][]model.Interval, len(userIDs))
+	for _, event := range s.events {
+		interval := model.Interval{Start: event.StartTime, End: event.StartTime.Add(event.Duration)}
+		if !interval.End.After(from) || !interval.Start.Before(to) {
+			continue
+		}
+		for _, userID := range userIDs {
+			if isBusyFor(event, userID) {
+				busy[userID] = append(busy[userID], interval)
+			}
+		}
+	}
+	return busy, nil
+}
+
+func (s *Storage) GetCalendarBusyIntervals(
+	ctx context.Context, calendarIDs []uuid.UUID, from, to time.Time,
+) ([]model.Interval, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	calendars := make(map[uuid.UUID]bool, len(calendarIDs))
+	for _, id := range calendarIDs {
+		calendars[id] = true
+	}
+
+	var busy []model.Interval
+	for _, event := range s.events {
+		if event.CalendarID == uuid.Nil || !calendars[event.CalendarID] {
+			continue
+		}
+		interval := model.Interval{Start: event.StartTime, End: event.StartTime.Add(event.Duration)}
+		if interval.End.After(from) && interval.Start.Before(to) {
+			busy = append(busy, interval)
+		}
+	}
+	return busy, nil
+}
+
+// isBusyFor сообщает, занимает ли событие время пользователя: владельца
+// или участника, который принял приглашение или ответил "возможно".
+func isBusyFor(event model.Event, userID string) bool {
+	if event.UserID == userID {
+		return true
+	}
+	for _, a := range event.Attendees {
+		if a.UserID == userID {
+			return a.Status == model.AttendeeAccepted || a.Status == model.AttendeeTentative
+		}
+	}
+	return false
+}
+
+func (s *Storage) InviteAttendees(ctx context.Context, eventID uuid.UUID, userIDs []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event, ok := s.events[eventID]
+	if !ok {
+		return model.ErrEventNotFound
+	}
+
+	// Копируем срез, чтобы не менять события, уже отданные наружу
+	attendees := append([]model.Attendee(nil), event.Attendees...)
+	for _, userID := range userIDs {
+		if event.HasParticipant(userID) {
+			continue
+		}
+		attendees = append(attendees, model.Attendee{UserID: userID, Status: model.AttendeeNeedsAction})
+		event.Attendees = attendees
+	}
+
+	_, err := s.replaceEvent(eventID, event)
+	return err
+}
+
+func (s *Storage) RespondToInvitation(
+	ctx context.Context, eventID uuid.UUID, userID string, status model.AttendeeStatus,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event, ok := s.events[eventID]
+	if !ok {
+		return model.ErrEventNotFound
+	}
+
+	attendees := append([]model.Attendee(nil), event.Attendees...)
+	for i := range attendees {
+		if attendees[i].UserID == userID {
+			attendees[i].Status = status
+			event.Attendees = attendees
+			_, err := s.replaceEvent(eventID, event)
+			return err
+		}
+	}
+	return model.ErrAttendeeNotFound
+}
+
+// GetNotifications возвращает все неотправленные напоминания, время которых
+// наступило к date, в том числе о уже начавшихся событиях: решение об опоздавших
+// напоминаниях принимает планировщик.
 func (s *Storage) GetNotifications(ctx context.Context, date time.Time) ([]model.Notification, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	var notifications []model.Notification
-	dayKey := date.Format(time.DateOnly)
-	if dayEvents, ok := s.byDay[dayKey]; ok {
-		for _, event := range dayEvents {
-			if event.NotifyBefore != 0 &&
-				!event.Sent &&
-				event.StartTime.Add(-event.NotifyBefore).Before(date) {
-				notification := model.Notification{
-					EventID: event.ID,
-					Title:   event.Title,
-					Date:    event.StartTime,
-					UserID:  event.UserID,
-				}
-				notifications = append(notifications, notification)
+	for _, event := range s.events {
+		for _, reminder := range event.Reminders {
+			notifyAt := event.StartTime.Add(-reminder.Offset)
+			if reminder.Sent || notifyAt.After(date) {
+				continue
+			}
+			notification := model.Notification{
+				EventID:     event.ID,
+				ReminderID:  reminder.ID,
+				Channel:     reminder.Channel,
+				Title:       event.Title,
+				Date:        event.StartTime,
+				Duration:    event.Duration,
+				Description: event.Description,
+				UserID:      event.UserID,
+				NotifyAt:    notifyAt,
+
+				Attendees: event.AcceptedAttendees(),
 			}
+			notifications = append(notifications, notification)
 		}
 	}
+	// Порядок не зависит от обхода map: сначала самые ранние
+	sort.Slice(notifications, func(i, j int) bool {
+		return notifications[i].NotifyAt.Before(notifications[j].NotifyAt)
+	})
 	return notifications, nil
 }
 
 func (s *Storage) MarkEventsAsNotified(ctx context.Context, notifications []model.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sentAt := s.clock.Now()
+	sent := make(map[uuid.UUID]map[uuid.UUID]model.Delivery)
 	for _, n := range notifications {
-		event := s.events[n.EventID]
-		event.Sent = true
-		dayKey := event.StartTime.Format(time.DateOnly)
-		if dayEvents, ok := s.byDay[dayKey]; ok {
-			for j, storedEvent := range dayEvents {
-				if storedEvent.ID == event.ID {
-					s.byDay[dayKey][j].Sent = true
-				}
+		if sent[n.EventID] == nil {
+			sent[n.EventID] = make(map[uuid.UUID]model.Delivery)
+		}
+		sent[n.EventID][n.ReminderID] = n.Delivery
+	}
+
+	for eventID, reminderIDs := range sent {
+		event, ok := s.events[eventID]
+		if !ok {
+			continue
+		}
+
+		reminders := append([]model.Reminder(nil), event.Reminders...)
+		for i := range reminders {
+			if delivery, ok := reminderIDs[reminders[i].ID]; ok && !reminders[i].Sent {
+				reminders[i].Sent = true
+				reminders[i].SentAt = sentAt
+				reminders[i].Delivery = delivery
 			}
 		}
+		event.Reminders = reminders
+		event.Sent = model.AllRemindersSent(reminders)
+
+		if _, err := s.replaceEvent(eventID, event); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (s *Storage) DeleteOldEvents(ctx context.Context) error {
+// PurgeEvents удаляет события, срок хранения которых по policy истёк.
+func (s *Storage) PurgeEvents(_ context.Context, policy model.RetentionPolicy) (model.PurgeStats, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	cutoffDate := time.Now().AddDate(-1, 0, 0)
-
-	for dayKey, events := range s.byDay {
-		var remainingEvents []model.Event
+	now := s.clock.Now()
+	stats := model.PurgeStats{DryRun: policy.DryRun}
+	for id, event := range s.events {
+		rule := policy.Rule(event)
+		if !rule.Expired(event, now) {
+			continue
+		}
+		if rule.KeepWithAttendees && len(event.Attendees) > 0 {
+			stats.KeptWithAttendees++
+			continue
+		}
 
-		for _, event := range events {
-			if event.StartTime.After(cutoffDate) {
-				remainingEvents = append(remainingEvents, event)
-			} else {
-				delete(s.events, event.ID)
+		stats.Deleted++
+		if policy.DryRun {
+			if len(stats.EventIDs) < model.MaxDryRunEventIDs {
+				stats.EventIDs = append(stats.EventIDs, id)
 			}
+			continue
 		}
-
-		if len(remainingEvents) > 0 {
-			s.byDay[dayKey] = remainingEvents
-		} else {
-			delete(s.byDay, dayKey)
+		if _, err := s.deleteEvent(id); err != nil {
+			return stats, err
 		}
 	}
-
-	return nil
+	return stats, nil
 }
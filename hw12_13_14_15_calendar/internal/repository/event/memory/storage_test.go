@@ -1,9 +1,13 @@
 package memorystorage
 
 import (
+	"errors"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/clock"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
 	"golang.org/x/net/context"
 )
@@ -52,7 +56,7 @@ func TestStorage_UpdateEvent(t *testing.T) {
 		Title:     "Updated Event",
 		StartTime: event.StartTime,
 		Duration:  2 * time.Hour,
-		UserID:    "user1",
+		UserID:    "user2",
 	}
 
 	err = testStorage.UpdateEvent(context.Background(), id, updatedEvent)
@@ -68,6 +72,9 @@ func TestStorage_UpdateEvent(t *testing.T) {
 	if storedEvent.Title != "Updated Event" {
 		t.Errorf("expected title 'Updated Event', got %s", storedEvent.Title)
 	}
+	if storedEvent.UserID != "user1" {
+		t.Errorf("expected owner to stay user1, got %s", storedEvent.UserID)
+	}
 
 	dayKey := updatedEvent.StartTime.Format(time.DateOnly)
 	if len(testStorage.byDay[dayKey]) != 1 {
@@ -147,3 +154,771 @@ func TestStorage_GetEvents(t *testing.T) {
 		t.Errorf("events not returned in expected order")
 	}
 }
+
+func TestStorage_BatchCreateEvents(t *testing.T) {
+	ctx := context.Background()
+	startTime := time.Now()
+
+	t.Run("partial", func(t *testing.T) {
+		testStorage := New()
+		events := []model.Event{
+			{Title: "Event 1", StartTime: startTime, UserID: "user1"},
+			{Title: "Event 2", StartTime: startTime, UserID: "user1"}, // то же время - занято
+			{Title: "Event 3", StartTime: startTime.Add(time.Hour), UserID: "user1"},
+		}
+
+		results, err := testStorage.BatchCreateEvents(ctx, events, false)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if results[0].Err != nil || results[2].Err != nil {
+			t.Fatalf("expected events 1 and 3 to be created, got %v, %v", results[0].Err, results[2].Err)
+		}
+		if !errors.Is(results[1].Err, model.ErrDateBusy) {
+			t.Fatalf("expected ErrDateBusy for event 2, got %v", results[1].Err)
+		}
+		if len(testStorage.events) != 2 {
+			t.Fatalf("expected 2 events in repository, got %d", len(testStorage.events))
+		}
+	})
+
+	t.Run("all or nothing", func(t *testing.T) {
+		testStorage := New()
+		events := []model.Event{
+			{Title: "Event 1", StartTime: startTime, UserID: "user1"},
+			{Title: "Event 2", StartTime: startTime, UserID: "user1"},
+			{Title: "Event 3", StartTime: startTime.Add(time.Hour), UserID: "user1"},
+		}
+
+		results, err := testStorage.BatchCreateEvents(ctx, events, true)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !errors.Is(results[0].Err, model.ErrBatchAborted) || !errors.Is(results[2].Err, model.ErrBatchAborted) {
+			t.Fatalf("expected events 1 and 3 to be aborted, got %v, %v", results[0].Err, results[2].Err)
+		}
+		if !errors.Is(results[1].Err, model.ErrDateBusy) {
+			t.Fatalf("expected ErrDateBusy for event 2, got %v", results[1].Err)
+		}
+		if len(testStorage.events) != 0 {
+			t.Fatalf("expected 0 events in repository after rollback, got %d", len(testStorage.events))
+		}
+		dayKey := startTime.Format(time.DateOnly)
+		if len(testStorage.byDay[dayKey]) != 0 {
+			t.Fatalf("expected 0 events in day index after rollback, got %d", len(testStorage.byDay[dayKey]))
+		}
+	})
+}
+
+func TestStorage_BatchDeleteEventsAllOrNothing(t *testing.T) {
+	ctx := context.Background()
+	testStorage := New()
+
+	id, err := testStorage.CreateEvent(ctx, model.Event{Title: "Event 1", StartTime: time.Now(), UserID: "user1"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	results, err := testStorage.BatchDeleteEvents(ctx, []uuid.UUID{id, uuid.New()}, true)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !errors.Is(results[1].Err, model.ErrEventNotFound) {
+		t.Fatalf("expected ErrEventNotFound for unknown event, got %v", results[1].Err)
+	}
+	if _, ok := testStorage.events[id]; !ok {
+		t.Fatalf("expected event %s to be restored after rollback", id)
+	}
+}
+
+func TestStorage_Attendees(t *testing.T) {
+	ctx := context.Background()
+	testStorage := New()
+	startTime := time.Now()
+
+	id, err := testStorage.CreateEvent(ctx, model.Event{
+		Title:        "Team meeting",
+		StartTime:    startTime,
+		Duration:     time.Hour,
+		UserID:       "user1",
+		NotifyBefore: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	err = testStorage.InviteAttendees(ctx, id, []string{"user1", "user2", "user3", "user2"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := len(testStorage.events[id].Attendees); got != 2 {
+		t.Fatalf("expected 2 attendees (owner and duplicates skipped), got %d", got)
+	}
+
+	events, err := testStorage.GetUserEvents(ctx, "user2", startTime, 1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(events) != 1 || events[0].ID != id {
+		t.Fatalf("expected invited user to see the event, got %v", events)
+	}
+	if events, err := testStorage.GetUserEvents(ctx, "user4", startTime, 1); err != nil || len(events) != 0 {
+		t.Fatalf("expected not invited user to see nothing, got %v, %v", events, err)
+	}
+
+	if err := testStorage.RespondToInvitation(ctx, id, "user2", model.AttendeeAccepted); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	err = testStorage.RespondToInvitation(ctx, id, "user4", model.AttendeeAccepted)
+	if !errors.Is(err, model.ErrAttendeeNotFound) {
+		t.Fatalf("expected ErrAttendeeNotFound, got %v", err)
+	}
+
+	// Обновление события не сбрасывает список участников
+	err = testStorage.UpdateEvent(ctx, id, model.Event{
+		Title:        "Team meeting (moved)",
+		StartTime:    startTime,
+		Duration:     time.Hour,
+		UserID:       "user1",
+		NotifyBefore: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	notifications, err := testStorage.GetNotifications(ctx, startTime)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(notifications) != 1 {
+		t.Fatalf("expected 1 notification, got %d", len(notifications))
+	}
+	if got := notifications[0].Attendees; len(got) != 1 || got[0] != "user2" {
+		t.Fatalf("expected notification for accepted attendee user2, got %v", got)
+	}
+}
+
+func TestStorage_Reminders(t *testing.T) {
+	ctx := context.Background()
+	testStorage := New()
+	startTime := time.Now().Add(30 * time.Minute)
+
+	id, err := testStorage.CreateEvent(ctx, model.Event{
+		Title:     "Event with reminders",
+		StartTime: startTime,
+		Duration:  time.Hour,
+		UserID:    "user1",
+		Reminders: []model.Reminder{
+			{Offset: time.Hour, Channel: model.ChannelEmail},
+			{Offset: 10 * time.Minute},
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if ch := testStorage.events[id].Reminders[1].Channel; ch != model.DefaultReminderChannel {
+		t.Fatalf("expected default channel for reminder without channel, got %q", ch)
+	}
+
+	// За 30 минут до начала должно сработать только часовое напоминание
+	notifications, err := testStorage.GetNotifications(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(notifications) != 1 || notifications[0].Channel != model.ChannelEmail {
+		t.Fatalf("expected 1 email notification, got %v", notifications)
+	}
+
+	if err := testStorage.MarkEventsAsNotified(ctx, notifications); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	event := testStorage.events[id]
+	if !event.Reminders[0].Sent || event.Reminders[1].Sent {
+		t.Fatalf("expected only the first reminder to be sent, got %v", event.Reminders)
+	}
+	if event.Sent {
+		t.Fatalf("expected event to stay partially delivered")
+	}
+
+	notifications, err = testStorage.GetNotifications(ctx, startTime.Add(-5*time.Minute))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(notifications) != 1 || notifications[0].ReminderID != event.Reminders[1].ID {
+		t.Fatalf("expected notification for the second reminder, got %v", notifications)
+	}
+	if err := testStorage.MarkEventsAsNotified(ctx, notifications); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !testStorage.events[id].Sent {
+		t.Fatalf("expected event to be sent after all reminders are delivered")
+	}
+}
+
+func TestStorage_NotificationsAfterDowntime(t *testing.T) {
+	ctx := context.Background()
+	testStorage := New()
+	// Событие началось накануне вечером, планировщик запустился после полуночи
+	startTime := time.Date(2024, time.September, 2, 23, 50, 0, 0, time.UTC)
+	now := time.Date(2024, time.September, 3, 0, 30, 0, 0, time.UTC)
+
+	id, err := testStorage.CreateEvent(ctx, model.Event{
+		Title:        "Late evening call",
+		StartTime:    startTime,
+		Duration:     time.Hour,
+		UserID:       "user1",
+		NotifyBefore: 15 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	notifications, err := testStorage.GetNotifications(ctx, now)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(notifications) != 1 || !notifications[0].NotifyAt.Equal(startTime.Add(-15*time.Minute)) {
+		t.Fatalf("expected the missed reminder of the previous day, got %v", notifications)
+	}
+
+	notifications[0].Delivery = model.DeliverySkipped
+	if err := testStorage.MarkEventsAsNotified(ctx, notifications); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := testStorage.events[id].Reminders[0].Delivery; got != model.DeliverySkipped {
+		t.Fatalf("expected skipped delivery to be recorded, got %q", got)
+	}
+	if notifications, _ = testStorage.GetNotifications(ctx, now); len(notifications) != 0 {
+		t.Fatalf("expected no notifications after marking, got %v", notifications)
+	}
+}
+
+func TestStorage_LegacyNotifyBefore(t *testing.T) {
+	testStorage := New()
+
+	id, err := testStorage.CreateEvent(context.Background(), model.Event{
+		Title:        "Legacy event",
+		StartTime:    time.Now(),
+		UserID:       "user1",
+		NotifyBefore: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	reminders := testStorage.events[id].Reminders
+	if len(reminders) != 1 || reminders[0].Offset != time.Hour || reminders[0].ID == uuid.Nil {
+		t.Fatalf("expected NotifyBefore to become a single reminder, got %v", reminders)
+	}
+}
+
+func TestStorage_GetBusyIntervals(t *testing.T) {
+	ctx := context.Background()
+	testStorage := New()
+	startTime := time.Date(2024, time.September, 2, 10, 0, 0, 0, time.UTC)
+
+	_, _ = testStorage.CreateEvent(ctx, model.Event{
+		Title:     "Owned",
+		StartTime: startTime,
+		Duration:  time.Hour,
+		UserID:    "user1",
+		Attendees: []model.Attendee{
+			{UserID: "user2", Status: model.AttendeeAccepted},
+			{UserID: "user3", Status: model.AttendeeDeclined},
+		},
+	})
+	_, _ = testStorage.CreateEvent(ctx, model.Event{
+		Title:     "Next day",
+		StartTime: startTime.AddDate(0, 0, 1),
+		Duration:  time.Hour,
+		UserID:    "user1",
+	})
+
+	busy, err := testStorage.GetBusyIntervals(ctx, []string{"user1", "user2", "user3"},
+		startTime.Add(-time.Hour), startTime.Add(12*time.Hour))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(busy["user1"]) != 1 || len(busy["user2"]) != 1 {
+		t.Fatalf("expected owner and accepted attendee to be busy, got %v", busy)
+	}
+	if len(busy["user3"]) != 0 {
+		t.Fatalf("expected declined attendee to be free, got %v", busy["user3"])
+	}
+}
+
+func TestStorage_GetCalendarBusyIntervals(t *testing.T) {
+	ctx := context.Background()
+	testStorage := New()
+	startTime := time.Date(2024, time.September, 2, 10, 0, 0, 0, time.UTC)
+
+	work, _ := testStorage.CreateCalendar(ctx, model.Calendar{OwnerID: "user1", Name: "work"})
+	personal, _ := testStorage.CreateCalendar(ctx, model.Calendar{OwnerID: "user1", Name: "personal"})
+	for _, event := range []model.Event{
+		{Title: "Standup", StartTime: startTime, Duration: time.Hour, UserID: "user1", CalendarID: work},
+		{Title: "Dentist", StartTime: startTime, Duration: time.Hour, UserID: "user1", CalendarID: personal},
+		{Title: "No calendar", StartTime: startTime, Duration: time.Hour, UserID: "user1"},
+	} {
+		_, _ = testStorage.CreateEvent(ctx, event)
+	}
+
+	busy, err := testStorage.GetCalendarBusyIntervals(ctx, []uuid.UUID{work},
+		startTime.Add(-time.Hour), startTime.Add(12*time.Hour))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(busy) != 1 || !busy[0].Start.Equal(startTime) {
+		t.Fatalf("expected only the work calendar event, got %v", busy)
+	}
+}
+
+func TestStorage_Calendars(t *testing.T) {
+	ctx := context.Background()
+	testStorage := New()
+	startTime := time.Date(2024, time.September, 2, 10, 0, 0, 0, time.UTC)
+
+	work, _ := testStorage.CreateCalendar(ctx, model.Calendar{OwnerID: "user1", Name: "work"})
+	personal, _ := testStorage.CreateCalendar(ctx, model.Calendar{OwnerID: "user1", Name: "personal"})
+	_, _ = testStorage.CreateEvent(ctx, model.Event{
+		Title: "Standup", StartTime: startTime, Duration: time.Hour, UserID: "user1", CalendarID: work,
+	})
+	_, _ = testStorage.CreateEvent(ctx, model.Event{
+		Title: "Dentist", StartTime: startTime.Add(2 * time.Hour), Duration: time.Hour, UserID: "user1", CalendarID: personal,
+	})
+
+	if err := testStorage.ShareCalendar(ctx, work, model.CalendarShare{
+		UserID: "user2", Permission: model.PermissionRead,
+	}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	calendars, _ := testStorage.ListCalendars(ctx, "user2")
+	if len(calendars) != 1 || calendars[0].ID != work {
+		t.Fatalf("expected only shared calendar, got %v", calendars)
+	}
+
+	events, _ := testStorage.GetUserEvents(ctx, "user2", startTime, 1)
+	if len(events) != 1 || events[0].Title != "Standup" {
+		t.Fatalf("expected event from shared calendar, got %v", events)
+	}
+
+	events, _ = testStorage.GetCalendarEvents(ctx, personal, startTime, 1)
+	if len(events) != 1 || events[0].Title != "Dentist" {
+		t.Fatalf("expected calendar events only, got %v", events)
+	}
+
+	_ = testStorage.RevokeCalendarShare(ctx, work, "user2")
+	events, _ = testStorage.GetUserEvents(ctx, "user2", startTime, 1)
+	if len(events) != 0 {
+		t.Fatalf("expected no events after revoke, got %v", events)
+	}
+
+	if err := testStorage.DeleteCalendar(ctx, work); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(testStorage.events) != 1 {
+		t.Fatalf("expected calendar events to be deleted, got %d events", len(testStorage.events))
+	}
+	if _, err := testStorage.GetCalendar(ctx, work); !errors.Is(err, model.ErrCalendarNotFound) {
+		t.Fatalf("expected ErrCalendarNotFound, got %v", err)
+	}
+}
+
+func TestStorage_SearchEvents(t *testing.T) {
+	ctx := context.Background()
+	testStorage := New()
+	startTime := time.Date(2024, time.September, 2, 10, 0, 0, 0, time.UTC)
+
+	budgetID, _ := testStorage.CreateEvent(ctx, model.Event{
+		Title: "Budget review", StartTime: startTime, Duration: time.Hour, UserID: "user1",
+	})
+	_, _ = testStorage.CreateEvent(ctx, model.Event{
+		Title: "Team sync", Description: "Discuss the budget for Q4", StartTime: startTime.Add(2 * time.Hour),
+		Duration: time.Hour, UserID: "user1",
+	})
+	_, _ = testStorage.CreateEvent(ctx, model.Event{
+		Title: "Budget planning", StartTime: startTime.Add(4 * time.Hour), Duration: time.Hour, UserID: "user2",
+	})
+
+	page, err := testStorage.SearchEvents(ctx, model.SearchQuery{Text: "budget", UserID: "user1"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if page.Total != 2 || page.Results[0].Event.ID != budgetID {
+		t.Fatalf("expected title match to rank first, got %+v", page)
+	}
+
+	page, _ = testStorage.SearchEvents(ctx, model.SearchQuery{Text: "Budget", Limit: 1, Offset: 1})
+	if page.Total != 3 || len(page.Results) != 1 {
+		t.Fatalf("expected second page of 1 result out of 3, got %+v", page)
+	}
+
+	page, _ = testStorage.SearchEvents(ctx, model.SearchQuery{Text: "Budget", Limit: 1, Offset: 5})
+	if page.Total != 3 || len(page.Results) != 0 {
+		t.Fatalf("expected empty page past the end to keep the total, got %+v", page)
+	}
+
+	_ = testStorage.UpdateEvent(ctx, budgetID, model.Event{
+		Title: "Quarterly review", StartTime: startTime, Duration: time.Hour, UserID: "user1",
+	})
+	page, _ = testStorage.SearchEvents(ctx, model.SearchQuery{Text: "budget review"})
+	if page.Total != 0 {
+		t.Fatalf("expected updated event to leave the index, got %+v", page)
+	}
+
+	_ = testStorage.DeleteEvent(ctx, budgetID)
+	page, _ = testStorage.SearchEvents(ctx, model.SearchQuery{Text: "quarterly"})
+	if page.Total != 0 {
+		t.Fatalf("expected deleted event to leave the index, got %+v", page)
+	}
+}
+
+func TestStorage_EventQuota(t *testing.T) {
+	ctx := context.Background()
+	testStorage := New(WithEventQuota(3))
+	startTime := time.Date(2024, time.September, 2, 9, 0, 0, 0, time.UTC)
+
+	// Параллельные запросы не должны превысить квоту
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _ = testStorage.CreateEvent(ctx, model.Event{
+				Title: "event", StartTime: startTime.Add(time.Duration(i) * time.Hour), Duration: time.Hour, UserID: "user1",
+			})
+		}(i)
+	}
+	wg.Wait()
+	if count := testStorage.countUserEvents("user1"); count != 3 {
+		t.Fatalf("expected quota of 3 events, got %d", count)
+	}
+
+	results, _ := testStorage.BatchCreateEvents(ctx, []model.Event{
+		{Title: "other", StartTime: startTime.Add(20 * time.Hour), Duration: time.Hour, UserID: "user2"},
+		{Title: "over", StartTime: startTime.Add(21 * time.Hour), Duration: time.Hour, UserID: "user1"},
+	}, false)
+	if results[0].Err != nil || !errors.Is(results[1].Err, model.ErrQuotaExceeded) {
+		t.Fatalf("expected only the event over quota to fail, got %+v", results)
+	}
+}
+
+func TestStorage_CreateEventIdempotent(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clock.NewFake(time.Date(2024, time.September, 2, 9, 0, 0, 0, time.UTC))
+	testStorage := New(WithClock(fakeClock))
+
+	event := model.Event{Title: "Standup", StartTime: fakeClock.Now(), Duration: time.Hour, UserID: "user1"}
+	key := model.IdempotencyKey{
+		Key: "k1", UserID: "user1", RequestHash: model.RequestHash(event), ExpiresAt: fakeClock.Now().Add(time.Hour),
+	}
+
+	id, replayed, err := testStorage.CreateEventIdempotent(ctx, key, event)
+	if err != nil || replayed {
+		t.Fatalf("expected first request to create event, got %v, %v", replayed, err)
+	}
+
+	replayID, replayed, err := testStorage.CreateEventIdempotent(ctx, key, event)
+	if err != nil || !replayed || replayID != id {
+		t.Fatalf("expected replay to return %s, got %s, %v, %v", id, replayID, replayed, err)
+	}
+	if len(testStorage.events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(testStorage.events))
+	}
+
+	other := event
+	other.Title = "Retro"
+	otherKey := key
+	otherKey.RequestHash = model.RequestHash(other)
+	_, _, err = testStorage.CreateEventIdempotent(ctx, otherKey, other)
+	if !errors.Is(err, model.ErrIdempotencyKeyReused) {
+		t.Fatalf("expected ErrIdempotencyKeyReused, got %v", err)
+	}
+
+	// Тот же ключ другого пользователя - это другой запрос
+	otherUser := event
+	otherUser.UserID = "user2"
+	otherUser.StartTime = event.StartTime.Add(2 * time.Hour)
+	otherUserKey := model.IdempotencyKey{
+		Key: "k1", UserID: "user2", RequestHash: model.RequestHash(otherUser), ExpiresAt: key.ExpiresAt,
+	}
+	if _, replayed, err := testStorage.CreateEventIdempotent(ctx, otherUserKey, otherUser); err != nil || replayed {
+		t.Fatalf("expected key to be scoped per user, got %v, %v", replayed, err)
+	}
+
+	// После истечения ключа повтор снова создает событие
+	fakeClock.Advance(2 * time.Hour)
+	moved := event
+	moved.StartTime = event.StartTime.Add(4 * time.Hour)
+	key.RequestHash = model.RequestHash(moved)
+	key.ExpiresAt = fakeClock.Now().Add(time.Hour)
+	if newID, replayed, err := testStorage.CreateEventIdempotent(ctx, key, moved); err != nil || replayed || newID == id {
+		t.Fatalf("expected expired key to create a new event, got %s, %v, %v", newID, replayed, err)
+	}
+}
+
+func TestStorage_CreateEventIdempotentQuota(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clock.NewFake(time.Date(2024, time.September, 2, 9, 0, 0, 0, time.UTC))
+	testStorage := New(WithClock(fakeClock), WithEventQuota(1))
+
+	event := model.Event{Title: "Standup", StartTime: fakeClock.Now(), Duration: time.Hour, UserID: "user1"}
+	key := model.IdempotencyKey{
+		Key: "k1", UserID: "user1", RequestHash: model.RequestHash(event), ExpiresAt: fakeClock.Now().Add(time.Hour),
+	}
+	id, _, err := testStorage.CreateEventIdempotent(ctx, key, event)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Квота исчерпана, но повтор ничего не создаёт и возвращает прежний результат
+	replayID, replayed, err := testStorage.CreateEventIdempotent(ctx, key, event)
+	if err != nil || !replayed || replayID != id {
+		t.Fatalf("expected replay to return %s, got %s, %v, %v", id, replayID, replayed, err)
+	}
+
+	other := event
+	other.StartTime = event.StartTime.Add(2 * time.Hour)
+	otherKey := model.IdempotencyKey{
+		Key: "k2", UserID: "user1", RequestHash: model.RequestHash(other), ExpiresAt: key.ExpiresAt,
+	}
+	if _, _, err := testStorage.CreateEventIdempotent(ctx, otherKey, other); !errors.Is(err, model.ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded for a new event, got %v", err)
+	}
+	if _, ok := testStorage.idempotency[otherKey.Scoped()]; ok {
+		t.Fatal("expected rejected request not to keep its idempotency key")
+	}
+}
+
+func TestStorage_ListJobRuns(t *testing.T) {
+	testStorage := New()
+	ctx := context.Background()
+	start := time.Now()
+
+	for i, job := range []string{"reminders", "cleanup", "reminders"} {
+		run := model.JobRun{Job: job, StartedAt: start.Add(time.Duration(i) * time.Minute), Status: model.JobRunSucceeded}
+		if err := testStorage.SaveJobRun(ctx, run); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	runs, err := testStorage.ListJobRuns(ctx, model.JobRunFilter{Job: "reminders", Limit: 10})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(runs) != 2 || !runs[0].StartedAt.Equal(start.Add(2*time.Minute)) {
+		t.Fatalf("expected 2 reminders runs newest first, got %v", runs)
+	}
+
+	runs, _ = testStorage.ListJobRuns(ctx, model.JobRunFilter{Limit: 1})
+	if len(runs) != 1 || runs[0].Job != "reminders" {
+		t.Fatalf("expected the latest run only, got %v", runs)
+	}
+}
+
+func TestStorage_PurgeEvents(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, time.September, 2, 9, 0, 0, 0, time.UTC)
+	testStorage := New(WithClock(clock.NewFake(now)))
+
+	archive, _ := testStorage.CreateCalendar(ctx, model.Calendar{OwnerID: "user1", Name: "archive"})
+	create := func(title string, age time.Duration, userID string, calendarID uuid.UUID, attendees ...model.Attendee) {
+		t.Helper()
+		_, err := testStorage.CreateEvent(ctx, model.Event{
+			Title: title, StartTime: now.Add(-age), Duration: time.Hour,
+			UserID: userID, CalendarID: calendarID, Attendees: attendees,
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	create("recent", 24*time.Hour, "user1", uuid.Nil)
+	create("old", 40*24*time.Hour, "user1", uuid.Nil)
+	create("old meeting", 41*24*time.Hour, "user1", uuid.Nil, model.Attendee{UserID: "user2"})
+	create("archived", 400*24*time.Hour, "user1", archive)
+	create("vip", 50*24*time.Hour, "vip", uuid.Nil)
+
+	policy := model.RetentionPolicy{
+		Default:   model.RetentionRule{MaxAge: 30 * 24 * time.Hour, KeepWithAttendees: true},
+		Calendars: map[uuid.UUID]model.RetentionRule{archive: {}},
+		Users:     map[string]model.RetentionRule{"vip": {MaxAge: 60 * 24 * time.Hour}},
+		DryRun:    true,
+	}
+
+	stats, err := testStorage.PurgeEvents(ctx, policy)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if stats.Deleted != 1 || stats.KeptWithAttendees != 1 || len(stats.EventIDs) != 1 {
+		t.Fatalf("expected one event to be reported, got %+v", stats)
+	}
+	if len(testStorage.events) != 5 {
+		t.Fatalf("expected dry run to keep all events, got %d", len(testStorage.events))
+	}
+	if testStorage.events[stats.EventIDs[0]].Title != "old" {
+		t.Fatalf("expected old event to be reported, got %v", testStorage.events[stats.EventIDs[0]])
+	}
+
+	policy.DryRun = false
+	stats, _ = testStorage.PurgeEvents(ctx, policy)
+	if stats.Deleted != 1 || stats.EventIDs != nil {
+		t.Fatalf("expected one event to be deleted, got %+v", stats)
+	}
+	events, _ := testStorage.GetUserEvents(ctx, "user1", now.Add(-40*24*time.Hour), 1)
+	if len(events) != 0 {
+		t.Fatalf("expected purged event to be removed from indexes, got %v", events)
+	}
+	if len(testStorage.events) != 4 {
+		t.Fatalf("expected 4 events left, got %d", len(testStorage.events))
+	}
+}
+
+func TestStorage_PurgeEventsDryRunLimit(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, time.September, 2, 9, 0, 0, 0, time.UTC)
+	testStorage := New(WithClock(clock.NewFake(now)))
+
+	total := model.MaxDryRunEventIDs + 5
+	for i := 0; i < total; i++ {
+		_, err := testStorage.CreateEvent(ctx, model.Event{
+			Title: "old", StartTime: now.Add(-time.Duration(48+i) * time.Hour), Duration: time.Hour, UserID: "user1",
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	policy := model.RetentionPolicy{Default: model.RetentionRule{MaxAge: 24 * time.Hour}, DryRun: true}
+	stats, err := testStorage.PurgeEvents(ctx, policy)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if stats.Deleted != total || len(stats.EventIDs) != model.MaxDryRunEventIDs {
+		t.Fatalf("expected %d events with %d ids, got %d with %d ids",
+			total, model.MaxDryRunEventIDs, stats.Deleted, len(stats.EventIDs))
+	}
+}
+
+func TestStorage_NotificationLog(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, time.September, 2, 9, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFake(now)
+	testStorage := New(WithClock(fakeClock))
+
+	eventID := uuid.New()
+	record := func(ownerID string, queuedAt time.Time) model.NotificationRecord {
+		return model.NotificationRecord{
+			ID: uuid.New(), EventID: eventID, OwnerID: ownerID, RecipientID: ownerID,
+			Status: model.NotificationQueued, QueuedAt: queuedAt, UpdatedAt: queuedAt,
+		}
+	}
+	old := record("user1", now.Add(-time.Hour))
+	latest := record("user1", now)
+	other := record("user2", now)
+	if err := testStorage.SaveNotifications(ctx, []model.NotificationRecord{old, latest, other}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	report := model.NotificationStatusReport{
+		ID: latest.ID, Status: model.NotificationFailed, Attempts: 3, Error: "timeout", At: now.Add(time.Minute),
+	}
+	if err := testStorage.UpdateNotificationStatus(ctx, report); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	report.ID = uuid.New()
+	if err := testStorage.UpdateNotificationStatus(ctx, report); !errors.Is(err, model.ErrNotificationNotFound) {
+		t.Fatalf("expected ErrNotificationNotFound, got %v", err)
+	}
+
+	records, _ := testStorage.ListNotifications(ctx, model.NotificationFilter{OwnerID: "user1", Limit: 10})
+	if len(records) != 2 || records[0].ID != latest.ID || records[1].ID != old.ID {
+		t.Fatalf("expected user1 records newest first, got %v", records)
+	}
+	if records[0].Status != model.NotificationFailed || records[0].Attempts != 3 || records[0].LastError != "timeout" {
+		t.Fatalf("expected status report to be applied, got %+v", records[0])
+	}
+
+	// Старые записи удаляются при сохранении новых
+	fakeClock.Advance(notificationRetention)
+	_ = testStorage.SaveNotifications(ctx, []model.NotificationRecord{record("user1", fakeClock.Now())})
+	records, _ = testStorage.ListNotifications(ctx, model.NotificationFilter{EventID: eventID, Limit: 10})
+	if len(records) != 3 {
+		t.Fatalf("expected records older than retention to be pruned, got %d", len(records))
+	}
+}
+
+func TestStorage_NotificationPreferences(t *testing.T) {
+	ctx := context.Background()
+	testStorage := New()
+
+	if _, err := testStorage.GetNotificationPreferences(ctx, "user1"); !errors.Is(err, model.ErrPreferencesNotFound) {
+		t.Fatalf("expected ErrPreferencesNotFound, got %v", err)
+	}
+
+	prefs := model.NotificationPreferences{
+		UserID:   "user1",
+		Channels: []model.ReminderChannel{model.ChannelSMS},
+		TimeZone: "Europe/Moscow",
+		Mode:     model.ModeDigest,
+	}
+	if err := testStorage.SaveNotificationPreferences(ctx, prefs); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	prefs.Channels[0] = model.ChannelPush
+	got, err := testStorage.GetNotificationPreferences(ctx, "user1")
+	if err != nil || got.Mode != model.ModeDigest || got.Channels[0] != model.ChannelSMS {
+		t.Fatalf("expected saved preferences, got %+v, %v", got, err)
+	}
+
+	all, _ := testStorage.ListNotificationPreferences(ctx, []string{"user1", "user2"})
+	if len(all) != 1 || all["user1"].TimeZone != "Europe/Moscow" {
+		t.Fatalf("expected only user1 preferences, got %v", all)
+	}
+
+	if err := testStorage.DeleteNotificationPreferences(ctx, "user1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := testStorage.DeleteNotificationPreferences(ctx, "user1"); !errors.Is(err, model.ErrPreferencesNotFound) {
+		t.Fatalf("expected ErrPreferencesNotFound, got %v", err)
+	}
+}
+
+func TestStorage_Agenda(t *testing.T) {
+	ctx := context.Background()
+	testStorage := New()
+	_ = testStorage.SaveNotificationPreferences(ctx, model.NotificationPreferences{
+		UserID: "user1", Agenda: model.DailyAgenda{Enabled: true, At: 8 * time.Hour},
+	})
+	_ = testStorage.SaveNotificationPreferences(ctx, model.NotificationPreferences{UserID: "user2"})
+
+	prefs, _ := testStorage.ListAgendaPreferences(ctx)
+	if len(prefs) != 1 || prefs[0].UserID != "user1" {
+		t.Fatalf("expected only user1 with agenda, got %v", prefs)
+	}
+
+	day := time.Date(2024, time.September, 2, 0, 0, 0, 0, time.UTC)
+	for i, tc := range []struct {
+		day  time.Time
+		want bool
+	}{{day, true}, {day, false}, {day.AddDate(0, 0, -1), false}, {day.AddDate(0, 0, 1), true}} {
+		if got, err := testStorage.ClaimAgenda(ctx, "user1", tc.day, nil); err != nil || got != tc.want {
+			t.Fatalf("claim %d: expected %t, got %t, %v", i, tc.want, got, err)
+		}
+	}
+
+	// Отметка и запись журнала сохраняются вместе, снятая отметка позволяет повторить сводку
+	next := day.AddDate(0, 0, 2)
+	record := model.NotificationRecord{ID: uuid.New(), Kind: model.KindAgenda, OwnerID: "user1", RecipientID: "user1"}
+	if got, _ := testStorage.ClaimAgenda(ctx, "user1", next, []model.NotificationRecord{record}); !got {
+		t.Fatal("expected agenda to be claimed")
+	}
+	if _, ok := testStorage.notifications[record.ID]; !ok {
+		t.Fatal("expected agenda record to be saved with the claim")
+	}
+	if err := testStorage.ReleaseAgenda(ctx, "user1", next); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got, _ := testStorage.ClaimAgenda(ctx, "user1", next, nil); !got {
+		t.Fatal("expected released agenda to be claimed again")
+	}
+}
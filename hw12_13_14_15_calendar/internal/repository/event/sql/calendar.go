@@ -0,0 +1,218 @@
+package sqlstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+)
+
+func (s *Storage) CreateCalendar(ctx context.Context, calendar model.Calendar) (uuid.UUID, error) {
+	const op = "repository.sql.CreateCalendar"
+
+	query, args, err := sq.Insert("calendar").
+		PlaceholderFormat(sq.Dollar).
+		Columns("id", "owner_id", "name", "description").
+		Values(s.generateID(), calendar.OwnerID, calendar.Name, calendar.Description).
+		Suffix("RETURNING id").
+		ToSql()
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var id uuid.UUID
+	if err := s.pool.QueryRow(ctx, query, args...).Scan(&id); err != nil {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+func (s *Storage) UpdateCalendar(ctx context.Context, id uuid.UUID, calendar model.Calendar) error {
+	const op = "repository.sql.UpdateCalendar"
+
+	query, args, err := sq.Update("calendar").
+		PlaceholderFormat(sq.Dollar).
+		Set("name", calendar.Name).
+		Set("description", calendar.Description).
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	tag, err := s.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, model.ErrCalendarNotFound)
+	}
+	return nil
+}
+
+// DeleteCalendar удаляет календарь; его события и доступы удаляются каскадно.
+func (s *Storage) DeleteCalendar(ctx context.Context, id uuid.UUID) error {
+	const op = "repository.sql.DeleteCalendar"
+
+	tag, err := s.pool.Exec(ctx, "DELETE FROM calendar WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, model.ErrCalendarNotFound)
+	}
+	return nil
+}
+
+func (s *Storage) GetCalendar(ctx context.Context, id uuid.UUID) (model.Calendar, error) {
+	const op = "repository.sql.GetCalendar"
+
+	calendars, err := s.selectCalendars(ctx, sq.Eq{"id": id})
+	if err != nil {
+		return model.Calendar{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(calendars) == 0 {
+		return model.Calendar{}, fmt.Errorf("%s: %w", op, model.ErrCalendarNotFound)
+	}
+	return calendars[0], nil
+}
+
+// ListCalendars возвращает календари, которыми пользователь владеет или к которым ему открыт доступ.
+func (s *Storage) ListCalendars(ctx context.Context, userID string) ([]model.Calendar, error) {
+	const op = "repository.sql.ListCalendars"
+
+	calendars, err := s.selectCalendars(ctx, sq.Or{
+		sq.Eq{"owner_id": userID},
+		sq.Expr("id IN (SELECT calendar_id FROM calendar_share WHERE user_id = ?)", userID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return calendars, nil
+}
+
+func (s *Storage) selectCalendars(ctx context.Context, where sq.Sqlizer) ([]model.Calendar, error) {
+	query, args, err := sq.Select("id", "owner_id", "name", "description").
+		From("calendar").
+		PlaceholderFormat(sq.Dollar).
+		Where(where).
+		OrderBy("name").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var calendars []model.Calendar
+	for rows.Next() {
+		var calendar model.Calendar
+		if err := rows.Scan(&calendar.ID, &calendar.OwnerID, &calendar.Name, &calendar.Description); err != nil {
+			return nil, err
+		}
+		calendars = append(calendars, calendar)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.loadShares(ctx, calendars); err != nil {
+		return nil, err
+	}
+	return calendars, nil
+}
+
+func (s *Storage) loadShares(ctx context.Context, calendars []model.Calendar) error {
+	if len(calendars) == 0 {
+		return nil
+	}
+
+	byID := make(map[uuid.UUID]int, len(calendars))
+	ids := make([]uuid.UUID, 0, len(calendars))
+	for i, calendar := range calendars {
+		byID[calendar.ID] = i
+		ids = append(ids, calendar.ID)
+	}
+
+	query, args, err := sq.Select("calendar_id", "user_id", "permission").
+		From("calendar_share").
+		PlaceholderFormat(sq.Dollar).
+		Where(sq.Eq{"calendar_id": ids}).
+		OrderBy("user_id").
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			calendarID uuid.UUID
+			share      model.CalendarShare
+		)
+		if err := rows.Scan(&calendarID, &share.UserID, &share.Permission); err != nil {
+			return err
+		}
+		i := byID[calendarID]
+		calendars[i].Shares = append(calendars[i].Shares, share)
+	}
+	return rows.Err()
+}
+
+func (s *Storage) ShareCalendar(ctx context.Context, calendarID uuid.UUID, share model.CalendarShare) error {
+	const op = "repository.sql.ShareCalendar"
+
+	if err := s.calendarExists(ctx, calendarID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	query, args, err := sq.Insert("calendar_share").
+		PlaceholderFormat(sq.Dollar).
+		Columns("calendar_id", "user_id", "permission").
+		Values(calendarID, share.UserID, string(share.Permission)).
+		Suffix("ON CONFLICT (calendar_id, user_id) DO UPDATE SET permission = EXCLUDED.permission").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := s.pool.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) RevokeCalendarShare(ctx context.Context, calendarID uuid.UUID, userID string) error {
+	const op = "repository.sql.RevokeCalendarShare"
+
+	if err := s.calendarExists(ctx, calendarID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err := s.pool.Exec(ctx, "DELETE FROM calendar_share WHERE calendar_id = $1 AND user_id = $2", calendarID, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) calendarExists(ctx context.Context, id uuid.UUID) error {
+	var exists int
+	err := s.pool.QueryRow(ctx, "SELECT 1 FROM calendar WHERE id = $1", id).Scan(&exists)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.ErrCalendarNotFound
+	}
+	return err
+}
@@ -0,0 +1,59 @@
+package sqlstorage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+)
+
+// CreateEventIdempotent создаёт событие, запоминая результат под ключом. Повтор с тем же
+// ключом и тем же запросом возвращает исходный ID и replayed = true.
+//
+// Ключ вставляется до создания события: параллельный запрос с тем же ключом
+// ждёт на уникальном индексе, пока первая транзакция не завершится.
+// Квота проверяется только для нового ключа: повтор не создаёт событие и не упирается в неё.
+func (s *Storage) CreateEventIdempotent(
+	ctx context.Context, key model.IdempotencyKey, event model.Event,
+) (id uuid.UUID, replayed bool, err error) {
+	const op = "repository.sql.CreateEventIdempotent"
+
+	err = s.withTx(ctx, func(q querier) error {
+		if _, err := q.Exec(ctx, "DELETE FROM idempotency_key WHERE expires_at < $1", s.clock.Now()); err != nil {
+			return err
+		}
+
+		tag, err := q.Exec(ctx,
+			`INSERT INTO idempotency_key (key, request_hash, expires_at) VALUES ($1, $2, $3)
+			ON CONFLICT (key) DO NOTHING`,
+			key.Scoped(), key.RequestHash, key.ExpiresAt)
+		if err != nil {
+			return err
+		}
+
+		if tag.RowsAffected() == 0 {
+			var requestHash string
+			err := q.QueryRow(ctx, "SELECT request_hash, event_id FROM idempotency_key WHERE key = $1",
+				key.Scoped()).Scan(&requestHash, &id)
+			if err != nil {
+				return err
+			}
+			if requestHash != key.RequestHash {
+				return model.ErrIdempotencyKeyReused
+			}
+			replayed = true
+			return nil
+		}
+
+		if id, err = s.createEvent(ctx, q, event); err != nil {
+			return err
+		}
+		_, err = q.Exec(ctx, "UPDATE idempotency_key SET event_id = $2 WHERE key = $1", key.Scoped(), id)
+		return err
+	})
+	if err != nil {
+		return uuid.Nil, false, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, replayed, nil
+}
@@ -0,0 +1,78 @@
+package sqlstorage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+)
+
+// jobRunRetention - сколько хранится история запусков задач.
+const jobRunRetention = 30 * 24 * time.Hour
+
+// SaveJobRun добавляет запись в историю запусков и удаляет записи этой задачи старше jobRunRetention.
+func (s *Storage) SaveJobRun(ctx context.Context, run model.JobRun) error {
+	const op = "repository.sql.SaveJobRun"
+
+	err := s.withTx(ctx, func(q querier) error {
+		_, err := q.Exec(ctx,
+			`INSERT INTO job_run (job, started_at, duration_ms, status, error, details)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			run.Job, run.StartedAt, run.Duration.Milliseconds(), string(run.Status), run.Error, run.Details)
+		if err != nil {
+			return err
+		}
+		_, err = q.Exec(ctx, "DELETE FROM job_run WHERE job = $1 AND started_at < $2",
+			run.Job, run.StartedAt.Add(-jobRunRetention))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// ListJobRuns возвращает последние запуски задач, начиная с самого нового.
+func (s *Storage) ListJobRuns(ctx context.Context, filter model.JobRunFilter) ([]model.JobRun, error) {
+	const op = "repository.sql.ListJobRuns"
+
+	builder := sq.Select("job", "started_at", "duration_ms", "status", "error", "details").
+		From("job_run").
+		PlaceholderFormat(sq.Dollar).
+		OrderBy("started_at DESC", "id DESC").
+		Limit(uint64(filter.Limit))
+	if filter.Job != "" {
+		builder = builder.Where(sq.Eq{"job": filter.Job})
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to build SQL query: %w", op, err)
+	}
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to execute query: %w", op, err)
+	}
+	defer rows.Close()
+
+	var runs []model.JobRun
+	for rows.Next() {
+		var (
+			run        model.JobRun
+			durationMS int64
+			status     string
+		)
+		if err := rows.Scan(&run.Job, &run.StartedAt, &durationMS, &status, &run.Error, &run.Details); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		run.Duration = time.Duration(durationMS) * time.Millisecond
+		run.Status = model.JobRunStatus(status)
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return runs, nil
+}
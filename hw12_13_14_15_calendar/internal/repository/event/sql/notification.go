@@ -0,0 +1,172 @@
+package sqlstorage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+)
+
+// notificationRetention - сколько хранится журнал уведомлений.
+const notificationRetention = 30 * 24 * time.Hour
+
+var notificationColumns = []string{
+	"id", "kind", "event_id", "reminder_id", "owner_id", "recipient_id", "channel", "delivery", "title",
+	"event_start", "event_duration", "description", "status", "send_after", "attempts", "last_error",
+	"queued_at", "updated_at",
+}
+
+func nullableTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// SaveNotifications добавляет записи в журнал уведомлений и удаляет записи старше notificationRetention.
+func (s *Storage) SaveNotifications(ctx context.Context, records []model.NotificationRecord) error {
+	const op = "repository.sql.SaveNotifications"
+
+	if len(records) == 0 {
+		return nil
+	}
+	err := s.withTx(ctx, func(q querier) error {
+		return s.saveNotifications(ctx, q, records)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// saveNotifications добавляет записи в журнал и удаляет устаревшие.
+func (s *Storage) saveNotifications(ctx context.Context, q querier, records []model.NotificationRecord) error {
+	builder := sq.Insert("notification_log").
+		PlaceholderFormat(sq.Dollar).
+		Columns(notificationColumns...)
+	for _, r := range records {
+		builder = builder.Values(r.ID, string(r.Kind), r.EventID, r.ReminderID, r.OwnerID, r.RecipientID,
+			string(r.Channel), string(r.Delivery), r.Title, nullableTime(r.EventStart), r.EventDuration,
+			r.Description, string(r.Status), nullableTime(r.SendAfter), r.Attempts, r.LastError, r.QueuedAt,
+			r.UpdatedAt)
+	}
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SQL query: %w", err)
+	}
+	if _, err := q.Exec(ctx, query, args...); err != nil {
+		return err
+	}
+	_, err = q.Exec(ctx, "DELETE FROM notification_log WHERE queued_at < $1",
+		s.clock.Now().Add(-notificationRetention))
+	return err
+}
+
+// UpdateNotificationStatus применяет отчёт отправителя к записи журнала.
+func (s *Storage) UpdateNotificationStatus(ctx context.Context, report model.NotificationStatusReport) error {
+	const op = "repository.sql.UpdateNotificationStatus"
+
+	tag, err := s.pool.Exec(ctx,
+		`UPDATE notification_log SET status = $2, attempts = $3, last_error = $4, updated_at = $5 WHERE id = $1`,
+		report.ID, string(report.Status), report.Attempts, report.Error, report.At)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, model.ErrNotificationNotFound)
+	}
+	return nil
+}
+
+// ListNotifications возвращает записи журнала, начиная с самой новой.
+func (s *Storage) ListNotifications(
+	ctx context.Context, filter model.NotificationFilter,
+) ([]model.NotificationRecord, error) {
+	const op = "repository.sql.ListNotifications"
+
+	builder := sq.Select(notificationColumns...).
+		From("notification_log").
+		PlaceholderFormat(sq.Dollar).
+		OrderBy("queued_at DESC", "id").
+		Limit(uint64(filter.Limit))
+	if filter.OwnerID != "" {
+		builder = builder.Where(sq.Eq{"owner_id": filter.OwnerID})
+	}
+	if filter.EventID != uuid.Nil {
+		builder = builder.Where(sq.Eq{"event_id": filter.EventID})
+	}
+
+	records, err := s.selectNotifications(ctx, builder)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return records, nil
+}
+
+// ListDeferredNotifications возвращает отложенные записи журнала, время отправки которых наступило к until.
+func (s *Storage) ListDeferredNotifications(
+	ctx context.Context, until time.Time,
+) ([]model.NotificationRecord, error) {
+	const op = "repository.sql.ListDeferredNotifications"
+
+	builder := sq.Select(notificationColumns...).
+		From("notification_log").
+		PlaceholderFormat(sq.Dollar).
+		Where(sq.Eq{"status": string(model.NotificationDeferred)}).
+		Where(sq.LtOrEq{"send_after": until}).
+		OrderBy("send_after", "queued_at")
+	records, err := s.selectNotifications(ctx, builder)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return records, nil
+}
+
+func (s *Storage) selectNotifications(
+	ctx context.Context, builder sq.SelectBuilder,
+) ([]model.NotificationRecord, error) {
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SQL query: %w", err)
+	}
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var records []model.NotificationRecord
+	for rows.Next() {
+		var (
+			r                       model.NotificationRecord
+			kind, channel, delivery string
+			status                  string
+			eventStart, sendAfter   *time.Time
+			eventDuration           *time.Duration
+		)
+		err := rows.Scan(&r.ID, &kind, &r.EventID, &r.ReminderID, &r.OwnerID, &r.RecipientID, &channel, &delivery,
+			&r.Title, &eventStart, &eventDuration, &r.Description, &status, &sendAfter, &r.Attempts, &r.LastError,
+			&r.QueuedAt, &r.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		r.Kind = model.NotificationKind(kind)
+		r.Channel = model.ReminderChannel(channel)
+		r.Delivery = model.Delivery(delivery)
+		r.Status = model.NotificationStatus(status)
+		if eventStart != nil {
+			r.EventStart = *eventStart
+		}
+		if eventDuration != nil {
+			r.EventDuration = *eventDuration
+		}
+		if sendAfter != nil {
+			r.SendAfter = *sendAfter
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
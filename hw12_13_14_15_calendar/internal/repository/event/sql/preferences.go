@@ -0,0 +1,189 @@
+package sqlstorage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+)
+
+var preferencesColumns = []string{
+	"user_id", "channels", "time_zone", "locale", "quiet_start_min", "quiet_end_min", "mode",
+	"agenda_enabled", "agenda_min",
+}
+
+func (s *Storage) GetNotificationPreferences(
+	ctx context.Context, userID string,
+) (model.NotificationPreferences, error) {
+	const op = "repository.sql.GetNotificationPreferences"
+
+	prefs, err := s.selectPreferences(ctx, sq.Eq{"user_id": userID})
+	if err != nil {
+		return model.NotificationPreferences{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(prefs) == 0 {
+		return model.NotificationPreferences{}, model.ErrPreferencesNotFound
+	}
+	return prefs[userID], nil
+}
+
+// SaveNotificationPreferences создаёт или заменяет настройки пользователя.
+func (s *Storage) SaveNotificationPreferences(ctx context.Context, prefs model.NotificationPreferences) error {
+	const op = "repository.sql.SaveNotificationPreferences"
+
+	channels := make([]string, 0, len(prefs.Channels))
+	for _, c := range prefs.Channels {
+		channels = append(channels, string(c))
+	}
+	// agenda_sent_on не перезаписывается, чтобы изменение настроек не повторило сегодняшнюю сводку
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO notification_preferences
+			(user_id, channels, time_zone, locale, quiet_start_min, quiet_end_min, mode,
+			 agenda_enabled, agenda_min, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (user_id) DO UPDATE SET
+			channels = EXCLUDED.channels, time_zone = EXCLUDED.time_zone, locale = EXCLUDED.locale,
+			quiet_start_min = EXCLUDED.quiet_start_min, quiet_end_min = EXCLUDED.quiet_end_min,
+			mode = EXCLUDED.mode, agenda_enabled = EXCLUDED.agenda_enabled, agenda_min = EXCLUDED.agenda_min,
+			updated_at = EXCLUDED.updated_at`,
+		prefs.UserID, channels, prefs.TimeZone, prefs.Locale, int(prefs.QuietHours.Start/time.Minute),
+		int(prefs.QuietHours.End/time.Minute), string(prefs.Mode), prefs.Agenda.Enabled,
+		int(prefs.Agenda.At/time.Minute), s.clock.Now())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) DeleteNotificationPreferences(ctx context.Context, userID string) error {
+	const op = "repository.sql.DeleteNotificationPreferences"
+
+	tag, err := s.pool.Exec(ctx, "DELETE FROM notification_preferences WHERE user_id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return model.ErrPreferencesNotFound
+	}
+	return nil
+}
+
+// ListNotificationPreferences возвращает настройки пользователей, которые их задали.
+func (s *Storage) ListNotificationPreferences(
+	ctx context.Context, userIDs []string,
+) (map[string]model.NotificationPreferences, error) {
+	const op = "repository.sql.ListNotificationPreferences"
+
+	if len(userIDs) == 0 {
+		return map[string]model.NotificationPreferences{}, nil
+	}
+	prefs, err := s.selectPreferences(ctx, sq.Eq{"user_id": userIDs})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return prefs, nil
+}
+
+// ListAgendaPreferences возвращает настройки пользователей, включивших ежедневную сводку.
+func (s *Storage) ListAgendaPreferences(ctx context.Context) ([]model.NotificationPreferences, error) {
+	const op = "repository.sql.ListAgendaPreferences"
+
+	prefs, err := s.selectPreferences(ctx, sq.Eq{"agenda_enabled": true})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	result := make([]model.NotificationPreferences, 0, len(prefs))
+	for _, p := range prefs {
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+// ClaimAgenda отмечает сводку пользователя за день day отправленной и в той же
+// транзакции записывает records в журнал уведомлений; false - сводка за этот день
+// уже отправлялась, в том числе другим экземпляром планировщика.
+func (s *Storage) ClaimAgenda(
+	ctx context.Context, userID string, day time.Time, records []model.NotificationRecord,
+) (bool, error) {
+	const op = "repository.sql.ClaimAgenda"
+
+	var claimed bool
+	err := s.withTx(ctx, func(q querier) error {
+		tag, err := q.Exec(ctx, `
+			UPDATE notification_preferences SET agenda_sent_on = $2
+			WHERE user_id = $1 AND (agenda_sent_on IS NULL OR agenda_sent_on < $2)`,
+			userID, day.Format(time.DateOnly))
+		if err != nil {
+			return err
+		}
+		claimed = tag.RowsAffected() > 0
+		if !claimed || len(records) == 0 {
+			return nil
+		}
+		return s.saveNotifications(ctx, q, records)
+	})
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return claimed, nil
+}
+
+// ReleaseAgenda снимает отметку ClaimAgenda, если сводку за день day не удалось отправить.
+func (s *Storage) ReleaseAgenda(ctx context.Context, userID string, day time.Time) error {
+	const op = "repository.sql.ReleaseAgenda"
+
+	_, err := s.pool.Exec(ctx,
+		"UPDATE notification_preferences SET agenda_sent_on = NULL WHERE user_id = $1 AND agenda_sent_on = $2",
+		userID, day.Format(time.DateOnly))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) selectPreferences(
+	ctx context.Context, where sq.Sqlizer,
+) (map[string]model.NotificationPreferences, error) {
+	query, args, err := sq.Select(preferencesColumns...).
+		From("notification_preferences").
+		PlaceholderFormat(sq.Dollar).
+		Where(where).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SQL query: %w", err)
+	}
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string]model.NotificationPreferences)
+	for rows.Next() {
+		var (
+			p                    model.NotificationPreferences
+			channels             []string
+			quietStart, quietEnd int
+			mode                 string
+			agendaAt             int
+		)
+		err := rows.Scan(&p.UserID, &channels, &p.TimeZone, &p.Locale, &quietStart, &quietEnd, &mode,
+			&p.Agenda.Enabled, &agendaAt)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range channels {
+			p.Channels = append(p.Channels, model.ReminderChannel(c))
+		}
+		p.QuietHours = model.QuietHours{
+			Start: time.Duration(quietStart) * time.Minute,
+			End:   time.Duration(quietEnd) * time.Minute,
+		}
+		p.Mode = model.NotificationMode(mode)
+		p.Agenda.At = time.Duration(agendaAt) * time.Minute
+		result[p.UserID] = p
+	}
+	return result, rows.Err()
+}
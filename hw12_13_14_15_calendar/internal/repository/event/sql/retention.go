@@ -0,0 +1,132 @@
+package sqlstorage
+
+import (
+	"context"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+)
+
+const hasAttendees = "EXISTS (SELECT 1 FROM event_attendee a WHERE a.event_id = event.id)"
+
+// retentionGroup - события, к которым применяется одно правило хранения.
+type retentionGroup struct {
+	rule  model.RetentionRule
+	where sq.Sqlizer
+}
+
+// retentionGroups разбивает события на непересекающиеся группы так же, как
+// model.RetentionPolicy.Rule: календарь, затем владелец, затем правило по умолчанию.
+func retentionGroups(policy model.RetentionPolicy) []retentionGroup {
+	var groups []retentionGroup
+
+	calendarIDs := make([]string, 0, len(policy.Calendars))
+	for id, rule := range policy.Calendars {
+		if id == uuid.Nil {
+			continue
+		}
+		calendarIDs = append(calendarIDs, id.String())
+		groups = append(groups, retentionGroup{rule, sq.Eq{"calendar_id": id}})
+	}
+	otherCalendars := sq.Expr("(calendar_id IS NULL OR calendar_id <> ALL(?::uuid[]))", calendarIDs)
+
+	userIDs := make([]string, 0, len(policy.Users))
+	for userID, rule := range policy.Users {
+		userIDs = append(userIDs, userID)
+		groups = append(groups, retentionGroup{rule, sq.And{sq.Eq{"user_id": userID}, otherCalendars}})
+	}
+	otherUsers := sq.Expr("(user_id IS NULL OR user_id <> ALL(?::text[]))", userIDs)
+
+	return append(groups, retentionGroup{policy.Default, sq.And{otherCalendars, otherUsers}})
+}
+
+// PurgeEvents удаляет события, срок хранения которых по policy истёк.
+func (s *Storage) PurgeEvents(ctx context.Context, policy model.RetentionPolicy) (model.PurgeStats, error) {
+	const op = "repository.sql.PurgeEvents"
+
+	now := s.clock.Now()
+	stats := model.PurgeStats{DryRun: policy.DryRun}
+	err := s.withTx(ctx, func(q querier) error {
+		for _, group := range retentionGroups(policy) {
+			if group.rule.MaxAge <= 0 {
+				continue
+			}
+			expired := sq.And{group.where, sq.Lt{"start_time": now.Add(-group.rule.MaxAge)}}
+
+			if group.rule.KeepWithAttendees {
+				kept, err := countEvents(ctx, q, sq.And{expired, sq.Expr(hasAttendees)})
+				if err != nil {
+					return err
+				}
+				stats.KeptWithAttendees += kept
+				expired = append(expired, sq.Expr("NOT "+hasAttendees))
+			}
+
+			if policy.DryRun {
+				count, err := countEvents(ctx, q, expired)
+				if err != nil {
+					return err
+				}
+				stats.Deleted += count
+				if limit := model.MaxDryRunEventIDs - len(stats.EventIDs); count > 0 && limit > 0 {
+					ids, err := selectEventIDs(ctx, q, expired, limit)
+					if err != nil {
+						return err
+					}
+					stats.EventIDs = append(stats.EventIDs, ids...)
+				}
+				continue
+			}
+
+			query, args, err := sq.Delete("event").PlaceholderFormat(sq.Dollar).Where(expired).ToSql()
+			if err != nil {
+				return fmt.Errorf("failed to build SQL query: %w", err)
+			}
+			tag, err := q.Exec(ctx, query, args...)
+			if err != nil {
+				return err
+			}
+			stats.Deleted += int(tag.RowsAffected())
+		}
+		return nil
+	})
+	if err != nil {
+		return model.PurgeStats{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return stats, nil
+}
+
+func countEvents(ctx context.Context, q querier, where sq.Sqlizer) (int, error) {
+	query, args, err := sq.Select("count(*)").From("event").PlaceholderFormat(sq.Dollar).Where(where).ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build SQL query: %w", err)
+	}
+	var count int
+	err = q.QueryRow(ctx, query, args...).Scan(&count)
+	return count, err
+}
+
+func selectEventIDs(ctx context.Context, q querier, where sq.Sqlizer, limit int) ([]uuid.UUID, error) {
+	query, args, err := sq.Select("id").From("event").PlaceholderFormat(sq.Dollar).
+		Where(where).OrderBy("start_time").Limit(uint64(limit)).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build SQL query: %w", err)
+	}
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,50 @@
+package sqlstorage
+
+import (
+	"testing"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionGroups(t *testing.T) {
+	archive := uuid.New()
+	policy := model.RetentionPolicy{
+		Default:   model.RetentionRule{MaxAge: 30 * 24 * time.Hour},
+		Calendars: map[uuid.UUID]model.RetentionRule{archive: {}, uuid.Nil: {MaxAge: time.Hour}},
+		Users:     map[string]model.RetentionRule{"vip": {MaxAge: 60 * 24 * time.Hour}},
+	}
+
+	groups := retentionGroups(policy)
+	require.Len(t, groups, 3)
+
+	toSQL := func(where sq.Sqlizer) (string, []interface{}) {
+		t.Helper()
+		query, args, err := where.ToSql()
+		require.NoError(t, err)
+		return query, args
+	}
+
+	// Правило календаря действует на все события календаря
+	query, args := toSQL(groups[0].where)
+	require.Equal(t, model.RetentionRule{}, groups[0].rule)
+	require.Equal(t, "calendar_id = ?", query)
+	require.Equal(t, []interface{}{archive.String()}, args)
+
+	// Правило владельца не трогает события календарей со своим правилом
+	query, args = toSQL(groups[1].where)
+	require.Equal(t, policy.Users["vip"], groups[1].rule)
+	require.Equal(t, "(user_id = ? AND (calendar_id IS NULL OR calendar_id <> ALL(?::uuid[])))", query)
+	require.Equal(t, []interface{}{"vip", []string{archive.String()}}, args)
+
+	// Правило по умолчанию - для всех остальных событий
+	query, args = toSQL(groups[2].where)
+	require.Equal(t, policy.Default, groups[2].rule)
+	require.Equal(t,
+		"((calendar_id IS NULL OR calendar_id <> ALL(?::uuid[])) AND (user_id IS NULL OR user_id <> ALL(?::text[])))",
+		query)
+	require.Equal(t, []interface{}{[]string{archive.String()}, []string{"vip"}}, args)
+}
@@ -0,0 +1,119 @@
+package sqlstorage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+)
+
+// searchVector совпадает с выражением индекса event_search_idx.
+const searchVector = `(setweight(to_tsvector('simple', coalesce(title, '')), 'A') || ` +
+	`setweight(to_tsvector('simple', coalesce(description, '')), 'B'))`
+
+func (s *Storage) SearchEvents(ctx context.Context, query model.SearchQuery) (model.SearchPage, error) {
+	const op = "repository.sql.SearchEvents"
+
+	if strings.TrimSpace(query.Text) == "" {
+		return model.SearchPage{}, fmt.Errorf("%s: %w", op, model.ErrEmptySearchQuery)
+	}
+
+	where := sq.And{sq.Expr(searchVector+" @@ plainto_tsquery('simple', ?)", query.Text)}
+	if !query.From.IsZero() {
+		where = append(where, sq.GtOrEq{"start_time": query.From})
+	}
+	if !query.To.IsZero() {
+		where = append(where, sq.Lt{"start_time": query.To})
+	}
+	if query.UserID != "" {
+		where = append(where, readableBy(query.UserID))
+	}
+
+	var page model.SearchPage
+	// Total считается отдельно: оконный count(*) пуст, когда смещение за пределами результатов
+	countQuery, args, err := sq.Select("count(*)").From("event").PlaceholderFormat(sq.Dollar).Where(where).ToSql()
+	if err != nil {
+		return model.SearchPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := s.pool.QueryRow(ctx, countQuery, args...).Scan(&page.Total); err != nil {
+		return model.SearchPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if page.Total == 0 || query.Offset >= page.Total {
+		return page, nil
+	}
+
+	builder := sq.Select("id").
+		Column(sq.Expr("ts_rank("+searchVector+", plainto_tsquery('simple', ?)) AS rank", query.Text)).
+		From("event").
+		PlaceholderFormat(sq.Dollar).
+		Where(where).
+		OrderBy("rank DESC", "start_time").
+		Offset(uint64(query.Offset))
+	if query.Limit > 0 {
+		builder = builder.Limit(uint64(query.Limit))
+	}
+
+	sqlQuery, args, err := builder.ToSql()
+	if err != nil {
+		return model.SearchPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := s.pool.Query(ctx, sqlQuery, args...)
+	if err != nil {
+		return model.SearchPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var (
+		ids   []uuid.UUID
+		ranks = make(map[uuid.UUID]float64)
+	)
+	for rows.Next() {
+		var (
+			id   uuid.UUID
+			rank float32
+		)
+		if err := rows.Scan(&id, &rank); err != nil {
+			return model.SearchPage{}, fmt.Errorf("%s: %w", op, err)
+		}
+		ids = append(ids, id)
+		ranks[id] = float64(rank)
+	}
+	if err := rows.Err(); err != nil {
+		return model.SearchPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(ids) == 0 {
+		return page, nil
+	}
+
+	events, err := s.selectEvents(ctx, sq.Eq{"id": ids})
+	if err != nil {
+		return model.SearchPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+	for _, event := range events {
+		page.Results = append(page.Results, model.SearchResult{Event: event, Rank: ranks[event.ID]})
+	}
+	sort.SliceStable(page.Results, func(i, j int) bool {
+		if page.Results[i].Rank != page.Results[j].Rank {
+			return page.Results[i].Rank > page.Results[j].Rank
+		}
+		return page.Results[i].Event.StartTime.Before(page.Results[j].Event.StartTime)
+	})
+	return page, nil
+}
+
+// readableBy отбирает события, содержимое которых пользователь может читать:
+// как participantOf, но без календарей с доступом free-busy.
+func readableBy(userID string) sq.Sqlizer {
+	return sq.Or{
+		sq.Eq{"user_id": userID},
+		sq.Expr("id IN (SELECT event_id FROM event_attendee WHERE user_id = ?)", userID),
+		sq.Expr("calendar_id IN (SELECT id FROM calendar WHERE owner_id = ?)", userID),
+		sq.Expr("calendar_id IN (SELECT calendar_id FROM calendar_share WHERE user_id = ? AND permission IN (?, ?))",
+			userID, string(model.PermissionRead), string(model.PermissionWrite)),
+	}
+}
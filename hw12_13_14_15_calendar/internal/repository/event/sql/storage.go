@@ -2,36 +2,88 @@ package sqlstorage
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/clock"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/config"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/tlsconfig"
 )
 
 type Storage struct {
-	pool *pgxpool.Pool
+	pool  *pgxpool.Pool
+	clock clock.Clock
+	// maxEventsPerUser - сколько событий может хранить один пользователь; 0 - без ограничений.
+	maxEventsPerUser int
 }
 
-func New(pool *pgxpool.Pool) *Storage {
-	return &Storage{
-		pool: pool,
+type Option func(*Storage)
+
+// WithClock задаёт источник времени, в тестах - clock.Fake.
+func WithClock(c clock.Clock) Option {
+	return func(s *Storage) {
+		s.clock = c
+	}
+}
+
+// WithEventQuota ограничивает число событий, которыми владеет один пользователь.
+func WithEventQuota(maxEventsPerUser int) Option {
+	return func(s *Storage) {
+		s.maxEventsPerUser = maxEventsPerUser
+	}
+}
+
+// querier - общая часть pgxpool.Pool и pgx.Tx, позволяющая выполнять
+// одни и те же запросы как в транзакции, так и без неё.
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+func New(pool *pgxpool.Pool, opts ...Option) *Storage {
+	s := &Storage{
+		pool:  pool,
+		clock: clock.Real,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 func (s *Storage) Connect(ctx context.Context, cfg config.Config) error {
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+	sslMode := cfg.Database.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s%s",
 		cfg.Database.Host,
 		cfg.Database.Port,
 		cfg.Database.Username,
 		cfg.Database.Password,
 		cfg.Database.DBName,
+		sslMode,
+		sslParams(cfg.Database.TLS),
 	)
 
-	pool, err := pgxpool.Connect(ctx, dsn)
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return fmt.Errorf("failed to parse database config: %w", err)
+	}
+	if err := reloadClientCertificate(poolConfig, cfg.Database.TLS); err != nil {
+		return fmt.Errorf("failed to load database client certificate: %w", err)
+	}
+
+	pool, err := pgxpool.ConnectConfig(ctx, poolConfig)
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
@@ -39,6 +91,50 @@ func (s *Storage) Connect(ctx context.Context, cfg config.Config) error {
 	return s.pool.Ping(ctx)
 }
 
+// sslParams добавляет к DSN файлы сертификатов из секции tls.
+func sslParams(cfg config.TLS) string {
+	var params string
+	if cfg.CAFile != "" {
+		params += " sslrootcert=" + cfg.CAFile
+	}
+	if cfg.CertFile != "" {
+		params += " sslcert=" + cfg.CertFile
+	}
+	if cfg.KeyFile != "" {
+		params += " sslkey=" + cfg.KeyFile
+	}
+	return params
+}
+
+// reloadClientCertificate заменяет клиентский сертификат, который pgx прочитал
+// при разборе DSN, на перечитываемый при изменении файлов.
+func reloadClientCertificate(poolConfig *pgxpool.Config, cfg config.TLS) error {
+	if cfg.CertFile == "" {
+		return nil
+	}
+
+	reloader, err := tlsconfig.NewReloader(cfg.CertFile, cfg.KeyFile, "")
+	if err != nil {
+		return err
+	}
+	getCertificate := func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return reloader.Certificate(), nil
+	}
+
+	// При sslmode=allow/prefer pgx пробует подключения с TLS и без
+	tlsConfigs := []*tls.Config{poolConfig.ConnConfig.TLSConfig}
+	for _, fallback := range poolConfig.ConnConfig.Fallbacks {
+		tlsConfigs = append(tlsConfigs, fallback.TLSConfig)
+	}
+	for _, tlsConfig := range tlsConfigs {
+		if tlsConfig != nil {
+			tlsConfig.Certificates = nil
+			tlsConfig.GetClientCertificate = getCertificate
+		}
+	}
+	return nil
+}
+
 func (s *Storage) Close(ctx context.Context) {
 	s.pool.Close()
 }
@@ -47,14 +143,53 @@ func (s *Storage) generateID() string {
 	return uuid.New().String()
 }
 
+// nullableID превращает нулевой UUID в NULL.
+func nullableID(id uuid.UUID) interface{} {
+	if id == uuid.Nil {
+		return nil
+	}
+	return id
+}
+
+// withTx выполняет fn в транзакции и фиксирует её, если fn не вернула ошибку.
+func (s *Storage) withTx(ctx context.Context, fn func(q querier) error) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
 func (s *Storage) CreateEvent(ctx context.Context, event model.Event) (uuid.UUID, error) {
+	var eventID uuid.UUID
+	err := s.withTx(ctx, func(q querier) error {
+		var err error
+		eventID, err = s.createEvent(ctx, q, event)
+		return err
+	})
+	return eventID, err
+}
+
+func (s *Storage) createEvent(ctx context.Context, q querier, event model.Event) (uuid.UUID, error) {
 	const op = "repository.sql.CreateEvent"
 
+	if err := s.checkQuota(ctx, q, event.UserID); err != nil {
+		return uuid.UUID{}, fmt.Errorf("%s: %w", op, err)
+	}
+
 	builderInsert := sq.Insert("event").
 		PlaceholderFormat(sq.Dollar).
-		Columns("id", "title", "start_time", "description", "duration", "notify_before", "user_id").
+		Columns("id", "title", "start_time", "description", "duration", "notify_before", "user_id", "calendar_id").
 		Values(s.generateID(), event.Title, event.StartTime, event.Description,
-			event.Duration, event.NotifyBefore, event.UserID).
+			event.Duration, event.NotifyBefore, event.UserID, nullableID(event.CalendarID)).
 		Suffix("RETURNING id")
 
 	query, args, err := builderInsert.ToSql()
@@ -63,23 +198,107 @@ func (s *Storage) CreateEvent(ctx context.Context, event model.Event) (uuid.UUID
 	}
 
 	var eventID uuid.UUID
-	err = s.pool.QueryRow(ctx, query, args...).Scan(&eventID)
+	err = q.QueryRow(ctx, query, args...).Scan(&eventID)
 	if err != nil {
 		return uuid.UUID{}, fmt.Errorf("%s: %w", op, err)
 	}
 
+	if err := s.insertAttendees(ctx, q, eventID, event.Attendees); err != nil {
+		return uuid.UUID{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := s.insertReminders(ctx, q, eventID, model.NormalizeReminders(event)); err != nil {
+		return uuid.UUID{}, fmt.Errorf("%s: %w", op, err)
+	}
+
 	return eventID, nil
 }
 
+func (s *Storage) insertReminders(ctx context.Context, q querier, eventID uuid.UUID, reminders []model.Reminder) error {
+	if len(reminders) == 0 {
+		return nil
+	}
+
+	builderInsert := sq.Insert("event_reminder").
+		PlaceholderFormat(sq.Dollar).
+		Columns("id", "event_id", "notify_offset", "channel", "sent", "sent_at", "delivery")
+	for _, r := range reminders {
+		id := r.ID
+		if id == uuid.Nil {
+			id = uuid.New()
+		}
+		var sentAt *time.Time
+		if r.Sent {
+			sentAt = &r.SentAt
+		}
+		builderInsert = builderInsert.Values(id, eventID, r.Offset, string(r.Channel), r.Sent, sentAt, string(r.Delivery))
+	}
+
+	query, args, err := builderInsert.ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(ctx, query, args...)
+	return err
+}
+
+func (s *Storage) insertAttendees(ctx context.Context, q querier, eventID uuid.UUID, attendees []model.Attendee) error {
+	if len(attendees) == 0 {
+		return nil
+	}
+
+	builderInsert := sq.Insert("event_attendee").
+		PlaceholderFormat(sq.Dollar).
+		Columns("event_id", "user_id", "status").
+		Suffix("ON CONFLICT (event_id, user_id) DO NOTHING")
+	for _, a := range attendees {
+		status := a.Status
+		if status == "" {
+			status = model.AttendeeNeedsAction
+		}
+		builderInsert = builderInsert.Values(eventID, a.UserID, string(status))
+	}
+
+	query, args, err := builderInsert.ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(ctx, query, args...)
+	return err
+}
+
 func (s *Storage) UpdateEvent(ctx context.Context, id uuid.UUID, event model.Event) error {
+	return s.withTx(ctx, func(q querier) error {
+		return s.updateEvent(ctx, q, id, event)
+	})
+}
+
+func (s *Storage) updateEvent(ctx context.Context, q querier, id uuid.UUID, event model.Event) error {
 	const op = "repository.sql.UpdateEvent"
 
+	oldEvent := model.Event{ID: id}
+	err := q.QueryRow(ctx, "SELECT start_time FROM event WHERE id = $1 FOR UPDATE", id).Scan(&oldEvent.StartTime)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%s: %w", op, model.ErrEventNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	oldReminders, err := s.selectReminders(ctx, q, []uuid.UUID{id})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	oldEvent.Reminders = oldReminders[id]
+	reminders := model.MergeReminders(oldEvent, event)
+
+	// user_id не обновляется: владелец события постоянен
 	builderUpdate := sq.Update("event").
 		PlaceholderFormat(sq.Dollar).
 		Set("title", event.Title).
 		Set("start_time", event.StartTime).
 		Set("description", event.Description).
 		Set("duration", event.Duration).
+		Set("calendar_id", nullableID(event.CalendarID)).
+		Set("sent", model.AllRemindersSent(reminders)).
 		Where(sq.Eq{"id": id})
 
 	query, args, err := builderUpdate.ToSql()
@@ -87,15 +306,66 @@ func (s *Storage) UpdateEvent(ctx context.Context, id uuid.UUID, event model.Eve
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	_, err = s.pool.Exec(ctx, query, args...)
-	if err != nil {
+	if _, err := q.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := q.Exec(ctx, "DELETE FROM event_reminder WHERE event_id = $1", id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := s.insertReminders(ctx, q, id, reminders); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
 
+// selectReminders возвращает напоминания указанных событий, сгруппированные по событию.
+func (s *Storage) selectReminders(
+	ctx context.Context, q querier, eventIDs []uuid.UUID,
+) (map[uuid.UUID][]model.Reminder, error) {
+	query, args, err := sq.Select("event_id", "id", "notify_offset", "channel", "sent", "sent_at", "delivery").
+		From("event_reminder").
+		PlaceholderFormat(sq.Dollar).
+		Where(sq.Eq{"event_id": eventIDs}).
+		OrderBy("notify_offset DESC").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := make(map[uuid.UUID][]model.Reminder)
+	for rows.Next() {
+		var (
+			eventID  uuid.UUID
+			reminder model.Reminder
+			sentAt   *time.Time
+			delivery string
+		)
+		err := rows.Scan(&eventID, &reminder.ID, &reminder.Offset, &reminder.Channel, &reminder.Sent, &sentAt, &delivery)
+		if err != nil {
+			return nil, err
+		}
+		reminder.Delivery = model.Delivery(delivery)
+		if sentAt != nil {
+			reminder.SentAt = *sentAt
+		}
+		reminders[eventID] = append(reminders[eventID], reminder)
+	}
+	return reminders, rows.Err()
+}
+
 func (s *Storage) DeleteEvent(ctx context.Context, id uuid.UUID) error {
+	return s.deleteEvent(ctx, s.pool, id)
+}
+
+func (s *Storage) deleteEvent(ctx context.Context, q querier, id uuid.UUID) error {
 	const op = "repository.sql.DeleteEvent"
 
 	builderDelete := sq.Delete("event").
@@ -106,60 +376,432 @@ func (s *Storage) DeleteEvent(ctx context.Context, id uuid.UUID) error {
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
-	_, err = s.pool.Exec(ctx, query, args...)
+	tag, err := q.Exec(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, model.ErrEventNotFound)
+	}
 	return nil
 }
 
-func (s *Storage) GetEvents(ctx context.Context, date time.Time, offset int) ([]model.Event, error) {
-	const op = "repository.sql.GetEvents"
+// runBatch выполняет apply для каждого элемента пакета в одной транзакции.
+// Каждый элемент обёрнут в точку сохранения, поэтому без allOrNothing ошибка
+// одного элемента не мешает зафиксировать остальные.
+func (s *Storage) runBatch(
+	ctx context.Context, n int, allOrNothing bool,
+	apply func(ctx context.Context, q querier, i int) (uuid.UUID, error),
+) ([]model.BatchResult, error) {
+	const op = "repository.sql.runBatch"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to begin transaction: %w", op, err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	results := make([]model.BatchResult, n)
+	for i := 0; i < n; i++ {
+		savepoint, err := tx.Begin(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to create savepoint: %w", op, err)
+		}
+
+		id, err := apply(ctx, savepoint, i)
+		results[i] = model.BatchResult{Index: i, ID: id, Err: err}
+		if err != nil {
+			if err := savepoint.Rollback(ctx); err != nil {
+				return nil, fmt.Errorf("%s: failed to rollback savepoint: %w", op, err)
+			}
+			if allOrNothing {
+				for j := i + 1; j < n; j++ {
+					results[j] = model.BatchResult{Index: j}
+				}
+				model.AbortBatch(results)
+				return results, nil
+			}
+			continue
+		}
+
+		if err := savepoint.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("%s: failed to release savepoint: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("%s: failed to commit transaction: %w", op, err)
+	}
+	return results, nil
+}
+
+func (s *Storage) BatchCreateEvents(
+	ctx context.Context, events []model.Event, allOrNothing bool,
+) ([]model.BatchResult, error) {
+	return s.runBatch(ctx, len(events), allOrNothing, func(ctx context.Context, q querier, i int) (uuid.UUID, error) {
+		return s.createEvent(ctx, q, events[i])
+	})
+}
+
+func (s *Storage) BatchUpdateEvents(
+	ctx context.Context, updates []model.EventUpdate, allOrNothing bool,
+) ([]model.BatchResult, error) {
+	return s.runBatch(ctx, len(updates), allOrNothing, func(ctx context.Context, q querier, i int) (uuid.UUID, error) {
+		return updates[i].ID, s.updateEvent(ctx, q, updates[i].ID, updates[i].Event)
+	})
+}
+
+func (s *Storage) BatchDeleteEvents(
+	ctx context.Context, ids []uuid.UUID, allOrNothing bool,
+) ([]model.BatchResult, error) {
+	return s.runBatch(ctx, len(ids), allOrNothing, func(ctx context.Context, q querier, i int) (uuid.UUID, error) {
+		return ids[i], s.deleteEvent(ctx, q, ids[i])
+	})
+}
 
+func eventsBetween(date time.Time, offset int) sq.Sqlizer {
 	startDate := date.Format(time.DateOnly)                     // Приводим к формату даты
 	endDate := date.AddDate(0, 0, offset).Format(time.DateOnly) // Конечная дата
 
-	builderSelect := sq.Select("id", "title", "start_time", "description", "duration", "notify_before", "user_id").
+	return sq.Expr("start_time BETWEEN ? AND ?", startDate+" 00:00:00", endDate+" 23:59:59")
+}
+
+// participantOf отбирает события, где пользователь - владелец или приглашённый участник,
+// а также события календарей, которыми он владеет или к которым ему открыт доступ.
+func participantOf(userID string) sq.Sqlizer {
+	return sq.Or{
+		sq.Eq{"user_id": userID},
+		sq.Expr("id IN (SELECT event_id FROM event_attendee WHERE user_id = ?)", userID),
+		sq.Expr("calendar_id IN (SELECT id FROM calendar WHERE owner_id = ?)", userID),
+		sq.Expr("calendar_id IN (SELECT calendar_id FROM calendar_share WHERE user_id = ?)", userID),
+	}
+}
+
+func (s *Storage) GetEvents(ctx context.Context, date time.Time, offset int) ([]model.Event, error) {
+	const op = "repository.sql.GetEvents"
+
+	events, err := s.selectEvents(ctx, eventsBetween(date, offset))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return events, nil
+}
+
+func (s *Storage) GetUserEvents(ctx context.Context, userID string, date time.Time, offset int) ([]model.Event, error) {
+	const op = "repository.sql.GetUserEvents"
+
+	events, err := s.selectEvents(ctx, sq.And{eventsBetween(date, offset), participantOf(userID)})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return events, nil
+}
+
+// checkQuota проверяет, что владелец может создать ещё одно событие. Вызывается в транзакции:
+// блокировка пользователя держится до её конца, и параллельные вставки не превысят квоту.
+func (s *Storage) checkQuota(ctx context.Context, q querier, userID string) error {
+	if s.maxEventsPerUser <= 0 {
+		return nil
+	}
+	if _, err := q.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('event_quota:' || $1::text))", userID); err != nil {
+		return err
+	}
+	var count int
+	if err := q.QueryRow(ctx, "SELECT count(*) FROM event WHERE user_id = $1", userID).Scan(&count); err != nil {
+		return err
+	}
+	if count >= s.maxEventsPerUser {
+		return model.ErrQuotaExceeded
+	}
+	return nil
+}
+
+func (s *Storage) GetCalendarEvents(
+	ctx context.Context, calendarID uuid.UUID, date time.Time, offset int,
+) ([]model.Event, error) {
+	const op = "repository.sql.GetCalendarEvents"
+
+	events, err := s.selectEvents(ctx, sq.And{eventsBetween(date, offset), sq.Eq{"calendar_id": calendarID}})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return events, nil
+}
+
+func (s *Storage) GetEvent(ctx context.Context, id uuid.UUID) (model.Event, error) {
+	const op = "repository.sql.GetEvent"
+
+	events, err := s.selectEvents(ctx, sq.Eq{"id": id})
+	if err != nil {
+		return model.Event{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(events) == 0 {
+		return model.Event{}, fmt.Errorf("%s: %w", op, model.ErrEventNotFound)
+	}
+	return events[0], nil
+}
+
+func (s *Storage) selectEvents(ctx context.Context, where sq.Sqlizer) ([]model.Event, error) {
+	builderSelect := sq.Select("id", "title", "start_time", "description", "duration",
+		"notify_before", "user_id", "sent", "calendar_id").
 		From("event").
 		PlaceholderFormat(sq.Dollar).
-		Where(sq.Expr("start_time BETWEEN ? AND ?", startDate+" 00:00:00", endDate+" 23:59:59"))
+		Where(where)
 
 	query, args, err := builderSelect.ToSql()
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return nil, err
 	}
 	rows, err := s.pool.Query(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return nil, err
 	}
 	defer rows.Close()
 	var events []model.Event
 	for rows.Next() {
-		var event model.Event
+		var (
+			event      model.Event
+			calendarID *uuid.UUID
+		)
 		if err := rows.Scan(&event.ID, &event.Title, &event.StartTime, &event.Description,
-			&event.Duration, &event.NotifyBefore, &event.UserID); err != nil {
-			return nil, fmt.Errorf("%s: %w", op, err)
+			&event.Duration, &event.NotifyBefore, &event.UserID, &event.Sent, &calendarID); err != nil {
+			return nil, err
+		}
+		if calendarID != nil {
+			event.CalendarID = *calendarID
 		}
 		events = append(events, event)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return nil, err
+	}
+
+	if err := s.loadAttendees(ctx, events); err != nil {
+		return nil, err
+	}
+	if err := s.loadReminders(ctx, events); err != nil {
+		return nil, err
 	}
 	return events, nil
 }
 
+func (s *Storage) loadReminders(ctx context.Context, events []model.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+
+	reminders, err := s.selectReminders(ctx, s.pool, ids)
+	if err != nil {
+		return err
+	}
+	for i := range events {
+		events[i].Reminders = reminders[events[i].ID]
+	}
+	return nil
+}
+
+func (s *Storage) loadAttendees(ctx context.Context, events []model.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	byID := make(map[uuid.UUID]int, len(events))
+	ids := make([]uuid.UUID, 0, len(events))
+	for i, event := range events {
+		byID[event.ID] = i
+		ids = append(ids, event.ID)
+	}
+
+	query, args, err := sq.Select("event_id", "user_id", "status").
+		From("event_attendee").
+		PlaceholderFormat(sq.Dollar).
+		Where(sq.Eq{"event_id": ids}).
+		OrderBy("user_id").
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			eventID  uuid.UUID
+			attendee model.Attendee
+		)
+		if err := rows.Scan(&eventID, &attendee.UserID, &attendee.Status); err != nil {
+			return err
+		}
+		i := byID[eventID]
+		events[i].Attendees = append(events[i].Attendees, attendee)
+	}
+	return rows.Err()
+}
+
+// busyIntervals выбирает события, которые пересекаются с [$2, $3) и занимают время
+// пользователей из $1: как владельцев или как участников, принявших приглашение.
+const busyIntervals = `
+SELECT e.user_id, e.start_time, coalesce(e.duration, interval '0')
+FROM event e
+WHERE e.user_id = ANY($1::text[])
+  AND e.start_time < $3 AND e.start_time + coalesce(e.duration, interval '0') > $2
+UNION ALL
+SELECT a.user_id, e.start_time, coalesce(e.duration, interval '0')
+FROM event e
+JOIN event_attendee a ON a.event_id = e.id
+WHERE a.user_id = ANY($1::text[]) AND a.status IN ('accepted', 'tentative')
+  AND e.start_time < $3 AND e.start_time + coalesce(e.duration, interval '0') > $2`
+
+func (s *Storage) GetBusyIntervals(
+	ctx context.Context, userIDs []string, from, to time.Time,
+) (map[string][]model.Interval, error) {
+	const op = "repository.sql.GetBusyIntervals"
+
+	rows, err := s.pool.Query(ctx, busyIntervals, userIDs, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	busy := make(map[string][]model.Interval, len(userIDs))
+	for rows.Next() {
+		var (
+			userID    string
+			startTime time.Time
+			duration  time.Duration
+		)
+		if err := rows.Scan(&userID, &startTime, &duration); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		busy[userID] = append(busy[userID], model.Interval{Start: startTime, End: startTime.Add(duration)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return busy, nil
+}
+
+// calendarBusyIntervals выбирает события календарей из $1, которые пересекаются с [$2, $3).
+const calendarBusyIntervals = `
+SELECT e.start_time, coalesce(e.duration, interval '0')
+FROM event e
+WHERE e.calendar_id = ANY($1::uuid[])
+  AND e.start_time < $3 AND e.start_time + coalesce(e.duration, interval '0') > $2`
+
+func (s *Storage) GetCalendarBusyIntervals(
+	ctx context.Context, calendarIDs []uuid.UUID, from, to time.Time,
+) ([]model.Interval, error) {
+	const op = "repository.sql.GetCalendarBusyIntervals"
+
+	ids := make([]string, 0, len(calendarIDs))
+	for _, id := range calendarIDs {
+		ids = append(ids, id.String())
+	}
+	rows, err := s.pool.Query(ctx, calendarBusyIntervals, ids, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var busy []model.Interval
+	for rows.Next() {
+		var (
+			startTime time.Time
+			duration  time.Duration
+		)
+		if err := rows.Scan(&startTime, &duration); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		busy = append(busy, model.Interval{Start: startTime, End: startTime.Add(duration)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return busy, nil
+}
+
+func (s *Storage) eventOwner(ctx context.Context, eventID uuid.UUID) (string, error) {
+	var owner string
+	err := s.pool.QueryRow(ctx, "SELECT user_id FROM event WHERE id = $1", eventID).Scan(&owner)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", model.ErrEventNotFound
+	}
+	return owner, err
+}
+
+func (s *Storage) InviteAttendees(ctx context.Context, eventID uuid.UUID, userIDs []string) error {
+	const op = "repository.sql.InviteAttendees"
+
+	owner, err := s.eventOwner(ctx, eventID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	attendees := make([]model.Attendee, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if userID != owner {
+			attendees = append(attendees, model.Attendee{UserID: userID, Status: model.AttendeeNeedsAction})
+		}
+	}
+
+	if err := s.insertAttendees(ctx, s.pool, eventID, attendees); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) RespondToInvitation(
+	ctx context.Context, eventID uuid.UUID, userID string, status model.AttendeeStatus,
+) error {
+	const op = "repository.sql.RespondToInvitation"
+
+	query, args, err := sq.Update("event_attendee").
+		PlaceholderFormat(sq.Dollar).
+		Set("status", string(status)).
+		Where(sq.Eq{"event_id": eventID, "user_id": userID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	tag, err := s.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		if _, err := s.eventOwner(ctx, eventID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return fmt.Errorf("%s: %w", op, model.ErrAttendeeNotFound)
+	}
+	return nil
+}
+
+// GetNotifications возвращает все неотправленные напоминания, время которых
+// наступило к date, в том числе о уже начавшихся событиях: решение об опоздавших
+// напоминаниях принимает планировщик.
 func (s *Storage) GetNotifications(ctx context.Context, date time.Time) ([]model.Notification, error) {
 	const op = "repository.sql.GetNotifications"
 
 	dateString := date.Format("2006-01-02 15:04:05")
 
-	builderSelect := sq.Select("id", "title", "start_time", "user_id").
-		From("event").
+	builderSelect := sq.Select("e.id", "r.id", "r.channel", "e.title", "e.start_time",
+		"COALESCE(e.duration, '0')", "COALESCE(e.description, '')", "e.user_id",
+		"e.start_time - r.notify_offset AS notify_at").
+		From("event e").
+		Join("event_reminder r ON r.event_id = e.id").
 		PlaceholderFormat(sq.Dollar).
-		Where("notify_before IS NOT NULL").
-		Where("sent = FALSE").
-		Where("start_time - notify_before <= ?", dateString). // Здесь SQL обработает вычитание интервала
-		Where("start_time > ?", dateString)
+		Where("r.sent = FALSE").
+		Where("e.start_time - r.notify_offset <= ?", dateString). // Здесь SQL обработает вычитание интервала
+		OrderBy("notify_at")
 
 	query, args, err := builderSelect.ToSql()
 	if err != nil {
@@ -176,7 +818,9 @@ func (s *Storage) GetNotifications(ctx context.Context, date time.Time) ([]model
 
 	for rows.Next() {
 		var notification model.Notification
-		err := rows.Scan(&notification.EventID, &notification.Title, &notification.Date, &notification.UserID)
+		err := rows.Scan(&notification.EventID, &notification.ReminderID, &notification.Channel,
+			&notification.Title, &notification.Date, &notification.Duration, &notification.Description,
+			&notification.UserID, &notification.NotifyAt)
 		if err != nil {
 			return nil, fmt.Errorf("%s: failed to scan row: %w", op, err)
 		}
@@ -187,49 +831,90 @@ func (s *Storage) GetNotifications(ctx context.Context, date time.Time) ([]model
 		return nil, fmt.Errorf("%s: rows iteration error: %w", op, err)
 	}
 
+	if err := s.loadAcceptedAttendees(ctx, notifications); err != nil {
+		return nil, fmt.Errorf("%s: failed to load attendees: %w", op, err)
+	}
+
 	return notifications, nil
 }
 
-func (s *Storage) MarkEventsAsNotified(ctx context.Context, notifications []model.Notification) error {
-	for _, notification := range notifications {
-		const op = "repository.sql.MarkSent"
-
-		builderUpdate := sq.Update("event").
-			PlaceholderFormat(sq.Dollar).
-			Set("sent", true).
-			Where(sq.Eq{"id": notification.EventID})
+func (s *Storage) loadAcceptedAttendees(ctx context.Context, notifications []model.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
 
-		query, args, err := builderUpdate.ToSql()
-		if err != nil {
-			return fmt.Errorf("%s: %w", op, err)
+	byID := make(map[uuid.UUID][]int, len(notifications))
+	ids := make([]uuid.UUID, 0, len(notifications))
+	for i, n := range notifications {
+		if _, ok := byID[n.EventID]; !ok {
+			ids = append(ids, n.EventID)
 		}
+		byID[n.EventID] = append(byID[n.EventID], i)
+	}
 
-		_, err = s.pool.Exec(ctx, query, args...)
-		if err != nil {
-			return fmt.Errorf("%s: %w", op, err)
+	query, args, err := sq.Select("event_id", "user_id").
+		From("event_attendee").
+		PlaceholderFormat(sq.Dollar).
+		Where(sq.Eq{"event_id": ids, "status": string(model.AttendeeAccepted)}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			eventID uuid.UUID
+			userID  string
+		)
+		if err := rows.Scan(&eventID, &userID); err != nil {
+			return err
+		}
+		for _, i := range byID[eventID] {
+			notifications[i].Attendees = append(notifications[i].Attendees, userID)
 		}
 	}
-	return nil
+	return rows.Err()
 }
 
-func (s *Storage) DeleteOldEvents(ctx context.Context) error {
-	const op = "repository.sql.DeleteOldEvents"
+// markRemindersSent отмечает напоминания обработанными, сохраняя способ доставки,
+// и пересчитывает флаг sent у их событий. CTE видит таблицу до обновления, поэтому
+// только что отмеченные напоминания исключаются из проверки явно.
+const markRemindersSent = `
+WITH marked AS (
+	UPDATE event_reminder r SET sent = TRUE, sent_at = $3, delivery = d.delivery
+	FROM unnest($1::uuid[], $2::text[]) AS d(id, delivery)
+	WHERE r.id = d.id
+	RETURNING r.event_id
+)
+UPDATE event e SET sent = NOT EXISTS (
+	SELECT 1 FROM event_reminder r
+	WHERE r.event_id = e.id AND r.sent = FALSE AND r.id <> ALL($1::uuid[])
+)
+WHERE e.id IN (SELECT event_id FROM marked)`
 
-	cutoffDate := time.Now().AddDate(-1, 0, 0)
+func (s *Storage) MarkEventsAsNotified(ctx context.Context, notifications []model.Notification) error {
+	const op = "repository.sql.MarkSent"
 
-	builderDelete := sq.Delete("event").
-		PlaceholderFormat(sq.Dollar).
-		Where("start_time < ?", cutoffDate)
+	if len(notifications) == 0 {
+		return nil
+	}
 
-	query, args, err := builderDelete.ToSql()
-	if err != nil {
-		return fmt.Errorf("%s: failed to build SQL query: %w", op, err)
+	ids := make([]string, 0, len(notifications))
+	deliveries := make([]string, 0, len(notifications))
+	for _, notification := range notifications {
+		ids = append(ids, notification.ReminderID.String())
+		deliveries = append(deliveries, string(notification.Delivery))
 	}
 
-	_, err = s.pool.Exec(ctx, query, args...)
+	// Один батч-запрос вместо отдельного UPDATE на каждое уведомление
+	_, err := s.pool.Exec(ctx, markRemindersSent, ids, deliveries, s.clock.Now())
 	if err != nil {
-		return fmt.Errorf("%s: failed to execute query: %w", op, err)
+		return fmt.Errorf("%s: %w", op, err)
 	}
-
 	return nil
 }
@@ -0,0 +1,46 @@
+package internalgrpc
+
+import (
+	"context"
+	"crypto/tls"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// identityInterceptor определяет вызывающего по проверенному клиентскому сертификату и отклоняет
+// запросы, в которых x-user-id с ним не совпадает. Запросам HTTP gateway с секретным gatewayToken
+// пользователя уже подставил gateway, см. identityMiddleware.
+func identityInterceptor(gatewayToken string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if fromGateway(ctx, gatewayToken) {
+			return handler(ctx, req)
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		userID, err := auth.ResolveIdentity(peerTLSState(ctx), md.Get(auth.MetadataKey))
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if userID != "" {
+			ctx = auth.WithUserID(ctx, userID)
+		}
+		return handler(ctx, req)
+	}
+}
+
+func peerTLSState(ctx context.Context) *tls.ConnectionState {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
+	}
+	return &info.State
+}
@@ -0,0 +1,55 @@
+package internalgrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/auth"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestIdentityInterceptor(t *testing.T) {
+	interceptor := identityInterceptor("secret")
+	handler := func(ctx context.Context, _ any) (any, error) {
+		userID, _ := auth.UserIDFromContext(ctx)
+		return userID, nil
+	}
+
+	call := func(commonName string, md metadata.MD) (any, codes.Code) {
+		ctx := context.Background()
+		if commonName != "" {
+			ctx = peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+				VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: commonName}}}},
+			}}})
+		}
+		ctx = metadata.NewIncomingContext(ctx, md)
+		userID, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+		return userID, status.Code(err)
+	}
+
+	userID, code := call("user1", metadata.MD{})
+	require.Equal(t, codes.OK, code)
+	require.Equal(t, "user1", userID)
+
+	_, code = call("user1", metadata.Pairs("x-user-id", "user2"))
+	require.Equal(t, codes.Unauthenticated, code)
+
+	// Без сертификата используется x-user-id, выставленный доверенным прокси
+	userID, code = call("", metadata.Pairs("x-user-id", "user2"))
+	require.Equal(t, codes.OK, code)
+	require.Equal(t, "user2", userID)
+
+	// Пользователя запроса gateway уже проверил HTTP-сервер
+	userID, code = call("gateway", metadata.Pairs("x-user-id", "user2", gatewayTokenMetadata, "secret"))
+	require.Equal(t, codes.OK, code)
+	require.Equal(t, "user2", userID)
+}
@@ -0,0 +1,82 @@
+package internalgrpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/auth"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/ratelimit"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// gatewayTokenMetadata - метаданные, которыми HTTP gateway помечает свои запросы к gRPC-серверу.
+const gatewayTokenMetadata = "x-gateway-token"
+
+// rateLimitInterceptor ограничивает частоту запросов по пользователю и по IP клиента.
+// Пользователя уже определил identityInterceptor. Запросы HTTP gateway с секретным gatewayToken
+// не ограничиваются: gateway уже ограничил клиентов по их настоящим адресам.
+func rateLimitInterceptor(byUser, byIP *ratelimit.Limiter, gatewayToken string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if fromGateway(ctx, gatewayToken) {
+			return handler(ctx, req)
+		}
+		if userID, ok := auth.UserIDFromContext(ctx); ok {
+			if allowed, wait := byUser.Allow(userID); !allowed {
+				return nil, resourceExhausted(ctx, wait, "too many requests for user")
+			}
+		}
+		if ip := peerIP(ctx); ip != "" {
+			if allowed, wait := byIP.Allow(ip); !allowed {
+				return nil, resourceExhausted(ctx, wait, "too many requests from address")
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+func fromGateway(ctx context.Context, gatewayToken string) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || gatewayToken == "" {
+		return false
+	}
+	for _, v := range md.Get(gatewayTokenMetadata) {
+		if subtle.ConstantTimeCompare([]byte(v), []byte(gatewayToken)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// resourceExhausted возвращает ResourceExhausted с заголовком retry-after
+// и подсказкой errdetails.RetryInfo.
+func resourceExhausted(ctx context.Context, wait time.Duration, msg string) error {
+	retryAfter := strconv.Itoa(ratelimit.RetryAfterSeconds(wait))
+	_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", retryAfter))
+
+	st := status.New(codes.ResourceExhausted, msg)
+	if withDetails, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(wait)}); err == nil {
+		return withDetails.Err()
+	}
+	return st.Err()
+}
@@ -0,0 +1,53 @@
+package internalgrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/auth"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/ratelimit"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestRateLimitInterceptor(t *testing.T) {
+	interceptor := rateLimitInterceptor(nil, ratelimit.NewLimiter(1, 1), "secret")
+	handler := func(context.Context, any) (any, error) { return "ok", nil }
+
+	call := func(md metadata.MD) codes.Code {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{
+			Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 50000},
+		})
+		ctx = metadata.NewIncomingContext(ctx, md)
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+		return status.Code(err)
+	}
+
+	// Loopback-адрес больше не освобождает от ограничения, x-user-id его не обходит
+	require.Equal(t, codes.OK, call(metadata.Pairs("x-user-id", "user1")))
+	require.Equal(t, codes.ResourceExhausted, call(metadata.Pairs("x-user-id", "user2")))
+	require.Equal(t, codes.ResourceExhausted, call(metadata.Pairs(gatewayTokenMetadata, "guess")))
+
+	// Запросы gateway уже ограничены по адресам настоящих клиентов
+	require.Equal(t, codes.OK, call(metadata.Pairs(gatewayTokenMetadata, "secret")))
+}
+
+func TestRateLimitInterceptorByUser(t *testing.T) {
+	interceptor := rateLimitInterceptor(ratelimit.NewLimiter(1, 1), nil, "secret")
+	handler := func(context.Context, any) (any, error) { return "ok", nil }
+
+	// Пользователь берётся из контекста, куда его положил identityInterceptor
+	call := func(userID string) codes.Code {
+		_, err := interceptor(auth.WithUserID(context.Background(), userID), nil, &grpc.UnaryServerInfo{}, handler)
+		return status.Code(err)
+	}
+
+	require.Equal(t, codes.OK, call("user1"))
+	require.Equal(t, codes.ResourceExhausted, call("user1"))
+	require.Equal(t, codes.OK, call("user2"))
+}
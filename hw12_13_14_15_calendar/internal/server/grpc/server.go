@@ -1,13 +1,24 @@
 package internalgrpc
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
 	"log"
 	"log/slog"
 	"net"
+	"net/http"
 
+	"github.com/milov52/hw12_13_14_15_calendar/internal/api/apierror"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/api/event"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/config"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/ratelimit"
 	desc "github.com/milov52/hw12_13_14_15_calendar/pkg/api/event/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
 )
 
@@ -15,20 +26,43 @@ type Server struct {
 	grpcServer *grpc.Server
 	logger     slog.Logger
 	controller *event.Controller
+	// gatewayToken - секрет, которым HTTP gateway подписывает свои запросы, см. GatewayDialOption.
+	gatewayToken string
 }
 
-func NewServer(logger slog.Logger, controller event.Controller) *Server {
-	return &Server{
-		logger:     logger,
-		grpcServer: grpc.NewServer(),
-		controller: &controller,
+// NewServer создает gRPC-сервер. При tlsConfig == nil сервер работает без шифрования.
+func NewServer(logger slog.Logger, controller event.Controller, cfg config.RateLimit, tlsConfig *tls.Config) *Server {
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
 	}
-}
+	gatewayToken := newGatewayToken()
 
-func (s *Server) Start(lis net.Listener) error {
+	s := &Server{
+		logger: logger,
+		grpcServer: grpc.NewServer(
+			grpc.Creds(creds),
+			grpc.ChainUnaryInterceptor(
+				apierror.UnaryServerInterceptor(logger),
+				identityInterceptor(gatewayToken),
+				rateLimitInterceptor(ratelimit.New(cfg.PerUser), ratelimit.New(cfg.PerIP), gatewayToken),
+			),
+		),
+		controller:   &controller,
+		gatewayToken: gatewayToken,
+	}
 	reflection.Register(s.grpcServer)
 	desc.RegisterCalendarServer(s.grpcServer, s.controller)
+	return s
+}
+
+// ServeHTTP обслуживает gRPC-запрос, пришедший на HTTP/2-сервер.
+// Используется, когда gRPC и HTTP работают на одном порту.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.grpcServer.ServeHTTP(w, r)
+}
 
+func (s *Server) Start(lis net.Listener) error {
 	go func() {
 		if err := s.grpcServer.Serve(lis); err != nil { // запускаем grpc сервер
 			log.Fatalf("failed to serve: %v", err)
@@ -36,3 +70,23 @@ func (s *Server) Start(lis net.Listener) error {
 	}()
 	return nil
 }
+
+// GatewayDialOption помечает запросы HTTP gateway, подключённого к серверу как клиент:
+// их частоту уже ограничил gateway, и сервер не ограничивает их повторно.
+func (s *Server) GatewayDialOption() grpc.DialOption {
+	return grpc.WithChainUnaryInterceptor(func(
+		ctx context.Context, method string, req, reply any,
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption,
+	) error {
+		ctx = metadata.AppendToOutgoingContext(ctx, gatewayTokenMetadata, s.gatewayToken)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	})
+}
+
+func newGatewayToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
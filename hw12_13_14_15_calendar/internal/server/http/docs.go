@@ -0,0 +1,43 @@
+package internalhttp
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	swaggerfiles "github.com/swaggo/files/v2"
+)
+
+// swaggerUI - страница Swagger UI, которая загружает описание API с /openapi.json.
+// Скрипты и стили интерфейса встроены в бинарник из swagger-ui-dist и отдаются с /docs/,
+// поэтому документация не зависит от внешних CDN.
+//
+//go:embed swagger/index.html
+var swaggerUI []byte
+
+// RegisterDocs добавляет в mux описание API /openapi.json, страницу Swagger UI /docs
+// и её статические файлы /docs/{file}.
+func RegisterDocs(mux *runtime.ServeMux, spec []byte) error {
+	err := mux.HandlePath(http.MethodGet, "/openapi.json",
+		func(w http.ResponseWriter, _ *http.Request, _ map[string]string) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(spec)
+		})
+	if err != nil {
+		return err
+	}
+
+	err = mux.HandlePath(http.MethodGet, "/docs",
+		func(w http.ResponseWriter, _ *http.Request, _ map[string]string) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write(swaggerUI)
+		})
+	if err != nil {
+		return err
+	}
+
+	return mux.HandlePath(http.MethodGet, "/docs/{file}",
+		func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+			http.ServeFileFS(w, r, swaggerfiles.FS, params["file"])
+		})
+}
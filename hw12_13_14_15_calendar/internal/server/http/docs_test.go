@@ -0,0 +1,43 @@
+package internalhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterDocs(t *testing.T) {
+	mux := runtime.NewServeMux()
+	require.NoError(t, RegisterDocs(mux, []byte(`{"swagger":"2.0"}`)))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get("/openapi.json")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	require.JSONEq(t, `{"swagger":"2.0"}`, w.Body.String())
+
+	w = get("/docs")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	require.Contains(t, w.Body.String(), `url: "/openapi.json"`)
+	require.NotContains(t, w.Body.String(), "https://")
+
+	// Интерфейс встроен в бинарник и не загружается с CDN
+	w = get("/docs/swagger-ui-bundle.js")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Header().Get("Content-Type"), "javascript")
+
+	w = get("/docs/swagger-ui.css")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Header().Get("Content-Type"), "text/css")
+
+	require.Equal(t, http.StatusNotFound, get("/docs/missing.js").Code)
+}
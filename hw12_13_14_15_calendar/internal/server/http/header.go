@@ -0,0 +1,24 @@
+package internalhttp
+
+import (
+	"net/textproto"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/api/event"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/auth"
+)
+
+// forwardedHeaders - заголовки, которые передаются в метаданные gRPC как есть.
+var forwardedHeaders = map[string]string{
+	textproto.CanonicalMIMEHeaderKey(auth.MetadataKey):             auth.MetadataKey,
+	textproto.CanonicalMIMEHeaderKey(event.IdempotencyKeyMetadata): event.IdempotencyKeyMetadata,
+}
+
+// HeaderMatcher пробрасывает заголовки X-User-Id и Idempotency-Key в метаданные gRPC
+// как есть, остальные заголовки обрабатываются по умолчанию.
+func HeaderMatcher(key string) (string, bool) {
+	if md, ok := forwardedHeaders[textproto.CanonicalMIMEHeaderKey(key)]; ok {
+		return md, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
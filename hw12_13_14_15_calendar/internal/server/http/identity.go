@@ -0,0 +1,31 @@
+package internalhttp
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/api/apierror"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/auth"
+	"google.golang.org/genproto/googleapis/rpc/code"
+)
+
+// identityMiddleware подставляет в X-User-Id пользователя из проверенного клиентского сертификата
+// и отвечает 401, если клиент передал другой X-User-Id. Без сертификата заголовок остаётся как есть.
+func identityMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.ResolveIdentity(r.TLS, r.Header.Values(auth.MetadataKey))
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(apierror.ErrorBody{
+				Code:    code.Code_UNAUTHENTICATED.String(),
+				Message: err.Error(),
+			})
+			return
+		}
+		if userID != "" {
+			r.Header.Set(auth.MetadataKey, userID)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,47 @@
+package internalhttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentityMiddleware(t *testing.T) {
+	var forwarded string
+	handler := identityMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get("X-User-Id")
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(commonName, userID string) int {
+		forwarded = ""
+		r := httptest.NewRequest(http.MethodPost, "/v1/event", nil)
+		if commonName != "" {
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+				{Subject: pkix.Name{CommonName: commonName}},
+			}}}
+		}
+		if userID != "" {
+			r.Header.Set("X-User-Id", userID)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// С сертификатом пользователем становится его CN
+	require.Equal(t, http.StatusOK, request("user1", ""))
+	require.Equal(t, "user1", forwarded)
+	require.Equal(t, http.StatusOK, request("user1", "user1"))
+	require.Equal(t, http.StatusUnauthorized, request("user1", "user2"))
+	require.Empty(t, forwarded)
+
+	// Без сертификата заголовок доходит как есть: его должен выставлять доверенный прокси
+	require.Equal(t, http.StatusOK, request("", "user2"))
+	require.Equal(t, "user2", forwarded)
+}
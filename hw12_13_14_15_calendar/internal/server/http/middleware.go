@@ -4,17 +4,19 @@ import (
 	"log/slog"
 	"net/http"
 	"time"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/clock"
 )
 
-func loggingMiddleware(next http.Handler) http.Handler {
+func loggingMiddleware(c clock.Clock, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		startTime := time.Now()
+		startTime := c.Now()
 		// Сохраним оригинальный ResponseWriter для получения статуса ответа
 		ww := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 
 		next.ServeHTTP(ww, r)
 
-		latency := time.Since(startTime)
+		latency := clock.Since(c, startTime)
 		clientIP := r.RemoteAddr
 		method := r.Method
 		path := r.URL.Path
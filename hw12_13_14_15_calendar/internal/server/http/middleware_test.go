@@ -0,0 +1,32 @@
+package internalhttp
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggingMiddlewareLatency(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	fakeClock := clock.NewFake(time.Date(2024, time.September, 2, 12, 0, 0, 0, time.UTC))
+	handler := loggingMiddleware(fakeClock, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fakeClock.Advance(150 * time.Millisecond)
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/event", nil))
+
+	require.Contains(t, buf.String(), "status=201")
+	require.Contains(t, buf.String(), "latency=150ms")
+	require.Contains(t, buf.String(), `time="Mon, 02 Sep 2024 12:00:00 UTC"`)
+}
@@ -0,0 +1,45 @@
+package internalhttp
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/api/apierror"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/auth"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/ratelimit"
+	"google.golang.org/genproto/googleapis/rpc/code"
+)
+
+// rateLimitMiddleware ограничивает частоту запросов по пользователю и по IP клиента, отвечая 429
+// с заголовком Retry-After. Пользователя уже определил identityMiddleware; ограничение по IP
+// действует всегда, поэтому сменой X-User-Id его не обойти.
+func rateLimitMiddleware(byUser, byIP *ratelimit.Limiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if userID := strings.TrimSpace(r.Header.Get(auth.MetadataKey)); userID != "" {
+			if allowed, wait := byUser.Allow(userID); !allowed {
+				tooManyRequests(w, ratelimit.RetryAfterSeconds(wait), "too many requests for user")
+				return
+			}
+		}
+		if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			if allowed, wait := byIP.Allow(ip); !allowed {
+				tooManyRequests(w, ratelimit.RetryAfterSeconds(wait), "too many requests from address")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func tooManyRequests(w http.ResponseWriter, retryAfter int, msg string) {
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	_ = json.NewEncoder(w).Encode(apierror.ErrorBody{
+		Code:    code.Code_RESOURCE_EXHAUSTED.String(),
+		Message: msg,
+	})
+}
@@ -0,0 +1,59 @@
+package internalhttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/ratelimit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	handler := identityMiddleware(rateLimitMiddleware(ratelimit.NewLimiter(1, 1), nil,
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})))
+
+	// Пользователь определяется по проверенному клиентскому сертификату
+	request := func(commonName string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/v1/event", nil)
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+			{Subject: pkix.Name{CommonName: commonName}},
+		}}}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusOK, request("user1").Code)
+
+	w := request("user1")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "1", w.Header().Get("Retry-After"))
+	require.Contains(t, w.Body.String(), "RESOURCE_EXHAUSTED")
+
+	require.Equal(t, http.StatusOK, request("user2").Code)
+}
+
+func TestRateLimitMiddlewareIgnoresUserHeader(t *testing.T) {
+	handler := rateLimitMiddleware(ratelimit.NewLimiter(100, 100), ratelimit.NewLimiter(1, 1),
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+	// Смена X-User-Id не даёт клиенту без сертификата обойти ограничение по IP
+	request := func(userID string) int {
+		r := httptest.NewRequest(http.MethodPost, "/v1/event", nil)
+		r.Header.Set("X-User-Id", userID)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, request("user1"))
+	require.Equal(t, http.StatusTooManyRequests, request("user2"))
+}
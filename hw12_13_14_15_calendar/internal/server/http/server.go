@@ -2,36 +2,76 @@ package internalhttp
 
 import (
 	"context"
+	"crypto/tls"
 	"log/slog"
 	"net"
 	"net/http"
+	"strings"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/clock"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/config"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/ratelimit"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 type Server struct {
 	httpServer *http.Server
 	logger     slog.Logger
+	// Отдельные от gRPC-сервера ограничители: запрос через gateway
+	// проверяется здесь, а не повторно на loopback-соединении
+	limitByUser *ratelimit.Limiter
+	limitByIP   *ratelimit.Limiter
+	// grpcHandler обслуживает gRPC-запросы на том же порту, nil - только HTTP
+	grpcHandler http.Handler
+	clock       clock.Clock
 }
 
-func NewServer(logger slog.Logger, cfg config.Config) *Server {
+// NewServer создает HTTP-сервер. При tlsConfig == nil сервер работает без шифрования.
+func NewServer(logger slog.Logger, cfg config.Config, tlsConfig *tls.Config) *Server {
 	return &Server{
 		logger: logger,
 		httpServer: &http.Server{
 			Addr:         net.JoinHostPort(cfg.HTTPServer.Host, cfg.HTTPServer.Port),
+			TLSConfig:    tlsConfig,
 			ReadTimeout:  cfg.HTTPServer.Timeout,
 			WriteTimeout: cfg.HTTPServer.Timeout,
 			IdleTimeout:  cfg.HTTPServer.IdleTimeout,
 		},
+		limitByUser: ratelimit.New(cfg.RateLimit.PerUser),
+		limitByIP:   ratelimit.New(cfg.RateLimit.PerIP),
+		clock:       clock.Real,
 	}
 }
 
+// ServeGRPC включает обслуживание gRPC на порту HTTP-сервера. Вызывается до Start.
+func (s *Server) ServeGRPC(grpcHandler http.Handler) {
+	s.grpcHandler = grpcHandler
+}
+
 func (s *Server) Start(mux *runtime.ServeMux) error {
-	s.httpServer.Handler = loggingMiddleware(mux)
+	var handler http.Handler = loggingMiddleware(s.clock,
+		identityMiddleware(rateLimitMiddleware(s.limitByUser, s.limitByIP, mux)))
+	if s.grpcHandler != nil {
+		// gRPC-запросы идут мимо middleware: у gRPC-сервера свои интерцепторы
+		handler = splitGRPC(s.grpcHandler, handler)
+		if s.httpServer.TLSConfig == nil {
+			// Без TLS HTTP/2 возможен только как h2c
+			handler = h2c.NewHandler(handler, &http2.Server{})
+		}
+	}
+	s.httpServer.Handler = handler
 	s.logger.Info("starting http server with address", "address", s.httpServer.Addr)
 
-	if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	var err error
+	if s.httpServer.TLSConfig != nil {
+		// Сертификат берется из TLSConfig, файлы не передаются
+		err = s.httpServer.ListenAndServeTLS("", "")
+	} else {
+		err = s.httpServer.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
 		s.logger.Error("could not listen on", "address", s.httpServer.Addr, ":", err)
 		return err
 	}
@@ -43,8 +83,20 @@ func (s *Server) Stop(ctx context.Context) error {
 	s.logger.Info("shutting down http server")
 
 	if err := s.httpServer.Shutdown(ctx); err != nil {
-		s.logger.Error("failed to shutdown http server:", err)
+		s.logger.Error("failed to shutdown http server", "err", err)
 	}
 	s.logger.Info("shutting down http server gracefully")
 	return nil
 }
+
+// splitGRPC направляет запросы HTTP/2 с content-type application/grpc в grpcHandler,
+// остальные - в httpHandler.
+func splitGRPC(grpcHandler, httpHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcHandler.ServeHTTP(w, r)
+			return
+		}
+		httpHandler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,35 @@
+package internalhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitGRPC(t *testing.T) {
+	handler := splitGRPC(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("X-Handler", "grpc")
+		}),
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("X-Handler", "http")
+		}),
+	)
+
+	serve := func(protoMajor int, contentType string) string {
+		r := httptest.NewRequest(http.MethodPost, "/event.v1.Calendar/CreateEvent", nil)
+		r.ProtoMajor = protoMajor
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Header().Get("X-Handler")
+	}
+
+	require.Equal(t, "grpc", serve(2, "application/grpc"))
+	require.Equal(t, "grpc", serve(2, "application/grpc+proto"))
+	require.Equal(t, "http", serve(2, "application/json"))
+	// gRPC возможен только поверх HTTP/2
+	require.Equal(t, "http", serve(1, "application/grpc"))
+}
@@ -0,0 +1,47 @@
+package calendar
+
+import (
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"golang.org/x/net/context"
+)
+
+// WithAdmins задаёт пользователей с доступом к служебным методам.
+func WithAdmins(userIDs []string) Option {
+	return func(s *Service) {
+		s.admins = make(map[string]bool, len(userIDs))
+		for _, id := range userIDs {
+			s.admins[id] = true
+		}
+	}
+}
+
+func (s *Service) authorizeAdmin(ctx context.Context) error {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return err
+	}
+	if !s.admins[caller] {
+		return model.ErrPermissionDenied
+	}
+	return nil
+}
+
+// ListJobRuns возвращает историю запусков задач планировщика, начиная с последнего.
+func (s *Service) ListJobRuns(ctx context.Context, filter model.JobRunFilter) ([]model.JobRun, error) {
+	if err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+	switch {
+	case filter.Limit <= 0:
+		filter.Limit = model.DefaultJobRunLimit
+	case filter.Limit > model.MaxJobRunLimit:
+		filter.Limit = model.MaxJobRunLimit
+	}
+
+	runs, err := s.repository.ListJobRuns(ctx, filter)
+	if err != nil {
+		s.logger.Error("failed list job runs", "err", err)
+		return nil, err
+	}
+	return runs, nil
+}
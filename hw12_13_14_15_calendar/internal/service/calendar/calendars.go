@@ -0,0 +1,298 @@
+package calendar
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/auth"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"golang.org/x/net/context"
+)
+
+func (s *Service) CreateCalendar(ctx context.Context, calendar model.Calendar) (uuid.UUID, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	calendar.OwnerID = caller
+
+	id, err := s.repository.CreateCalendar(ctx, calendar)
+	if err != nil {
+		s.logger.Error("failed create calendar", "err", err)
+		return uuid.Nil, err
+	}
+	s.logger.Info("created calendar", "id", id, "owner_id", calendar.OwnerID)
+	return id, nil
+}
+
+func (s *Service) UpdateCalendar(ctx context.Context, id uuid.UUID, calendar model.Calendar) error {
+	if _, err := s.ownedCalendar(ctx, id); err != nil {
+		return err
+	}
+
+	if err := s.repository.UpdateCalendar(ctx, id, calendar); err != nil {
+		s.logger.Error("failed update calendar", "err", err)
+		return err
+	}
+	s.logger.Info("updated calendar", "id", id)
+	return nil
+}
+
+func (s *Service) DeleteCalendar(ctx context.Context, id uuid.UUID) error {
+	if _, err := s.ownedCalendar(ctx, id); err != nil {
+		return err
+	}
+
+	if err := s.repository.DeleteCalendar(ctx, id); err != nil {
+		s.logger.Error("failed delete calendar", "err", err)
+		return err
+	}
+	s.logger.Info("deleted calendar", "id", id)
+	return nil
+}
+
+func (s *Service) GetCalendar(ctx context.Context, id uuid.UUID) (model.Calendar, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return model.Calendar{}, err
+	}
+	calendar, err := s.repository.GetCalendar(ctx, id)
+	if err != nil {
+		return model.Calendar{}, err
+	}
+	if calendar.PermissionFor(caller) == model.PermissionNone {
+		return model.Calendar{}, model.ErrPermissionDenied
+	}
+	if caller != calendar.OwnerID {
+		// Список доступов видит только владелец
+		calendar.Shares = nil
+	}
+	return calendar, nil
+}
+
+// ListCalendars возвращает календари пользователя и календари, к которым ему открыт доступ.
+func (s *Service) ListCalendars(ctx context.Context, userID string) ([]model.Calendar, error) {
+	userID, err := s.callerFor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	calendars, err := s.repository.ListCalendars(ctx, userID)
+	if err != nil {
+		s.logger.Error("failed list calendars", "err", err)
+		return nil, err
+	}
+	for i := range calendars {
+		if calendars[i].OwnerID != userID {
+			calendars[i].Shares = nil
+		}
+	}
+	return calendars, nil
+}
+
+func (s *Service) ShareCalendar(ctx context.Context, id uuid.UUID, share model.CalendarShare) error {
+	if !share.Permission.Valid() || share.UserID == "" {
+		return model.ErrInvalidPermission
+	}
+	calendar, err := s.ownedCalendar(ctx, id)
+	if err != nil {
+		return err
+	}
+	if share.UserID == calendar.OwnerID {
+		return model.ErrInvalidPermission
+	}
+
+	if err := s.repository.ShareCalendar(ctx, id, share); err != nil {
+		s.logger.Error("failed share calendar", "err", err)
+		return err
+	}
+	s.logger.Info("shared calendar", "id", id, "user_id", share.UserID, "permission", share.Permission)
+	return nil
+}
+
+func (s *Service) RevokeCalendarShare(ctx context.Context, id uuid.UUID, userID string) error {
+	if _, err := s.ownedCalendar(ctx, id); err != nil {
+		return err
+	}
+
+	if err := s.repository.RevokeCalendarShare(ctx, id, userID); err != nil {
+		s.logger.Error("failed revoke calendar share", "err", err)
+		return err
+	}
+	s.logger.Info("revoked calendar share", "id", id, "user_id", userID)
+	return nil
+}
+
+// ownedCalendar возвращает календарь, если вызывающий - его владелец.
+func (s *Service) ownedCalendar(ctx context.Context, id uuid.UUID) (model.Calendar, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return model.Calendar{}, err
+	}
+	calendar, err := s.repository.GetCalendar(ctx, id)
+	if err != nil {
+		return model.Calendar{}, err
+	}
+	if caller != calendar.OwnerID {
+		return model.Calendar{}, model.ErrPermissionDenied
+	}
+	return calendar, nil
+}
+
+// caller возвращает вызывающего пользователя. Анонимные запросы допускаются
+// только к открытым методам вроде GetFreeBusy, остальные отклоняются с ErrUnauthenticated.
+func (s *Service) caller(ctx context.Context) (string, error) {
+	caller, ok := auth.UserIDFromContext(ctx)
+	if !ok {
+		return "", model.ErrUnauthenticated
+	}
+	return caller, nil
+}
+
+// callerFor сверяет запрошенного пользователя с вызывающим: смотреть чужие
+// данные от имени другого пользователя нельзя. Пустой userID заменяется вызывающим.
+func (s *Service) callerFor(ctx context.Context, userID string) (string, error) {
+	caller, err := s.caller(ctx)
+	switch {
+	case err != nil:
+		return "", err
+	case userID != "" && userID != caller:
+		return "", model.ErrPermissionDenied
+	}
+	return caller, nil
+}
+
+// authorizeCalendar проверяет, что у пользователя есть доступ required к календарю.
+// События вне календарей доступны только их владельцу.
+func (s *Service) authorizeCalendar(
+	ctx context.Context, calendarID uuid.UUID, userID string, required model.Permission,
+) error {
+	if calendarID == uuid.Nil {
+		return nil
+	}
+	calendar, err := s.repository.GetCalendar(ctx, calendarID)
+	if err != nil {
+		return err
+	}
+	if !calendar.PermissionFor(userID).Allows(required) {
+		return model.ErrPermissionDenied
+	}
+	return nil
+}
+
+// authorizeEventWrite проверяет право вызывающего изменять существующее событие.
+func (s *Service) authorizeEventWrite(ctx context.Context, id uuid.UUID) (model.Event, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return model.Event{}, err
+	}
+	event, err := s.repository.GetEvent(ctx, id)
+	if err != nil {
+		return model.Event{}, err
+	}
+
+	if event.CalendarID == uuid.Nil {
+		if caller != event.UserID {
+			return model.Event{}, model.ErrPermissionDenied
+		}
+		return event, nil
+	}
+	return event, s.authorizeCalendar(ctx, event.CalendarID, caller, model.PermissionWrite)
+}
+
+// authorizeEventUpdate проверяет право вызывающего изменить событие и дополняет
+// изменение: владелец события не меняется, не указанный календарь остаётся прежним,
+// а для переноса в другой календарь нужно право записи в него.
+func (s *Service) authorizeEventUpdate(ctx context.Context, update *model.EventUpdate) error {
+	old, err := s.authorizeEventWrite(ctx, update.ID)
+	if err != nil {
+		return err
+	}
+	event := &update.Event
+	event.UserID = old.UserID
+	switch {
+	case update.ClearCalendar:
+		event.CalendarID = uuid.Nil
+	case event.CalendarID == uuid.Nil:
+		event.CalendarID = old.CalendarID
+	case event.CalendarID != old.CalendarID:
+		caller, _ := s.caller(ctx)
+		return s.authorizeCalendar(ctx, event.CalendarID, caller, model.PermissionWrite)
+	}
+	return nil
+}
+
+// authorizeEventCreate проверяет право записи в календарь нового события
+// и проставляет владельца события. Приглашённые ещё не ответили: статус
+// участника меняет только он сам через RespondToInvitation.
+func (s *Service) authorizeEventCreate(ctx context.Context, event *model.Event) error {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return err
+	}
+	event.UserID = caller
+	for i := range event.Attendees {
+		event.Attendees[i].Status = model.AttendeeNeedsAction
+	}
+	return s.authorizeCalendar(ctx, event.CalendarID, event.UserID, model.PermissionWrite)
+}
+
+// listEvents выбирает события с учётом фильтра и прав вызывающего.
+// События, к которым у пользователя есть только доступ free-busy, обезличиваются.
+func (s *Service) listEvents(
+	ctx context.Context, date time.Time, offset int, filter model.EventFilter,
+) ([]model.Event, error) {
+	userID, err := s.callerFor(ctx, filter.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.CalendarID != uuid.Nil {
+		calendar, err := s.repository.GetCalendar(ctx, filter.CalendarID)
+		if err != nil {
+			return nil, err
+		}
+		permission := calendar.PermissionFor(userID)
+		if permission == model.PermissionNone {
+			return nil, model.ErrPermissionDenied
+		}
+
+		events, err := s.repository.GetCalendarEvents(ctx, filter.CalendarID, date, offset)
+		if err != nil {
+			return nil, err
+		}
+		if !permission.Allows(model.PermissionRead) {
+			for i := range events {
+				events[i] = events[i].Redacted()
+			}
+		}
+		return events, nil
+	}
+
+	events, err := s.repository.GetUserEvents(ctx, userID, date, offset)
+	if err != nil {
+		return nil, err
+	}
+	return s.redactForUser(ctx, userID, events)
+}
+
+func (s *Service) redactForUser(ctx context.Context, userID string, events []model.Event) ([]model.Event, error) {
+	calendars, err := s.repository.ListCalendars(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	permissions := make(map[uuid.UUID]model.Permission, len(calendars))
+	for _, calendar := range calendars {
+		permissions[calendar.ID] = calendar.PermissionFor(userID)
+	}
+
+	for i, event := range events {
+		if event.CalendarID == uuid.Nil || event.HasParticipant(userID) {
+			continue
+		}
+		if !permissions[event.CalendarID].Allows(model.PermissionRead) {
+			events[i] = event.Redacted()
+		}
+	}
+	return events, nil
+}
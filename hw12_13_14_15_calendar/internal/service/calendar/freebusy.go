@@ -0,0 +1,233 @@
+package calendar
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultWorkDayStart = 9 * time.Hour
+	defaultWorkDayEnd   = 18 * time.Hour
+	defaultSlotsLimit   = 10
+)
+
+// GetFreeBusy возвращает занятость пользователей без названий и участников событий.
+// Свою занятость вызывающий видит целиком, чужую - только по календарям, которыми
+// с ним поделились хотя бы на уровне free-busy.
+func (s *Service) GetFreeBusy(
+	ctx context.Context, userIDs []string, from, to time.Time,
+) (map[string][]model.Interval, error) {
+	if !from.Before(to) {
+		return nil, model.ErrInvalidTimeRange
+	}
+	verr := &model.ValidationError{}
+	model.ValidateFreeBusyUsers(verr, userIDs)
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+
+	busy, err := s.busyIntervals(ctx, userIDs, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]model.Interval, len(userIDs))
+	for _, userID := range userIDs {
+		result[userID] = clipIntervals(mergeIntervals(busy[userID]), from, to)
+	}
+	return result, nil
+}
+
+func (s *Service) FindFreeSlots(ctx context.Context, query model.SlotQuery) ([]model.Interval, error) {
+	if !query.From.Before(query.To) {
+		return nil, model.ErrInvalidTimeRange
+	}
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	busy, err := s.busyIntervals(ctx, query.UserIDs, query.From, query.To)
+	if err != nil {
+		return nil, err
+	}
+
+	var all []model.Interval
+	for _, intervals := range busy {
+		all = append(all, intervals...)
+	}
+
+	slots := findFreeSlots(mergeIntervals(all), query)
+	s.logger.Info("found free slots", "users", len(query.UserIDs), "slots", len(slots))
+	return slots, nil
+}
+
+// busyIntervals собирает занятость пользователей, видимую вызывающему. Если ни один
+// календарь пользователя не открыт вызывающему, запрос отклоняется: пустой ответ
+// выглядел бы как свободное время.
+func (s *Service) busyIntervals(
+	ctx context.Context, userIDs []string, from, to time.Time,
+) (map[string][]model.Interval, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var own bool
+	shared := make(map[string][]uuid.UUID)
+	for _, userID := range userIDs {
+		if userID == caller {
+			own = true
+		} else {
+			shared[userID] = nil
+		}
+	}
+	if len(shared) > 0 {
+		calendars, err := s.repository.ListCalendars(ctx, caller)
+		if err != nil {
+			s.logger.Error("failed list calendars", "err", err)
+			return nil, err
+		}
+		for _, calendar := range calendars {
+			ids, requested := shared[calendar.OwnerID]
+			if requested && calendar.PermissionFor(caller).Allows(model.PermissionFreeBusy) {
+				shared[calendar.OwnerID] = append(ids, calendar.ID)
+			}
+		}
+	}
+
+	busy := make(map[string][]model.Interval, len(userIDs))
+	for userID, calendarIDs := range shared {
+		if len(calendarIDs) == 0 {
+			return nil, model.ErrPermissionDenied
+		}
+		intervals, err := s.repository.GetCalendarBusyIntervals(ctx, calendarIDs, from, to)
+		if err != nil {
+			s.logger.Error("failed get busy intervals", "err", err)
+			return nil, err
+		}
+		busy[userID] = intervals
+	}
+	if own {
+		intervals, err := s.repository.GetBusyIntervals(ctx, []string{caller}, from, to)
+		if err != nil {
+			s.logger.Error("failed get busy intervals", "err", err)
+			return nil, err
+		}
+		busy[caller] = intervals[caller]
+	}
+	return busy, nil
+}
+
+// mergeIntervals сортирует интервалы и склеивает пересекающиеся и смежные.
+func mergeIntervals(intervals []model.Interval) []model.Interval {
+	if len(intervals) == 0 {
+		return nil
+	}
+
+	sorted := append([]model.Interval(nil), intervals...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+
+	merged := []model.Interval{sorted[0]}
+	for _, interval := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if interval.Start.After(last.End) {
+			merged = append(merged, interval)
+			continue
+		}
+		if interval.End.After(last.End) {
+			last.End = interval.End
+		}
+	}
+	return merged
+}
+
+func clipIntervals(intervals []model.Interval, from, to time.Time) []model.Interval {
+	clipped := make([]model.Interval, 0, len(intervals))
+	for _, interval := range intervals {
+		if interval.Start.Before(from) {
+			interval.Start = from
+		}
+		if interval.End.After(to) {
+			interval.End = to
+		}
+		if interval.Start.Before(interval.End) {
+			clipped = append(clipped, interval)
+		}
+	}
+	return clipped
+}
+
+// findFreeSlots предлагает идущие подряд слоты длительностью query.Duration,
+// которые попадают в рабочее время и не пересекаются с занятыми интервалами busy.
+// busy должен быть отсортирован и не содержать пересечений.
+func findFreeSlots(busy []model.Interval, query model.SlotQuery) []model.Interval {
+	hours := query.WorkingHours
+	if hours.Start == 0 && hours.End == 0 {
+		hours.Start, hours.End = defaultWorkDayStart, defaultWorkDayEnd
+	}
+	if hours.Location == nil {
+		hours.Location = time.UTC
+	}
+	limit := query.Limit
+	switch {
+	case limit <= 0:
+		limit = defaultSlotsLimit
+	case limit > model.MaxSlotsLimit:
+		limit = model.MaxSlotsLimit
+	}
+
+	var slots []model.Interval
+	from := query.From.In(hours.Location)
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, hours.Location)
+	for ; day.Before(query.To) && len(slots) < limit; day = day.AddDate(0, 0, 1) {
+		window := clipIntervals([]model.Interval{{
+			Start: wallClock(day, hours.Start),
+			End:   wallClock(day, hours.End),
+		}}, query.From, query.To)
+		if len(window) == 0 {
+			continue
+		}
+
+		for _, gap := range subtractIntervals(window[0], busy) {
+			for start := gap.Start; !start.Add(query.Duration).After(gap.End); start = start.Add(query.Duration) {
+				slots = append(slots, model.Interval{Start: start, End: start.Add(query.Duration)})
+				if len(slots) == limit {
+					return slots
+				}
+			}
+		}
+	}
+	return slots
+}
+
+// wallClock возвращает момент, когда на часах в день day будет offset после полуночи.
+// В отличие от day.Add(offset) учитывает переход на летнее время.
+func wallClock(day time.Time, offset time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, int(offset), day.Location())
+}
+
+// subtractIntervals возвращает части window, не покрытые интервалами busy.
+func subtractIntervals(window model.Interval, busy []model.Interval) []model.Interval {
+	var free []model.Interval
+	cursor := window.Start
+	for _, interval := range busy {
+		if !interval.End.After(cursor) {
+			continue
+		}
+		if !interval.Start.Before(window.End) {
+			break
+		}
+		if interval.Start.After(cursor) {
+			free = append(free, model.Interval{Start: cursor, End: interval.Start})
+		}
+		cursor = interval.End
+	}
+	if cursor.Before(window.End) {
+		free = append(free, model.Interval{Start: cursor, End: window.End})
+	}
+	return free
+}
@@ -0,0 +1,82 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func at(hour, minute int) time.Time {
+	return time.Date(2024, time.September, 2, hour, minute, 0, 0, time.UTC)
+}
+
+func TestMergeIntervals(t *testing.T) {
+	merged := mergeIntervals([]model.Interval{
+		{Start: at(13, 0), End: at(14, 0)},
+		{Start: at(9, 0), End: at(10, 0)},
+		{Start: at(9, 30), End: at(11, 0)},
+		{Start: at(11, 0), End: at(11, 30)},
+	})
+
+	require.Equal(t, []model.Interval{
+		{Start: at(9, 0), End: at(11, 30)},
+		{Start: at(13, 0), End: at(14, 0)},
+	}, merged)
+}
+
+func TestFindFreeSlots(t *testing.T) {
+	busy := mergeIntervals([]model.Interval{
+		{Start: at(9, 0), End: at(10, 30)},
+		{Start: at(11, 0), End: at(12, 0)},
+		{Start: at(12, 0), End: at(16, 45)},
+	})
+
+	slots := findFreeSlots(busy, model.SlotQuery{
+		From:     at(0, 0),
+		To:       at(23, 59),
+		Duration: 30 * time.Minute,
+		WorkingHours: model.WorkingHours{
+			Start: 9 * time.Hour,
+			End:   18 * time.Hour,
+		},
+	})
+
+	require.Equal(t, []model.Interval{
+		{Start: at(10, 30), End: at(11, 0)},
+		{Start: at(16, 45), End: at(17, 15)},
+		{Start: at(17, 15), End: at(17, 45)},
+	}, slots)
+}
+
+func TestFindFreeSlotsLimitAndTimeZone(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+
+	slots := findFreeSlots(nil, model.SlotQuery{
+		From:     at(0, 0),
+		To:       at(0, 0).AddDate(0, 0, 3),
+		Duration: time.Hour,
+		WorkingHours: model.WorkingHours{
+			Start:    9 * time.Hour,
+			End:      10 * time.Hour,
+			Location: loc,
+		},
+		Limit: 2,
+	})
+
+	require.Len(t, slots, 2)
+	require.Equal(t, at(6, 0), slots[0].Start.UTC())
+	require.Equal(t, at(6, 0).AddDate(0, 0, 1), slots[1].Start.UTC())
+}
+
+func TestFindFreeSlotsLimitIsCapped(t *testing.T) {
+	slots := findFreeSlots(nil, model.SlotQuery{
+		From:     at(0, 0),
+		To:       at(0, 0).AddDate(0, 0, 2*model.MaxSlotsLimit),
+		Duration: time.Hour,
+		Limit:    10 * model.MaxSlotsLimit,
+	})
+
+	require.Len(t, slots, model.MaxSlotsLimit)
+}
@@ -9,6 +9,7 @@ import (
 	sq "github.com/Masterminds/squirrel"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/auth"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
 	sqlstorage "github.com/milov52/hw12_13_14_15_calendar/internal/repository/event/sql"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/service/calendar"
@@ -16,11 +17,14 @@ import (
 	"golang.org/x/net/context"
 )
 
+// userCtx - запросы от имени владельца тестовых событий.
+var userCtx = auth.WithUserID(context.Background(), "user1")
+
 type EventService interface {
 	CreateEvent(ctx context.Context, event model.Event) (uuid.UUID, error)
-	DayEventList(ctx context.Context, date time.Time) ([]model.Event, error)
-	WeekEventList(ctx context.Context, date time.Time) ([]model.Event, error)
-	MonthEventList(ctx context.Context, date time.Time) ([]model.Event, error)
+	DayEventList(ctx context.Context, date time.Time, filter model.EventFilter) ([]model.Event, error)
+	WeekEventList(ctx context.Context, date time.Time, filter model.EventFilter) ([]model.Event, error)
+	MonthEventList(ctx context.Context, date time.Time, filter model.EventFilter) ([]model.Event, error)
 }
 
 type CalendarServiceSuite struct {
@@ -46,12 +50,12 @@ func (s *CalendarServiceSuite) SetupSuite() {
 }
 
 func (s *CalendarServiceSuite) SetupTest() {
-	_, err := s.pool.Exec(context.Background(), "TRUNCATE TABLE event")
+	_, err := s.pool.Exec(context.Background(), "TRUNCATE TABLE event CASCADE")
 	s.Require().NoError(err)
 }
 
 func (s *CalendarServiceSuite) TearDownSuite() {
-	_, _ = s.pool.Exec(context.Background(), "TRUNCATE TABLE event")
+	_, _ = s.pool.Exec(context.Background(), "TRUNCATE TABLE event CASCADE")
 }
 
 func (s *CalendarServiceSuite) TestCreateEvent() {
@@ -67,7 +71,7 @@ func (s *CalendarServiceSuite) TestCreateEvent() {
 		UserID:    "user1",
 	}
 
-	eventID, err := s.svc.CreateEvent(context.Background(), m)
+	eventID, err := s.svc.CreateEvent(userCtx, m)
 	s.Require().NoError(err)
 	s.Require().NotEmpty(eventID)
 
@@ -108,7 +112,7 @@ func (s *CalendarServiceSuite) TestDayEventList() {
 	s.createDirectItem(m2)
 	s.createDirectItem(m3)
 
-	dayEvents, err := s.svc.DayEventList(context.Background(), time.Now())
+	dayEvents, err := s.svc.DayEventList(userCtx, time.Now(), model.EventFilter{})
 	s.Require().NoError(err)
 	s.Require().Equal(2, len(dayEvents))
 }
@@ -139,7 +143,7 @@ func (s *CalendarServiceSuite) TestWeekEventList() {
 	s.createDirectItem(m2)
 	s.createDirectItem(m3)
 
-	dayEvents, err := s.svc.WeekEventList(context.Background(), time.Now())
+	dayEvents, err := s.svc.WeekEventList(userCtx, time.Now(), model.EventFilter{})
 	s.Require().NoError(err)
 	s.Require().Equal(3, len(dayEvents))
 }
@@ -170,7 +174,7 @@ func (s *CalendarServiceSuite) TestMonthEventList() {
 	s.createDirectItem(m2)
 	s.createDirectItem(m3)
 
-	dayEvents, err := s.svc.MonthEventList(context.Background(), time.Now())
+	dayEvents, err := s.svc.MonthEventList(userCtx, time.Now(), model.EventFilter{})
 	s.Require().NoError(err)
 	s.Require().Equal(3, len(dayEvents))
 }
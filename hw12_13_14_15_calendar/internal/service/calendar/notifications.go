@@ -0,0 +1,100 @@
+package calendar
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"golang.org/x/net/context"
+)
+
+// ListNotifications возвращает журнал доставки уведомлений о событиях пользователя,
+// начиная с последнего. Историю одного события видит тот, кто может его изменять.
+func (s *Service) ListNotifications(
+	ctx context.Context, filter model.NotificationFilter,
+) ([]model.NotificationRecord, error) {
+	ownerID, err := s.callerFor(ctx, filter.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	filter.OwnerID = ownerID
+	if filter.EventID != uuid.Nil {
+		event, err := s.authorizeEventWrite(ctx, filter.EventID)
+		if err != nil {
+			return nil, err
+		}
+		// Участники с правом записи в календарь видят уведомления о событии его владельца,
+		// но не записи других владельцев с тем же event_id
+		filter.OwnerID = event.UserID
+	}
+	switch {
+	case filter.Limit <= 0:
+		filter.Limit = model.DefaultNotificationLimit
+	case filter.Limit > model.MaxNotificationLimit:
+		filter.Limit = model.MaxNotificationLimit
+	}
+
+	records, err := s.repository.ListNotifications(ctx, filter)
+	if err != nil {
+		s.logger.Error("failed list notifications", "err", err)
+		return nil, err
+	}
+	return records, nil
+}
+
+// GetNotificationPreferences возвращает настройки уведомлений пользователя,
+// для пользователя без сохранённых настроек - настройки по умолчанию.
+func (s *Service) GetNotificationPreferences(
+	ctx context.Context, userID string,
+) (model.NotificationPreferences, error) {
+	userID, err := s.callerFor(ctx, userID)
+	if err != nil {
+		return model.NotificationPreferences{}, err
+	}
+
+	prefs, err := s.repository.GetNotificationPreferences(ctx, userID)
+	if errors.Is(err, model.ErrPreferencesNotFound) {
+		return model.DefaultPreferences(userID), nil
+	}
+	if err != nil {
+		s.logger.Error("failed get notification preferences", "err", err)
+		return model.NotificationPreferences{}, err
+	}
+	return prefs, nil
+}
+
+// UpdateNotificationPreferences сохраняет настройки уведомлений пользователя целиком.
+func (s *Service) UpdateNotificationPreferences(
+	ctx context.Context, prefs model.NotificationPreferences,
+) (model.NotificationPreferences, error) {
+	userID, err := s.callerFor(ctx, prefs.UserID)
+	if err != nil {
+		return model.NotificationPreferences{}, err
+	}
+	prefs.UserID = userID
+	if err := prefs.Validate(); err != nil {
+		return model.NotificationPreferences{}, err
+	}
+
+	if err := s.repository.SaveNotificationPreferences(ctx, prefs); err != nil {
+		s.logger.Error("failed save notification preferences", "err", err)
+		return model.NotificationPreferences{}, err
+	}
+	return prefs, nil
+}
+
+// DeleteNotificationPreferences возвращает пользователю настройки по умолчанию.
+func (s *Service) DeleteNotificationPreferences(ctx context.Context, userID string) error {
+	userID, err := s.callerFor(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.repository.DeleteNotificationPreferences(ctx, userID)
+	// Настроек и так не было - результат тот же
+	if err != nil && !errors.Is(err, model.ErrPreferencesNotFound) {
+		s.logger.Error("failed delete notification preferences", "err", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package calendar
+
+import (
+	"strings"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"golang.org/x/net/context"
+)
+
+func (s *Service) SearchEvents(ctx context.Context, query model.SearchQuery) (model.SearchPage, error) {
+	if strings.TrimSpace(query.Text) == "" {
+		return model.SearchPage{}, model.ErrEmptySearchQuery
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		return model.SearchPage{}, model.ErrInvalidTimeRange
+	}
+	switch {
+	case query.Limit <= 0:
+		query.Limit = model.DefaultSearchLimit
+	case query.Limit > model.MaxSearchLimit:
+		query.Limit = model.MaxSearchLimit
+	}
+	if query.Offset < 0 {
+		query.Offset = 0
+	}
+
+	userID, err := s.callerFor(ctx, query.UserID)
+	if err != nil {
+		return model.SearchPage{}, err
+	}
+	query.UserID = userID
+
+	page, err := s.repository.SearchEvents(ctx, query)
+	if err != nil {
+		s.logger.Error("failed search events", "err", err)
+		return model.SearchPage{}, err
+	}
+
+	s.logger.Info("searched events", "total", page.Total, "returned", len(page.Results))
+	return page, nil
+}
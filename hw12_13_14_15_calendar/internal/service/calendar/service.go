@@ -1,10 +1,13 @@
 package calendar
 
 import (
+	"errors"
 	"log/slog"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/clock"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
 	"golang.org/x/net/context"
 )
@@ -19,22 +22,79 @@ type Storage interface {
 	CreateEvent(ctx context.Context, event model.Event) (uuid.UUID, error)
 	UpdateEvent(ctx context.Context, id uuid.UUID, event model.Event) error
 	DeleteEvent(ctx context.Context, id uuid.UUID) error
-	GetEvents(ctx context.Context, date time.Time, offset int) ([]model.Event, error)
+	GetUserEvents(ctx context.Context, userID string, date time.Time, offset int) ([]model.Event, error)
+	GetBusyIntervals(ctx context.Context, userIDs []string, from, to time.Time) (map[string][]model.Interval, error)
+	GetCalendarBusyIntervals(ctx context.Context, calendarIDs []uuid.UUID, from, to time.Time) ([]model.Interval, error)
+	InviteAttendees(ctx context.Context, eventID uuid.UUID, userIDs []string) error
+	RespondToInvitation(ctx context.Context, eventID uuid.UUID, userID string, status model.AttendeeStatus) error
+	BatchCreateEvents(ctx context.Context, events []model.Event, allOrNothing bool) ([]model.BatchResult, error)
+	BatchUpdateEvents(ctx context.Context, updates []model.EventUpdate, allOrNothing bool) ([]model.BatchResult, error)
+	BatchDeleteEvents(ctx context.Context, ids []uuid.UUID, allOrNothing bool) ([]model.BatchResult, error)
+	GetEvent(ctx context.Context, id uuid.UUID) (model.Event, error)
+	GetCalendarEvents(ctx context.Context, calendarID uuid.UUID, date time.Time, offset int) ([]model.Event, error)
+	CreateCalendar(ctx context.Context, calendar model.Calendar) (uuid.UUID, error)
+	UpdateCalendar(ctx context.Context, id uuid.UUID, calendar model.Calendar) error
+	DeleteCalendar(ctx context.Context, id uuid.UUID) error
+	GetCalendar(ctx context.Context, id uuid.UUID) (model.Calendar, error)
+	ListCalendars(ctx context.Context, userID string) ([]model.Calendar, error)
+	ShareCalendar(ctx context.Context, calendarID uuid.UUID, share model.CalendarShare) error
+	RevokeCalendarShare(ctx context.Context, calendarID uuid.UUID, userID string) error
+	SearchEvents(ctx context.Context, query model.SearchQuery) (model.SearchPage, error)
+	CreateEventIdempotent(
+		ctx context.Context, key model.IdempotencyKey, event model.Event,
+	) (uuid.UUID, bool, error)
+	ListJobRuns(ctx context.Context, filter model.JobRunFilter) ([]model.JobRun, error)
+	ListNotifications(ctx context.Context, filter model.NotificationFilter) ([]model.NotificationRecord, error)
+	GetNotificationPreferences(ctx context.Context, userID string) (model.NotificationPreferences, error)
+	SaveNotificationPreferences(ctx context.Context, prefs model.NotificationPreferences) error
+	DeleteNotificationPreferences(ctx context.Context, userID string) error
 }
 
 type Service struct {
-	logger     slog.Logger
-	repository Storage
+	logger         slog.Logger
+	repository     Storage
+	idempotencyTTL time.Duration
+	// admins - пользователи с доступом к служебным методам.
+	admins map[string]bool
+	clock  clock.Clock
 }
 
-func NewEventService(logger slog.Logger, eventProvider Storage) *Service {
-	return &Service{
-		logger:     logger,
-		repository: eventProvider,
+type Option func(*Service)
+
+// WithClock задаёт источник времени, в тестах - clock.Fake.
+func WithClock(c clock.Clock) Option {
+	return func(s *Service) {
+		s.clock = c
+	}
+}
+
+// WithIdempotencyTTL задаёт, сколько хранятся ключи идемпотентности.
+func WithIdempotencyTTL(ttl time.Duration) Option {
+	return func(s *Service) {
+		if ttl > 0 {
+			s.idempotencyTTL = ttl
+		}
+	}
+}
+
+func NewEventService(logger slog.Logger, eventProvider Storage, opts ...Option) *Service {
+	s := &Service{
+		logger:         logger,
+		repository:     eventProvider,
+		idempotencyTTL: model.DefaultIdempotencyTTL,
+		clock:          clock.Real,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 func (s *Service) CreateEvent(ctx context.Context, event model.Event) (uuid.UUID, error) {
+	if err := s.authorizeEventCreate(ctx, &event); err != nil {
+		return uuid.Nil, err
+	}
+
 	id, err := s.repository.CreateEvent(ctx, event)
 	if err != nil {
 		s.logger.Error("failed create new event", "err", err)
@@ -44,47 +104,222 @@ func (s *Service) CreateEvent(ctx context.Context, event model.Event) (uuid.UUID
 	return id, nil
 }
 
-func (s *Service) UpdateEvent(ctx context.Context, id uuid.UUID, event model.Event) error {
-	err := s.repository.UpdateEvent(ctx, id, event)
+// CreateEventIdempotent создаёт событие один раз для ключа идемпотентности:
+// повтор запроса возвращает ID уже созданного события. Хранилище ищет повтор до проверки
+// квоты, поэтому повтор успешного запроса не отклоняется, даже когда квота уже исчерпана.
+func (s *Service) CreateEventIdempotent(ctx context.Context, key string, event model.Event) (uuid.UUID, error) {
+	if key == "" {
+		return s.CreateEvent(ctx, event)
+	}
+
+	if err := s.authorizeEventCreate(ctx, &event); err != nil {
+		return uuid.Nil, err
+	}
+
+	idempotencyKey := model.IdempotencyKey{
+		Key:         key,
+		UserID:      event.UserID,
+		RequestHash: model.RequestHash(event),
+		ExpiresAt:   s.clock.Now().Add(s.idempotencyTTL),
+	}
+	id, replayed, err := s.repository.CreateEventIdempotent(ctx, idempotencyKey, event)
+	if err != nil {
+		s.logger.Error("failed create new event", "err", err)
+		return uuid.Nil, err
+	}
+	if replayed {
+		s.logger.Info("replayed create event", "id", id, "idempotency_key", key)
+		return id, nil
+	}
+	s.logger.Info("created new event with id: %s", "id", id)
+	return id, nil
+}
+
+func (s *Service) UpdateEvent(ctx context.Context, update model.EventUpdate) error {
+	if err := s.authorizeEventUpdate(ctx, &update); err != nil {
+		return err
+	}
+
+	id := update.ID
+	err := s.repository.UpdateEvent(ctx, id, update.Event)
 	if err != nil {
 		s.logger.Error("failed update event", "err", err)
+		return err
 	}
-	s.logger.Info("updated event")
+	s.logger.Info("updated event", "id", id)
 	return nil
 }
 
 func (s *Service) DeleteEvent(ctx context.Context, id uuid.UUID) error {
+	if _, err := s.authorizeEventWrite(ctx, id); err != nil {
+		return err
+	}
+
 	err := s.repository.DeleteEvent(ctx, id)
 	if err != nil {
 		s.logger.Error("failed delete event", "err", err)
+		return err
+	}
+	s.logger.Info("deleted event", "id", id)
+	return nil
+}
+
+func (s *Service) BatchCreateEvents(
+	ctx context.Context, events []model.Event, allOrNothing bool,
+) ([]model.BatchResult, error) {
+	for i := range events {
+		if err := s.authorizeEventCreate(ctx, &events[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	results, err := s.repository.BatchCreateEvents(ctx, events, allOrNothing)
+	if err != nil {
+		s.logger.Error("failed batch create events", "err", err)
+		return nil, err
 	}
-	s.logger.Info("deleted event")
+	s.logBatch("batch created events", results)
+	return results, nil
+}
+
+func (s *Service) BatchUpdateEvents(
+	ctx context.Context, updates []model.EventUpdate, allOrNothing bool,
+) ([]model.BatchResult, error) {
+	// Несуществующие события отмечаются в результатах пакета, а не отклоняют его целиком
+	for i := range updates {
+		if err := s.authorizeEventUpdate(ctx, &updates[i]); err != nil && !errors.Is(err, model.ErrEventNotFound) {
+			return nil, err
+		}
+	}
+
+	results, err := s.repository.BatchUpdateEvents(ctx, updates, allOrNothing)
+	if err != nil {
+		s.logger.Error("failed batch update events", "err", err)
+		return nil, err
+	}
+	s.logBatch("batch updated events", results)
+	return results, nil
+}
+
+func (s *Service) BatchDeleteEvents(
+	ctx context.Context, ids []uuid.UUID, allOrNothing bool,
+) ([]model.BatchResult, error) {
+	for _, id := range ids {
+		if _, err := s.authorizeEventWrite(ctx, id); errors.Is(err, model.ErrPermissionDenied) {
+			return nil, err
+		}
+	}
+
+	results, err := s.repository.BatchDeleteEvents(ctx, ids, allOrNothing)
+	if err != nil {
+		s.logger.Error("failed batch delete events", "err", err)
+		return nil, err
+	}
+	s.logBatch("batch deleted events", results)
+	return results, nil
+}
+
+func (s *Service) logBatch(msg string, results []model.BatchResult) {
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			// Клиент получает только код и безопасный текст, подробности - здесь
+			s.logger.Warn("batch item failed", "index", r.Index, "id", r.ID, "err", r.Err)
+		}
+	}
+	s.logger.Info(msg, "total", len(results), "failed", failed)
+}
+
+func (s *Service) InviteAttendees(ctx context.Context, eventID uuid.UUID, userIDs []string) error {
+	if _, err := s.authorizeEventWrite(ctx, eventID); err != nil {
+		return err
+	}
+
+	err := s.repository.InviteAttendees(ctx, eventID, userIDs)
+	if err != nil {
+		s.logger.Error("failed invite attendees", "err", err)
+		return err
+	}
+	s.logger.Info("invited attendees", "id", eventID, "count", len(userIDs))
+	return nil
+}
+
+func (s *Service) RespondToInvitation(
+	ctx context.Context, eventID uuid.UUID, userID string, status model.AttendeeStatus,
+) error {
+	if !status.Valid() {
+		return model.ErrInvalidAttendeeStatus
+	}
+	userID, err := s.callerFor(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.repository.RespondToInvitation(ctx, eventID, userID, status)
+	if err != nil {
+		s.logger.Error("failed respond to invitation", "err", err)
+		return err
+	}
+	s.logger.Info("responded to invitation", "id", eventID, "user_id", userID, "status", status)
 	return nil
 }
 
-func (s *Service) DayEventList(ctx context.Context, date time.Time) ([]model.Event, error) {
-	eventList, err := s.repository.GetEvents(ctx, date, DAY)
+func (s *Service) DayEventList(ctx context.Context, date time.Time, filter model.EventFilter) ([]model.Event, error) {
+	eventList, err := s.listEvents(ctx, date, DAY, filter)
 	if err != nil {
 		s.logger.Error("failed list event", "err", err)
+		return nil, err
 	}
 	s.logger.Info("list event")
 	return eventList, nil
 }
 
-func (s *Service) WeekEventList(ctx context.Context, startDate time.Time) ([]model.Event, error) {
-	eventList, err := s.repository.GetEvents(ctx, startDate, WEEK)
+func (s *Service) WeekEventList(
+	ctx context.Context, startDate time.Time, filter model.EventFilter,
+) ([]model.Event, error) {
+	eventList, err := s.listEvents(ctx, startDate, WEEK, filter)
 	if err != nil {
 		s.logger.Error("failed list event", "err", err)
+		return nil, err
 	}
 	s.logger.Info("list event")
 	return eventList, nil
 }
 
-func (s *Service) MonthEventList(ctx context.Context, startDate time.Time) ([]model.Event, error) {
-	eventList, err := s.repository.GetEvents(ctx, startDate, MONTH)
+func (s *Service) MonthEventList(
+	ctx context.Context, startDate time.Time, filter model.EventFilter,
+) ([]model.Event, error) {
+	eventList, err := s.listEvents(ctx, startDate, MONTH, filter)
 	if err != nil {
 		s.logger.Error("failed list event", "err", err)
+		return nil, err
 	}
 	s.logger.Info("list event")
 	return eventList, nil
 }
+
+// EventsBetween возвращает события, начинающиеся в [from, to), с теми же правами доступа,
+// что и DayEventList, по времени начала.
+func (s *Service) EventsBetween(
+	ctx context.Context, from, to time.Time, filter model.EventFilter,
+) ([]model.Event, error) {
+	// Хранилища выбирают события по календарным датам, поэтому даты берутся с запасом
+	// на разницу часовых поясов, а лишнее отсекается по времени
+	start := from.UTC().AddDate(0, 0, -1)
+	days := int(to.Sub(from)/(24*time.Hour)) + 2
+	eventList, err := s.listEvents(ctx, start, days, filter)
+	if err != nil {
+		s.logger.Error("failed list event", "err", err)
+		return nil, err
+	}
+
+	var res []model.Event
+	for _, e := range eventList {
+		if !e.StartTime.Before(from) && e.StartTime.Before(to) {
+			res = append(res, e)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].StartTime.Before(res[j].StartTime) })
+	return res, nil
+}
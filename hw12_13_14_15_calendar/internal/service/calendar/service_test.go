@@ -0,0 +1,41 @@
+package calendar
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/auth"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	memorystorage "github.com/milov52/hw12_13_14_15_calendar/internal/repository/event/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsBetween(t *testing.T) {
+	ctx := context.Background()
+	storage := memorystorage.New()
+	for _, e := range []model.Event{
+		{Title: "late", StartTime: time.Date(2024, time.September, 1, 20, 30, 0, 0, time.UTC)},
+		{Title: "review", StartTime: time.Date(2024, time.September, 2, 14, 0, 0, 0, time.UTC)},
+		{Title: "standup", StartTime: time.Date(2024, time.September, 1, 21, 0, 0, 0, time.UTC)},
+		{Title: "tomorrow", StartTime: time.Date(2024, time.September, 2, 21, 0, 0, 0, time.UTC)},
+	} {
+		e.UserID, e.Duration = "user1", time.Hour
+		_, err := storage.CreateEvent(ctx, e)
+		require.NoError(t, err)
+	}
+	s := NewEventService(*slog.New(slog.NewTextHandler(io.Discard, nil)), storage)
+	ctx = auth.WithUserID(ctx, "user1")
+
+	// 2 сентября по Москве: с 21:00 UTC 1 сентября до 21:00 UTC 2 сентября
+	loc, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+	day := time.Date(2024, time.September, 2, 0, 0, 0, 0, loc)
+	events, err := s.EventsBetween(ctx, day, day.AddDate(0, 0, 1), model.EventFilter{UserID: "user1"})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, "standup", events[0].Title)
+	require.Equal(t, "review", events[1].Title)
+}
@@ -0,0 +1,117 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/auth"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"golang.org/x/net/context"
+)
+
+// Events - выборка событий пользователя с учётом прав доступа, её реализует calendar.Service.
+type Events interface {
+	EventsBetween(ctx context.Context, from, to time.Time, filter model.EventFilter) ([]model.Event, error)
+}
+
+// SendAgendas отправляет ежедневные сводки событий пользователям, у которых в их часовом
+// поясе наступило время сводки, - задача JobAgenda. Каждому пользователю уходит не больше
+// одной сводки в день; день без событий сводки не получает.
+func (s *Scheduler) SendAgendas(ctx context.Context) error {
+	if s.events == nil {
+		return errors.New("agenda: events source is not configured")
+	}
+	now := s.clock.Now()
+	prefs, err := s.storage.ListAgendaPreferences(ctx)
+	if err != nil {
+		return fmt.Errorf("load preferences: %w", err)
+	}
+
+	var (
+		sent int
+		errs []error
+	)
+	for _, p := range prefs {
+		day, ok := p.AgendaDue(now)
+		if !ok {
+			continue
+		}
+		ok, err := s.sendAgenda(ctx, p, day, now)
+		if err != nil {
+			s.logger.Error("failed to send agenda", "user_id", p.UserID, "err", err)
+			errs = append(errs, fmt.Errorf("agenda for %s: %w", p.UserID, err))
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	ReportDetails(ctx, fmt.Sprintf("sent=%d failed=%d", sent, len(errs)))
+	return errors.Join(errs...)
+}
+
+// sendAgenda отправляет сводку за день day, если она ещё не отправлялась и в дне есть события.
+func (s *Scheduler) sendAgenda(
+	ctx context.Context, p model.NotificationPreferences, day, now time.Time,
+) (bool, error) {
+	// Сводка собирается от имени получателя и с его правами доступа
+	userCtx := auth.WithUserID(ctx, p.UserID)
+	events, err := s.events.EventsBetween(userCtx, day, day.AddDate(0, 0, 1), model.EventFilter{UserID: p.UserID})
+	if err != nil {
+		return false, err
+	}
+
+	channel := model.ChannelEmail
+	if len(p.Channels) > 0 {
+		channel = p.Channels[0]
+	}
+	record := model.NotificationRecord{
+		ID:          uuid.New(),
+		Kind:        model.KindAgenda,
+		OwnerID:     p.UserID,
+		RecipientID: p.UserID,
+		Channel:     channel,
+		Delivery:    model.DeliveryOnTime,
+		EventStart:  day,
+		Status:      model.NotificationQueued,
+		QueuedAt:    now,
+		UpdatedAt:   now,
+	}
+	var records []model.NotificationRecord
+	if len(events) > 0 {
+		records = append(records, record)
+	}
+	// Отметка и запись в журнал до отправки и одной операцией: сводку не должны отправить
+	// ни повторный запуск, ни другой экземпляр. День без событий только отмечается.
+	claimed, err := s.storage.ClaimAgenda(ctx, p.UserID, day, records)
+	if err != nil {
+		return false, fmt.Errorf("claim agenda: %w", err)
+	}
+	if !claimed || len(events) == 0 {
+		return false, nil
+	}
+
+	msg := messageFor(record, p)
+	for _, e := range events {
+		msg.Agenda = append(msg.Agenda, model.AgendaItem{
+			EventID:     e.ID,
+			Title:       e.Title,
+			Start:       e.StartTime,
+			Duration:    e.Duration,
+			Description: e.Description,
+		})
+	}
+	if err := s.send(msg); err != nil {
+		s.applyStatus(ctx, model.NotificationStatusReport{
+			ID: record.ID, Status: model.NotificationFailed, Error: err.Error(), At: s.clock.Now(),
+		})
+		// Без отметки сводку повторит следующий запуск
+		if releaseErr := s.storage.ReleaseAgenda(ctx, p.UserID, day); releaseErr != nil {
+			s.logger.Error("failed to release agenda", "user_id", p.UserID, "err", releaseErr)
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,238 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/clock"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/cron"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+)
+
+var (
+	ErrJobNotFound   = errors.New("job not found")
+	ErrDuplicateJob  = errors.New("job already registered")
+	ErrInvalidJob    = errors.New("invalid job")
+	errPreviousRun   = errors.New("previous run is still in progress")
+	errJobPanicked   = errors.New("job panicked")
+	errNeverSchedule = errors.New("schedule never fires")
+)
+
+// Job - периодическая задача планировщика.
+type Job struct {
+	Name     string
+	Schedule cron.Schedule
+	// Jitter - случайная задержка запуска от 0 до Jitter, чтобы несколько
+	// экземпляров планировщика не обращались к базе одновременно.
+	Jitter time.Duration
+	// Timeout ограничивает один запуск; 0 - без ограничения.
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// History сохраняет историю запусков задач.
+type History interface {
+	SaveJobRun(ctx context.Context, run model.JobRun) error
+}
+
+// jobEntry - зарегистрированная задача и её состояние.
+type jobEntry struct {
+	job Job
+	// running не дает запустить задачу, пока не завершился предыдущий запуск
+	running atomic.Bool
+	// reschedule передает новое расписание циклу задачи
+	reschedule chan cron.Schedule
+}
+
+// Register добавляет задачу. Задачи регистрируются до Start.
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" || job.Schedule == nil || job.Run == nil {
+		return fmt.Errorf("%w: name, schedule and run are required", ErrInvalidJob)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateJob, job.Name)
+	}
+	s.jobs[job.Name] = &jobEntry{job: job, reschedule: make(chan cron.Schedule, 1)}
+	return nil
+}
+
+// Reschedule меняет расписание задачи, в том числе запущенного планировщика.
+func (s *Scheduler) Reschedule(name string, schedule cron.Schedule) error {
+	s.mu.Lock()
+	entry, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+
+	// Непрочитанное расписание заменяется новым
+	select {
+	case <-entry.reschedule:
+	default:
+	}
+	entry.reschedule <- schedule
+	return nil
+}
+
+// Start запускает задачи и блокируется до отмены ctx, после чего ждет
+// завершения начатых запусков.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.logger.Info("Starting Scheduler...")
+
+	var wg sync.WaitGroup
+	s.mu.Lock()
+	for _, entry := range s.jobs {
+		wg.Add(1)
+		go func(entry *jobEntry) {
+			defer wg.Done()
+			s.loop(ctx, entry, &wg)
+		}(entry)
+	}
+	s.mu.Unlock()
+
+	wg.Wait()
+}
+
+// loop запускает задачу по расписанию до отмены ctx.
+func (s *Scheduler) loop(ctx context.Context, entry *jobEntry, wg *sync.WaitGroup) {
+	// Для каждого запуска создается новый таймер; nil - расписание больше не срабатывает
+	var timer clock.Timer
+	arm := func(schedule cron.Schedule) {
+		if timer != nil {
+			timer.Stop()
+			timer = nil
+		}
+		if delay, ok := s.nextDelay(entry.job, schedule); ok {
+			timer = s.clock.NewTimer(delay)
+		}
+	}
+	fired := func() <-chan time.Time {
+		if timer == nil {
+			return nil
+		}
+		return timer.C()
+	}
+
+	schedule := entry.job.Schedule
+	arm(schedule)
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case schedule = <-entry.reschedule:
+			arm(schedule)
+			s.logger.Info("job rescheduled", "job", entry.job.Name)
+		case <-fired():
+			s.trigger(ctx, entry, wg)
+			arm(schedule)
+		}
+	}
+}
+
+// nextDelay возвращает время до следующего по расписанию запуска с учетом jitter;
+// false, если расписание больше не срабатывает.
+func (s *Scheduler) nextDelay(job Job, schedule cron.Schedule) (time.Duration, bool) {
+	now := s.clock.Now()
+	next := schedule.Next(now)
+	if next.IsZero() {
+		s.logger.Error("job is not scheduled", "job", job.Name, "err", errNeverSchedule)
+		return 0, false
+	}
+	if job.Jitter > 0 {
+		next = next.Add(rand.N(job.Jitter))
+	}
+	s.logger.Debug("job scheduled", "job", job.Name, "next_run", next)
+	return next.Sub(now), true
+}
+
+// trigger запускает задачу, если предыдущий запуск уже завершился, иначе
+// записывает пропуск в историю.
+func (s *Scheduler) trigger(ctx context.Context, entry *jobEntry, wg *sync.WaitGroup) {
+	if !entry.running.CompareAndSwap(false, true) {
+		s.logger.Warn("job run skipped", "job", entry.job.Name, "err", errPreviousRun)
+		s.saveRun(ctx, model.JobRun{
+			Job:       entry.job.Name,
+			StartedAt: s.clock.Now(),
+			Status:    model.JobRunSkipped,
+			Error:     errPreviousRun.Error(),
+		})
+		return
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer entry.running.Store(false)
+		s.run(ctx, entry.job)
+	}()
+}
+
+func (s *Scheduler) run(ctx context.Context, job Job) {
+	runCtx := ctx
+	if job.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = clock.WithTimeout(ctx, s.clock, job.Timeout)
+		defer cancel()
+	}
+
+	details := new(atomic.Pointer[string])
+	runCtx = context.WithValue(runCtx, detailsKey{}, details)
+
+	run := model.JobRun{Job: job.Name, StartedAt: s.clock.Now()}
+	err := runSafe(runCtx, job.Run)
+	run.Duration = clock.Since(s.clock, run.StartedAt)
+	if d := details.Load(); d != nil {
+		run.Details = *d
+	}
+
+	if err != nil {
+		run.Status = model.JobRunFailed
+		run.Error = err.Error()
+		s.logger.Error("job failed", "job", job.Name, "duration", run.Duration, "err", err)
+	} else {
+		run.Status = model.JobRunSucceeded
+		s.logger.Info("job finished", "job", job.Name, "duration", run.Duration, "details", run.Details)
+	}
+	s.saveRun(ctx, run)
+}
+
+type detailsKey struct{}
+
+// ReportDetails сохраняет в истории текущего запуска задачи сводку результата,
+// например статистику удаления. Вне задачи планировщика ничего не делает.
+func ReportDetails(ctx context.Context, details string) {
+	if d, ok := ctx.Value(detailsKey{}).(*atomic.Pointer[string]); ok {
+		d.Store(&details)
+	}
+}
+
+// runSafe превращает панику задачи в ошибку, чтобы она не остановила планировщик.
+func runSafe(ctx context.Context, run func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", errJobPanicked, r)
+		}
+	}()
+	return run(ctx)
+}
+
+func (s *Scheduler) saveRun(ctx context.Context, run model.JobRun) {
+	// История сохраняется и для запуска, прерванного остановкой планировщика
+	if err := s.storage.SaveJobRun(context.WithoutCancel(ctx), run); err != nil {
+		s.logger.Error("failed to save job run", "job", run.Job, "err", err)
+	}
+}
@@ -0,0 +1,210 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/clock"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/cron"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2024, time.September, 2, 12, 0, 0, 0, time.UTC)
+
+// historyStorage передает сохраненные запуски в канал, чтобы тест мог их дождаться.
+type historyStorage struct {
+	Storage
+	saved chan model.JobRun
+}
+
+func (h *historyStorage) SaveJobRun(_ context.Context, run model.JobRun) error {
+	h.saved <- run
+	return nil
+}
+
+func newTestScheduler() (*Scheduler, *historyStorage, *clock.Fake) {
+	storage := &historyStorage{saved: make(chan model.JobRun, 100)}
+	fakeClock := clock.NewFake(start)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewScheduler(*logger, storage, nil, WithClock(fakeClock)), storage, fakeClock
+}
+
+// run запускает планировщик и возвращает функцию остановки, ожидающую его завершения.
+func run(s *Scheduler) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Start(ctx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestSchedulerRecordsRuns(t *testing.T) {
+	s, storage, fakeClock := newTestScheduler()
+	var calls int
+	require.NoError(t, s.Register(Job{
+		Name:     "job",
+		Schedule: cron.Every(time.Minute),
+		Run: func(context.Context) error {
+			calls++
+			if calls == 2 {
+				return errors.New("boom")
+			}
+			return nil
+		},
+	}))
+	defer run(s)()
+
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(time.Minute)
+	first := <-storage.saved
+	require.Equal(t, model.JobRun{Job: "job", StartedAt: start.Add(time.Minute), Status: model.JobRunSucceeded}, first)
+
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(time.Minute)
+	second := <-storage.saved
+	require.Equal(t, model.JobRunFailed, second.Status)
+	require.Equal(t, "boom", second.Error)
+	require.Equal(t, start.Add(2*time.Minute), second.StartedAt)
+}
+
+func TestSchedulerPreventsOverlap(t *testing.T) {
+	s, storage, fakeClock := newTestScheduler()
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	require.NoError(t, s.Register(Job{
+		Name:     "slow",
+		Schedule: cron.Every(time.Minute),
+		Run: func(context.Context) error {
+			entered <- struct{}{}
+			<-release
+			return nil
+		},
+	}))
+	defer run(s)()
+
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(time.Minute)
+	<-entered
+
+	// Второй запуск приходится на время работы первого и пропускается
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(time.Minute)
+	skipped := <-storage.saved
+	require.Equal(t, model.JobRunSkipped, skipped.Status)
+
+	close(release)
+	finished := <-storage.saved
+	require.Equal(t, model.JobRunSucceeded, finished.Status)
+	require.Equal(t, time.Minute, finished.Duration)
+}
+
+func TestSchedulerTimeout(t *testing.T) {
+	s, storage, fakeClock := newTestScheduler()
+	require.NoError(t, s.Register(Job{
+		Name:     "timeout",
+		Schedule: cron.Every(time.Hour),
+		Timeout:  30 * time.Second,
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}))
+	defer run(s)()
+
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(time.Hour)
+	// Взведены следующий запуск и таймаут текущего
+	fakeClock.BlockUntil(2)
+	fakeClock.Advance(30 * time.Second)
+
+	failed := <-storage.saved
+	require.Equal(t, model.JobRunFailed, failed.Status)
+	require.Equal(t, context.DeadlineExceeded.Error(), failed.Error)
+	require.Equal(t, 30*time.Second, failed.Duration)
+}
+
+func TestSchedulerRecoversPanic(t *testing.T) {
+	s, storage, fakeClock := newTestScheduler()
+	require.NoError(t, s.Register(Job{
+		Name:     "panic",
+		Schedule: cron.Every(time.Minute),
+		Run:      func(context.Context) error { panic("oops") },
+	}))
+	defer run(s)()
+
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(time.Minute)
+	failed := <-storage.saved
+	require.Equal(t, model.JobRunFailed, failed.Status)
+	require.Contains(t, failed.Error, "oops")
+}
+
+// notifySchedule сообщает о вычислении следующего запуска.
+type notifySchedule struct {
+	cron.Every
+	computed chan struct{}
+}
+
+func (n notifySchedule) Next(t time.Time) time.Time {
+	n.computed <- struct{}{}
+	return n.Every.Next(t)
+}
+
+func TestSchedulerReschedule(t *testing.T) {
+	s, storage, fakeClock := newTestScheduler()
+	job := Job{Name: "job", Schedule: cron.Every(time.Hour), Run: func(context.Context) error { return nil }}
+
+	require.NoError(t, s.Register(job))
+	require.ErrorIs(t, s.Register(job), ErrDuplicateJob)
+	require.ErrorIs(t, s.Register(Job{Name: "no-run", Schedule: cron.Every(time.Hour)}), ErrInvalidJob)
+	require.ErrorIs(t, s.Reschedule("missing", cron.Every(time.Hour)), ErrJobNotFound)
+	defer run(s)()
+
+	fakeClock.BlockUntil(1)
+	computed := make(chan struct{}, 10)
+	require.NoError(t, s.Reschedule("job", notifySchedule{cron.Every(time.Minute), computed}))
+	<-computed
+
+	fakeClock.Advance(time.Minute)
+	require.Equal(t, start.Add(time.Minute), (<-storage.saved).StartedAt)
+}
+
+// purgeStorage запоминает правила хранения, с которыми вызвано удаление.
+type purgeStorage struct {
+	*historyStorage
+	policy model.RetentionPolicy
+}
+
+func (p *purgeStorage) PurgeEvents(_ context.Context, policy model.RetentionPolicy) (model.PurgeStats, error) {
+	p.policy = policy
+	return model.PurgeStats{DryRun: policy.DryRun, Deleted: 3, KeptWithAttendees: 1}, nil
+}
+
+func TestSchedulerRecordsPurgeStats(t *testing.T) {
+	_, history, fakeClock := newTestScheduler()
+	storage := &purgeStorage{historyStorage: history}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewScheduler(*logger, storage, nil, WithClock(fakeClock))
+
+	policy := model.RetentionPolicy{Default: model.RetentionRule{MaxAge: time.Hour}, DryRun: true}
+	s.SetRetention(policy)
+	require.NoError(t, s.Register(Job{Name: JobCleanup, Schedule: cron.Every(time.Hour), Run: s.PurgeEvents}))
+	defer run(s)()
+
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(time.Hour)
+	purged := <-history.saved
+	require.Equal(t, model.JobRunSucceeded, purged.Status)
+	require.Equal(t, "deleted=3 kept_with_attendees=1 dry_run=true", purged.Details)
+	require.Equal(t, policy, storage.policy)
+}
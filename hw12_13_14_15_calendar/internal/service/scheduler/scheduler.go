@@ -1,18 +1,41 @@
 package scheduler
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/clock"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
 	"golang.org/x/net/context"
 )
 
+// Встроенные задачи планировщика.
+const (
+	JobReminders = "reminders"
+	JobCleanup   = "cleanup"
+	JobAgenda    = "agenda"
+)
+
+// DefaultDigestInterval - как часто уходят дайджесты пользователям в режиме model.ModeDigest.
+const DefaultDigestInterval = time.Hour
+
 type Storage interface {
+	History
 	GetNotifications(ctx context.Context, date time.Time) ([]model.Notification, error)
 	MarkEventsAsNotified(ctx context.Context, events []model.Notification) error
-	DeleteOldEvents(ctx context.Context) error
+	SaveNotifications(ctx context.Context, records []model.NotificationRecord) error
+	UpdateNotificationStatus(ctx context.Context, report model.NotificationStatusReport) error
+	ListDeferredNotifications(ctx context.Context, until time.Time) ([]model.NotificationRecord, error)
+	ListNotificationPreferences(ctx context.Context, userIDs []string) (map[string]model.NotificationPreferences, error)
+	ListAgendaPreferences(ctx context.Context) ([]model.NotificationPreferences, error)
+	ClaimAgenda(ctx context.Context, userID string, day time.Time, records []model.NotificationRecord) (bool, error)
+	ReleaseAgenda(ctx context.Context, userID string, day time.Time) error
+	PurgeEvents(ctx context.Context, policy model.RetentionPolicy) (model.PurgeStats, error)
 }
 
 type QueueMessage interface {
@@ -24,55 +47,338 @@ type Scheduler struct {
 	logger  slog.Logger
 	storage Storage
 	queue   QueueMessage
+	// statusQueue - отчёты отправителя о доставке, см. ConsumeStatusReports
+	statusQueue QueueMessage
+	// events - события для ежедневных сводок, см. SendAgendas
+	events Events
+
+	// catchUp - обработка напоминаний о начавшихся событиях
+	catchUp model.CatchUp
+	// digestInterval - интервал отправки дайджестов
+	digestInterval time.Duration
+	clock          clock.Clock
+
+	mu        sync.Mutex
+	jobs      map[string]*jobEntry
+	retention model.RetentionPolicy
 }
 
-func NewScheduler(logger slog.Logger, storage Storage, queue QueueMessage) *Scheduler {
-	return &Scheduler{
-		logger:  logger,
-		storage: storage,
-		queue:   queue,
+type Option func(*Scheduler)
+
+// WithCatchUp задаёт обработку напоминаний, время которых прошло, пока планировщик не работал.
+func WithCatchUp(catchUp model.CatchUp) Option {
+	return func(s *Scheduler) {
+		s.catchUp = catchUp
 	}
 }
 
-func (s *Scheduler) Start(ctx context.Context, freq time.Duration) {
-	s.logger.Info("Starting Scheduler...")
-
-	ticker := time.NewTicker(1 * freq)
-	for range ticker.C {
-		s.processReminders(ctx)
+// WithRetention задаёт правила хранения событий для задачи JobCleanup.
+func WithRetention(policy model.RetentionPolicy) Option {
+	return func(s *Scheduler) {
+		s.retention = policy
 	}
+}
 
-	deleteTicker := time.NewTicker(1 * time.Hour * 24)
-	for range deleteTicker.C {
-		err := s.storage.DeleteOldEvents(ctx)
-		if err != nil {
-			s.logger.Error("Failed to delete old events: %v", err)
+// WithDigestInterval задаёт, как часто уходят дайджесты пользователям в режиме дайджеста.
+func WithDigestInterval(d time.Duration) Option {
+	return func(s *Scheduler) {
+		if d > 0 {
+			s.digestInterval = d
 		}
 	}
 }
 
-func (s *Scheduler) processReminders(ctx context.Context) {
+// WithStatusQueue задаёт очередь отчётов отправителя о доставке уведомлений.
+func WithStatusQueue(queue QueueMessage) Option {
+	return func(s *Scheduler) {
+		s.statusQueue = queue
+	}
+}
+
+// WithEvents задаёт источник событий для ежедневных сводок.
+func WithEvents(events Events) Option {
+	return func(s *Scheduler) {
+		s.events = events
+	}
+}
+
+// WithClock задаёт источник времени, в тестах - clock.Fake.
+func WithClock(c clock.Clock) Option {
+	return func(s *Scheduler) {
+		s.clock = c
+	}
+}
+
+func NewScheduler(logger slog.Logger, storage Storage, queue QueueMessage, opts ...Option) *Scheduler {
+	s := &Scheduler{
+		logger:         logger,
+		storage:        storage,
+		queue:          queue,
+		catchUp:        model.CatchUp{Policy: model.DefaultCatchUpPolicy, Grace: model.DefaultCatchUpGrace},
+		digestInterval: DefaultDigestInterval,
+		clock:          clock.Real,
+		jobs:           make(map[string]*jobEntry),
+		retention: model.RetentionPolicy{
+			Default: model.RetentionRule{MaxAge: model.DefaultRetention},
+		},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// ProcessReminders отправляет в очередь наступившие напоминания - задача JobReminders.
+// Каждое сообщение получателю сначала записывается в журнал уведомлений: queued, если
+// оно уходит сразу, или deferred, если его откладывают тихие часы или режим дайджеста.
+// Отложенные сообщения, время которых наступило, уходят здесь же.
+func (s *Scheduler) ProcessReminders(ctx context.Context) error {
 	s.logger.Info("Processing reminders...")
-	currentTime := time.Now()
+	currentTime := s.clock.Now()
 
 	notifications, err := s.storage.GetNotifications(ctx, currentTime)
 	if err != nil {
-		s.logger.Error(err.Error())
+		return err
+	}
+	prefs, err := s.storage.ListNotificationPreferences(ctx, recipients(notifications))
+	if err != nil {
+		return fmt.Errorf("load preferences: %w", err)
 	}
 
-	for _, n := range notifications {
-		msg := fmt.Sprintf("Notification to User: %s, Event ID: %s, Title: %s, Notify At: %s",
-			n.UserID, n.EventID, n.Title, n.Date)
+	var (
+		records  []model.NotificationRecord
+		messages []model.NotificationMessage
+	)
+	for i := range notifications {
+		n := &notifications[i]
+		n.Delivery = s.catchUp.Delivery(*n, currentTime)
+		if !n.Delivery.Sent() {
+			// Пропущенное напоминание остается в хранилище с delivery = skipped
+			s.logger.Warn("reminder skipped", "event_id", n.EventID, "reminder_id", n.ReminderID,
+				"notify_at", n.NotifyAt, "late_by", currentTime.Sub(n.NotifyAt))
+			continue
+		}
 
-		err := s.queue.Send(msg)
-		if err != nil {
-			s.logger.Error("Error sending message to queue: %v", err)
+		// Напоминание получает владелец события и каждый участник, принявший приглашение
+		for _, userID := range append([]string{n.UserID}, n.Attendees...) {
+			p, ok := prefs[userID]
+			if !ok {
+				p = model.DefaultPreferences(userID)
+			}
+			record := model.NotificationRecord{
+				ID:            uuid.New(),
+				Kind:          model.KindReminder,
+				EventID:       n.EventID,
+				ReminderID:    n.ReminderID,
+				OwnerID:       n.UserID,
+				RecipientID:   userID,
+				Channel:       p.Channel(n.Channel),
+				Delivery:      n.Delivery,
+				Title:         n.Title,
+				EventStart:    n.Date,
+				EventDuration: n.Duration,
+				Description:   n.Description,
+				Status:        model.NotificationQueued,
+				QueuedAt:      currentTime,
+				UpdatedAt:     currentTime,
+			}
+			if at := p.DeferUntil(currentTime, s.digestInterval, n.Date); !at.IsZero() {
+				record.Status = model.NotificationDeferred
+				record.SendAfter = at
+			} else {
+				messages = append(messages, messageFor(record, p))
+			}
+			records = append(records, record)
+		}
+	}
+	// Без записи в журнале отчёт отправителя некуда применить, поэтому сначала журнал
+	if err := s.storage.SaveNotifications(ctx, records); err != nil {
+		return fmt.Errorf("save notifications: %w", err)
+	}
+
+	var sendErrs []error
+	for _, msg := range messages {
+		if err := s.send(msg); err != nil {
+			s.logger.Error("Error sending message to queue", "err", err)
+			sendErrs = append(sendErrs, err)
+			s.applyStatus(ctx, model.NotificationStatusReport{
+				ID: msg.ID, Status: model.NotificationFailed, Error: err.Error(), At: s.clock.Now(),
+			})
 		}
 	}
 	if len(notifications) > 0 {
 		err := s.storage.MarkEventsAsNotified(ctx, notifications)
 		if err != nil {
-			s.logger.Error("Error update sent: %v", err)
+			return fmt.Errorf("update sent: %w", err)
+		}
+	}
+	if err := s.flushDeferred(ctx, currentTime); err != nil {
+		sendErrs = append(sendErrs, err)
+	}
+	return errors.Join(sendErrs...)
+}
+
+// recipients возвращает всех получателей напоминаний без повторов.
+func recipients(notifications []model.Notification) []string {
+	seen := make(map[string]bool)
+	var userIDs []string
+	for _, n := range notifications {
+		for _, userID := range append([]string{n.UserID}, n.Attendees...) {
+			if !seen[userID] {
+				seen[userID] = true
+				userIDs = append(userIDs, userID)
+			}
+		}
+	}
+	return userIDs
+}
+
+// flushDeferred отправляет отложенные сообщения, время которых наступило: всё, что
+// накопилось для одного получателя и канала, уходит одним сообщением.
+func (s *Scheduler) flushDeferred(ctx context.Context, now time.Time) error {
+	deferred, err := s.storage.ListDeferredNotifications(ctx, now)
+	if err != nil {
+		return fmt.Errorf("list deferred notifications: %w", err)
+	}
+	if len(deferred) == 0 {
+		return nil
+	}
+	userIDs := make([]string, 0, len(deferred))
+	for _, r := range deferred {
+		userIDs = append(userIDs, r.RecipientID)
+	}
+	// Часовой пояс и язык берутся на момент отправки
+	prefs, err := s.storage.ListNotificationPreferences(ctx, userIDs)
+	if err != nil {
+		return fmt.Errorf("load preferences: %w", err)
+	}
+
+	type batchKey struct {
+		recipientID string
+		channel     model.ReminderChannel
+	}
+	var keys []batchKey
+	batches := make(map[batchKey][]model.NotificationRecord)
+	for _, r := range deferred {
+		key := batchKey{r.RecipientID, r.Channel}
+		if _, ok := batches[key]; !ok {
+			keys = append(keys, key)
+		}
+		batches[key] = append(batches[key], r)
+	}
+
+	var sendErrs []error
+	for _, key := range keys {
+		batch := batches[key]
+		p := prefs[key.recipientID]
+		msg := messageFor(batch[0], p)
+		if len(batch) > 1 {
+			msg = model.NotificationMessage{
+				ID: uuid.New(), Kind: model.KindReminder, RecipientID: key.recipientID, Channel: key.channel,
+				TimeZone: p.TimeZone, Locale: p.Locale,
+			}
+			for _, r := range batch {
+				msg.Items = append(msg.Items, r.Message())
+			}
 		}
+
+		// Статус queued - до отправки, иначе он может затереть уже пришедший отчёт отправителя
+		s.applyBatchStatus(ctx, batch, model.NotificationStatusReport{Status: model.NotificationQueued, At: s.clock.Now()})
+		if err := s.send(msg); err != nil {
+			s.logger.Error("Error sending message to queue", "err", err)
+			sendErrs = append(sendErrs, err)
+			s.applyBatchStatus(ctx, batch, model.NotificationStatusReport{
+				Status: model.NotificationFailed, Error: err.Error(), At: s.clock.Now(),
+			})
+		}
+	}
+	return errors.Join(sendErrs...)
+}
+
+// messageFor возвращает сообщение для записи журнала с часовым поясом и языком получателя.
+func messageFor(r model.NotificationRecord, p model.NotificationPreferences) model.NotificationMessage {
+	msg := r.Message()
+	msg.TimeZone, msg.Locale = p.TimeZone, p.Locale
+	return msg
+}
+
+func (s *Scheduler) applyBatchStatus(
+	ctx context.Context, batch []model.NotificationRecord, report model.NotificationStatusReport,
+) {
+	for _, r := range batch {
+		report.ID = r.ID
+		s.applyStatus(ctx, report)
+	}
+}
+
+func (s *Scheduler) send(msg model.NotificationMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return s.queue.Send(string(body))
+}
+
+// ConsumeStatusReports применяет к журналу уведомлений отчёты отправителя о доставке,
+// пока не закроется очередь или не отменится ctx. Без WithStatusQueue сразу возвращается.
+func (s *Scheduler) ConsumeStatusReports(ctx context.Context) {
+	if s.statusQueue == nil {
+		return
+	}
+	reports, err := s.statusQueue.Receive()
+	if err != nil {
+		s.logger.Error("failed to receive status reports", "err", err)
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case body, ok := <-reports:
+			if !ok {
+				return
+			}
+			var report model.NotificationStatusReport
+			if err := json.Unmarshal([]byte(body), &report); err != nil || !report.Status.Valid() {
+				s.logger.Warn("invalid status report", "report", body, "err", err)
+				continue
+			}
+			s.applyStatus(ctx, report)
+		}
+	}
+}
+
+func (s *Scheduler) applyStatus(ctx context.Context, report model.NotificationStatusReport) {
+	if err := s.storage.UpdateNotificationStatus(ctx, report); err != nil {
+		s.logger.Error("failed to update notification status", "id", report.ID, "err", err)
+	}
+}
+
+// SetRetention заменяет правила хранения событий, например после перечитывания конфигурации.
+func (s *Scheduler) SetRetention(policy model.RetentionPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retention = policy
+}
+
+// PurgeEvents удаляет события с истекшим сроком хранения - задача JobCleanup.
+// Статистика попадает в лог и в историю запуска задачи.
+func (s *Scheduler) PurgeEvents(ctx context.Context) error {
+	s.mu.Lock()
+	policy := s.retention
+	s.mu.Unlock()
+
+	stats, err := s.storage.PurgeEvents(ctx, policy)
+	if err != nil {
+		return err
+	}
+	ReportDetails(ctx, stats.String())
+	if stats.DryRun {
+		s.logger.Info("retention dry run", "would_delete", stats.Deleted,
+			"kept_with_attendees", stats.KeptWithAttendees, "event_ids", stats.EventIDs)
+		return nil
 	}
+	s.logger.Info("old events purged", "deleted", stats.Deleted, "kept_with_attendees", stats.KeptWithAttendees)
+	return nil
 }
@@ -0,0 +1,461 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/auth"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/clock"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+type notificationStorage struct {
+	historyStorage
+	pending []model.Notification
+	marked  []model.Notification
+	log     map[uuid.UUID]model.NotificationRecord
+	prefs   map[string]model.NotificationPreferences
+	// agendaSent - день последней сводки пользователя
+	agendaSent map[string]time.Time
+}
+
+func (n *notificationStorage) SaveNotifications(_ context.Context, records []model.NotificationRecord) error {
+	if n.log == nil {
+		n.log = make(map[uuid.UUID]model.NotificationRecord)
+	}
+	for _, r := range records {
+		n.log[r.ID] = r
+	}
+	return nil
+}
+
+func (n *notificationStorage) UpdateNotificationStatus(_ context.Context, report model.NotificationStatusReport) error {
+	r, ok := n.log[report.ID]
+	if !ok {
+		return model.ErrNotificationNotFound
+	}
+	r.Status, r.Attempts, r.LastError, r.UpdatedAt = report.Status, report.Attempts, report.Error, report.At
+	n.log[report.ID] = r
+	return nil
+}
+
+func (n *notificationStorage) ListDeferredNotifications(
+	_ context.Context, until time.Time,
+) ([]model.NotificationRecord, error) {
+	var due []model.NotificationRecord
+	for _, r := range n.log {
+		if r.Status == model.NotificationDeferred && !r.SendAfter.After(until) {
+			due = append(due, r)
+		}
+	}
+	return due, nil
+}
+
+func (n *notificationStorage) ListNotificationPreferences(
+	_ context.Context, _ []string,
+) (map[string]model.NotificationPreferences, error) {
+	return n.prefs, nil
+}
+
+func (n *notificationStorage) ListAgendaPreferences(context.Context) ([]model.NotificationPreferences, error) {
+	var result []model.NotificationPreferences
+	for _, p := range n.prefs {
+		if p.Agenda.Enabled {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+func (n *notificationStorage) ClaimAgenda(
+	ctx context.Context, userID string, day time.Time, records []model.NotificationRecord,
+) (bool, error) {
+	if n.agendaSent == nil {
+		n.agendaSent = make(map[string]time.Time)
+	}
+	if last, ok := n.agendaSent[userID]; ok && !day.After(last) {
+		return false, nil
+	}
+	n.agendaSent[userID] = day
+	return true, n.SaveNotifications(ctx, records)
+}
+
+func (n *notificationStorage) ReleaseAgenda(_ context.Context, userID string, day time.Time) error {
+	if last, ok := n.agendaSent[userID]; ok && last.Equal(day) {
+		delete(n.agendaSent, userID)
+	}
+	return nil
+}
+
+func (n *notificationStorage) GetNotifications(_ context.Context, date time.Time) ([]model.Notification, error) {
+	var due []model.Notification
+	for _, notification := range n.pending {
+		if !notification.NotifyAt.After(date) {
+			due = append(due, notification)
+		}
+	}
+	return due, nil
+}
+
+func (n *notificationStorage) MarkEventsAsNotified(_ context.Context, notifications []model.Notification) error {
+	n.marked = append(n.marked, notifications...)
+	return nil
+}
+
+type recordingQueue struct {
+	messages []model.NotificationMessage
+	// fail - получатели, сообщения которым очередь не принимает
+	fail     map[string]bool
+	received chan string
+}
+
+func (q *recordingQueue) Send(body string) error {
+	var msg model.NotificationMessage
+	if err := json.Unmarshal([]byte(body), &msg); err != nil {
+		return err
+	}
+	if q.fail[msg.RecipientID] {
+		return errors.New("queue is unavailable")
+	}
+	q.messages = append(q.messages, msg)
+	return nil
+}
+
+func (q *recordingQueue) Receive() (<-chan string, error) {
+	return q.received, nil
+}
+
+func reminder(title string, start time.Time, offset time.Duration) model.Notification {
+	return model.Notification{
+		EventID:    uuid.New(),
+		ReminderID: uuid.New(),
+		Title:      title,
+		Date:       start,
+		NotifyAt:   start.Add(-offset),
+		UserID:     "user1",
+		Channel:    model.ChannelEmail,
+	}
+}
+
+func TestProcessRemindersCatchUp(t *testing.T) {
+	now := time.Date(2024, time.September, 2, 12, 0, 0, 0, time.UTC)
+	pending := []model.Notification{
+		// Событие ещё не началось - напоминание уходит как обычно
+		reminder("upcoming", now.Add(10*time.Minute), 15*time.Minute),
+		// Началось 30 минут назад - в пределах grace
+		reminder("started", now.Add(-30*time.Minute), 15*time.Minute),
+		// Началось 3 часа назад - за пределами grace
+		reminder("old", now.Add(-3*time.Hour), 15*time.Minute),
+	}
+
+	tests := []struct {
+		policy model.CatchUpPolicy
+		want   map[string]model.Delivery
+	}{
+		{model.CatchUpSendLate, map[string]model.Delivery{
+			"upcoming": model.DeliveryOnTime, "started": model.DeliveryLate, "old": model.DeliverySkipped,
+		}},
+		{model.CatchUpSendMissed, map[string]model.Delivery{
+			"upcoming": model.DeliveryOnTime, "started": model.DeliveryMissed, "old": model.DeliverySkipped,
+		}},
+		{model.CatchUpSkip, map[string]model.Delivery{
+			"upcoming": model.DeliveryOnTime, "started": model.DeliverySkipped, "old": model.DeliverySkipped,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			storage := &notificationStorage{pending: pending}
+			queue := &recordingQueue{}
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			s := NewScheduler(*logger, storage, queue,
+				WithCatchUp(model.CatchUp{Policy: tt.policy, Grace: time.Hour}),
+				WithClock(clock.NewFake(now)))
+
+			require.NoError(t, s.ProcessReminders(context.Background()))
+
+			// Обработанными отмечаются все напоминания, в том числе пропущенные
+			got := map[string]model.Delivery{}
+			for _, n := range storage.marked {
+				got[n.Title] = n.Delivery
+			}
+			require.Equal(t, tt.want, got)
+
+			var sent int
+			for _, delivery := range tt.want {
+				if delivery.Sent() {
+					sent++
+				}
+			}
+			require.Len(t, queue.messages, sent)
+			for _, msg := range queue.messages {
+				require.NotEqual(t, "old", msg.Title)
+				require.Equal(t, tt.want[msg.Title], msg.Delivery)
+				require.Equal(t, model.NotificationQueued, storage.log[msg.ID].Status)
+			}
+			require.Len(t, storage.log, sent)
+		})
+	}
+}
+
+func TestNotificationLog(t *testing.T) {
+	now := time.Date(2024, time.September, 2, 12, 0, 0, 0, time.UTC)
+	n := reminder("standup", now.Add(10*time.Minute), 15*time.Minute)
+	n.Attendees = []string{"user2"}
+	storage := &notificationStorage{pending: []model.Notification{n}}
+	queue := &recordingQueue{fail: map[string]bool{"user2": true}}
+	statusQueue := &recordingQueue{received: make(chan string, 2)}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewScheduler(*logger, storage, queue, WithStatusQueue(statusQueue), WithClock(clock.NewFake(now)))
+
+	require.Error(t, s.ProcessReminders(context.Background()))
+	require.Len(t, queue.messages, 1)
+	require.Len(t, storage.log, 2)
+
+	// Сообщение, не принятое очередью, сразу отмечается failed
+	var failed model.NotificationRecord
+	for _, r := range storage.log {
+		if r.RecipientID == "user2" {
+			failed = r
+		}
+	}
+	require.Equal(t, model.NotificationFailed, failed.Status)
+	require.Equal(t, "queue is unavailable", failed.LastError)
+
+	// Отчёт отправителя о доставке сообщения владельцу
+	delivered := queue.messages[0].ID
+	report, _ := json.Marshal(model.NotificationStatusReport{
+		ID: delivered, Status: model.NotificationDelivered, Attempts: 2, At: now.Add(time.Minute),
+	})
+	statusQueue.received <- "not json"
+	statusQueue.received <- string(report)
+	close(statusQueue.received)
+	s.ConsumeStatusReports(context.Background())
+
+	record := storage.log[delivered]
+	require.Equal(t, "user1", record.RecipientID)
+	require.Equal(t, model.NotificationDelivered, record.Status)
+	require.Equal(t, 2, record.Attempts)
+	require.Equal(t, now.Add(time.Minute), record.UpdatedAt)
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	// 23:30 по Москве - тихие часы user2
+	now := time.Date(2024, time.September, 2, 20, 30, 0, 0, time.UTC)
+	standup := reminder("standup", now.Add(10*time.Hour), 10*time.Hour)
+	standup.Attendees = []string{"user2"}
+	standup.Duration, standup.Description = 15*time.Minute, "room 4"
+	review := reminder("review", now.Add(11*time.Hour), 11*time.Hour)
+	storage := &notificationStorage{
+		pending: []model.Notification{standup, review},
+		prefs: map[string]model.NotificationPreferences{
+			"user1": {UserID: "user1", Mode: model.ModeDigest},
+			"user2": {
+				UserID:     "user2",
+				Channels:   []model.ReminderChannel{model.ChannelPush},
+				TimeZone:   "Europe/Moscow",
+				Locale:     "ru",
+				QuietHours: model.QuietHours{Start: 22 * time.Hour, End: 7 * time.Hour},
+				Mode:       model.ModeIndividual,
+			},
+		},
+	}
+	queue := &recordingQueue{}
+	fake := clock.NewFake(now)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewScheduler(*logger, storage, queue, WithDigestInterval(time.Hour), WithClock(fake))
+
+	require.NoError(t, s.ProcessReminders(context.Background()))
+	require.Empty(t, queue.messages)
+	require.Len(t, storage.log, 3)
+	for _, r := range storage.log {
+		require.Equal(t, model.NotificationDeferred, r.Status)
+		if r.RecipientID == "user2" {
+			require.Equal(t, model.ChannelPush, r.Channel)
+			require.Equal(t, time.Date(2024, time.September, 3, 4, 0, 0, 0, time.UTC), r.SendAfter)
+		} else {
+			require.Equal(t, now.Add(30*time.Minute), r.SendAfter)
+		}
+	}
+
+	// Дайджест user1: оба напоминания одним сообщением
+	storage.pending = nil
+	fake.Advance(30 * time.Minute)
+	require.NoError(t, s.ProcessReminders(context.Background()))
+	require.Len(t, queue.messages, 1)
+	digest := queue.messages[0]
+	require.Equal(t, "user1", digest.RecipientID)
+	require.Len(t, digest.Items, 2)
+	for _, item := range digest.Items {
+		require.Equal(t, model.NotificationQueued, storage.log[item.ID].Status)
+	}
+
+	// Тихие часы user2 закончились в 07:00 по Москве
+	fake.Advance(7 * time.Hour)
+	require.NoError(t, s.ProcessReminders(context.Background()))
+	require.Len(t, queue.messages, 2)
+	msg := queue.messages[1]
+	require.Equal(t, "user2", msg.RecipientID)
+	require.Equal(t, "standup", msg.Title)
+	require.Empty(t, msg.Items)
+	// Текст отложенного сообщения отправитель формирует по языку, поясу и данным события из журнала
+	require.Equal(t, "ru", msg.Locale)
+	require.Equal(t, "Europe/Moscow", msg.TimeZone)
+	require.Equal(t, 15*time.Minute, msg.Duration)
+	require.Equal(t, "room 4", msg.Description)
+	require.Equal(t, model.NotificationQueued, storage.log[msg.ID].Status)
+}
+
+func TestDeferredReminderBeforeEventStart(t *testing.T) {
+	// 23:30 по Москве, событие в 00:15 - до конца тихих часов
+	now := time.Date(2024, time.September, 2, 20, 30, 0, 0, time.UTC)
+	start := now.Add(45 * time.Minute)
+	storage := &notificationStorage{
+		pending: []model.Notification{reminder("late call", start, time.Hour)},
+		prefs: map[string]model.NotificationPreferences{
+			"user1": {
+				UserID:     "user1",
+				TimeZone:   "Europe/Moscow",
+				QuietHours: model.QuietHours{Start: 22 * time.Hour, End: 7 * time.Hour},
+				Mode:       model.ModeIndividual,
+			},
+		},
+	}
+	queue := &recordingQueue{}
+	fake := clock.NewFake(now)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewScheduler(*logger, storage, queue, WithClock(fake))
+
+	// Тихие часы откладывают напоминание не дальше начала события
+	require.NoError(t, s.ProcessReminders(context.Background()))
+	require.Empty(t, queue.messages)
+	require.Len(t, storage.log, 1)
+	for _, r := range storage.log {
+		require.Equal(t, model.NotificationDeferred, r.Status)
+		require.Equal(t, start, r.SendAfter)
+	}
+
+	storage.pending = nil
+	fake.Advance(45 * time.Minute)
+	require.NoError(t, s.ProcessReminders(context.Background()))
+	require.Len(t, queue.messages, 1)
+	require.Equal(t, "late call", queue.messages[0].Title)
+	require.Equal(t, model.DeliveryOnTime, queue.messages[0].Delivery)
+
+	// Событие уже идёт: напоминание не откладывается
+	storage.pending = []model.Notification{reminder("started", fake.Now().Add(-time.Minute), time.Hour)}
+	require.NoError(t, s.ProcessReminders(context.Background()))
+	require.Len(t, queue.messages, 2)
+	require.Equal(t, "started", queue.messages[1].Title)
+}
+
+// dayEvents возвращает события пользователей за любой интервал, если их запрашивает сам пользователь.
+type dayEvents struct {
+	events map[string][]model.Event
+}
+
+func (d *dayEvents) EventsBetween(
+	ctx context.Context, _, _ time.Time, filter model.EventFilter,
+) ([]model.Event, error) {
+	if caller, ok := auth.UserIDFromContext(ctx); !ok || caller != filter.UserID {
+		return nil, model.ErrPermissionDenied
+	}
+	return d.events[filter.UserID], nil
+}
+
+func TestSendAgendas(t *testing.T) {
+	// 08:00 по Москве
+	now := time.Date(2024, time.September, 2, 5, 0, 0, 0, time.UTC)
+	agenda := func(userID string, at time.Duration) model.NotificationPreferences {
+		return model.NotificationPreferences{
+			UserID:   userID,
+			Channels: []model.ReminderChannel{model.ChannelPush},
+			TimeZone: "Europe/Moscow",
+			Mode:     model.ModeIndividual,
+			Agenda:   model.DailyAgenda{Enabled: true, At: at},
+		}
+	}
+	storage := &notificationStorage{prefs: map[string]model.NotificationPreferences{
+		"user1": agenda("user1", 8*time.Hour),
+		"user2": agenda("user2", 9*time.Hour),
+		"user3": agenda("user3", 7*time.Hour),
+		"user4": {UserID: "user4", Mode: model.ModeIndividual},
+	}}
+	events := &dayEvents{events: map[string][]model.Event{
+		"user1": {{ID: uuid.New(), Title: "standup", StartTime: now.Add(time.Hour), Duration: 15 * time.Minute}},
+		"user2": {{ID: uuid.New(), Title: "review", StartTime: now.Add(5 * time.Hour), Duration: time.Hour}},
+	}}
+	queue := &recordingQueue{}
+	fake := clock.NewFake(now)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewScheduler(*logger, storage, queue, WithEvents(events), WithClock(fake))
+
+	require.NoError(t, s.SendAgendas(context.Background()))
+	require.Len(t, queue.messages, 1)
+	msg := queue.messages[0]
+	require.Equal(t, model.KindAgenda, msg.Kind)
+	require.Equal(t, "user1", msg.RecipientID)
+	require.Equal(t, model.ChannelPush, msg.Channel)
+	require.Equal(t, "Europe/Moscow", msg.TimeZone)
+	require.Len(t, msg.Agenda, 1)
+	require.Equal(t, "standup", msg.Agenda[0].Title)
+	// День сводки - с местной полуночи
+	require.True(t, time.Date(2024, time.September, 1, 21, 0, 0, 0, time.UTC).Equal(msg.Date))
+	require.Equal(t, model.NotificationQueued, storage.log[msg.ID].Status)
+	require.Equal(t, model.KindAgenda, storage.log[msg.ID].Kind)
+	// У user3 событий нет - сводка не отправляется, но день отмечен
+	require.Contains(t, storage.agendaSent, "user3")
+
+	// Повторный запуск в тот же день сводку не повторяет
+	fake.Advance(time.Hour)
+	require.NoError(t, s.SendAgendas(context.Background()))
+	require.Len(t, queue.messages, 2)
+	require.Equal(t, "user2", queue.messages[1].RecipientID)
+}
+
+func TestSendAgendaRetry(t *testing.T) {
+	// 08:00 по Москве
+	now := time.Date(2024, time.September, 2, 5, 0, 0, 0, time.UTC)
+	storage := &notificationStorage{prefs: map[string]model.NotificationPreferences{
+		"user1": {
+			UserID:   "user1",
+			TimeZone: "Europe/Moscow",
+			Mode:     model.ModeIndividual,
+			Agenda:   model.DailyAgenda{Enabled: true, At: 8 * time.Hour},
+		},
+	}}
+	events := &dayEvents{events: map[string][]model.Event{
+		"user1": {{ID: uuid.New(), Title: "standup", StartTime: now.Add(time.Hour), Duration: 15 * time.Minute}},
+	}}
+	queue := &recordingQueue{fail: map[string]bool{"user1": true}}
+	fake := clock.NewFake(now)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewScheduler(*logger, storage, queue, WithEvents(events), WithClock(fake))
+
+	// Очередь недоступна: запись журнала остаётся с ошибкой, отметка дня снимается
+	require.Error(t, s.SendAgendas(context.Background()))
+	require.NotContains(t, storage.agendaSent, "user1")
+	require.Len(t, storage.log, 1)
+	for _, r := range storage.log {
+		require.Equal(t, model.NotificationFailed, r.Status)
+	}
+
+	queue.fail = nil
+	fake.Advance(time.Hour)
+	require.NoError(t, s.SendAgendas(context.Background()))
+	require.Len(t, queue.messages, 1)
+	require.Contains(t, storage.agendaSent, "user1")
+
+	// После окна отправки сводка за день не уходит
+	delete(storage.agendaSent, "user1")
+	fake.Advance(model.AgendaWindow)
+	require.NoError(t, s.SendAgendas(context.Background()))
+	require.Len(t, queue.messages, 1)
+}
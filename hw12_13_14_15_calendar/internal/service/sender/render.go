@@ -0,0 +1,356 @@
+package sender
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+)
+
+// DefaultLocale - язык уведомлений, если у получателя он не задан или для него нет шаблонов.
+const DefaultLocale = "en"
+
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// Content - тема и текст уведомления для доставки.
+type Content struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// templateKey - шаблон уведомлений вида kind на языке locale для канала channel;
+// пустой канал - шаблон для всех каналов.
+type templateKey struct {
+	locale  string
+	kind    model.NotificationKind
+	channel model.ReminderChannel
+}
+
+// Renderer формирует текст уведомлений по шаблонам <язык>/<вид>[.<канал>].<txt|html>.tmpl:
+// текстовый шаблон задаёт тему в блоке subject, HTML-версия необязательна.
+type Renderer struct {
+	defaultLocale string
+	text          map[templateKey]*texttemplate.Template
+	html          map[templateKey]*htmltemplate.Template
+}
+
+var templateFuncs = map[string]any{
+	"duration": formatDuration,
+	"minutes":  func(d time.Duration) int { return int(d.Round(time.Minute).Minutes()) },
+}
+
+var knownKinds = []model.NotificationKind{model.KindReminder, model.KindAgenda}
+
+// defaultRenderer - встроенные шаблоны; их корректность проверяют тесты.
+var defaultRenderer = mustRenderer()
+
+func mustRenderer() *Renderer {
+	r, err := NewRenderer("", DefaultLocale)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// NewRenderer загружает встроенные шаблоны и шаблоны из каталога dir, которые заменяют
+// встроенные с тем же именем, и проверяет их на тестовых сообщениях. Пустой dir - только встроенные.
+func NewRenderer(dir, defaultLocale string) (*Renderer, error) {
+	if defaultLocale == "" {
+		defaultLocale = DefaultLocale
+	}
+	files := make(map[string][]byte)
+	embedded, err := fs.Sub(embeddedTemplates, "templates")
+	if err != nil {
+		return nil, err
+	}
+	if err := readTemplates(embedded, files); err != nil {
+		return nil, fmt.Errorf("read embedded templates: %w", err)
+	}
+	if dir != "" {
+		if err := readTemplates(os.DirFS(dir), files); err != nil {
+			return nil, fmt.Errorf("read templates from %s: %w", dir, err)
+		}
+	}
+
+	r := &Renderer{
+		defaultLocale: normalizeLocale(defaultLocale),
+		text:          make(map[templateKey]*texttemplate.Template),
+		html:          make(map[templateKey]*htmltemplate.Template),
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		if err := r.add(name, files[name]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	if len(errs) == 0 {
+		errs = r.validate()
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid notification templates: %w", err)
+	}
+	return r, nil
+}
+
+// readTemplates добавляет в files все файлы *.tmpl из fsys, ключ - путь внутри fsys.
+func readTemplates(fsys fs.FS, files map[string][]byte) error {
+	return fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".tmpl") {
+			return err
+		}
+		body, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		files[path] = body
+		return nil
+	})
+}
+
+// parseName разбирает путь шаблона <язык>/<вид>[.<канал>].<txt|html>.tmpl.
+func parseName(name string) (templateKey, string, error) {
+	errName := errors.New("name must be <locale>/<kind>[.<channel>].<txt|html>.tmpl")
+	locale, file, ok := strings.Cut(name, "/")
+	if !ok || strings.Contains(file, "/") {
+		return templateKey{}, "", errName
+	}
+	parts := strings.Split(strings.TrimSuffix(file, ".tmpl"), ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return templateKey{}, "", errName
+	}
+
+	key := templateKey{locale: normalizeLocale(locale), kind: model.NotificationKind(parts[0])}
+	format := parts[len(parts)-1]
+	switch {
+	case !containsKind(key.kind):
+		return templateKey{}, "", fmt.Errorf("unknown notification kind %q", key.kind)
+	case format != "txt" && format != "html":
+		return templateKey{}, "", fmt.Errorf("unknown template format %q", format)
+	}
+	if len(parts) == 3 {
+		key.channel = model.ReminderChannel(parts[1])
+		if !key.channel.Valid() {
+			return templateKey{}, "", fmt.Errorf("unknown channel %q", key.channel)
+		}
+	}
+	return key, format, nil
+}
+
+func containsKind(kind model.NotificationKind) bool {
+	for _, k := range knownKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Renderer) add(name string, body []byte) error {
+	key, format, err := parseName(name)
+	if err != nil {
+		return err
+	}
+	if format == "html" {
+		t, err := htmltemplate.New(name).Funcs(templateFuncs).Parse(string(body))
+		if err != nil {
+			return err
+		}
+		r.html[key] = t
+		return nil
+	}
+	t, err := texttemplate.New(name).Funcs(templateFuncs).Parse(string(body))
+	if err != nil {
+		return err
+	}
+	r.text[key] = t
+	return nil
+}
+
+// validate проверяет, что для языка по умолчанию есть шаблоны всех видов уведомлений,
+// и выполняет каждый шаблон на тестовых сообщениях.
+func (r *Renderer) validate() []error {
+	var errs []error
+	for _, kind := range knownKinds {
+		if _, ok := r.text[templateKey{locale: r.defaultLocale, kind: kind}]; !ok {
+			errs = append(errs, fmt.Errorf("no %s text template for default locale %q", kind, r.defaultLocale))
+		}
+	}
+
+	execute := func(key templateKey, exec func(io.Writer, view) error) {
+		for _, msg := range sampleMessages(key.kind) {
+			if err := exec(io.Discard, view{NotificationMessage: msg, loc: time.UTC}); err != nil {
+				errs = append(errs, err)
+				return
+			}
+		}
+	}
+	for _, key := range sortedKeys(r.text) {
+		t := r.text[key]
+		execute(key, func(w io.Writer, v view) error {
+			if t.Lookup("subject") != nil {
+				if err := t.ExecuteTemplate(w, "subject", v); err != nil {
+					return err
+				}
+			}
+			return t.Execute(w, v)
+		})
+	}
+	for _, key := range sortedKeys(r.html) {
+		t := r.html[key]
+		execute(key, func(w io.Writer, v view) error { return t.Execute(w, v) })
+	}
+	return errs
+}
+
+func sortedKeys[T any](m map[templateKey]T) []templateKey {
+	keys := make([]templateKey, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.locale != b.locale {
+			return a.locale < b.locale
+		}
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		return a.channel < b.channel
+	})
+	return keys
+}
+
+// sampleMessages - сообщения для проверки шаблонов: одиночное и пакетное напоминание или сводка.
+func sampleMessages(kind model.NotificationKind) []model.NotificationMessage {
+	start := time.Date(2024, time.January, 15, 9, 30, 0, 0, time.UTC)
+	reminder := model.NotificationMessage{
+		ID: uuid.New(), Kind: model.KindReminder, EventID: uuid.New(), RecipientID: "user",
+		Title: "Event", Date: start, Channel: model.ChannelEmail, Delivery: model.DeliveryMissed,
+		Duration: time.Hour, Description: "Description",
+	}
+	if kind == model.KindAgenda {
+		agenda := reminder
+		agenda.Kind = model.KindAgenda
+		agenda.Agenda = []model.AgendaItem{{
+			EventID: reminder.EventID, Title: reminder.Title, Start: start,
+			Duration: time.Hour, Description: reminder.Description,
+		}}
+		return []model.NotificationMessage{agenda}
+	}
+	batch := reminder
+	batch.Items = []model.NotificationMessage{reminder, reminder}
+	return []model.NotificationMessage{reminder, batch}
+}
+
+// view - данные шаблона: сообщение и часовой пояс получателя.
+type view struct {
+	model.NotificationMessage
+	loc *time.Location
+}
+
+// Local переводит время в часовой пояс получателя.
+func (v view) Local(t time.Time) time.Time {
+	return t.In(v.loc)
+}
+
+// Render формирует текст сообщения на языке получателя; сообщения без вида считаются напоминаниями.
+// Шаблон ищется для языка получателя, затем для основного языка (ru для ru-RU) и языка
+// по умолчанию, на каждом языке сначала для канала сообщения.
+func (r *Renderer) Render(msg model.NotificationMessage) (Content, error) {
+	kind := msg.Kind
+	if kind == "" {
+		kind = model.KindReminder
+	}
+	key, ok := r.lookup(kind, msg.Channel, msg.Locale)
+	if !ok {
+		return Content{}, fmt.Errorf("no template for %q notifications", kind)
+	}
+	loc, err := time.LoadLocation(msg.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	data := view{NotificationMessage: msg, loc: loc}
+
+	text := r.text[key]
+	var subject, body, html bytes.Buffer
+	if text.Lookup("subject") != nil {
+		if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+			return Content{}, err
+		}
+	}
+	if err := text.Execute(&body, data); err != nil {
+		return Content{}, err
+	}
+	// HTML-версия - парная к текстовому шаблону, у коротких каналов вроде sms её нет
+	if t, ok := r.html[key]; ok {
+		if err := t.Execute(&html, data); err != nil {
+			return Content{}, err
+		}
+	}
+	return Content{Subject: strings.TrimSpace(subject.String()), Text: body.String(), HTML: html.String()}, nil
+}
+
+// lookup выбирает текстовый шаблон по языку и каналу.
+func (r *Renderer) lookup(
+	kind model.NotificationKind, channel model.ReminderChannel, locale string,
+) (templateKey, bool) {
+	for _, l := range r.locales(locale) {
+		for _, c := range []model.ReminderChannel{channel, ""} {
+			key := templateKey{locale: l, kind: kind, channel: c}
+			if _, ok := r.text[key]; ok {
+				return key, true
+			}
+		}
+	}
+	return templateKey{}, false
+}
+
+// locales возвращает языки для поиска шаблона: язык получателя, основной язык и язык по умолчанию.
+func (r *Renderer) locales(locale string) []string {
+	locale = normalizeLocale(locale)
+	var locales []string
+	if locale != "" {
+		locales = append(locales, locale)
+		if base, _, ok := strings.Cut(locale, "-"); ok {
+			locales = append(locales, base)
+		}
+	}
+	return append(locales, r.defaultLocale)
+}
+
+// normalizeLocale приводит тег языка к виду pt-br.
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+}
+
+// formatDuration выводит длительность без нулевых единиц: 1h, 1h30m, 45m.
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	hours, minutes := int(d.Hours()), int(d.Minutes())%60
+	switch {
+	case hours == 0:
+		return fmt.Sprintf("%dm", minutes)
+	case minutes == 0:
+		return fmt.Sprintf("%dh", hours)
+	}
+	return fmt.Sprintf("%dh%dm", hours, minutes)
+}
@@ -0,0 +1,134 @@
+package sender
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderAgenda(t *testing.T) {
+	day := time.Date(2024, time.September, 2, 21, 0, 0, 0, time.UTC)
+	content, err := defaultRenderer.Render(model.NotificationMessage{
+		ID:       uuid.New(),
+		Kind:     model.KindAgenda,
+		Date:     day,
+		TimeZone: "Europe/Moscow",
+		Agenda: []model.AgendaItem{
+			{Title: "standup", Start: day.Add(9 * time.Hour), Duration: 15 * time.Minute},
+			{
+				Title: "review <draft>", Start: day.Add(14 * time.Hour), Duration: 90 * time.Minute,
+				Description: "room 4",
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Your agenda for Tuesday, 3 September", content.Subject)
+	require.Equal(t, "09:00 standup (15m)\n14:00 review <draft> (1h30m)\n  room 4\n", content.Text)
+	// В HTML-версии текст событий экранируется
+	require.Contains(t, content.HTML, "<b>14:00</b> review &lt;draft&gt; (1h30m)<br>room 4</li>")
+}
+
+func TestRenderReminder(t *testing.T) {
+	start := time.Date(2024, time.September, 2, 9, 0, 0, 0, time.UTC)
+	content, err := defaultRenderer.Render(model.NotificationMessage{
+		Title: "standup", Date: start, Delivery: model.DeliveryMissed,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Reminder: standup", content.Subject)
+	require.Equal(t, "standup starts Mon 2 Sep 09:00.\n"+
+		"The reminder was delayed and the event may have already started.\n", content.Text)
+
+	content, err = defaultRenderer.Render(model.NotificationMessage{
+		Kind: model.KindReminder,
+		Items: []model.NotificationMessage{
+			{Title: "standup", Date: start}, {Title: "review", Date: start.Add(time.Hour)},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "2 upcoming events", content.Subject)
+	require.Equal(t, "Upcoming events:\n- standup, Mon 2 Sep 09:00\n- review, Mon 2 Sep 10:00\n", content.Text)
+}
+
+func TestRenderLocaleAndChannel(t *testing.T) {
+	msg := model.NotificationMessage{
+		Title: "планёрка", Date: time.Date(2024, time.September, 2, 6, 0, 0, 0, time.UTC),
+		Duration: 30 * time.Minute, Description: "комната 4", TimeZone: "Europe/Moscow", Locale: "ru-RU",
+		Channel: model.ChannelEmail,
+	}
+	// ru-RU нет - используется ru
+	content, err := defaultRenderer.Render(msg)
+	require.NoError(t, err)
+	require.Equal(t, "Напоминание: планёрка", content.Subject)
+	require.Equal(t, "планёрка начинается 02.09.2024 в 09:00, длительность 30 мин.\n\nкомната 4\n", content.Text)
+	require.Contains(t, content.HTML, "<p>комната 4</p>")
+
+	// Для SMS - короткий текст без HTML
+	msg.Channel = model.ChannelSMS
+	content, err = defaultRenderer.Render(msg)
+	require.NoError(t, err)
+	require.Equal(t, "02.09 09:00 планёрка (30 мин)", content.Text)
+	require.Empty(t, content.HTML)
+
+	// Неизвестный язык - язык по умолчанию, для push отдельного шаблона нет
+	msg.Locale, msg.Channel, msg.Title = "de", model.ChannelPush, "standup"
+	content, err = defaultRenderer.Render(msg)
+	require.NoError(t, err)
+	require.Equal(t, "Reminder: standup", content.Subject)
+	require.Equal(t, "standup starts Mon 2 Sep 09:00 and lasts 30m.\n\nкомната 4\n", content.Text)
+}
+
+func TestNewRendererDir(t *testing.T) {
+	writeTemplate := func(t *testing.T, dir, name, body string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(body), 0o600))
+	}
+
+	t.Run("override", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTemplate(t, dir, "en/reminder.push.txt.tmpl", "{{.Title}} at {{(.Local .Date).Format \"15:04\"}}")
+		writeTemplate(t, dir, "de/reminder.txt.tmpl", `{{define "subject"}}Erinnerung{{end}}{{.Title}}`)
+		r, err := NewRenderer(dir, "en")
+		require.NoError(t, err)
+
+		msg := model.NotificationMessage{
+			Title: "standup", Date: time.Date(2024, time.September, 2, 9, 0, 0, 0, time.UTC),
+			Channel: model.ChannelPush,
+		}
+		content, err := r.Render(msg)
+		require.NoError(t, err)
+		require.Equal(t, "standup at 09:00", content.Text)
+
+		msg.Locale = "de"
+		content, err = r.Render(msg)
+		require.NoError(t, err)
+		require.Equal(t, Content{Subject: "Erinnerung", Text: "standup"}, content)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTemplate(t, dir, "en/reminder.txt.tmpl", "{{.Title")
+		writeTemplate(t, dir, "en/agenda.html.tmpl", "{{.Unknown}}")
+		writeTemplate(t, dir, "en/invite.txt.tmpl", "{{.Title}}")
+		_, err := NewRenderer(dir, "en")
+		require.ErrorContains(t, err, "en/reminder.txt.tmpl")
+		require.ErrorContains(t, err, `unknown notification kind "invite"`)
+
+		// Шаблоны разбираются, но не выполняются на тестовых сообщениях
+		dir = t.TempDir()
+		writeTemplate(t, dir, "en/agenda.html.tmpl", "{{.Unknown}}")
+		_, err = NewRenderer(dir, "en")
+		require.ErrorContains(t, err, "can't evaluate field Unknown")
+	})
+
+	t.Run("default locale without templates", func(t *testing.T) {
+		_, err := NewRenderer("", "de")
+		require.ErrorContains(t, err, `no reminder text template for default locale "de"`)
+	})
+}
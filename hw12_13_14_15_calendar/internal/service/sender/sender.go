@@ -1,7 +1,18 @@
 package sender
 
 import (
+	"context"
+	"encoding/json"
 	"log/slog"
+	"time"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/clock"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+)
+
+const (
+	DefaultMaxAttempts  = 3
+	DefaultRetryBackoff = time.Second
 )
 
 type QueueMessage interface {
@@ -9,25 +20,183 @@ type QueueMessage interface {
 	Receive() (<-chan string, error) // Возвращаем канал для чтения сообщений
 }
 
-type Sender struct {
+// Deliverer доставляет уведомление получателю по его каналу.
+type Deliverer interface {
+	Deliver(ctx context.Context, msg model.NotificationMessage, content Content) error
+}
+
+// logDeliverer только пишет уведомление в лог - настоящих каналов доставки пока нет.
+type logDeliverer struct {
 	logger slog.Logger
-	queue  QueueMessage
 }
 
-func NewSender(logger slog.Logger, queue QueueMessage) *Sender {
-	return &Sender{
-		logger: logger,
-		queue:  queue,
+func (d logDeliverer) Deliver(_ context.Context, msg model.NotificationMessage, content Content) error {
+	d.logger.Info("Received message", "id", msg.ID, "kind", msg.Kind, "recipient", msg.RecipientID,
+		"channel", msg.Channel, "delivery", msg.Delivery, "items", len(msg.Items),
+		"subject", content.Subject, "text", content.Text)
+	return nil
+}
+
+type Sender struct {
+	logger    slog.Logger
+	queue     QueueMessage
+	deliverer Deliverer
+	renderer  *Renderer
+	// statusQueue - куда отправляются отчёты о доставке; nil - отчёты не отправляются.
+	statusQueue QueueMessage
+	// maxAttempts и retryBackoff - повторы неудачной доставки, задержка растет вдвое с каждой попыткой.
+	maxAttempts  int
+	retryBackoff time.Duration
+	clock        clock.Clock
+}
+
+type Option func(*Sender)
+
+// WithStatusQueue задаёт очередь отчётов о доставке для планировщика.
+func WithStatusQueue(queue QueueMessage) Option {
+	return func(s *Sender) {
+		s.statusQueue = queue
+	}
+}
+
+// WithDeliverer задаёт способ доставки уведомлений.
+func WithDeliverer(d Deliverer) Option {
+	return func(s *Sender) {
+		s.deliverer = d
+	}
+}
+
+// WithRenderer задаёт шаблоны текста уведомлений.
+func WithRenderer(r *Renderer) Option {
+	return func(s *Sender) {
+		s.renderer = r
+	}
+}
+
+// WithRetry задаёт число попыток доставки и задержку перед первым повтором.
+func WithRetry(maxAttempts int, backoff time.Duration) Option {
+	return func(s *Sender) {
+		if maxAttempts > 0 {
+			s.maxAttempts = maxAttempts
+		}
+		if backoff > 0 {
+			s.retryBackoff = backoff
+		}
 	}
 }
 
-func (s *Sender) ReadMessages() {
+// WithClock задаёт источник времени, в тестах - clock.Fake.
+func WithClock(c clock.Clock) Option {
+	return func(s *Sender) {
+		s.clock = c
+	}
+}
+
+// NewSender создаёт отправителя; без WithRenderer используются встроенные шаблоны.
+func NewSender(logger slog.Logger, queue QueueMessage, opts ...Option) *Sender {
+	s := &Sender{
+		logger:       logger,
+		queue:        queue,
+		deliverer:    logDeliverer{logger: logger},
+		renderer:     defaultRenderer,
+		maxAttempts:  DefaultMaxAttempts,
+		retryBackoff: DefaultRetryBackoff,
+		clock:        clock.Real,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// ReadMessages доставляет уведомления из очереди, пока она не закроется или не отменится ctx.
+func (s *Sender) ReadMessages(ctx context.Context) {
 	messages, err := s.queue.Receive()
 	if err != nil {
 		s.logger.Error("Received message", "err", err)
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case body, ok := <-messages:
+			if !ok {
+				return
+			}
+			var msg model.NotificationMessage
+			if err := json.Unmarshal([]byte(body), &msg); err != nil {
+				s.logger.Error("invalid message", "msg", body, "err", err)
+				continue
+			}
+			report := s.deliver(ctx, msg)
+			if len(msg.Items) == 0 {
+				s.report(report)
+				continue
+			}
+			// Журнал ведётся по отдельным напоминаниям, поэтому отчёт - по каждому из пакета
+			for _, item := range msg.Items {
+				report.ID = item.ID
+				s.report(report)
+			}
+		}
+	}
+}
+
+// deliver доставляет уведомление с повторами и возвращает итоговый отчёт.
+func (s *Sender) deliver(ctx context.Context, msg model.NotificationMessage) model.NotificationStatusReport {
+	report := model.NotificationStatusReport{ID: msg.ID}
+	content, err := s.renderer.Render(msg)
+	if err != nil {
+		s.logger.Error("failed to render message", "id", msg.ID, "err", err)
+		report.Status = model.NotificationFailed
+		report.Error = "render: " + err.Error()
+		report.At = s.clock.Now()
+		return report
+	}
+
+	backoff := s.retryBackoff
+	for report.Attempts < s.maxAttempts {
+		if report.Attempts > 0 {
+			timer := s.clock.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				report.Status = model.NotificationFailed
+				report.Error = ctx.Err().Error()
+				report.At = s.clock.Now()
+				return report
+			case <-timer.C():
+			}
+			backoff *= 2
+		}
+
+		report.Attempts++
+		err := s.deliverer.Deliver(ctx, msg, content)
+		if err == nil {
+			report.Status = model.NotificationDelivered
+			report.Error = ""
+			break
+		}
+		s.logger.Warn("delivery failed", "id", msg.ID, "attempt", report.Attempts, "err", err)
+		report.Status = model.NotificationFailed
+		report.Error = err.Error()
 	}
+	report.At = s.clock.Now()
+	return report
+}
 
-	for msg := range messages {
-		s.logger.Info("Received message", "msg", msg)
+func (s *Sender) report(report model.NotificationStatusReport) {
+	if s.statusQueue == nil {
+		return
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		s.logger.Error("failed to encode status report", "id", report.ID, "err", err)
+		return
+	}
+	if err := s.statusQueue.Send(string(body)); err != nil {
+		s.logger.Error("failed to send status report", "id", report.ID, "err", err)
 	}
 }
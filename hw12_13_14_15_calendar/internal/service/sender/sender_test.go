@@ -0,0 +1,132 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/clock"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2024, time.September, 2, 12, 0, 0, 0, time.UTC)
+
+type chanQueue struct {
+	ch chan string
+}
+
+func (q chanQueue) Send(msg string) error {
+	q.ch <- msg
+	return nil
+}
+
+func (q chanQueue) Receive() (<-chan string, error) {
+	return q.ch, nil
+}
+
+// flakyDeliverer не доставляет первые failures сообщений.
+type flakyDeliverer struct {
+	failures int
+	calls    int
+}
+
+func (d *flakyDeliverer) Deliver(context.Context, model.NotificationMessage, Content) error {
+	d.calls++
+	if d.calls <= d.failures {
+		return errors.New("smtp timeout")
+	}
+	return nil
+}
+
+func newTestSender(d Deliverer) (*Sender, chanQueue, chanQueue, *clock.Fake) {
+	queue := chanQueue{make(chan string, 1)}
+	statusQueue := chanQueue{make(chan string, 1)}
+	fakeClock := clock.NewFake(start)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewSender(*logger, queue,
+		WithDeliverer(d), WithStatusQueue(statusQueue), WithRetry(3, time.Second), WithClock(fakeClock))
+	return s, queue, statusQueue, fakeClock
+}
+
+func send(t *testing.T, q chanQueue) uuid.UUID {
+	t.Helper()
+	msg := model.NotificationMessage{ID: uuid.New(), EventID: uuid.New(), RecipientID: "user1", Title: "standup"}
+	body, err := json.Marshal(msg)
+	require.NoError(t, err)
+	q.ch <- string(body)
+	return msg.ID
+}
+
+func receiveReport(t *testing.T, q chanQueue) model.NotificationStatusReport {
+	t.Helper()
+	var report model.NotificationStatusReport
+	require.NoError(t, json.Unmarshal([]byte(<-q.ch), &report))
+	return report
+}
+
+func TestSenderRetriesDelivery(t *testing.T) {
+	s, queue, statusQueue, fakeClock := newTestSender(&flakyDeliverer{failures: 2})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.ReadMessages(ctx)
+
+	id := send(t, queue)
+	// Повторы через 1s и 2s
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(time.Second)
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(2 * time.Second)
+
+	report := receiveReport(t, statusQueue)
+	require.Equal(t, model.NotificationStatusReport{
+		ID: id, Status: model.NotificationDelivered, Attempts: 3, At: start.Add(3 * time.Second),
+	}, report)
+}
+
+func TestSenderReportsFailure(t *testing.T) {
+	s, queue, statusQueue, fakeClock := newTestSender(&flakyDeliverer{failures: 5})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.ReadMessages(ctx)
+
+	id := send(t, queue)
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(time.Second)
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(2 * time.Second)
+
+	report := receiveReport(t, statusQueue)
+	require.Equal(t, id, report.ID)
+	require.Equal(t, model.NotificationFailed, report.Status)
+	require.Equal(t, 3, report.Attempts)
+	require.Equal(t, "smtp timeout", report.Error)
+}
+
+func TestSenderReportsEachBatchItem(t *testing.T) {
+	deliverer := &flakyDeliverer{}
+	s, queue, _, _ := newTestSender(deliverer)
+	statusQueue := chanQueue{make(chan string, 2)}
+	s.statusQueue = statusQueue
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.ReadMessages(ctx)
+
+	items := []model.NotificationMessage{{ID: uuid.New(), Title: "standup"}, {ID: uuid.New(), Title: "review"}}
+	body, err := json.Marshal(model.NotificationMessage{ID: uuid.New(), RecipientID: "user1", Items: items})
+	require.NoError(t, err)
+	queue.ch <- string(body)
+
+	// Пакет доставляется одним сообщением, отчёт - по каждому напоминанию
+	for _, item := range items {
+		report := receiveReport(t, statusQueue)
+		require.Equal(t, item.ID, report.ID)
+		require.Equal(t, model.NotificationDelivered, report.Status)
+	}
+	require.Equal(t, 1, deliverer.calls)
+}
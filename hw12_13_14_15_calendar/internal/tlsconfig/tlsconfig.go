@@ -0,0 +1,268 @@
+// Package tlsconfig собирает *tls.Config для серверов и клиентов из config.TLS
+// и перечитывает сертификаты с диска при их изменении.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/config"
+)
+
+// checkInterval - как часто проверяется время изменения файлов.
+const checkInterval = 10 * time.Second
+
+var (
+	ErrNoCertificate = errors.New("tls: cert_file and key_file are required")
+	ErrNoCA          = errors.New("tls: ca_file is required to verify client certificates")
+	ErrInvalidCA     = errors.New("tls: no certificates found in ca_file")
+)
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":                   tls.NoClientCert,
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify_if_given":    tls.VerifyClientCertIfGiven,
+	"require_and_verify": tls.RequireAndVerifyClientCert,
+}
+
+func ParseClientAuth(mode string) (tls.ClientAuthType, error) {
+	auth, ok := clientAuthTypes[mode]
+	if !ok {
+		return tls.NoClientCert, fmt.Errorf("tls: unknown client_auth mode %q", mode)
+	}
+	return auth, nil
+}
+
+// Reloader хранит пару сертификат/ключ и пул CA, перечитывая файлы,
+// если с последней проверки изменилось время их модификации.
+// Безопасен для конкурентного использования.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	now      func() time.Time
+	interval time.Duration
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	pool      *x509.CertPool
+	modTimes  map[string]time.Time
+	lastCheck time.Time
+}
+
+// NewReloader загружает файлы сразу, чтобы ошибка в конфигурации
+// обнаружилась при старте. Пустые пути пропускаются.
+func NewReloader(certFile, keyFile, caFile string) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		now:      time.Now,
+		interval: checkInterval,
+		modTimes: make(map[string]time.Time),
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	r.lastCheck = r.now()
+	return r, nil
+}
+
+// Certificate возвращает актуальный сертификат, nil если он не настроен.
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.maybeReload()
+	return r.cert
+}
+
+// CAPool возвращает актуальный пул CA, nil если CA не настроен.
+func (r *Reloader) CAPool() *x509.CertPool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.maybeReload()
+	return r.pool
+}
+
+func (r *Reloader) maybeReload() {
+	now := r.now()
+	if now.Sub(r.lastCheck) < r.interval {
+		return
+	}
+	r.lastCheck = now
+
+	if !r.changed() {
+		return
+	}
+	// Файлы могут быть записаны не полностью - в этом случае продолжаем
+	// работать со старыми и пробуем снова при следующей проверке
+	if err := r.load(); err != nil {
+		r.modTimes = make(map[string]time.Time)
+	}
+}
+
+func (r *Reloader) changed() bool {
+	for _, name := range r.files() {
+		info, err := os.Stat(name)
+		if err != nil || !info.ModTime().Equal(r.modTimes[name]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reloader) files() []string {
+	files := make([]string, 0, 3)
+	for _, name := range []string{r.certFile, r.keyFile, r.caFile} {
+		if name != "" {
+			files = append(files, name)
+		}
+	}
+	return files
+}
+
+func (r *Reloader) load() error {
+	modTimes := make(map[string]time.Time)
+	for _, name := range r.files() {
+		info, err := os.Stat(name)
+		if err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
+		modTimes[name] = info.ModTime()
+	}
+
+	var cert *tls.Certificate
+	if r.certFile != "" || r.keyFile != "" {
+		pair, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return fmt.Errorf("tls: failed to load key pair: %w", err)
+		}
+		cert = &pair
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("tls: failed to read ca_file: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return ErrInvalidCA
+		}
+	}
+
+	r.cert = cert
+	r.pool = pool
+	r.modTimes = modTimes
+	return nil
+}
+
+// Server собирает конфигурацию для сервера. При выключенном TLS возвращает nil.
+func Server(cfg config.TLS) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, ErrNoCertificate
+	}
+
+	clientAuth, err := ParseClientAuth(cfg.ClientAuth)
+	if err != nil {
+		return nil, err
+	}
+	verify := clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert
+	if verify && cfg.CAFile == "" {
+		return nil, ErrNoCA
+	}
+
+	reloader, err := NewReloader(cfg.CertFile, cfg.KeyFile, cfg.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: clientAuth,
+		ClientCAs:  reloader.CAPool(),
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return reloader.Certificate(), nil
+		},
+	}
+	if verify {
+		// Клиентские сертификаты проверяются вручную по актуальному пулу CA,
+		// чтобы новый CA применялся без перезапуска. GetConfigForClient для этого
+		// не подходит: http и grpc дополняют NextProtos в своей копии конфигурации
+		conf.ClientAuth = tls.RequestClientCert
+		if clientAuth == tls.RequireAndVerifyClientCert {
+			conf.ClientAuth = tls.RequireAnyClientCert
+		}
+		conf.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return nil
+			}
+			return verifyClient(rawCerts, reloader.CAPool())
+		}
+	}
+	return conf, nil
+}
+
+func verifyClient(rawCerts [][]byte, roots *x509.CertPool) error {
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("tls: failed to parse client certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(opts)
+	return err
+}
+
+// Client собирает конфигурацию для клиента. При выключенном TLS возвращает nil.
+// Пул CA сервера читается один раз, клиентский сертификат перечитывается при изменении.
+func Client(cfg config.TLS) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, ErrNoCertificate
+	}
+
+	reloader, err := NewReloader(cfg.CertFile, cfg.KeyFile, cfg.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		RootCAs:            reloader.CAPool(),
+		InsecureSkipVerify: cfg.InsecureSkipVerify, //nolint:gosec
+	}
+	if cfg.CertFile != "" {
+		conf.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return reloader.Certificate(), nil
+		}
+	}
+	return conf, nil
+}
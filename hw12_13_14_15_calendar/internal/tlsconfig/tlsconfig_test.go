@@ -0,0 +1,213 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/milov52/hw12_13_14_15_calendar/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newCert(t *testing.T, name string, serial int64, parent *testCert) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) write(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	writePEM(t, certFile, "CERTIFICATE", c.cert.Raw)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, name, typ string, der []byte) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600))
+}
+
+func TestParseClientAuth(t *testing.T) {
+	auth, err := ParseClientAuth("require_and_verify")
+	require.NoError(t, err)
+	require.Equal(t, tls.RequireAndVerifyClientCert, auth)
+
+	auth, err = ParseClientAuth("")
+	require.NoError(t, err)
+	require.Equal(t, tls.NoClientCert, auth)
+
+	_, err = ParseClientAuth("always")
+	require.Error(t, err)
+}
+
+func TestServerConfig(t *testing.T) {
+	conf, err := Server(config.TLS{})
+	require.NoError(t, err)
+	require.Nil(t, conf)
+
+	_, err = Server(config.TLS{Enabled: true})
+	require.ErrorIs(t, err, ErrNoCertificate)
+
+	dir := t.TempDir()
+	certFile, keyFile := newCert(t, "localhost", 1, nil).write(t, dir, "server")
+	_, err = Server(config.TLS{
+		Enabled:    true,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		ClientAuth: "require_and_verify",
+	})
+	require.ErrorIs(t, err, ErrNoCA)
+}
+
+func TestReloaderReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := newCert(t, "localhost", 1, nil).write(t, dir, "server")
+
+	r, err := NewReloader(certFile, keyFile, "")
+	require.NoError(t, err)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	leaf, err := x509.ParseCertificate(r.Certificate().Certificate[0])
+	require.NoError(t, err)
+	require.Equal(t, int64(1), leaf.SerialNumber.Int64())
+
+	newCert(t, "localhost", 2, nil).write(t, dir, "server")
+	future := now.Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+
+	// До истечения интервала проверки остается старый сертификат
+	leaf, err = x509.ParseCertificate(r.Certificate().Certificate[0])
+	require.NoError(t, err)
+	require.Equal(t, int64(1), leaf.SerialNumber.Int64())
+
+	now = now.Add(checkInterval)
+	leaf, err = x509.ParseCertificate(r.Certificate().Certificate[0])
+	require.NoError(t, err)
+	require.Equal(t, int64(2), leaf.SerialNumber.Int64())
+
+	// Битый файл не сбрасывает загруженный сертификат
+	require.NoError(t, os.WriteFile(certFile, []byte("garbage"), 0o600))
+	now = now.Add(checkInterval)
+	leaf, err = x509.ParseCertificate(r.Certificate().Certificate[0])
+	require.NoError(t, err)
+	require.Equal(t, int64(2), leaf.SerialNumber.Int64())
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCert(t, "calendar-ca", 1, nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	serverCert, serverKey := newCert(t, "localhost", 2, ca).write(t, dir, "server")
+	clientCert, clientKey := newCert(t, "client", 3, ca).write(t, dir, "client")
+
+	serverConf, err := Server(config.TLS{
+		Enabled:    true,
+		CertFile:   serverCert,
+		KeyFile:    serverKey,
+		CAFile:     caFile,
+		ClientAuth: "require_and_verify",
+	})
+	require.NoError(t, err)
+	// Так конфигурацию дополняют http и grpc: без h2 в ALPN gRPC поверх TLS не работает
+	serverConf.NextProtos = []string{"h2"}
+
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", serverConf)
+	require.NoError(t, err)
+	defer lis.Close()
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			_, _ = conn.Write([]byte("ok"))
+			conn.Close()
+		}
+	}()
+
+	dial := func(cfg config.TLS) error {
+		conf, err := Client(cfg)
+		require.NoError(t, err)
+		conf.NextProtos = []string{"h2"}
+
+		conn, err := tls.Dial("tcp", lis.Addr().String(), conf)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		// Ошибка проверки клиентского сертификата приходит при первом чтении
+		if _, err = conn.Read(make([]byte, 2)); err != nil {
+			return err
+		}
+		require.Equal(t, "h2", conn.ConnectionState().NegotiatedProtocol)
+		return nil
+	}
+
+	require.NoError(t, dial(config.TLS{
+		Enabled:    true,
+		CertFile:   clientCert,
+		KeyFile:    clientKey,
+		CAFile:     caFile,
+		ServerName: "localhost",
+	}))
+
+	// Без клиентского сертификата сервер обрывает соединение
+	require.Error(t, dial(config.TLS{Enabled: true, CAFile: caFile, ServerName: "localhost"}))
+
+	// Сертификат, выпущенный чужим CA, отклоняется
+	otherCert, otherKey := newCert(t, "client", 4, newCert(t, "other-ca", 5, nil)).write(t, dir, "other")
+	require.Error(t, dial(config.TLS{
+		Enabled:    true,
+		CertFile:   otherCert,
+		KeyFile:    otherKey,
+		CAFile:     caFile,
+		ServerName: "localhost",
+	}))
+}
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE table event_attendee (
+                       event_id        UUID not null references event (id) on delete cascade,
+                       user_id         text not null,
+                       status          text not null default 'needs-action',
+                       created_at      TIMESTAMP not null default now(),
+                       primary key (event_id, user_id)
+);
+
+CREATE INDEX event_attendee_user_id_idx ON event_attendee (user_id);
+
+-- +goose Down
+drop table event_attendee;
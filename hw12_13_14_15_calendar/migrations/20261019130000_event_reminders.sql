@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE table event_reminder (
+                       id              UUID PRIMARY KEY,
+                       event_id        UUID not null references event (id) on delete cascade,
+                       notify_offset   interval not null,
+                       channel         text not null default 'email',
+                       sent            boolean not null default false,
+                       sent_at         TIMESTAMP
+);
+
+CREATE INDEX event_reminder_event_id_idx ON event_reminder (event_id);
+CREATE INDEX event_reminder_unsent_idx ON event_reminder (event_id) WHERE sent = false;
+
+-- Переносим единственное напоминание notify_before в новую таблицу
+INSERT INTO event_reminder (id, event_id, notify_offset, channel, sent, sent_at)
+SELECT md5(random()::text || id::text)::uuid, id, notify_before, 'email', coalesce(sent, false),
+       CASE WHEN sent THEN now() END
+FROM event
+WHERE notify_before IS NOT NULL AND notify_before > interval '0';
+
+-- +goose Down
+drop table event_reminder;
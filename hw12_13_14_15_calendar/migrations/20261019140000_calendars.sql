@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE table calendar (
+                       id              UUID PRIMARY KEY,
+                       owner_id        text not null,
+                       name            text not null,
+                       description     text,
+                       created_at      TIMESTAMP not null default now()
+);
+
+CREATE INDEX calendar_owner_id_idx ON calendar (owner_id);
+
+CREATE table calendar_share (
+                       calendar_id     UUID not null references calendar (id) on delete cascade,
+                       user_id         text not null,
+                       permission      text not null,
+                       primary key (calendar_id, user_id)
+);
+
+CREATE INDEX calendar_share_user_id_idx ON calendar_share (user_id);
+
+ALTER TABLE event ADD COLUMN calendar_id UUID references calendar (id) on delete cascade;
+CREATE INDEX event_calendar_id_idx ON event (calendar_id);
+
+-- +goose Down
+ALTER TABLE event DROP COLUMN calendar_id;
+DROP TABLE calendar_share;
+DROP TABLE calendar;
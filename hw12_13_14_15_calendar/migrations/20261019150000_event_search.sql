@@ -0,0 +1,9 @@
+-- +goose Up
+-- Выражение должно совпадать с searchVector в sqlstorage, иначе индекс не будет использован
+CREATE INDEX event_search_idx ON event USING GIN ((
+    setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce(description, '')), 'B')
+));
+
+-- +goose Down
+DROP INDEX event_search_idx;
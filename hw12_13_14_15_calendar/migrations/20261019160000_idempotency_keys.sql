@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE table idempotency_key (
+                       key             text PRIMARY KEY,
+                       request_hash    text not null,
+                       event_id        UUID,
+                       expires_at      TIMESTAMP not null
+);
+
+CREATE INDEX idempotency_key_expires_at_idx ON idempotency_key (expires_at);
+
+-- +goose Down
+DROP TABLE idempotency_key;
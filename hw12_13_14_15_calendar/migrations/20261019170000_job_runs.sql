@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE table job_run (
+                       id              BIGSERIAL PRIMARY KEY,
+                       job             text not null,
+                       started_at      TIMESTAMP not null,
+                       duration_ms     BIGINT not null,
+                       status          text not null,
+                       error           text not null default ''
+);
+
+CREATE INDEX job_run_job_started_at_idx ON job_run (job, started_at);
+
+-- +goose Down
+DROP TABLE job_run;
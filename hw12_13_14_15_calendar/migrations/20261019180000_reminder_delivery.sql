@@ -0,0 +1,7 @@
+-- +goose Up
+-- Как обработано напоминание: on_time, late, missed или skipped; пусто - не отправлено
+-- или отправлено до появления колонки
+ALTER TABLE event_reminder ADD COLUMN delivery text not null default '';
+
+-- +goose Down
+ALTER TABLE event_reminder DROP COLUMN delivery;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- Сводка результата запуска задачи, например статистика удаления событий
+ALTER TABLE job_run ADD COLUMN details text not null default '';
+
+-- +goose Down
+ALTER TABLE job_run DROP COLUMN details;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- Журнал уведомлений: одно сообщение о напоминании одному получателю.
+-- Записи не удаляются вместе с событием, их чистит сохранение новых записей.
+CREATE table notification_log (
+                       id              UUID PRIMARY KEY,
+                       event_id        UUID not null,
+                       reminder_id     UUID not null,
+                       owner_id        text not null,
+                       recipient_id    text not null,
+                       channel         text not null,
+                       delivery        text not null default '',
+                       status          text not null,
+                       attempts        integer not null default 0,
+                       last_error      text not null default '',
+                       queued_at       TIMESTAMP not null,
+                       updated_at      TIMESTAMP not null
+);
+
+CREATE INDEX notification_log_owner_id_queued_at_idx ON notification_log (owner_id, queued_at);
+CREATE INDEX notification_log_event_id_idx ON notification_log (event_id);
+
+-- +goose Down
+DROP TABLE notification_log;
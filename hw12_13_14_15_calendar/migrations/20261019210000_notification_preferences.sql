@@ -0,0 +1,24 @@
+-- +goose Up
+-- Тихие часы хранятся смещениями от полуночи в минутах, равные значения - выключены
+CREATE table notification_preferences (
+                       user_id         text PRIMARY KEY,
+                       channels        text[] not null default '{}',
+                       time_zone       text not null default '',
+                       quiet_start_min integer not null default 0,
+                       quiet_end_min   integer not null default 0,
+                       mode            text not null default 'individual',
+                       updated_at      TIMESTAMP not null default now()
+);
+
+-- Отложенные уведомления отправляются из журнала, поэтому в нем нужен текст сообщения
+ALTER TABLE notification_log ADD COLUMN title text not null default '';
+ALTER TABLE notification_log ADD COLUMN event_start TIMESTAMP;
+ALTER TABLE notification_log ADD COLUMN send_after TIMESTAMP;
+CREATE INDEX notification_log_deferred_idx ON notification_log (send_after) WHERE status = 'deferred';
+
+-- +goose Down
+DROP INDEX notification_log_deferred_idx;
+ALTER TABLE notification_log DROP COLUMN send_after;
+ALTER TABLE notification_log DROP COLUMN event_start;
+ALTER TABLE notification_log DROP COLUMN title;
+DROP TABLE notification_preferences;
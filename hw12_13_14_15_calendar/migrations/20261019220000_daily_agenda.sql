@@ -0,0 +1,13 @@
+-- +goose Up
+-- Ежедневная сводка: время отправки в минутах от местной полуночи и дата последней сводки
+ALTER TABLE notification_preferences ADD COLUMN agenda_enabled boolean not null default false;
+ALTER TABLE notification_preferences ADD COLUMN agenda_min integer not null default 0;
+ALTER TABLE notification_preferences ADD COLUMN agenda_sent_on date;
+
+ALTER TABLE notification_log ADD COLUMN kind text not null default 'reminder';
+
+-- +goose Down
+ALTER TABLE notification_log DROP COLUMN kind;
+ALTER TABLE notification_preferences DROP COLUMN agenda_sent_on;
+ALTER TABLE notification_preferences DROP COLUMN agenda_min;
+ALTER TABLE notification_preferences DROP COLUMN agenda_enabled;
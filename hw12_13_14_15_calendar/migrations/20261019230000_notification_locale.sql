@@ -0,0 +1,11 @@
+-- +goose Up
+-- Текст уведомления формирует отправитель: ему нужны язык получателя и подробности события
+ALTER TABLE notification_preferences ADD COLUMN locale text not null default '';
+
+ALTER TABLE notification_log ADD COLUMN event_duration interval;
+ALTER TABLE notification_log ADD COLUMN description text not null default '';
+
+-- +goose Down
+ALTER TABLE notification_log DROP COLUMN description;
+ALTER TABLE notification_log DROP COLUMN event_duration;
+ALTER TABLE notification_preferences DROP COLUMN locale;
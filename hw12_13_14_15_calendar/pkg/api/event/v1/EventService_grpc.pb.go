@@ -20,12 +20,32 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	Calendar_CreateEvent_FullMethodName       = "/event.Calendar/CreateEvent"
-	Calendar_UpdateEvent_FullMethodName       = "/event.Calendar/UpdateEvent"
-	Calendar_DeleteEvent_FullMethodName       = "/event.Calendar/DeleteEvent"
-	Calendar_GetDayEventList_FullMethodName   = "/event.Calendar/GetDayEventList"
-	Calendar_GetWeekEventList_FullMethodName  = "/event.Calendar/GetWeekEventList"
-	Calendar_GetMonthEventList_FullMethodName = "/event.Calendar/GetMonthEventList"
+	Calendar_CreateEvent_FullMethodName                   = "/event.Calendar/CreateEvent"
+	Calendar_UpdateEvent_FullMethodName                   = "/event.Calendar/UpdateEvent"
+	Calendar_DeleteEvent_FullMethodName                   = "/event.Calendar/DeleteEvent"
+	Calendar_GetDayEventList_FullMethodName               = "/event.Calendar/GetDayEventList"
+	Calendar_GetWeekEventList_FullMethodName              = "/event.Calendar/GetWeekEventList"
+	Calendar_GetMonthEventList_FullMethodName             = "/event.Calendar/GetMonthEventList"
+	Calendar_SearchEvents_FullMethodName                  = "/event.Calendar/SearchEvents"
+	Calendar_InviteAttendees_FullMethodName               = "/event.Calendar/InviteAttendees"
+	Calendar_RespondToInvitation_FullMethodName           = "/event.Calendar/RespondToInvitation"
+	Calendar_GetFreeBusy_FullMethodName                   = "/event.Calendar/GetFreeBusy"
+	Calendar_FindFreeSlots_FullMethodName                 = "/event.Calendar/FindFreeSlots"
+	Calendar_BatchCreateEvents_FullMethodName             = "/event.Calendar/BatchCreateEvents"
+	Calendar_BatchUpdateEvents_FullMethodName             = "/event.Calendar/BatchUpdateEvents"
+	Calendar_BatchDeleteEvents_FullMethodName             = "/event.Calendar/BatchDeleteEvents"
+	Calendar_CreateCalendar_FullMethodName                = "/event.Calendar/CreateCalendar"
+	Calendar_UpdateCalendar_FullMethodName                = "/event.Calendar/UpdateCalendar"
+	Calendar_DeleteCalendar_FullMethodName                = "/event.Calendar/DeleteCalendar"
+	Calendar_GetCalendar_FullMethodName                   = "/event.Calendar/GetCalendar"
+	Calendar_ListCalendars_FullMethodName                 = "/event.Calendar/ListCalendars"
+	Calendar_ShareCalendar_FullMethodName                 = "/event.Calendar/ShareCalendar"
+	Calendar_RevokeCalendarShare_FullMethodName           = "/event.Calendar/RevokeCalendarShare"
+	Calendar_ListJobRuns_FullMethodName                   = "/event.Calendar/ListJobRuns"
+	Calendar_ListNotifications_FullMethodName             = "/event.Calendar/ListNotifications"
+	Calendar_GetNotificationPreferences_FullMethodName    = "/event.Calendar/GetNotificationPreferences"
+	Calendar_UpdateNotificationPreferences_FullMethodName = "/event.Calendar/UpdateNotificationPreferences"
+	Calendar_DeleteNotificationPreferences_FullMethodName = "/event.Calendar/DeleteNotificationPreferences"
 )
 
 // CalendarClient is the client API for Calendar service.
@@ -38,6 +58,30 @@ type CalendarClient interface {
 	GetDayEventList(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
 	GetWeekEventList(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
 	GetMonthEventList(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	SearchEvents(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error)
+	InviteAttendees(ctx context.Context, in *InviteRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	RespondToInvitation(ctx context.Context, in *RespondRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// Чужая занятость видна только по календарям, открытым вызывающему хотя бы на уровне
+	// free-busy; содержимое событий не раскрывается.
+	GetFreeBusy(ctx context.Context, in *FreeBusyRequest, opts ...grpc.CallOption) (*FreeBusyResponse, error)
+	// Учитывает ту же занятость, что и GetFreeBusy.
+	FindFreeSlots(ctx context.Context, in *FindFreeSlotsRequest, opts ...grpc.CallOption) (*FindFreeSlotsResponse, error)
+	BatchCreateEvents(ctx context.Context, in *BatchCreateRequest, opts ...grpc.CallOption) (*BatchResponse, error)
+	BatchUpdateEvents(ctx context.Context, in *BatchUpdateRequest, opts ...grpc.CallOption) (*BatchResponse, error)
+	BatchDeleteEvents(ctx context.Context, in *BatchDeleteRequest, opts ...grpc.CallOption) (*BatchResponse, error)
+	CreateCalendar(ctx context.Context, in *CreateCalendarRequest, opts ...grpc.CallOption) (*CreateResponse, error)
+	UpdateCalendar(ctx context.Context, in *UpdateCalendarRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	DeleteCalendar(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	GetCalendar(ctx context.Context, in *GetCalendarRequest, opts ...grpc.CallOption) (*UserCalendar, error)
+	ListCalendars(ctx context.Context, in *ListCalendarsRequest, opts ...grpc.CallOption) (*ListCalendarsResponse, error)
+	ShareCalendar(ctx context.Context, in *ShareCalendarRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	RevokeCalendarShare(ctx context.Context, in *RevokeCalendarShareRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// ListJobRuns - история запусков задач планировщика, доступна пользователям из admin.users.
+	ListJobRuns(ctx context.Context, in *ListJobRunsRequest, opts ...grpc.CallOption) (*ListJobRunsResponse, error)
+	ListNotifications(ctx context.Context, in *ListNotificationsRequest, opts ...grpc.CallOption) (*ListNotificationsResponse, error)
+	GetNotificationPreferences(ctx context.Context, in *NotificationPreferencesRequest, opts ...grpc.CallOption) (*NotificationPreferences, error)
+	UpdateNotificationPreferences(ctx context.Context, in *UpdateNotificationPreferencesRequest, opts ...grpc.CallOption) (*NotificationPreferences, error)
+	DeleteNotificationPreferences(ctx context.Context, in *NotificationPreferencesRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
 }
 
 type calendarClient struct {
@@ -108,6 +152,206 @@ func (c *calendarClient) GetMonthEventList(ctx context.Context, in *GetRequest,
 	return out, nil
 }
 
+func (c *calendarClient) SearchEvents(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SearchResponse)
+	err := c.cc.Invoke(ctx, Calendar_SearchEvents_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) InviteAttendees(ctx context.Context, in *InviteRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Calendar_InviteAttendees_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) RespondToInvitation(ctx context.Context, in *RespondRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Calendar_RespondToInvitation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) GetFreeBusy(ctx context.Context, in *FreeBusyRequest, opts ...grpc.CallOption) (*FreeBusyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FreeBusyResponse)
+	err := c.cc.Invoke(ctx, Calendar_GetFreeBusy_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) FindFreeSlots(ctx context.Context, in *FindFreeSlotsRequest, opts ...grpc.CallOption) (*FindFreeSlotsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FindFreeSlotsResponse)
+	err := c.cc.Invoke(ctx, Calendar_FindFreeSlots_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) BatchCreateEvents(ctx context.Context, in *BatchCreateRequest, opts ...grpc.CallOption) (*BatchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchResponse)
+	err := c.cc.Invoke(ctx, Calendar_BatchCreateEvents_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) BatchUpdateEvents(ctx context.Context, in *BatchUpdateRequest, opts ...grpc.CallOption) (*BatchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchResponse)
+	err := c.cc.Invoke(ctx, Calendar_BatchUpdateEvents_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) BatchDeleteEvents(ctx context.Context, in *BatchDeleteRequest, opts ...grpc.CallOption) (*BatchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchResponse)
+	err := c.cc.Invoke(ctx, Calendar_BatchDeleteEvents_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) CreateCalendar(ctx context.Context, in *CreateCalendarRequest, opts ...grpc.CallOption) (*CreateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateResponse)
+	err := c.cc.Invoke(ctx, Calendar_CreateCalendar_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) UpdateCalendar(ctx context.Context, in *UpdateCalendarRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Calendar_UpdateCalendar_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) DeleteCalendar(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Calendar_DeleteCalendar_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) GetCalendar(ctx context.Context, in *GetCalendarRequest, opts ...grpc.CallOption) (*UserCalendar, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UserCalendar)
+	err := c.cc.Invoke(ctx, Calendar_GetCalendar_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) ListCalendars(ctx context.Context, in *ListCalendarsRequest, opts ...grpc.CallOption) (*ListCalendarsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListCalendarsResponse)
+	err := c.cc.Invoke(ctx, Calendar_ListCalendars_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) ShareCalendar(ctx context.Context, in *ShareCalendarRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Calendar_ShareCalendar_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) RevokeCalendarShare(ctx context.Context, in *RevokeCalendarShareRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Calendar_RevokeCalendarShare_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) ListJobRuns(ctx context.Context, in *ListJobRunsRequest, opts ...grpc.CallOption) (*ListJobRunsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListJobRunsResponse)
+	err := c.cc.Invoke(ctx, Calendar_ListJobRuns_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) ListNotifications(ctx context.Context, in *ListNotificationsRequest, opts ...grpc.CallOption) (*ListNotificationsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListNotificationsResponse)
+	err := c.cc.Invoke(ctx, Calendar_ListNotifications_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) GetNotificationPreferences(ctx context.Context, in *NotificationPreferencesRequest, opts ...grpc.CallOption) (*NotificationPreferences, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(NotificationPreferences)
+	err := c.cc.Invoke(ctx, Calendar_GetNotificationPreferences_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) UpdateNotificationPreferences(ctx context.Context, in *UpdateNotificationPreferencesRequest, opts ...grpc.CallOption) (*NotificationPreferences, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(NotificationPreferences)
+	err := c.cc.Invoke(ctx, Calendar_UpdateNotificationPreferences_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calendarClient) DeleteNotificationPreferences(ctx context.Context, in *NotificationPreferencesRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, Calendar_DeleteNotificationPreferences_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // CalendarServer is the server API for Calendar service.
 // All implementations must embed UnimplementedCalendarServer
 // for forward compatibility.
@@ -118,6 +362,30 @@ type CalendarServer interface {
 	GetDayEventList(context.Context, *GetRequest) (*GetResponse, error)
 	GetWeekEventList(context.Context, *GetRequest) (*GetResponse, error)
 	GetMonthEventList(context.Context, *GetRequest) (*GetResponse, error)
+	SearchEvents(context.Context, *SearchRequest) (*SearchResponse, error)
+	InviteAttendees(context.Context, *InviteRequest) (*emptypb.Empty, error)
+	RespondToInvitation(context.Context, *RespondRequest) (*emptypb.Empty, error)
+	// Чужая занятость видна только по календарям, открытым вызывающему хотя бы на уровне
+	// free-busy; содержимое событий не раскрывается.
+	GetFreeBusy(context.Context, *FreeBusyRequest) (*FreeBusyResponse, error)
+	// Учитывает ту же занятость, что и GetFreeBusy.
+	FindFreeSlots(context.Context, *FindFreeSlotsRequest) (*FindFreeSlotsResponse, error)
+	BatchCreateEvents(context.Context, *BatchCreateRequest) (*BatchResponse, error)
+	BatchUpdateEvents(context.Context, *BatchUpdateRequest) (*BatchResponse, error)
+	BatchDeleteEvents(context.Context, *BatchDeleteRequest) (*BatchResponse, error)
+	CreateCalendar(context.Context, *CreateCalendarRequest) (*CreateResponse, error)
+	UpdateCalendar(context.Context, *UpdateCalendarRequest) (*emptypb.Empty, error)
+	DeleteCalendar(context.Context, *DeleteRequest) (*emptypb.Empty, error)
+	GetCalendar(context.Context, *GetCalendarRequest) (*UserCalendar, error)
+	ListCalendars(context.Context, *ListCalendarsRequest) (*ListCalendarsResponse, error)
+	ShareCalendar(context.Context, *ShareCalendarRequest) (*emptypb.Empty, error)
+	RevokeCalendarShare(context.Context, *RevokeCalendarShareRequest) (*emptypb.Empty, error)
+	// ListJobRuns - история запусков задач планировщика, доступна пользователям из admin.users.
+	ListJobRuns(context.Context, *ListJobRunsRequest) (*ListJobRunsResponse, error)
+	ListNotifications(context.Context, *ListNotificationsRequest) (*ListNotificationsResponse, error)
+	GetNotificationPreferences(context.Context, *NotificationPreferencesRequest) (*NotificationPreferences, error)
+	UpdateNotificationPreferences(context.Context, *UpdateNotificationPreferencesRequest) (*NotificationPreferences, error)
+	DeleteNotificationPreferences(context.Context, *NotificationPreferencesRequest) (*emptypb.Empty, error)
 	mustEmbedUnimplementedCalendarServer()
 }
 
@@ -146,6 +414,66 @@ func (UnimplementedCalendarServer) GetWeekEventList(context.Context, *GetRequest
 func (UnimplementedCalendarServer) GetMonthEventList(context.Context, *GetRequest) (*GetResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetMonthEventList not implemented")
 }
+func (UnimplementedCalendarServer) SearchEvents(context.Context, *SearchRequest) (*SearchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchEvents not implemented")
+}
+func (UnimplementedCalendarServer) InviteAttendees(context.Context, *InviteRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method InviteAttendees not implemented")
+}
+func (UnimplementedCalendarServer) RespondToInvitation(context.Context, *RespondRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RespondToInvitation not implemented")
+}
+func (UnimplementedCalendarServer) GetFreeBusy(context.Context, *FreeBusyRequest) (*FreeBusyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetFreeBusy not implemented")
+}
+func (UnimplementedCalendarServer) FindFreeSlots(context.Context, *FindFreeSlotsRequest) (*FindFreeSlotsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FindFreeSlots not implemented")
+}
+func (UnimplementedCalendarServer) BatchCreateEvents(context.Context, *BatchCreateRequest) (*BatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchCreateEvents not implemented")
+}
+func (UnimplementedCalendarServer) BatchUpdateEvents(context.Context, *BatchUpdateRequest) (*BatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchUpdateEvents not implemented")
+}
+func (UnimplementedCalendarServer) BatchDeleteEvents(context.Context, *BatchDeleteRequest) (*BatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchDeleteEvents not implemented")
+}
+func (UnimplementedCalendarServer) CreateCalendar(context.Context, *CreateCalendarRequest) (*CreateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateCalendar not implemented")
+}
+func (UnimplementedCalendarServer) UpdateCalendar(context.Context, *UpdateCalendarRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateCalendar not implemented")
+}
+func (UnimplementedCalendarServer) DeleteCalendar(context.Context, *DeleteRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteCalendar not implemented")
+}
+func (UnimplementedCalendarServer) GetCalendar(context.Context, *GetCalendarRequest) (*UserCalendar, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCalendar not implemented")
+}
+func (UnimplementedCalendarServer) ListCalendars(context.Context, *ListCalendarsRequest) (*ListCalendarsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListCalendars not implemented")
+}
+func (UnimplementedCalendarServer) ShareCalendar(context.Context, *ShareCalendarRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ShareCalendar not implemented")
+}
+func (UnimplementedCalendarServer) RevokeCalendarShare(context.Context, *RevokeCalendarShareRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeCalendarShare not implemented")
+}
+func (UnimplementedCalendarServer) ListJobRuns(context.Context, *ListJobRunsRequest) (*ListJobRunsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListJobRuns not implemented")
+}
+func (UnimplementedCalendarServer) ListNotifications(context.Context, *ListNotificationsRequest) (*ListNotificationsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListNotifications not implemented")
+}
+func (UnimplementedCalendarServer) GetNotificationPreferences(context.Context, *NotificationPreferencesRequest) (*NotificationPreferences, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetNotificationPreferences not implemented")
+}
+func (UnimplementedCalendarServer) UpdateNotificationPreferences(context.Context, *UpdateNotificationPreferencesRequest) (*NotificationPreferences, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateNotificationPreferences not implemented")
+}
+func (UnimplementedCalendarServer) DeleteNotificationPreferences(context.Context, *NotificationPreferencesRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteNotificationPreferences not implemented")
+}
 func (UnimplementedCalendarServer) mustEmbedUnimplementedCalendarServer() {}
 func (UnimplementedCalendarServer) testEmbeddedByValue()                  {}
 
@@ -275,6 +603,366 @@ func _Calendar_GetMonthEventList_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Calendar_SearchEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).SearchEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_SearchEvents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).SearchEvents(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_InviteAttendees_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InviteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).InviteAttendees(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_InviteAttendees_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).InviteAttendees(ctx, req.(*InviteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_RespondToInvitation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RespondRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).RespondToInvitation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_RespondToInvitation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).RespondToInvitation(ctx, req.(*RespondRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_GetFreeBusy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FreeBusyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).GetFreeBusy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_GetFreeBusy_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).GetFreeBusy(ctx, req.(*FreeBusyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_FindFreeSlots_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FindFreeSlotsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).FindFreeSlots(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_FindFreeSlots_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).FindFreeSlots(ctx, req.(*FindFreeSlotsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_BatchCreateEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchCreateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).BatchCreateEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_BatchCreateEvents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).BatchCreateEvents(ctx, req.(*BatchCreateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_BatchUpdateEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchUpdateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).BatchUpdateEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_BatchUpdateEvents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).BatchUpdateEvents(ctx, req.(*BatchUpdateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_BatchDeleteEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchDeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).BatchDeleteEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_BatchDeleteEvents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).BatchDeleteEvents(ctx, req.(*BatchDeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_CreateCalendar_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateCalendarRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).CreateCalendar(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_CreateCalendar_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).CreateCalendar(ctx, req.(*CreateCalendarRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_UpdateCalendar_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateCalendarRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).UpdateCalendar(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_UpdateCalendar_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).UpdateCalendar(ctx, req.(*UpdateCalendarRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_DeleteCalendar_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).DeleteCalendar(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_DeleteCalendar_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).DeleteCalendar(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_GetCalendar_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCalendarRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).GetCalendar(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_GetCalendar_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).GetCalendar(ctx, req.(*GetCalendarRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_ListCalendars_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListCalendarsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).ListCalendars(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_ListCalendars_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).ListCalendars(ctx, req.(*ListCalendarsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_ShareCalendar_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShareCalendarRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).ShareCalendar(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_ShareCalendar_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).ShareCalendar(ctx, req.(*ShareCalendarRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_RevokeCalendarShare_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeCalendarShareRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).RevokeCalendarShare(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_RevokeCalendarShare_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).RevokeCalendarShare(ctx, req.(*RevokeCalendarShareRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_ListJobRuns_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListJobRunsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).ListJobRuns(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_ListJobRuns_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).ListJobRuns(ctx, req.(*ListJobRunsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_ListNotifications_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListNotificationsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).ListNotifications(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_ListNotifications_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).ListNotifications(ctx, req.(*ListNotificationsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_GetNotificationPreferences_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NotificationPreferencesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).GetNotificationPreferences(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_GetNotificationPreferences_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).GetNotificationPreferences(ctx, req.(*NotificationPreferencesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_UpdateNotificationPreferences_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateNotificationPreferencesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).UpdateNotificationPreferences(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_UpdateNotificationPreferences_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).UpdateNotificationPreferences(ctx, req.(*UpdateNotificationPreferencesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calendar_DeleteNotificationPreferences_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NotificationPreferencesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalendarServer).DeleteNotificationPreferences(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calendar_DeleteNotificationPreferences_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalendarServer).DeleteNotificationPreferences(ctx, req.(*NotificationPreferencesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Calendar_ServiceDesc is the grpc.ServiceDesc for Calendar service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -306,6 +994,86 @@ var Calendar_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetMonthEventList",
 			Handler:    _Calendar_GetMonthEventList_Handler,
 		},
+		{
+			MethodName: "SearchEvents",
+			Handler:    _Calendar_SearchEvents_Handler,
+		},
+		{
+			MethodName: "InviteAttendees",
+			Handler:    _Calendar_InviteAttendees_Handler,
+		},
+		{
+			MethodName: "RespondToInvitation",
+			Handler:    _Calendar_RespondToInvitation_Handler,
+		},
+		{
+			MethodName: "GetFreeBusy",
+			Handler:    _Calendar_GetFreeBusy_Handler,
+		},
+		{
+			MethodName: "FindFreeSlots",
+			Handler:    _Calendar_FindFreeSlots_Handler,
+		},
+		{
+			MethodName: "BatchCreateEvents",
+			Handler:    _Calendar_BatchCreateEvents_Handler,
+		},
+		{
+			MethodName: "BatchUpdateEvents",
+			Handler:    _Calendar_BatchUpdateEvents_Handler,
+		},
+		{
+			MethodName: "BatchDeleteEvents",
+			Handler:    _Calendar_BatchDeleteEvents_Handler,
+		},
+		{
+			MethodName: "CreateCalendar",
+			Handler:    _Calendar_CreateCalendar_Handler,
+		},
+		{
+			MethodName: "UpdateCalendar",
+			Handler:    _Calendar_UpdateCalendar_Handler,
+		},
+		{
+			MethodName: "DeleteCalendar",
+			Handler:    _Calendar_DeleteCalendar_Handler,
+		},
+		{
+			MethodName: "GetCalendar",
+			Handler:    _Calendar_GetCalendar_Handler,
+		},
+		{
+			MethodName: "ListCalendars",
+			Handler:    _Calendar_ListCalendars_Handler,
+		},
+		{
+			MethodName: "ShareCalendar",
+			Handler:    _Calendar_ShareCalendar_Handler,
+		},
+		{
+			MethodName: "RevokeCalendarShare",
+			Handler:    _Calendar_RevokeCalendarShare_Handler,
+		},
+		{
+			MethodName: "ListJobRuns",
+			Handler:    _Calendar_ListJobRuns_Handler,
+		},
+		{
+			MethodName: "ListNotifications",
+			Handler:    _Calendar_ListNotifications_Handler,
+		},
+		{
+			MethodName: "GetNotificationPreferences",
+			Handler:    _Calendar_GetNotificationPreferences_Handler,
+		},
+		{
+			MethodName: "UpdateNotificationPreferences",
+			Handler:    _Calendar_UpdateNotificationPreferences_Handler,
+		},
+		{
+			MethodName: "DeleteNotificationPreferences",
+			Handler:    _Calendar_DeleteNotificationPreferences_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "EventService.proto",
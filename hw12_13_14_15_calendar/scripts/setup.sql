@@ -9,4 +9,121 @@ CREATE table event (
                        sent            boolean default false,
                        created_at      TIMESTAMP not null default now(),
                        updated_at      DATE
-);
\ No newline at end of file
+);
+
+CREATE table event_attendee (
+                       event_id        UUID not null references event (id) on delete cascade,
+                       user_id         text not null,
+                       status          text not null default 'needs-action',
+                       created_at      TIMESTAMP not null default now(),
+                       primary key (event_id, user_id)
+);
+
+CREATE INDEX event_attendee_user_id_idx ON event_attendee (user_id);
+
+CREATE table event_reminder (
+                       id              UUID PRIMARY KEY,
+                       event_id        UUID not null references event (id) on delete cascade,
+                       notify_offset   interval not null,
+                       channel         text not null default 'email',
+                       sent            boolean not null default false,
+                       sent_at         TIMESTAMP
+);
+
+CREATE INDEX event_reminder_event_id_idx ON event_reminder (event_id);
+CREATE INDEX event_reminder_unsent_idx ON event_reminder (event_id) WHERE sent = false;
+
+CREATE table calendar (
+                       id              UUID PRIMARY KEY,
+                       owner_id        text not null,
+                       name            text not null,
+                       description     text,
+                       created_at      TIMESTAMP not null default now()
+);
+
+CREATE INDEX calendar_owner_id_idx ON calendar (owner_id);
+
+CREATE table calendar_share (
+                       calendar_id     UUID not null references calendar (id) on delete cascade,
+                       user_id         text not null,
+                       permission      text not null,
+                       primary key (calendar_id, user_id)
+);
+
+CREATE INDEX calendar_share_user_id_idx ON calendar_share (user_id);
+
+ALTER TABLE event ADD COLUMN calendar_id UUID references calendar (id) on delete cascade;
+CREATE INDEX event_calendar_id_idx ON event (calendar_id);
+
+CREATE INDEX event_search_idx ON event USING GIN ((
+    setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce(description, '')), 'B')
+));
+
+CREATE table idempotency_key (
+                       key             text PRIMARY KEY,
+                       request_hash    text not null,
+                       event_id        UUID,
+                       expires_at      TIMESTAMP not null
+);
+
+CREATE INDEX idempotency_key_expires_at_idx ON idempotency_key (expires_at);
+
+CREATE table job_run (
+                       id              BIGSERIAL PRIMARY KEY,
+                       job             text not null,
+                       started_at      TIMESTAMP not null,
+                       duration_ms     BIGINT not null,
+                       status          text not null,
+                       error           text not null default ''
+);
+
+CREATE INDEX job_run_job_started_at_idx ON job_run (job, started_at);
+
+ALTER TABLE event_reminder ADD COLUMN delivery text not null default '';
+
+ALTER TABLE job_run ADD COLUMN details text not null default '';
+
+CREATE table notification_log (
+                       id              UUID PRIMARY KEY,
+                       event_id        UUID not null,
+                       reminder_id     UUID not null,
+                       owner_id        text not null,
+                       recipient_id    text not null,
+                       channel         text not null,
+                       delivery        text not null default '',
+                       status          text not null,
+                       attempts        integer not null default 0,
+                       last_error      text not null default '',
+                       queued_at       TIMESTAMP not null,
+                       updated_at      TIMESTAMP not null
+);
+
+CREATE INDEX notification_log_owner_id_queued_at_idx ON notification_log (owner_id, queued_at);
+CREATE INDEX notification_log_event_id_idx ON notification_log (event_id);
+
+CREATE table notification_preferences (
+                       user_id         text PRIMARY KEY,
+                       channels        text[] not null default '{}',
+                       time_zone       text not null default '',
+                       quiet_start_min integer not null default 0,
+                       quiet_end_min   integer not null default 0,
+                       mode            text not null default 'individual',
+                       updated_at      TIMESTAMP not null default now()
+);
+
+ALTER TABLE notification_log ADD COLUMN title text not null default '';
+ALTER TABLE notification_log ADD COLUMN event_start TIMESTAMP;
+ALTER TABLE notification_log ADD COLUMN send_after TIMESTAMP;
+CREATE INDEX notification_log_deferred_idx ON notification_log (send_after) WHERE status = 'deferred';
+
+ALTER TABLE notification_preferences ADD COLUMN agenda_enabled boolean not null default false;
+ALTER TABLE notification_preferences ADD COLUMN agenda_min integer not null default 0;
+ALTER TABLE notification_preferences ADD COLUMN agenda_sent_on date;
+
+ALTER TABLE notification_log ADD COLUMN kind text not null default 'reminder';
+
+ALTER TABLE notification_preferences ADD COLUMN locale text not null default '';
+
+ALTER TABLE notification_log ADD COLUMN event_duration interval;
+ALTER TABLE notification_log ADD COLUMN description text not null default '';
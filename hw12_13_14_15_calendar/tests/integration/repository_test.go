@@ -21,6 +21,7 @@ type Repository interface {
 	UpdateEvent(ctx context.Context, id uuid.UUID, event model.Event) error
 	DeleteEvent(ctx context.Context, id uuid.UUID) error
 	GetEvents(ctx context.Context, date time.Time, offset int) ([]model.Event, error)
+	SearchEvents(ctx context.Context, query model.SearchQuery) (model.SearchPage, error)
 }
 
 type IntegrationSuite struct {
@@ -43,11 +44,11 @@ func (s *IntegrationSuite) SetupSuite() {
 }
 
 func (s *IntegrationSuite) TearDownSuite() {
-	_, _ = s.pool.Exec(context.Background(), "TRUNCATE TABLE event")
+	_, _ = s.pool.Exec(context.Background(), "TRUNCATE TABLE event CASCADE")
 }
 
 func (s *IntegrationSuite) SetupTest() {
-	_, err := s.pool.Exec(context.Background(), "TRUNCATE TABLE event")
+	_, err := s.pool.Exec(context.Background(), "TRUNCATE TABLE event CASCADE")
 	s.Require().NoError(err)
 }
 
@@ -177,6 +178,68 @@ func (s *IntegrationSuite) TestDeleteEvent() {
 	s.Require().Empty(events)
 }
 
+func (s *IntegrationSuite) TestSearchEventsTotal() {
+	startTime := time.Now()
+	for _, title := range []string{"budget review", "budget planning", "team sync"} {
+		s.createDirectItem(model.Event{Title: title, StartTime: startTime, Duration: time.Hour, UserID: "1000"})
+	}
+
+	page, err := s.r.SearchEvents(context.Background(), model.SearchQuery{Text: "budget", Limit: 1, Offset: 1})
+	s.Require().NoError(err)
+	s.Require().Equal(2, page.Total)
+	s.Require().Len(page.Results, 1)
+
+	// Страница за пределами результатов сохраняет общее число найденных
+	page, err = s.r.SearchEvents(context.Background(), model.SearchQuery{Text: "budget", Limit: 1, Offset: 5})
+	s.Require().NoError(err)
+	s.Require().Equal(2, page.Total)
+	s.Require().Empty(page.Results)
+}
+
+func (s *IntegrationSuite) TestPurgeEvents() {
+	ctx := context.Background()
+	storage := sqlstorage.New(s.pool)
+	now := time.Now()
+
+	archive, err := storage.CreateCalendar(ctx, model.Calendar{OwnerID: "user1", Name: "archive"})
+	s.Require().NoError(err)
+	create := func(title string, age time.Duration, userID string, calendarID uuid.UUID, attendees ...model.Attendee) {
+		_, err := storage.CreateEvent(ctx, model.Event{
+			Title: title, StartTime: now.Add(-age), Duration: time.Hour,
+			UserID: userID, CalendarID: calendarID, Attendees: attendees,
+		})
+		s.Require().NoError(err)
+	}
+	create("recent", 24*time.Hour, "user1", uuid.Nil)
+	create("old", 40*24*time.Hour, "user1", uuid.Nil)
+	create("old meeting", 41*24*time.Hour, "user1", uuid.Nil, model.Attendee{UserID: "user2"})
+	create("archived", 400*24*time.Hour, "user1", archive)
+	create("vip", 50*24*time.Hour, "vip", uuid.Nil)
+
+	policy := model.RetentionPolicy{
+		Default:   model.RetentionRule{MaxAge: 30 * 24 * time.Hour, KeepWithAttendees: true},
+		Calendars: map[uuid.UUID]model.RetentionRule{archive: {}},
+		Users:     map[string]model.RetentionRule{"vip": {MaxAge: 60 * 24 * time.Hour}},
+		DryRun:    true,
+	}
+
+	stats, err := storage.PurgeEvents(ctx, policy)
+	s.Require().NoError(err)
+	s.Require().Equal(1, stats.Deleted)
+	s.Require().Equal(1, stats.KeptWithAttendees)
+	s.Require().Len(stats.EventIDs, 1)
+	s.Require().Equal(stats.EventIDs[0], s.getDirectItem("old").ID)
+
+	policy.DryRun = false
+	stats, err = storage.PurgeEvents(ctx, policy)
+	s.Require().NoError(err)
+	s.Require().Equal(1, stats.Deleted)
+	s.Require().Empty(stats.EventIDs)
+	s.Require().Empty(s.getDirectItem("old"))
+	s.Require().NotEmpty(s.getDirectItem("archived"))
+	s.Require().NotEmpty(s.getDirectItem("old meeting"))
+}
+
 func (s *IntegrationSuite) createDirectItem(event model.Event) uuid.UUID {
 	query, args, err := sq.
 		Insert("event").
@@ -1,15 +1,25 @@
 package integration
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/clock"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/config"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/cron"
 	"github.com/milov52/hw12_13_14_15_calendar/internal/model"
-	queue "github.com/milov52/hw12_13_14_15_calendar/internal/queue/rabbitmq"
-	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/queue"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/queue/rabbitmq"
+	memorystorage "github.com/milov52/hw12_13_14_15_calendar/internal/repository/event/memory"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/service/scheduler"
+	"github.com/milov52/hw12_13_14_15_calendar/internal/service/sender"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -20,8 +30,7 @@ type QueueMessage interface {
 
 type ShedulerSuite struct {
 	suite.Suite
-	q  QueueMessage
-	ch *amqp.Channel
+	q QueueMessage
 }
 
 func TestServiceIntegrationSuite(t *testing.T) {
@@ -37,11 +46,10 @@ func (s *ShedulerSuite) SetupSuite() {
 			Password: "guest",
 		},
 	}
-	eventQueue, err := queue.NewQueue(&cfg)
+	eventQueue, err := rabbitmq.NewQueue(cfg.RabbitMQ, "notifications")
 	s.Require().NoError(err)
 
 	s.q = eventQueue
-	s.ch = eventQueue.Channel
 }
 
 func (s *ShedulerSuite) TestSendMessage() {
@@ -57,19 +65,159 @@ func (s *ShedulerSuite) TestSendMessage() {
 	err := s.q.Send(msg)
 	s.Require().NoError(err)
 	// Подписываемся на получение сообщений из очереди
-	messages, err := s.ch.Consume(
-		"notifications", // Имя очереди
-		"",              // Тег потребителя (оставляем пустым, чтобы RabbitMQ сгенерировал его автоматически)
-		true,            // Автоматическое подтверждение сообщений
-		false,           // Эксклюзивное использование
-		false,           // Запрещаем сообщения с локального подключения
-		false,           // Ожидание сообщений
-		nil,             // Дополнительные аргументы
-	)
+	messages, err := s.q.Receive()
 	s.Require().NoError(err)
 	for msg := range messages {
-		fmt.Printf("Received message: %s\n", string(msg.Body))
+		fmt.Printf("Received message: %s\n", msg)
 		s.Require().NotEmpty(msg)
 		break // Читаем одно сообщение и выходим
 	}
 }
+
+// jobStorage сообщает о каждом сохраненном запуске задачи.
+type jobStorage struct {
+	*memorystorage.Storage
+	saved chan model.JobRun
+}
+
+func (s *jobStorage) SaveJobRun(ctx context.Context, run model.JobRun) error {
+	defer func() { s.saved <- run }()
+	return s.Storage.SaveJobRun(ctx, run)
+}
+
+type chanQueue chan string
+
+func (q chanQueue) Send(msg string) error {
+	q <- msg
+	return nil
+}
+
+func (q chanQueue) Receive() (<-chan string, error) {
+	return q, nil
+}
+
+// TestSchedulerReminders прогоняет планировщик с хранилищем в памяти по часу
+// поддельного времени: напоминания уходят в нужную минуту без ожидания.
+func TestSchedulerReminders(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, time.September, 2, 9, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFake(start)
+	storage := &jobStorage{Storage: memorystorage.New(memorystorage.WithClock(fakeClock)), saved: make(chan model.JobRun)}
+
+	// Началось, пока планировщик не работал
+	_, err := storage.CreateEvent(ctx, model.Event{
+		Title: "standup", StartTime: start.Add(-30 * time.Minute), Duration: time.Hour, UserID: "user1",
+		NotifyBefore: 15 * time.Minute,
+	})
+	require.NoError(t, err)
+	_, err = storage.CreateEvent(ctx, model.Event{
+		Title: "review", StartTime: start.Add(time.Hour), Duration: time.Hour, UserID: "user1",
+		Reminders: []model.Reminder{{Offset: 30 * time.Minute}, {Offset: 10 * time.Minute}},
+	})
+	require.NoError(t, err)
+
+	messages := make(chanQueue, 10)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := scheduler.NewScheduler(*logger, storage, messages, scheduler.WithClock(fakeClock))
+	everyMinute, err := cron.Parse("* * * * *")
+	require.NoError(t, err)
+	require.NoError(t, s.Register(scheduler.Job{
+		Name:     scheduler.JobReminders,
+		Schedule: everyMinute,
+		Run:      s.ProcessReminders,
+	}))
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Start(runCtx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Заголовок события -> минуты отправки напоминаний
+	sent := map[string][]time.Time{}
+	for minute := 1; minute <= 60; minute++ {
+		fakeClock.BlockUntil(1)
+		fakeClock.Advance(time.Minute)
+		run := <-storage.saved
+		require.Equal(t, model.JobRunSucceeded, run.Status, run.Error)
+
+		for len(messages) > 0 {
+			var msg model.NotificationMessage
+			require.NoError(t, json.Unmarshal([]byte(<-messages), &msg))
+			sent[msg.Title] = append(sent[msg.Title], run.StartedAt)
+			if msg.Title == "standup" {
+				require.Equal(t, model.DeliveryLate, msg.Delivery)
+			}
+		}
+	}
+
+	require.Equal(t, map[string][]time.Time{
+		"standup": {start.Add(time.Minute)},
+		"review":  {start.Add(30 * time.Minute), start.Add(50 * time.Minute)},
+	}, sent)
+
+	// Каждое отправленное сообщение попало в журнал уведомлений
+	records, err := storage.ListNotifications(ctx, model.NotificationFilter{OwnerID: "user1", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	for _, r := range records {
+		require.Equal(t, model.NotificationQueued, r.Status)
+	}
+}
+
+// deliveries запоминает доставленные отправителем уведомления.
+type deliveries chan sender.Content
+
+func (d deliveries) Deliver(_ context.Context, _ model.NotificationMessage, content sender.Content) error {
+	d <- content
+	return nil
+}
+
+// TestInProcessPipeline прогоняет планировщик и отправителя в одном процессе через очереди в памяти.
+func TestInProcessPipeline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	start := time.Date(2024, time.September, 2, 9, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFake(start)
+	storage := memorystorage.New(memorystorage.WithClock(fakeClock))
+	_, err := storage.CreateEvent(ctx, model.Event{
+		Title: "standup", StartTime: start.Add(15 * time.Minute), Duration: 30 * time.Minute, UserID: "user1",
+		NotifyBefore: 15 * time.Minute,
+	})
+	require.NoError(t, err)
+
+	cfg := &config.Config{Queue: config.Queue{Type: config.QueueMemory}}
+	eventQueue, err := queue.NewQueue(cfg)
+	require.NoError(t, err)
+	defer eventQueue.Close()
+	statusQueue, err := queue.NewQueue(cfg, queue.WithName(queue.StatusQueue))
+	require.NoError(t, err)
+	defer statusQueue.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := scheduler.NewScheduler(*logger, storage, eventQueue,
+		scheduler.WithClock(fakeClock), scheduler.WithStatusQueue(statusQueue))
+	delivered := make(deliveries, 1)
+	go sender.NewSender(*logger, eventQueue,
+		sender.WithStatusQueue(statusQueue), sender.WithDeliverer(delivered)).ReadMessages(ctx)
+	go s.ConsumeStatusReports(ctx)
+
+	require.NoError(t, s.ProcessReminders(ctx))
+	select {
+	case content := <-delivered:
+		require.Equal(t, "Reminder: standup", content.Subject)
+	case <-time.After(time.Second):
+		t.Fatal("reminder was not delivered")
+	}
+
+	// Отчёт отправителя вернулся планировщику через очередь статусов
+	require.Eventually(t, func() bool {
+		records, err := storage.ListNotifications(ctx, model.NotificationFilter{OwnerID: "user1", Limit: 10})
+		return err == nil && len(records) == 1 && records[0].Status == model.NotificationDelivered
+	}, time.Second, 10*time.Millisecond)
+}